@@ -0,0 +1,142 @@
+package delugerpc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// AuthEntry is an account of the auth file of the daemon
+type AuthEntry struct {
+	Username string
+	Password string
+	Level    AuthLevel
+}
+
+// localclient is the account the daemon creates for the local clients
+const localclient = "localclient"
+
+// authLevelNames maps the names the auth file may give levels by to them
+var authLevelNames = map[string]AuthLevel{
+	"NONE":     AuthLevelNone,
+	"READONLY": AuthLevelReadOnly,
+	"DEFAULT":  AuthLevelDefault,
+	"NORMAL":   AuthLevelNormal,
+	"ADMIN":    AuthLevelAdmin,
+}
+
+// ReadAuthFile parses the auth file at path, whose lines hold
+// username:password:level, the level being a number or one of NONE,
+// READONLY, DEFAULT, NORMAL and ADMIN. Blank lines and lines starting with #
+// are skipped, and so are malformed lines, like the daemon does; the
+// accounts without a level get the level the daemon gives them.
+func ReadAuthFile(path string) ([]AuthEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []AuthEntry
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		e := AuthEntry{Username: fields[0], Level: AuthLevelDefault}
+		switch len(fields) {
+		case 2:
+			if e.Username == localclient {
+				e.Level = AuthLevelAdmin
+			}
+		case 3:
+			level, ok := parseAuthLevel(fields[2])
+			if !ok {
+				continue
+			}
+			e.Level = level
+		default:
+			continue
+		}
+		e.Password = fields[1]
+		entries = append(entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// parseAuthLevel parses the level of an auth file entry
+func parseAuthLevel(s string) (AuthLevel, bool) {
+	if level, err := strconv.Atoi(s); err == nil {
+		return AuthLevel(level), true
+	}
+	level, ok := authLevelNames[s]
+	return level, ok
+}
+
+// configDir returns the config directory of the local daemon
+func configDir() (string, error) {
+	if dir := os.Getenv("DELUGE_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
+	if runtime.GOOS == "windows" {
+		dir := os.Getenv("APPDATA")
+		if dir == "" {
+			return "", errors.New("delugerpc: %APPDATA% is not set")
+		}
+		return filepath.Join(dir, "deluge"), nil
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "deluge"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "deluge"), nil
+}
+
+// LocalAuthFile returns the path of the auth file of the local daemon, in
+// its config directory; see ReadLocalDaemon
+func LocalAuthFile() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "auth"), nil
+}
+
+// WithLocalAuth logs in with the localclient account of the auth file of the
+// local daemon, see LocalAuthFile, once connected by DialClient, Dial or
+// DialContext
+func WithLocalAuth() Option {
+	return func(o *options) {
+		o.localAuth = true
+	}
+}
+
+// localCredentials returns the localclient account of the local auth file
+func localCredentials() (AuthEntry, error) {
+	path, err := LocalAuthFile()
+	if err != nil {
+		return AuthEntry{}, err
+	}
+	entries, err := ReadAuthFile(path)
+	if err != nil {
+		return AuthEntry{}, err
+	}
+	for _, e := range entries {
+		if e.Username == localclient {
+			return e, nil
+		}
+	}
+	return AuthEntry{}, fmt.Errorf("delugerpc: no %s account in %s", localclient, path)
+}
@@ -0,0 +1,95 @@
+package delugerpc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadAuthFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth")
+	writeFile(t, path, "# accounts\nlocalclient:abc123\n\nalice:secret:1\nbob:pass\n"+
+		"carol:pw:ADMIN\ndave:pw:READONLY\nerin:pw:NONE\nfrank:pw:NORMAL\n")
+	entries, err := ReadAuthFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []AuthEntry{
+		{"localclient", "abc123", 10},
+		{"alice", "secret", 1},
+		{"bob", "pass", 5},
+		{"carol", "pw", 10},
+		{"dave", "pw", 1},
+		{"erin", "pw", 0},
+		{"frank", "pw", 5},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("got %+v, want %+v", entries, want)
+	}
+
+	// malformed lines are skipped
+	writeFile(t, path, "alice:secret:admin\nbob\na:b:1:2\nlocalclient:abc123\n")
+	entries, err = ReadAuthFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []AuthEntry{{"localclient", "abc123", 10}}; !reflect.DeepEqual(entries, want) {
+		t.Errorf("got %+v, want %+v", entries, want)
+	}
+	if _, err := ReadAuthFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing file read")
+	}
+}
+
+func TestWithLocalAuth(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	writeFile(t, filepath.Join(dir, "deluge", "auth"), "localclient:abc123:10\n")
+
+	l := listen(t)
+	go Serve(l, func(c *ServerCodec, req *Request) (interface{}, error) {
+		if req.Method == "daemon.login" {
+			if !reflect.DeepEqual(req.Args, Args{"localclient", "abc123"}) {
+				return nil, &RPCError{Type: "BadLoginError", Args: []interface{}{"Password does not match", req.Args[0]}}
+			}
+			return 10, nil
+		}
+		return nil, nil
+	})
+
+	c, err := DialClient(context.Background(), l.Addr().String(), WithoutTLS(), WithLocalAuth())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if level := c.AuthLevel(); level != 10 {
+		t.Errorf("auth level = %d after connecting", level)
+	}
+
+	rc, err := DialContext(context.Background(), "tcp", l.Addr().String(), WithoutTLS(), WithLocalAuth())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+
+	writeFile(t, filepath.Join(dir, "deluge", "auth"), "localclient:wrong:10\n")
+	if _, err := DialClient(context.Background(), l.Addr().String(), WithoutTLS(), WithLocalAuth()); err == nil {
+		t.Error("connected with the wrong password")
+	}
+	writeFile(t, filepath.Join(dir, "deluge", "auth"), "alice:secret:10\n")
+	if _, err := DialClient(context.Background(), l.Addr().String(), WithoutTLS(), WithLocalAuth()); err == nil {
+		t.Error("connected without a localclient account")
+	}
+}
@@ -0,0 +1,71 @@
+package delugerpc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The authentication levels of the daemon
+const (
+	AuthLevelNone     AuthLevel = 0
+	AuthLevelReadOnly AuthLevel = 1
+	AuthLevelNormal   AuthLevel = 5
+	AuthLevelAdmin    AuthLevel = 10
+	// AuthLevelDefault is the level of the methods exported without one,
+	// and of the accounts of the auth file without one
+	AuthLevelDefault = AuthLevelNormal
+)
+
+// ErrInsufficientAuthLevel is wrapped by the errors of the calls refused by
+// the client because the level granted to the user is below the one the
+// method requires. See WithAuthLevelCheck.
+var ErrInsufficientAuthLevel = errors.New("delugerpc: insufficient auth level")
+
+// methodAuthLevels holds the levels of the methods of the daemon not
+// requiring AuthLevelDefault
+var methodAuthLevels = map[string]AuthLevel{
+	"daemon.info":                   AuthLevelNone,
+	"daemon.login":                  AuthLevelNone,
+	"daemon.authorized_call":        AuthLevelNone,
+	"daemon.set_event_interest":     AuthLevelReadOnly,
+	"core.get_auth_levels_mappings": AuthLevelNone,
+	"core.get_known_accounts":       AuthLevelAdmin,
+	"core.create_account":           AuthLevelAdmin,
+	"core.update_account":           AuthLevelAdmin,
+	"core.remove_account":           AuthLevelAdmin,
+}
+
+// RequiredAuthLevel returns the level the daemon requires to call method,
+// and whether it is known: the levels of the methods of plugins are not
+func RequiredAuthLevel(method string) (AuthLevel, bool) {
+	if level, ok := methodAuthLevels[method]; ok {
+		return level, true
+	}
+	if strings.HasPrefix(method, "core.") || strings.HasPrefix(method, "daemon.") {
+		return AuthLevelDefault, true
+	}
+	return 0, false
+}
+
+// WithAuthLevelCheck refuses the calls of the methods whose required level,
+// as given by RequiredAuthLevel, is above the level granted by the last
+// daemon.login, before sending them
+func WithAuthLevelCheck() Option {
+	return func(o *options) {
+		o.authLevelCheck = true
+	}
+}
+
+// checkAuthLevel returns the error of a call of method refused by
+// WithAuthLevelCheck
+func (c *Client) checkAuthLevel(method string) error {
+	required, ok := RequiredAuthLevel(method)
+	if !ok {
+		return nil
+	}
+	if level := c.AuthLevel(); level < required {
+		return fmt.Errorf("%w: %s requires %d, granted %d", ErrInsufficientAuthLevel, method, required, level)
+	}
+	return nil
+}
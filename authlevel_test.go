@@ -0,0 +1,54 @@
+package delugerpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRequiredAuthLevel(t *testing.T) {
+	for _, tt := range []struct {
+		method string
+		level  AuthLevel
+		known  bool
+	}{
+		{"daemon.login", AuthLevelNone, true},
+		{"daemon.set_event_interest", AuthLevelReadOnly, true},
+		{"core.get_torrents_status", AuthLevelNormal, true},
+		{"core.create_account", AuthLevelAdmin, true},
+		{"label.get_labels", 0, false},
+	} {
+		if level, known := RequiredAuthLevel(tt.method); level != tt.level || known != tt.known {
+			t.Errorf("RequiredAuthLevel(%q) = %d, %v, want %d, %v", tt.method, level, known, tt.level, tt.known)
+		}
+	}
+}
+
+func TestClientAuthLevelCheck(t *testing.T) {
+	c, d := newTestClient(t, WithAuthLevelCheck())
+	go func() {
+		req := d.read()
+		d.reply(req.id, int(AuthLevelNormal))
+		req = d.read()
+		d.reply(req.id, nil)
+		req = d.read()
+		d.reply(req.id, []string{})
+	}()
+	ctx := context.Background()
+	if err := c.Call(ctx, "core.pause_torrent", Args{"abc"}, nil, nil); !errors.Is(err, ErrInsufficientAuthLevel) {
+		t.Errorf("got %v before login, want ErrInsufficientAuthLevel", err)
+	}
+	if _, err := c.Login(ctx, "alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Call(ctx, "core.pause_torrent", Args{"abc"}, nil, nil); err != nil {
+		t.Errorf("got %v with AuthLevelNormal", err)
+	}
+	if err := c.Call(ctx, "core.create_account", Args{"bob", "pass", "NORMAL"}, nil, nil); !errors.Is(err, ErrInsufficientAuthLevel) {
+		t.Errorf("got %v for an admin method, want ErrInsufficientAuthLevel", err)
+	}
+	// the levels of the methods of plugins are left to the daemon
+	if err := c.Call(ctx, "label.get_labels", nil, nil, nil); err != nil {
+		t.Errorf("got %v for a method of a plugin", err)
+	}
+}
@@ -0,0 +1,113 @@
+package delugerpc
+
+import (
+	"context"
+	"time"
+)
+
+// Batch queues calls to be sent together, in one message, saving the round
+// trips of calls made one after another. A Batch is not safe for concurrent
+// use.
+type Batch struct {
+	c     *Client
+	calls []*BatchCall
+}
+
+// BatchCall is a call queued in a Batch
+type BatchCall struct {
+	Method string
+	Args   Args
+	KWArgs KWArgs
+	// Result receives the return value, as with Client.Call
+	Result interface{}
+	// Error is the exception raised by the daemon, or the reason the
+	// response was not received, once the batch is done
+	Error error
+}
+
+// Batch returns an empty batch of calls to be made by c
+func (c *Client) Batch() *Batch {
+	return &Batch{c: c}
+}
+
+// Add queues a call of method with args and kwargs, whose return value is
+// decoded into result, which must be a pointer, or nil to discard the value
+func (b *Batch) Add(method string, args Args, kwargs KWArgs, result interface{}) *BatchCall {
+	call := &BatchCall{Method: method, Args: args, KWArgs: kwargs, Result: result}
+	b.calls = append(b.calls, call)
+	return call
+}
+
+// Len returns the number of queued calls
+func (b *Batch) Len() int {
+	return len(b.calls)
+}
+
+// Do sends the queued calls and waits for all their responses, setting the
+// Error of each call. It returns an error when the calls could not be sent,
+// or when the client shut down or ctx was done before all the responses
+// arrived; exceptions raised by the daemon are only reported by the calls.
+// The batch is emptied.
+func (b *Batch) Do(ctx context.Context) error {
+	calls := b.calls
+	b.calls = nil
+	if len(calls) == 0 {
+		return nil
+	}
+	for _, call := range calls {
+		if call.Error = checkResult(call.Result); call.Error != nil {
+			return call.Error
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	type response struct {
+		i   int
+		msg *message
+	}
+	sent := time.Now().UnixNano()
+	done := make(chan response, len(calls))
+	reqs := make([]request, len(calls))
+	for i, call := range calls {
+		i := i
+		reqs[i] = request{
+			method:  call.Method,
+			args:    call.Args,
+			kwargs:  call.KWArgs,
+			deliver: func(msg *message) { done <- response{i, msg} },
+		}
+	}
+	ids, err := b.c.startAll(ctx, reqs)
+	if err != nil {
+		for _, call := range calls {
+			call.Error = err
+		}
+		return err
+	}
+
+	var shutdown error
+	received := make([]bool, len(calls))
+	for remaining := len(calls); remaining > 0; remaining-- {
+		select {
+		case r := <-done:
+			received[r.i] = true
+			calls[r.i].Error = b.c.decodeResult(r.msg, calls[r.i].Result)
+			if r.msg == nil {
+				shutdown = calls[r.i].Error
+			}
+		case <-ctx.Done():
+			var pending []int64
+			for i, call := range calls {
+				if !received[i] {
+					call.Error = ctx.Err()
+					pending = append(pending, ids[i])
+				}
+			}
+			b.c.abandon(ctx, sent, pending...)
+			return ctx.Err()
+		}
+	}
+	return shutdown
+}
@@ -0,0 +1,89 @@
+package delugerpc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/rogaps/delugerpc/rencode"
+)
+
+func TestBatch(t *testing.T) {
+	c, d := newTestClient(t)
+	go func() {
+		// all the requests arrive in one message
+		body, err := d.conn.readMessage()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var reqs [][]interface{}
+		if err := rencode.NewDecoder(bytes.NewReader(body)).Decode(&reqs); err != nil {
+			t.Error(err)
+			return
+		}
+		if len(reqs) != 3 {
+			t.Errorf("got %d requests in the message, want 3", len(reqs))
+			return
+		}
+		// replies out of order
+		d.reply(reqs[2][0].(int64), []interface{}{"abc", "def"})
+		d.send(int(rpcError), reqs[1][0].(int64), "InvalidTorrentError", []interface{}{"no such torrent"}, map[string]interface{}{}, "")
+		d.reply(reqs[0][0].(int64), "2.1.1")
+	}()
+
+	b := c.Batch()
+	var version string
+	var ids []string
+	info := b.Add("daemon.info", nil, nil, &version)
+	status := b.Add("core.get_torrent_status", Args{"xyz", []string{"name"}}, nil, nil)
+	list := b.Add("core.get_session_state", nil, nil, &ids)
+	if err := b.Do(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if info.Error != nil || version != "2.1.1" {
+		t.Errorf("daemon.info: version = %q, err = %v", version, info.Error)
+	}
+	if status.Error == nil {
+		t.Error("core.get_torrent_status: expected an error")
+	}
+	if list.Error != nil || len(ids) != 2 {
+		t.Errorf("core.get_session_state: ids = %q, err = %v", ids, list.Error)
+	}
+	if b.Len() != 0 {
+		t.Errorf("batch not emptied: %d calls", b.Len())
+	}
+}
+
+func TestBatchCanceled(t *testing.T) {
+	c, d := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		body, err := d.conn.readMessage()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var reqs [][]interface{}
+		if err := rencode.NewDecoder(bytes.NewReader(body)).Decode(&reqs); err != nil {
+			t.Error(err)
+			return
+		}
+		d.reply(reqs[0][0].(int64), "2.1.1")
+		cancel()
+	}()
+
+	b := c.Batch()
+	var version string
+	info := b.Add("daemon.info", nil, nil, &version)
+	state := b.Add("core.get_session_state", nil, nil, nil)
+	if err := b.Do(ctx); err != context.Canceled {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+	if state.Error != context.Canceled {
+		t.Errorf("pending call: err = %v, want %v", state.Error, context.Canceled)
+	}
+	if info.Error == nil && version != "2.1.1" {
+		t.Errorf("version = %q", version)
+	}
+}
@@ -0,0 +1,146 @@
+package delugerpc
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by the calls and the dialings refused by an open
+// circuit breaker
+var ErrCircuitOpen = errors.New("delugerpc: circuit breaker is open")
+
+// CircuitBreaker fails the calls fast once the daemon looks down, instead of
+// sending them to it. It opens after a number of consecutive transport
+// failures: connections failing to be established, responses not received
+// in time and connections lost with calls pending. Once the cooldown has
+// passed, one call or dialing is let through as a probe, which closes the
+// breaker if it succeeds and opens it again otherwise. Exceptions raised by
+// the daemon do not count as failures.
+//
+// A CircuitBreaker is meant to be shared by the successive clients connecting
+// to the same daemon. See WithCircuitBreaker.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker returns a circuit breaker opening after threshold
+// consecutive failures, for at least cooldown
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// WithCircuitBreaker guards the dialing and the calls of the client with b
+func WithCircuitBreaker(b *CircuitBreaker) Option {
+	return func(o *options) {
+		o.breaker = b
+	}
+}
+
+// Open reports whether the breaker refuses calls, because it is open and
+// either waiting for its cooldown or probing the daemon
+func (b *CircuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= b.threshold && (b.probing || time.Since(b.openedAt) < b.cooldown)
+}
+
+// allow reports whether a call may proceed, making it the probe when the
+// cooldown has passed. Its outcome must then be given to success, failure or
+// release. A nil breaker allows everything.
+func (b *CircuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return nil
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	return nil
+}
+
+// success closes the breaker
+func (b *CircuitBreaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+}
+
+// failure counts a failure, opening the breaker once the threshold is
+// reached, or again after a failed probe
+func (b *CircuitBreaker) failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+	b.probing = false
+}
+
+// release ends a call whose outcome says nothing about the daemon, such as a
+// call canceled by its caller
+func (b *CircuitBreaker) release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// outcome records the outcome of the calls sent in one message, which the
+// breaker allowed at once: the first of them to complete decides, the
+// others are ignored. A nil outcome records nothing.
+type outcome struct {
+	b    *CircuitBreaker
+	once sync.Once
+}
+
+// newOutcome returns the outcome of the calls just allowed, nil for a nil
+// breaker
+func (b *CircuitBreaker) newOutcome() *outcome {
+	if b == nil {
+		return nil
+	}
+	return &outcome{b: b}
+}
+
+func (o *outcome) success() {
+	if o != nil {
+		o.once.Do(o.b.success)
+	}
+}
+
+func (o *outcome) failure() {
+	if o != nil {
+		o.once.Do(o.b.failure)
+	}
+}
+
+func (o *outcome) release() {
+	if o != nil {
+		o.once.Do(o.b.release)
+	}
+}
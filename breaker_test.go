@@ -0,0 +1,107 @@
+package delugerpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := NewCircuitBreaker(2, 50*time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if err := b.allow(); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		b.failure()
+	}
+	if !b.Open() {
+		t.Fatal("breaker not open after 2 failures")
+	}
+	if err := b.allow(); err != ErrCircuitOpen {
+		t.Fatalf("err = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	// one probe at a time
+	if err := b.allow(); err != ErrCircuitOpen {
+		t.Fatalf("err = %v, want %v", err, ErrCircuitOpen)
+	}
+	b.failure()
+	if err := b.allow(); err != ErrCircuitOpen {
+		t.Fatalf("after a failed probe: err = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	b.success()
+	if b.Open() {
+		t.Fatal("breaker open after a successful probe")
+	}
+	if err := b.allow(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	b := NewCircuitBreaker(1, time.Minute)
+	c, d := newTestClient(t, WithCircuitBreaker(b))
+	go func() {
+		// reads the request and never replies
+		d.read()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Call(ctx, "daemon.info", nil, nil, nil); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err != ErrCircuitOpen {
+		t.Errorf("err = %v, want %v", err, ErrCircuitOpen)
+	}
+	if _, err := DialClient(context.Background(), "127.0.0.1:1", WithCircuitBreaker(b)); err != ErrCircuitOpen {
+		t.Errorf("dialing: err = %v, want %v", err, ErrCircuitOpen)
+	}
+}
+
+func TestClientCircuitBreakerOutcomes(t *testing.T) {
+	// a batch is allowed once, and counts as a single failure when the
+	// connection is lost with its calls pending
+	b := NewCircuitBreaker(2, time.Minute)
+	c, d := newTestClient(t, WithCircuitBreaker(b))
+	go func() {
+		if _, err := d.conn.readMessage(); err != nil {
+			t.Error(err)
+			return
+		}
+		d.conn.Close()
+	}()
+	batch := c.Batch()
+	batch.Add("daemon.info", nil, nil, nil)
+	batch.Add("daemon.get_version", nil, nil, nil)
+	if err := batch.Do(context.Background()); err == nil {
+		t.Fatal("expected an error for the lost connection")
+	}
+	if b.Open() {
+		t.Fatal("breaker open after a single lost batch")
+	}
+
+	// the calls pending when the client is closed are not failures
+	b = NewCircuitBreaker(1, time.Minute)
+	c, d = newTestClient(t, WithCircuitBreaker(b))
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Call(context.Background(), "daemon.info", nil, nil, nil)
+	}()
+	d.read()
+	c.Close()
+	if err := <-done; err != ErrClosed {
+		t.Fatalf("err = %v, want %v", err, ErrClosed)
+	}
+	if b.Open() {
+		t.Fatal("breaker open after closing the client")
+	}
+}
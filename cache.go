@@ -0,0 +1,178 @@
+package delugerpc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rogaps/delugerpc/rencode"
+)
+
+// WithCache caches the return values of the calls of method for ttl, by
+// arguments, for methods without side effects such as
+// core.get_config_values or daemon.get_method_list. The cached values of
+// method are dropped when the daemon pushes one of the events invalidatedBy,
+// such as TorrentAddedEvent, which the client subscribes to on the first call
+// of method.
+func WithCache(method string, ttl time.Duration, invalidatedBy ...string) Option {
+	return func(o *options) {
+		if o.cache == nil {
+			o.cache = make(map[string]cachePolicy)
+		}
+		o.cache[method] = cachePolicy{ttl: ttl, invalidatedBy: invalidatedBy}
+	}
+}
+
+// cachePolicy is the caching of a method set by WithCache
+type cachePolicy struct {
+	ttl           time.Duration
+	invalidatedBy []string
+}
+
+// cacheSweepSize is the number of cached values above which the expired ones
+// are dropped when a value is added
+const cacheSweepSize = 256
+
+// responseCache holds the responses to the calls of the methods set by
+// WithCache
+type responseCache struct {
+	policies map[string]cachePolicy
+	// methods lists the methods invalidated by each event
+	methods map[string][]string
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// generation counts the invalidations, so that the responses to the
+	// calls made before one are not cached
+	generation uint64
+
+	// subscribed is set once the client is interested in the events
+	// invalidating the values
+	subMu      sync.Mutex
+	subscribed bool
+}
+
+type cacheEntry struct {
+	method  string
+	msg     *message
+	expires time.Time
+}
+
+func newResponseCache(policies map[string]cachePolicy) *responseCache {
+	if len(policies) == 0 {
+		return nil
+	}
+	rc := &responseCache{
+		policies: policies,
+		methods:  make(map[string][]string),
+		entries:  make(map[string]cacheEntry),
+	}
+	for method, p := range policies {
+		for _, event := range p.invalidatedBy {
+			rc.methods[event] = append(rc.methods[event], method)
+		}
+	}
+	return rc
+}
+
+// cached makes a call through the cache
+func (c *Client) cached(ctx context.Context, method string, args Args, kwargs KWArgs) (*message, error) {
+	rc := c.cache
+	if args == nil {
+		args = Args{}
+	}
+	if kwargs == nil {
+		kwargs = KWArgs{}
+	}
+	key, err := rencode.Append([]byte(method), []interface{}{args, kwargs})
+	if err != nil {
+		return nil, err
+	}
+	rc.mu.Lock()
+	e, ok := rc.entries[string(key)]
+	generation := rc.generation
+	rc.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.msg, nil
+	}
+
+	if err := c.subscribeInvalidations(ctx); err != nil {
+		return nil, err
+	}
+	var msg *message
+	if c.coalesced[method] {
+		msg, err = c.coalesce(ctx, method, args, kwargs)
+	} else {
+		msg, err = c.roundTrip(ctx, method, args, kwargs)
+	}
+	if err != nil || msg == nil || msg.err != nil {
+		return msg, err
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.generation != generation {
+		return msg, nil
+	}
+	now := time.Now()
+	if len(rc.entries) >= cacheSweepSize {
+		for k, e := range rc.entries {
+			if !now.Before(e.expires) {
+				delete(rc.entries, k)
+			}
+		}
+	}
+	rc.entries[string(key)] = cacheEntry{method: method, msg: msg, expires: now.Add(rc.policies[method].ttl)}
+	return msg, nil
+}
+
+// subscribeInvalidations makes the client interested in the events
+// invalidating the cached values
+func (c *Client) subscribeInvalidations(ctx context.Context) error {
+	rc := c.cache
+	rc.subMu.Lock()
+	defer rc.subMu.Unlock()
+	if rc.subscribed {
+		return nil
+	}
+	if len(rc.methods) > 0 {
+		events := make([]string, 0, len(rc.methods))
+		for event := range rc.methods {
+			events = append(events, event)
+		}
+		if err := c.addEventInterest(ctx, events); err != nil {
+			return err
+		}
+	}
+	rc.subscribed = true
+	return nil
+}
+
+// invalidate drops the cached values invalidated by the event e
+func (rc *responseCache) invalidate(e Event) {
+	methods := rc.methods[e.Name]
+	if len(methods) == 0 {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.generation++
+	for k, entry := range rc.entries {
+		for _, method := range methods {
+			if entry.method == method {
+				delete(rc.entries, k)
+			}
+		}
+	}
+}
+
+// InvalidateCache drops all the values cached by the client. See WithCache.
+func (c *Client) InvalidateCache() {
+	if c.cache == nil {
+		return
+	}
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	c.cache.generation++
+	c.cache.entries = make(map[string]cacheEntry)
+}
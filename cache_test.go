@@ -0,0 +1,76 @@
+package delugerpc
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientCache(t *testing.T) {
+	c, d := newTestClient(t,
+		WithCache("core.get_torrents_status", time.Minute, "TorrentAddedEvent"),
+		WithCache("daemon.info", 30*time.Millisecond),
+	)
+	// the daemon replies with the number of requests it received
+	requests := make(chan testRequest, 10)
+	var received int32
+	serve := func(n int) {
+		for i := 0; i < n; i++ {
+			req := d.read()
+			requests <- req
+			d.reply(req.id, atomic.AddInt32(&received, 1))
+		}
+	}
+	call := func(method string, args Args) int {
+		t.Helper()
+		var n int
+		if err := c.Call(context.Background(), method, args, nil, &n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// subscribes to the invalidating events, then calls
+	go serve(2)
+	if n := call("core.get_torrents_status", Args{KWArgs{}, []string{"name"}}); n != 2 {
+		t.Errorf("response %d, want 2", n)
+	}
+	if req := <-requests; req.method != "daemon.set_event_interest" {
+		t.Errorf("method = %q, want daemon.set_event_interest", req.method)
+	}
+	<-requests
+	if n := call("core.get_torrents_status", Args{KWArgs{}, []string{"name"}}); n != 2 {
+		t.Errorf("cached response %d, want 2", n)
+	}
+	// other arguments are cached separately
+	go serve(1)
+	if n := call("core.get_torrents_status", Args{KWArgs{}, []string{"state"}}); n != 3 {
+		t.Errorf("response %d, want 3", n)
+	}
+	<-requests
+
+	// an event invalidates the method
+	changed := make(chan struct{})
+	c.OnEvent("TorrentAddedEvent", func(Event) { close(changed) })
+	d.send(int(rpcEvent), "TorrentAddedEvent", []interface{}{"abc", false})
+	<-changed
+	go serve(1)
+	if n := call("core.get_torrents_status", Args{KWArgs{}, []string{"name"}}); n != 4 {
+		t.Errorf("response %d after invalidation, want 4", n)
+	}
+	<-requests
+
+	// values expire
+	go serve(2)
+	if n := call("daemon.info", nil); n != 5 {
+		t.Errorf("response %d, want 5", n)
+	}
+	if n := call("daemon.info", nil); n != 5 {
+		t.Errorf("cached response %d, want 5", n)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if n := call("daemon.info", nil); n != 6 {
+		t.Errorf("response %d after expiry, want 6", n)
+	}
+}
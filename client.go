@@ -1,160 +1,660 @@
 package delugerpc
 
 import (
-	"bytes"
-	"compress/zlib"
-	"crypto/tls"
+	"context"
 	"errors"
 	"fmt"
 	"net"
-	"net/rpc"
+	"os"
 	"reflect"
-	"strings"
-
-	"github.com/rogaps/delugerpc/rencode"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-type rpcResponseTypeID int
+// Args holds the positional arguments of a call
+type Args []interface{}
 
-const (
-	rpcResponse rpcResponseTypeID = 1
-	rpcError    rpcResponseTypeID = 2
-	rpcEvent    rpcResponseTypeID = 3
-)
+// KWArgs holds the keyword arguments of a call
+type KWArgs map[string]interface{}
 
-type clientCodec struct {
-	conn     *tls.Conn
-	respBody interface{}
-}
+// ErrClosed is returned by calls made on a closed client, and by the calls
+// still pending when it is closed
+var ErrClosed = errors.New("delugerpc: client is closed")
 
-func (c *clientCodec) WriteRequest(r *rpc.Request, body interface{}) error {
-	var b bytes.Buffer
-	var msg []interface{}
-	var req []interface{}
+// ErrUnresponsive is returned by the calls pending when the connection is
+// torn down because the daemon stopped responding. See WithTeardownOnTimeout.
+var ErrUnresponsive = errors.New("delugerpc: daemon is unresponsive")
 
-	zw := zlib.NewWriter(&b)
-	e := rencode.NewEncoder(zw)
+// ErrPoisoned is wrapped by the errors of the calls whose response made the
+// decoding panic. The connection is torn down, since the client can no longer
+// trust what it reads from it.
+var ErrPoisoned = errors.New("delugerpc: connection poisoned")
 
-	args, kwargs := getArgs(body)
-	msg = append(msg, r.Seq, r.ServiceMethod, args, kwargs)
-	req = append(req, msg)
+// Client makes calls to a daemon. Calls may be made concurrently: their
+// responses are matched to them by request id.
+type Client struct {
+	// droppedEvents and lastRead are accessed atomically, first to be 64-bit
+	// aligned
+	droppedEvents uint64
+	// lastRead is the time the last message was read, in nanoseconds
+	lastRead int64
 
-	if err := e.Encode(req); err != nil {
-		return err
+	// serializer and protocol are those of the connections
+	serializer Serializer
+	protocol   ProtocolVersion
+
+	mu sync.Mutex
+	// conn is the connection in use, replaced when reconnecting
+	conn    *messageConn
+	seq     int64
+	pending map[int64]pendingCall
+	closing bool
+	// quit is closed by Close, to stop reconnecting
+	quit chan struct{}
+	// failErr is the reason the connection was torn down by the client
+	failErr error
+	// down is the reason the connection was lost, until a new one is
+	// restored. See WithReconnect.
+	down     error
+	redialer *redialer
+	// err is the reason the client was shut down
+	err error
+	// teardownOnTimeout is set by WithTeardownOnTimeout
+	teardownOnTimeout bool
+	// shut is closed once the client is shut down
+	shut chan struct{}
+	// writes holds the messages waiting for the write loop, and writerDone
+	// is closed once the loop returned
+	writes     chan *outgoing
+	writerDone chan struct{}
+
+	// events holds the events waiting for dispatch
+	events            chan Event
+	eventDropPolicy   EventDropPolicy
+	eventBlockTimeout time.Duration
+
+	handlersMu  sync.Mutex
+	handlers    []eventHandler
+	nextHandler int
+
+	// interest counts the subscribers of each event
+	interestMu sync.Mutex
+	interest   map[string]int
+
+	stateMu  sync.Mutex
+	state    ConnState
+	stateChs []chan ConnState
+	// authLevel is the level granted by the last daemon.login, and login
+	// that call, replayed when reconnecting
+	authLevel AuthLevel
+	login     *request
+
+	logger  Logger
+	metrics Metrics
+	breaker *CircuitBreaker
+	limiter *rateLimiter
+
+	// coalesced holds the methods set by WithCoalescing, and flights their
+	// calls in progress by key
+	coalesced map[string]bool
+	flightsMu sync.Mutex
+	flights   map[string]*flight
+
+	cache *responseCache
+	// notifyErrors is set by WithNotifyErrors
+	notifyErrors func(method string, err error)
+	// authLevelCheck is set by WithAuthLevelCheck
+	authLevelCheck bool
+
+	// version is the version of the daemon, once fetched
+	versionMu sync.Mutex
+	version   *Version
+}
+
+// NewClient returns a client making calls over conn, an established
+// connection to the daemon. The options of the dialing, such as the timeouts
+// and the TLS configuration, do not apply.
+func NewClient(conn net.Conn, opts ...Option) (*Client, error) {
+	o := newOptions(opts)
+	if err := o.validate(); err != nil {
+		return nil, err
 	}
+	return newClient(conn, o, nil), nil
+}
 
-	if err := zw.Close(); err != nil {
-		return err
+// newClient returns a client making calls over conn, dialing the daemon
+// again with r when the connection is lost, if not nil
+func newClient(conn net.Conn, o options, r *redialer) *Client {
+	c := &Client{
+		conn:       newMessageConn(conn, o),
+		serializer: o.serializer,
+		protocol:   o.version,
+		redialer:   r,
+		pending:    make(map[int64]pendingCall),
+		quit:       make(chan struct{}),
+		shut:       make(chan struct{}),
+		events:     make(chan Event, o.eventQueueSize),
+		interest:   make(map[string]int),
+		state:      Connected,
+
+		writes:     make(chan *outgoing, o.writeQueueSize),
+		writerDone: make(chan struct{}),
+
+		teardownOnTimeout: o.teardownOnTimeout,
+		logger:            o.logger,
+		metrics:           o.metrics,
+		breaker:           o.breaker,
+		limiter:           newRateLimiter(o),
+		coalesced:         o.coalesced,
+		flights:           make(map[string]*flight),
+		cache:             newResponseCache(o.cache),
+		notifyErrors:      o.notifyErrors,
+		authLevelCheck:    o.authLevelCheck,
+
+		eventDropPolicy:   o.eventDropPolicy,
+		eventBlockTimeout: o.eventBlockTimeout,
 	}
-	if _, err := c.conn.Write(b.Bytes()); err != nil {
-		return err
+	if c.cache != nil {
+		c.OnEvent("", c.cache.invalidate)
 	}
-
-	return nil
+	for _, h := range o.eventHandlers {
+		c.OnEvent("", h)
+	}
+	if c.metrics != nil {
+		c.metrics.ConnectionOpened()
+	}
+	go c.readLoop()
+	go c.writeLoop()
+	go c.dispatchEvents()
+	if o.keepalive > 0 {
+		go c.keepalive(o.keepalive)
+	}
+	return c
 }
 
-func (c *clientCodec) ReadResponseHeader(r *rpc.Response) (err error) {
-	zr, err := zlib.NewReader(c.conn)
+// DialClient returns a client connected to the daemon listening on addr,
+// which is given in any of the forms accepted by Dial. It gives up
+// connecting when ctx is done.
+func DialClient(ctx context.Context, addr string, opts ...Option) (*Client, error) {
+	o := newOptions(opts)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	network, address := splitAddress(addr)
+	conn, err := o.dial(ctx, network, address)
 	if err != nil {
-		return
+		return nil, err
+	}
+	c := newClient(conn, o, o.redialer(network, address))
+	if err := o.setup(ctx, c); err != nil {
+		return nil, err
 	}
-	d := rencode.NewDecoder(zr)
+	return c, nil
+}
 
-	var resp []interface{}
-	if err = d.Decode(&resp); err != nil {
-		return
+// Call calls method with args and kwargs, and decodes its return value into
+// result, which must be a pointer, or nil to discard the value. Structs are
+// decoded following the rules of rencode, and a *rencode.RawMessage keeps the
+// encoded value to be decoded later, unless WithSerializer sets another
+// encoding. A value not fitting result fails the
+// call only. Exceptions raised by the daemon are returned as errors. When ctx
+// is done before the response arrives, Call returns ctx.Err() and the
+// response is discarded.
+func (c *Client) Call(ctx context.Context, method string, args Args, kwargs KWArgs, result interface{}) error {
+	if err := checkResult(result); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var msg *message
+	var err error
+	if c.shared(method) {
+		msg, err = c.callShared(ctx, method, args, kwargs)
+	} else {
+		msg, err = c.roundTrip(ctx, method, args, kwargs)
 	}
+	if err != nil {
+		return err
+	}
+	return c.decodeResult(msg, result)
+}
 
-	messageType := resp[0].(int64)
-	r.Seq = uint64(resp[1].(int64))
+// shared reports whether the responses to the calls of method may be shared
+// with other calls, through the cache or coalescing
+func (c *Client) shared(method string) bool {
+	return c.cache != nil && c.cache.policies[method].ttl > 0 || c.coalesced[method]
+}
 
-	switch rpcResponseTypeID(messageType) {
-	case rpcResponse:
-		c.respBody = resp[2]
-		return
-	case rpcError:
-		errMsg := resp[2].([]interface{})
-		exceptionType := errMsg[0]
-		exceptionMsg := errMsg[1]
-		return fmt.Errorf("%v: %v", exceptionType, exceptionMsg)
-	case rpcEvent:
-		return errors.New("event is not supported")
-	default:
-		return errors.New("unknown message type")
+// callShared makes a call of a shared method
+func (c *Client) callShared(ctx context.Context, method string, args Args, kwargs KWArgs) (*message, error) {
+	if c.cache != nil && c.cache.policies[method].ttl > 0 {
+		return c.cached(ctx, method, args, kwargs)
 	}
+	return c.coalesce(ctx, method, args, kwargs)
 }
 
-func (c *clientCodec) ReadResponseBody(body interface{}) (err error) {
-	bv := reflect.ValueOf(body)
-	if bv.Kind() != reflect.Ptr || bv.IsNil() {
-		return errors.New("Unwritable type passed into decode")
+// roundTrip sends a request and returns its response, nil if the client shut
+// down first
+func (c *Client) roundTrip(ctx context.Context, method string, args Args, kwargs KWArgs) (*message, error) {
+	sent := time.Now().UnixNano()
+	done := make(chan *message, 1)
+	id, err := c.start(ctx, method, args, kwargs, func(msg *message) { done <- msg })
+	if err != nil {
+		return nil, err
 	}
-	bv = bv.Elem()
-	if c.respBody != nil {
-		bv.Set(reflect.ValueOf(c.respBody))
+	select {
+	case msg := <-done:
+		return msg, nil
+	case <-ctx.Done():
+		c.abandon(ctx, sent, id)
+		return nil, ctx.Err()
+	}
+}
+
+// checkResult checks that result can receive a return value
+func checkResult(result interface{}) error {
+	if result != nil {
+		if rv := reflect.ValueOf(result); rv.Kind() != reflect.Ptr || rv.IsNil() {
+			return errors.New("delugerpc: result must be a non-nil pointer")
+		}
 	}
 	return nil
 }
 
-func (c *clientCodec) Close() error {
-	return c.conn.Close()
+// decodeResult decodes the return value held by the response msg into
+// result, nil meaning that the client shut down first
+func (c *Client) decodeResult(msg *message, result interface{}) error {
+	if msg == nil {
+		return c.shutdownErr()
+	}
+	if msg.err != nil {
+		return msg.err
+	}
+	if result == nil {
+		return nil
+	}
+	return c.unmarshal(msg.payload, result)
 }
 
-func newDelugeCodec(conn *tls.Conn) rpc.ClientCodec {
-	return &clientCodec{
-		conn: conn,
+// abandon gives up on the calls ids, sent at sent, because ctx is done. See
+// WithTeardownOnTimeout.
+func (c *Client) abandon(ctx context.Context, sent int64, ids ...int64) {
+	var o *outcome
+	for _, id := range ids {
+		if p := c.unregister(id); p.outcome != nil {
+			o = p.outcome
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		o.failure()
+	} else {
+		o.release()
 	}
+	if c.teardownOnTimeout && ctx.Err() == context.DeadlineExceeded &&
+		atomic.LoadInt64(&c.lastRead) < sent {
+		c.fail(ErrUnresponsive)
+	}
+}
+
+// request is a call to be sent
+type request struct {
+	method  string
+	args    Args
+	kwargs  KWArgs
+	deliver func(*message)
 }
 
-// Dial creates RPC client with rencode codec
-func Dial(network, address string) (*rpc.Client, error) {
-	conn, err := net.Dial(network, address)
+// start sends a request and returns its id. The read loop passes the
+// response to deliver, or nil if the client shuts down first; deliver must
+// not block. Sending is given up when ctx is done.
+func (c *Client) start(ctx context.Context, method string, args Args, kwargs KWArgs, deliver func(*message)) (int64, error) {
+	ids, err := c.startAll(ctx, []request{{method: method, args: args, kwargs: kwargs, deliver: deliver}})
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	tlsConn := tls.Client(conn, &tls.Config{
-		ServerName:         address,
-		InsecureSkipVerify: true,
-	})
-	return rpc.NewClientWithCodec(newDelugeCodec(tlsConn)), err
+	return ids[0], nil
 }
 
-func getArgs(body interface{}) (args []interface{}, kwargs map[string]interface{}) {
-	bodyValue := reflect.ValueOf(body)
-	switch bodyValue.Kind() {
-	case reflect.Slice, reflect.Array:
-		for i := 0; i < bodyValue.Len(); i++ {
-			args = append(args, bodyValue.Index(i).Interface())
+// startAll is like start, but sends all of reqs in one message
+func (c *Client) startAll(ctx context.Context, reqs []request) ([]int64, error) {
+	if c.authLevelCheck {
+		for _, r := range reqs {
+			if err := c.checkAuthLevel(r.method); err != nil {
+				return nil, err
+			}
 		}
-		return
-	case reflect.Map:
-		for _, key := range bodyValue.MapKeys() {
-			if strings.EqualFold("args", key.String()) {
-				argsValue := bodyValue.MapIndex(key)
-				if argsValue.Kind() == reflect.Interface {
-					argsValue = argsValue.Elem()
-				}
-				if argsValue.Kind() == reflect.Slice ||
-					argsValue.Kind() == reflect.Array {
-					for i := 0; i < argsValue.Len(); i++ {
-						args = append(args, argsValue.Index(i).Interface())
+	}
+	for _, r := range reqs {
+		if err := c.limiter.wait(ctx, r.method); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	// the calls are allowed at once, the first to complete decides
+	o := c.breaker.newOutcome()
+	restoring := ctx.Value(restoreKey{}) != nil
+	delivers := make([]func(*message), 0, len(reqs))
+	calls := make([][]interface{}, 0, len(reqs))
+	start := time.Now()
+	for _, r := range reqs {
+		args, kwargs, deliver := r.args, r.kwargs, r.deliver
+		if args == nil {
+			args = Args{}
+		}
+		if kwargs == nil {
+			kwargs = KWArgs{}
+		}
+		if r.method == "daemon.login" {
+			deliverLogin, login := deliver, request{method: r.method, args: args, kwargs: kwargs}
+			deliver = func(msg *message) {
+				if msg != nil && msg.err == nil {
+					var level int
+					c.unmarshal(msg.payload, &level)
+					c.authenticated(AuthLevel(level), &login)
+					if !restoring {
+						// restore reports it once the calls go through
+						c.setState(Authenticated)
 					}
 				}
-			} else if strings.EqualFold("kwargs", key.String()) {
-				kwargsValue := bodyValue.MapIndex(key)
-				if kwargsValue.Kind() == reflect.Interface {
-					kwargsValue = kwargsValue.Elem()
-				}
-				if kwargsValue.Kind() == reflect.Map {
-					kwargs = make(map[string]interface{})
-					for _, key := range kwargsValue.MapKeys() {
-						kwargs[key.String()] = kwargsValue.MapIndex(key).Interface()
-					}
+				deliverLogin(msg)
+			}
+		}
+		if o != nil {
+			// the calls failed by shutdown are recorded by it
+			deliverGuarded := deliver
+			deliver = func(msg *message) {
+				if msg != nil {
+					o.success()
 				}
+				deliverGuarded(msg)
+			}
+		}
+		if c.logger != nil || c.metrics != nil {
+			deliverObserved, method := deliver, r.method
+			deliver = func(msg *message) {
+				c.observeCall(method, start, msg)
+				deliverObserved(msg)
 			}
 		}
+		delivers = append(delivers, deliver)
+		calls = append(calls, []interface{}{r.method, []interface{}(args), map[string]interface{}(kwargs)})
+	}
+	ids, mc, err := c.register(delivers, o, restoring)
+	if err != nil {
+		o.release()
+		return nil, err
+	}
+	frame := make([]interface{}, len(calls))
+	for i, call := range calls {
+		frame[i] = append([]interface{}{ids[i]}, call...)
+	}
+	msg, err := mc.encode(frame)
+	if err != nil {
+		for _, id := range ids {
+			c.unregister(id)
+		}
+		o.release()
+		return nil, err
+	}
+	if n, err := c.write(ctx, mc, msg); err != nil {
+		for _, id := range ids {
+			c.unregister(id)
+		}
+		if isTimeout(err) {
+			err = ErrUnresponsive
+		}
+		if n > 0 || ctx.Err() == nil {
+			// the connection is broken, or the daemon cannot make sense of
+			// the next messages
+			c.failConn(mc, err)
+		}
+		c.mu.Lock()
+		if c.closing {
+			err = ErrClosed
+		} else if c.failErr != nil {
+			// the connection was torn down by the client
+			err = c.failErr
+		}
+		c.mu.Unlock()
+		if err == context.Canceled || err == ErrClosed {
+			o.release()
+		} else {
+			o.failure()
+		}
+		return nil, err
+	}
+	return ids, nil
+}
+
+// pendingCall is a call waiting for its response
+type pendingCall struct {
+	deliver func(*message)
+	// outcome is shared by the calls sent in the same message, nil without
+	// circuit breaker
+	outcome *outcome
+}
+
+// register assigns request ids to the calls whose responses are passed to
+// delivers, and returns the connection to send them on. While the
+// connection is being restored, only the calls restoring it are accepted.
+func (c *Client) register(delivers []func(*message), o *outcome, restoring bool) ([]int64, *messageConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+	if c.closing {
+		return nil, nil, ErrClosed
+	}
+	if c.down != nil && !restoring {
+		return nil, nil, c.down
+	}
+	ids := make([]int64, len(delivers))
+	for i, deliver := range delivers {
+		ids[i] = c.seq
+		c.seq++
+		c.pending[ids[i]] = pendingCall{deliver: deliver, outcome: o}
+	}
+	if len(c.pending) == len(delivers) {
+		c.armReadDeadline()
+	}
+	return ids, c.conn, nil
+}
+
+// unregister removes the call id, returning it unless it already completed
+func (c *Client) unregister(id int64) pendingCall {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p := c.pending[id]
+	delete(c.pending, id)
+	if len(c.pending) == 0 {
+		c.armReadDeadline()
+	}
+	return p
+}
+
+// armReadDeadline bounds the wait for the next message by the read timeout
+// while calls are pending, and lifts it otherwise. c.mu must be held.
+func (c *Client) armReadDeadline() {
+	if c.conn.readTimeout <= 0 {
 		return
-	default:
+	}
+	if len(c.pending) == 0 {
+		c.conn.conn.SetReadDeadline(time.Time{})
+	} else {
+		c.conn.conn.SetReadDeadline(time.Now().Add(c.conn.readTimeout))
+	}
+}
+
+// broken reports whether the connection failed or was torn down, and is
+// not restored yet
+func (c *Client) broken() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err != nil || c.failErr != nil || c.down != nil
+}
+
+func (c *Client) shutdownErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// readLoop delivers the responses to the pending calls and queues the events
+// until the connection fails, and the client cannot reconnect
+func (c *Client) readLoop() {
+	err := c.readMessages()
+	for c.redialer != nil && c.lose(err) {
+		if err = c.reconnect(); err != nil {
+			break
+		}
+		err = c.readMessages()
+	}
+	close(c.events)
+	c.shutdown(err)
+}
+
+// readMessages handles the messages read from the connection in use until
+// it fails, returning the reason
+func (c *Client) readMessages() error {
+	// only the read loop replaces the connection
+	c.mu.Lock()
+	mc := c.conn
+	c.mu.Unlock()
+	for {
+		body, err := mc.readMessage()
+		if err != nil {
+			if isTimeout(err) {
+				err = ErrUnresponsive
+			}
+			return err
+		}
+		atomic.StoreInt64(&c.lastRead, time.Now().UnixNano())
+		c.mu.Lock()
+		c.armReadDeadline()
+		c.mu.Unlock()
+		if err = c.handleMessage(body); err != nil {
+			return err
+		}
+	}
+}
+
+// handleMessage delivers a response, or queues an event. A panic while
+// decoding the message poisons the connection.
+func (c *Client) handleMessage(body []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = poisoned(r)
+		}
+	}()
+	msg, err := parseMessage(c.serializer, body)
+	if err != nil {
+		return err
+	}
+	if msg.typ == rpcEvent {
+		if c.metrics != nil {
+			c.metrics.EventReceived(msg.event)
+		}
+		c.queueEvent(msg)
+		return nil
+	}
+	// the responses of the calls given up on are dropped
+	if p := c.unregister(msg.id); p.deliver != nil {
+		p.deliver(msg)
+	}
+	return nil
+}
+
+// unmarshal decodes data into v with the serializer of the connection,
+// tearing the connection down if the decoding panics
+func (c *Client) unmarshal(data []byte, v interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = poisoned(r)
+			c.fail(err)
+		}
+	}()
+	return c.serializer.Unmarshal(data, v)
+}
+
+// poisoned returns the error of a panic r while decoding a message
+func poisoned(r interface{}) error {
+	return fmt.Errorf("%w: panic decoding a message: %v", ErrPoisoned, r)
+}
+
+// shutdown fails the pending calls and the later ones with err
+func (c *Client) shutdown(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing {
+		err = ErrClosed
+	} else if c.failErr != nil {
+		err = c.failErr
+	}
+	c.err = err
+	c.log(LogInfo, "connection closed", LogField{"error", err})
+	if c.metrics != nil {
+		c.metrics.ConnectionClosed(err)
+	}
+	for id, p := range c.pending {
+		delete(c.pending, id)
+		// a connection closed by the application says nothing about the
+		// daemon
+		if c.closing {
+			p.outcome.release()
+		} else {
+			p.outcome.failure()
+		}
+		p.deliver(nil)
+	}
+	close(c.shut)
+	c.conn.Close()
+	c.setState(Disconnected)
+}
+
+// fail tears the connection down, making the read loop shut the client down
+// with err, or reconnect
+func (c *Client) fail(err error) {
+	c.failConn(nil, err)
+}
+
+// failConn is like fail, but tears mc down only if it is still in use. A nil
+// mc is the connection in use.
+func (c *Client) failConn(mc *messageConn, err error) {
+	c.mu.Lock()
+	if c.err != nil || mc != nil && mc != c.conn {
+		// already shut down, or replaced
+		c.mu.Unlock()
 		return
 	}
+	if c.failErr == nil {
+		c.failErr = err
+	}
+	mc = c.conn
+	c.mu.Unlock()
+	c.log(LogWarn, "tearing the connection down", LogField{"error", err})
+	mc.Close()
+}
+
+// isTimeout reports whether err comes from an expired read or write deadline
+func isTimeout(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// Close closes the connection, failing the pending calls with ErrClosed
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closing {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.closing = true
+	close(c.quit)
+	conn := c.conn
+	c.mu.Unlock()
+	return conn.Close()
 }
@@ -0,0 +1,853 @@
+package delugerpc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rogaps/delugerpc/rencode"
+)
+
+// serveOne reads one request from conn, framed for version, and replies with
+// result
+func serveOne(t *testing.T, conn net.Conn, version ProtocolVersion, result interface{}) {
+	t.Helper()
+	r := bufio.NewReader(conn)
+	var body io.Reader = r
+	if version == ProtocolV2 {
+		var header [protocolV2Header]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			t.Errorf("reading header: %v", err)
+			return
+		}
+		if header[0] != 'D' {
+			t.Errorf("version byte = %q, want 'D'", header[0])
+		}
+		b := make([]byte, binary.BigEndian.Uint32(header[1:]))
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Errorf("reading body: %v", err)
+			return
+		}
+		body = bytes.NewReader(b)
+	}
+	zr, err := zlib.NewReader(body)
+	if err != nil {
+		t.Errorf("zlib: %v", err)
+		return
+	}
+	var req [][]interface{}
+	if err := rencode.NewDecoder(zr).Decode(&req); err != nil {
+		t.Errorf("decoding request: %v", err)
+		return
+	}
+	if got := req[0][1]; got != "daemon.info" {
+		t.Errorf("method = %v, want daemon.info", got)
+	}
+
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	e := rencode.NewEncoder(zw)
+	if err := e.Encode([]interface{}{int(rpcResponse), req[0][0], result}); err != nil {
+		t.Error(err)
+		return
+	}
+	zw.Close()
+	if version == ProtocolV2 {
+		var header [protocolV2Header]byte
+		header[0] = 'D'
+		binary.BigEndian.PutUint32(header[1:], uint32(b.Len()))
+		conn.Write(header[:])
+	}
+	conn.Write(b.Bytes())
+}
+
+func TestClientCodecFraming(t *testing.T) {
+	for _, version := range []ProtocolVersion{ProtocolV1, ProtocolV2} {
+		client, server := net.Pipe()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			serveOne(t, server, version, "2.1.1")
+			serveOne(t, server, version, "2.1.1")
+		}()
+
+		c := rpc.NewClientWithCodec(newDelugeCodec(client, newOptions([]Option{WithProtocolVersion(version)}), nil))
+		for i := 0; i < 2; i++ {
+			var info interface{}
+			if err := c.Call("daemon.info", []interface{}{}, &info); err != nil {
+				t.Fatalf("version %d: %v", version, err)
+			}
+			if info != "2.1.1" {
+				t.Errorf("version %d: info = %v, want 2.1.1", version, info)
+			}
+		}
+		<-done
+		c.Close()
+	}
+}
+
+func TestClientCodecBadVersionByte(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go server.Write([]byte{'X', 0, 0, 0, 0})
+
+	codec := newDelugeCodec(client, newOptions([]Option{WithProtocolVersion(ProtocolV2)}), nil)
+	defer codec.Close()
+	var resp rpc.Response
+	if err := codec.ReadResponseHeader(&resp); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// silentListener accepts connections and never answers on them
+func silentListener(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	return l
+}
+
+func TestDialContextHandshakeTimeout(t *testing.T) {
+	l := silentListener(t)
+	defer l.Close()
+
+	start := time.Now()
+	_, err := DialContext(context.Background(), "tcp", l.Addr().String(), WithHandshakeTimeout(50*time.Millisecond))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("dial returned after %v", elapsed)
+	}
+}
+
+func TestDialContextCanceled(t *testing.T) {
+	l := silentListener(t)
+	defer l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := DialContext(ctx, "tcp", l.Addr().String(), WithHandshakeTimeout(0))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	o := newOptions([]Option{WithProtocolVersion(ProtocolV2), WithCompressionLevel(zlib.BestSpeed)})
+	if err := o.validate(); err != nil {
+		t.Errorf("valid options: %v", err)
+	}
+	for _, opt := range []Option{
+		WithProtocolVersion(3),
+		WithCompressionLevel(10),
+		WithReadTimeout(-time.Second),
+		WithKeepalive(-time.Second),
+		WithRateLimit(0, 1),
+		WithMethodRateLimit("core.get_torrents_status", 1, 0),
+		WithCompressionThreshold(-1),
+		WithWriteQueue(-1),
+		WithMaxMessageSize(0),
+		WithReconnect(time.Second, time.Millisecond),
+	} {
+		o := newOptions([]Option{opt})
+		if err := o.validate(); err == nil {
+			t.Errorf("%+v: expected an error", o)
+		}
+	}
+}
+
+// newCertificate returns a certificate for localhost and 127.0.0.1, signed by
+// parent or self-signed when parent is nil
+func newCertificate(t *testing.T, parent *tls.Certificate, isCA bool) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "delugerpc test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	signer, signerKey := template, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// tlsListener accepts TLS connections, completes their handshake and sends
+// the server name requested by the client on serverNames
+func tlsListener(t *testing.T, config *tls.Config) (net.Listener, <-chan string) {
+	t.Helper()
+	l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverNames := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := conn.(*tls.Conn)
+			if tlsConn.Handshake() == nil {
+				serverNames <- tlsConn.ConnectionState().ServerName
+			}
+			conn.Close()
+		}
+	}()
+	return l, serverNames
+}
+
+func TestDialTLSConfig(t *testing.T) {
+	cert := newCertificate(t, nil, true)
+	l, serverNames := tlsListener(t, &tls.Config{Certificates: []tls.Certificate{cert}})
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	addr := net.JoinHostPort("localhost", port)
+
+	// the self-signed certificate is accepted by default
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if name := <-serverNames; name != "localhost" {
+		t.Errorf("server name = %q, want localhost", name)
+	}
+
+	// and verified against the given roots
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.Leaf)
+	c, err = Dial(addr, WithTLSConfig(&tls.Config{RootCAs: roots}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	<-serverNames
+
+	if _, err := Dial(addr, WithTLSConfig(&tls.Config{RootCAs: x509.NewCertPool()})); err == nil {
+		t.Error("expected a verification error")
+	}
+}
+
+func TestDialClientCertificate(t *testing.T) {
+	ca := newCertificate(t, nil, true)
+	clientCert := newCertificate(t, &ca, false)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.Leaf)
+	l, serverNames := tlsListener(t, &tls.Config{
+		Certificates: []tls.Certificate{ca},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})
+	defer l.Close()
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	key, err := x509.MarshalPKCS8PrivateKey(clientCert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientCert.Certificate[0]}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600)
+
+	for _, opt := range []Option{WithClientCertificate(clientCert), WithClientCertificateFile(certFile, keyFile)} {
+		c, err := Dial(l.Addr().String(), opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+		<-serverNames
+	}
+
+	// the server rejects the connection after the client's handshake is done,
+	// so the failure may only show on the first read
+	c, err := Dial(l.Addr().String())
+	if err == nil {
+		var info interface{}
+		err = c.Call("daemon.info", []interface{}{}, &info)
+		c.Close()
+	}
+	if err == nil {
+		t.Error("expected an error without a client certificate")
+	}
+
+	if _, err := Dial(l.Addr().String(), WithClientCertificateFile(certFile, filepath.Join(dir, "missing"))); err == nil {
+		t.Error("expected an error loading a missing key")
+	}
+}
+
+func TestDialWithoutTLS(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		serveOne(t, conn, ProtocolV2, "2.1.1")
+	}()
+
+	c, err := Dial(l.Addr().String(), WithoutTLS(), WithProtocolVersion(ProtocolV2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var info interface{}
+	if err := c.Call("daemon.info", []interface{}{}, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info != "2.1.1" {
+		t.Errorf("info = %v, want 2.1.1", info)
+	}
+}
+
+func TestSplitAddress(t *testing.T) {
+	tests := []struct {
+		addr, network, address string
+	}{
+		{"localhost:58846", "tcp", "localhost:58846"},
+		{"localhost", "tcp", "localhost:58846"},
+		{"10.0.0.1", "tcp", "10.0.0.1:58846"},
+		{"[::1]:1234", "tcp", "[::1]:1234"},
+		{"[::1]", "tcp", "[::1]:58846"},
+		{"::1", "tcp", "[::1]:58846"},
+		{"[fe80::1%eth0]:1234", "tcp", "[fe80::1%eth0]:1234"},
+		{"unix:/run/deluged.sock", "unix", "/run/deluged.sock"},
+		{"unix:///run/deluged.sock", "unix", "/run/deluged.sock"},
+		{"unix:deluged.sock", "unix", "deluged.sock"},
+		{"/run/deluged.sock", "unix", "/run/deluged.sock"},
+	}
+	for _, tt := range tests {
+		network, address := splitAddress(tt.addr)
+		if network != tt.network || address != tt.address {
+			t.Errorf("splitAddress(%q) = %q, %q, want %q, %q", tt.addr, network, address, tt.network, tt.address)
+		}
+	}
+}
+
+func TestClientTLSConfigServerName(t *testing.T) {
+	tests := []struct {
+		network, address, serverName string
+	}{
+		{"tcp", "example.com:58846", "example.com"},
+		{"tcp", "[::1]:58846", "::1"},
+		{"tcp", "[::1]", "::1"},
+		{"unix", "/run/deluged.sock", ""},
+	}
+	for _, tt := range tests {
+		o := newOptions(nil)
+		config, err := o.clientTLSConfig(tt.network, tt.address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.ServerName != tt.serverName {
+			t.Errorf("%s %s: ServerName = %q, want %q", tt.network, tt.address, config.ServerName, tt.serverName)
+		}
+	}
+}
+
+func TestDialUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deluged.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		serveOne(t, conn, ProtocolV1, "2.1.1")
+	}()
+
+	c, err := Dial("unix:"+path, WithoutTLS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var info interface{}
+	if err := c.Call("daemon.info", []interface{}{}, &info); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pipeDialer connects to a daemon served in process
+type pipeDialer struct {
+	t       *testing.T
+	network string
+	address string
+}
+
+func (d *pipeDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.network, d.address = network, address
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		serveOne(d.t, server, ProtocolV1, "2.1.1")
+	}()
+	return client, nil
+}
+
+func TestDialWithDialer(t *testing.T) {
+	d := &pipeDialer{t: t}
+	c, err := Dial("deluge.internal", WithDialer(d), WithoutTLS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var info interface{}
+	if err := c.Call("daemon.info", []interface{}{}, &info); err != nil {
+		t.Fatal(err)
+	}
+	if d.network != "tcp" || d.address != "deluge.internal:58846" {
+		t.Errorf("dialed %s %s", d.network, d.address)
+	}
+}
+
+// testRequest is a request received by a testDaemon
+type testRequest struct {
+	id     int64
+	method string
+	args   []interface{}
+	kwargs map[string]interface{}
+}
+
+// testDaemon is the daemon end of a connection made with net.Pipe
+type testDaemon struct {
+	t    *testing.T
+	conn *messageConn
+}
+
+func newTestClient(t *testing.T, opts ...Option) (*Client, *testDaemon) {
+	t.Helper()
+	client, server := net.Pipe()
+	c, err := NewClient(client, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+		server.Close()
+	})
+	return c, &testDaemon{t: t, conn: newMessageConn(server, newOptions(opts))}
+}
+
+func (d *testDaemon) read() testRequest {
+	body, err := d.conn.readMessage()
+	if err != nil {
+		d.t.Errorf("reading request: %v", err)
+		return testRequest{}
+	}
+	var raw [][]interface{}
+	if err := rencode.NewDecoder(bytes.NewReader(body)).Decode(&raw); err != nil {
+		d.t.Errorf("decoding request: %v", err)
+		return testRequest{}
+	}
+	req := raw[0]
+	return testRequest{
+		id:     req[0].(int64),
+		method: req[1].(string),
+		args:   req[2].([]interface{}),
+		kwargs: req[3].(map[string]interface{}),
+	}
+}
+
+func (d *testDaemon) reply(id int64, result interface{}) {
+	if err := d.conn.writeMessage([]interface{}{int(rpcResponse), id, result}); err != nil {
+		d.t.Errorf("writing response: %v", err)
+	}
+}
+
+func (d *testDaemon) send(msg ...interface{}) {
+	if err := d.conn.writeMessage(msg); err != nil {
+		d.t.Errorf("writing message: %v", err)
+	}
+}
+
+func TestClientCall(t *testing.T) {
+	c, d := newTestClient(t, WithProtocolVersion(ProtocolV2))
+	go func() {
+		// replies in the reverse order of the requests
+		first, second := d.read(), d.read()
+		for _, req := range []testRequest{second, first} {
+			d.reply(req.id, map[string]interface{}{"method": req.method, "args": req.args, "kwargs": req.kwargs})
+		}
+	}()
+
+	type result struct {
+		Method string          `rencode:"method"`
+		Args   []string        `rencode:"args"`
+		KWArgs map[string]bool `rencode:"kwargs"`
+	}
+	var wg sync.WaitGroup
+	for _, method := range []string{"core.get_torrents_status", "core.get_session_state"} {
+		wg.Add(1)
+		go func(method string) {
+			defer wg.Done()
+			var r result
+			err := c.Call(context.Background(), method, Args{"a"}, KWArgs{"b": true}, &r)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if r.Method != method || len(r.Args) != 1 || r.Args[0] != "a" || !r.KWArgs["b"] {
+				t.Errorf("%s: result = %+v", method, r)
+			}
+		}(method)
+	}
+	wg.Wait()
+}
+
+func TestClientCallError(t *testing.T) {
+	c, d := newTestClient(t)
+	go func() {
+		req := d.read()
+		d.send(int(rpcEvent), "TorrentAddedEvent", []interface{}{"abc", false})
+		d.send(int(rpcError), req.id, "BadLoginError", []interface{}{"Password does not match"}, map[string]interface{}{}, "Traceback")
+		req = d.read()
+		if len(req.args) != 0 || len(req.kwargs) != 0 {
+			t.Errorf("args = %v, kwargs = %v, want empty", req.args, req.kwargs)
+		}
+		d.reply(req.id, nil)
+	}()
+
+	err := c.Call(context.Background(), "daemon.login", Args{"user", "wrong"}, nil, nil)
+	if err == nil || err.Error() != "BadLoginError: Password does not match" {
+		t.Errorf("err = %v", err)
+	}
+	// the connection survives the exception
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientCallCanceled(t *testing.T) {
+	c, d := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	go func() {
+		late := d.read()
+		req := d.read()
+		d.reply(late.id, "late")
+		d.reply(req.id, "2.1.1")
+	}()
+
+	var info string
+	if err := c.Call(ctx, "daemon.info", nil, nil, &info); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info != "2.1.1" {
+		t.Errorf("info = %q, want 2.1.1", info)
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	c, d := newTestClient(t)
+	go func() {
+		d.read()
+		c.Close()
+	}()
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err != ErrClosed {
+		t.Errorf("pending call: err = %v, want %v", err, ErrClosed)
+	}
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err != ErrClosed {
+		t.Errorf("later call: err = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestRPCClientConcurrentCalls(t *testing.T) {
+	client, server := net.Pipe()
+	c := rpc.NewClientWithCodec(newDelugeCodec(client, newOptions(nil), nil))
+	defer c.Close()
+	d := &testDaemon{t: t, conn: newMessageConn(server, newOptions(nil))}
+	defer server.Close()
+	go func() {
+		first, second, third := d.read(), d.read(), d.read()
+		d.send(int(rpcError), second.id, "InvalidTorrentError", []interface{}{"no such torrent"}, map[string]interface{}{}, "Traceback")
+		d.reply(third.id, third.method)
+		d.reply(first.id, first.method)
+	}()
+
+	methods := []string{"core.get_session_state", "core.get_torrent_status", "daemon.info"}
+	calls := make([]*rpc.Call, len(methods))
+	for i, method := range methods {
+		var reply string
+		calls[i] = c.Go(method, []interface{}{}, &reply, nil)
+		// keeps the order of the requests
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i, call := range calls {
+		<-call.Done
+		if i == 1 {
+			if call.Error == nil || call.Error.Error() != "InvalidTorrentError: no such torrent" {
+				t.Errorf("%s: err = %v", call.ServiceMethod, call.Error)
+			}
+			continue
+		}
+		if call.Error != nil {
+			t.Errorf("%s: %v", call.ServiceMethod, call.Error)
+		} else if reply := *call.Reply.(*string); reply != call.ServiceMethod {
+			t.Errorf("%s: reply = %q", call.ServiceMethod, reply)
+		}
+	}
+}
+
+func TestClientCallBlockedWrite(t *testing.T) {
+	c, d := newTestClient(t)
+	// the daemon does not read yet, so the write blocks
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Call(ctx, "daemon.info", nil, nil, nil); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// nothing was written, so the connection is still usable
+	go func() {
+		req := d.read()
+		d.reply(req.id, "2.1.1")
+	}()
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientTeardownOnTimeout(t *testing.T) {
+	c, d := newTestClient(t, WithTeardownOnTimeout())
+	go func() {
+		// reads the requests and never replies
+		d.read()
+		d.read()
+	}()
+
+	pending := make(chan error, 1)
+	go func() {
+		pending <- c.Call(context.Background(), "core.get_session_state", nil, nil, nil)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Call(ctx, "daemon.info", nil, nil, nil); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := <-pending; err != ErrUnresponsive {
+		t.Errorf("pending call: err = %v, want %v", err, ErrUnresponsive)
+	}
+	if s := c.State(); s != Disconnected {
+		t.Errorf("state = %v, want %v", s, Disconnected)
+	}
+}
+
+func TestClientReadTimeout(t *testing.T) {
+	c, d := newTestClient(t, WithReadTimeout(50*time.Millisecond))
+	go func() {
+		// reads the request and never replies
+		d.read()
+	}()
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err != ErrUnresponsive {
+		t.Fatalf("err = %v, want %v", err, ErrUnresponsive)
+	}
+}
+
+func TestClientReadTimeoutIdle(t *testing.T) {
+	c, d := newTestClient(t, WithReadTimeout(20*time.Millisecond))
+	// an idle connection is not torn down
+	time.Sleep(100 * time.Millisecond)
+	go func() {
+		req := d.read()
+		d.reply(req.id, "2.1.1")
+	}()
+	var version string
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, &version); err != nil {
+		t.Fatal(err)
+	}
+	if version != "2.1.1" {
+		t.Errorf("version = %q, want %q", version, "2.1.1")
+	}
+}
+
+func TestClientWriteTimeout(t *testing.T) {
+	// the daemon never reads the request
+	c, _ := newTestClient(t, WithWriteTimeout(50*time.Millisecond))
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err != ErrUnresponsive {
+		t.Fatalf("err = %v, want %v", err, ErrUnresponsive)
+	}
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err != ErrUnresponsive {
+		t.Errorf("later call: err = %v, want %v", err, ErrUnresponsive)
+	}
+}
+
+func TestClientCallTypeMismatch(t *testing.T) {
+	c, d := newTestClient(t)
+	go func() {
+		for i := 0; i < 2; i++ {
+			req := d.read()
+			d.reply(req.id, map[string]interface{}{"name": "ubuntu.iso"})
+		}
+	}()
+
+	var mismatch []int
+	if err := c.Call(context.Background(), "core.get_torrent_status", nil, nil, &mismatch); err == nil {
+		t.Error("expected a decoding error")
+	}
+	// the connection survives the mismatch
+	var raw rencode.RawMessage
+	if err := c.Call(context.Background(), "core.get_torrent_status", nil, nil, &raw); err != nil {
+		t.Fatal(err)
+	}
+	var status map[string]string
+	if err := rencode.NewDecoder(bytes.NewReader(raw)).Decode(&status); err != nil || status["name"] != "ubuntu.iso" {
+		t.Errorf("status = %v, err = %v", status, err)
+	}
+}
+
+func TestMessageConnSequence(t *testing.T) {
+	for _, version := range []ProtocolVersion{ProtocolV1, ProtocolV2} {
+		client, server := net.Pipe()
+		o := newOptions([]Option{WithProtocolVersion(version)})
+		w, r := newMessageConn(client, o), newMessageConn(server, o)
+		values := []interface{}{"a", strings.Repeat("deluge", 10000), []interface{}{int64(1), "b"}, ""}
+		go func() {
+			defer client.Close()
+			for _, v := range values {
+				if err := w.writeMessage(v); err != nil {
+					t.Errorf("version %d: %v", version, err)
+					return
+				}
+			}
+		}()
+		// the decompressor and the buffers are reused from one message to the
+		// next
+		for i, want := range values {
+			body, err := r.readMessage()
+			if err != nil {
+				t.Fatalf("version %d, message %d: %v", version, i, err)
+			}
+			var got interface{}
+			if err := rencode.NewDecoder(bytes.NewReader(body)).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("version %d, message %d: got %.20v, want %.20v", version, i, got, want)
+			}
+		}
+		if _, err := r.readMessage(); err != io.EOF {
+			t.Errorf("version %d: err = %v, want %v", version, err, io.EOF)
+		}
+		server.Close()
+	}
+}
+
+func TestCompressionThreshold(t *testing.T) {
+	c := newMessageConn(nil, newOptions([]Option{WithCompressionThreshold(100)}))
+	small, err := c.encode([]interface{}{"daemon.info"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := c.encode([]interface{}{strings.Repeat("deluge", 100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the second byte of the zlib header holds the compression level
+	if small[1] != 0x01 {
+		t.Errorf("small message header = %x, want stored", small[:2])
+	}
+	if large[1] != 0x9c || len(large) > 100 {
+		t.Errorf("large message header = %x, length %d, want compressed", large[:2], len(large))
+	}
+	for _, msg := range [][]byte{small, large} {
+		zr, err := zlib.NewReader(bytes.NewReader(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(zr); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	c, d := newTestClient(t, WithMaxMessageSize(1000))
+	go func() {
+		// highly compressible, well below the bound once compressed
+		req := d.read()
+		d.reply(req.id, strings.Repeat("x", 100000))
+	}()
+	err := c.Call(context.Background(), "daemon.info", nil, nil, nil)
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("err = %v, want %v", err, ErrMessageTooLarge)
+	}
+	if c.State() != Disconnected {
+		t.Errorf("state = %v, want %v", c.State(), Disconnected)
+	}
+
+	// the length of a frame is checked before reading it
+	c, d = newTestClient(t, WithProtocolVersion(ProtocolV2), WithMaxMessageSize(1000))
+	go func() {
+		d.read()
+		d.conn.conn.Write([]byte{protocolV2Version, 0x10, 0, 0, 0})
+	}()
+	err = c.Call(context.Background(), "daemon.info", nil, nil, nil)
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("err = %v, want %v", err, ErrMessageTooLarge)
+	}
+}
@@ -0,0 +1,422 @@
+// Rencodegen generates MarshalRencode and UnmarshalRencode methods for
+// struct types, so they can be encoded and decoded without reflection.
+//
+// It is meant to be used with go generate:
+//
+//	//go:generate rencodegen -type=TorrentStatus
+//
+// Without -type, every struct type whose doc comment contains a
+// //rencodegen:generate line is processed. Fields follow the same rules as the
+// reflection based encoder: exported fields are encoded under the name given
+// by their rencode tag, or their Go name, "-" skips a field and the
+// omitempty option leaves empty fields out. Fields of basic types are handled
+// by the Encoder and Decoder primitives, any other type falls back to
+// Encode/Decode. Embedded fields are not supported.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const directive = "//rencodegen:generate"
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of type names; default to the annotated types")
+	output    = flag.String("output", "", "output file name; default <type>_rencode.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of rencodegen:\n")
+	fmt.Fprintf(os.Stderr, "\trencodegen [flags] [directory]\n")
+	fmt.Fprintf(os.Stderr, "Flags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("rencodegen: ")
+	flag.Usage = usage
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	var types []string
+	if *typeNames != "" {
+		types = strings.Split(*typeNames, ",")
+	}
+
+	files, err := parseDir(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	src, names, err := generate(files, types)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	outputName := *output
+	if outputName == "" {
+		outputName = filepath.Join(dir, strings.ToLower(names[0])+"_rencode.go")
+	}
+	if err := os.WriteFile(outputName, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseDir parses the non-test Go files of a directory
+func parseDir(dir string) ([]*ast.File, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") || strings.HasSuffix(path, "_rencode.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Go files in %s", dir)
+	}
+	return files, nil
+}
+
+// structType is a struct type declaration found in the package
+type structType struct {
+	name string
+	typ  *ast.StructType
+}
+
+// generate returns the formatted source of the methods for the requested
+// types, or for the annotated ones when types is empty, along with the names
+// of the processed types
+func generate(files []*ast.File, types []string) ([]byte, []string, error) {
+	var found []structType
+	wanted := make(map[string]bool)
+	for _, t := range types {
+		wanted[t] = true
+	}
+
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				st, ok := ts.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				if len(types) > 0 && !wanted[ts.Name.Name] {
+					continue
+				}
+				if len(types) == 0 && !annotated(gd.Doc) && !annotated(ts.Doc) {
+					continue
+				}
+				delete(wanted, ts.Name.Name)
+				found = append(found, structType{ts.Name.Name, st})
+			}
+		}
+	}
+	for name := range wanted {
+		return nil, nil, fmt.Errorf("struct type %s not found", name)
+	}
+	if len(found) == 0 {
+		return nil, nil, errors.New("no types to generate")
+	}
+
+	g := &generator{}
+	g.printf("// Code generated by rencodegen; DO NOT EDIT.\n\n")
+	g.printf("package %s\n\n", files[0].Name.Name)
+	g.printf("import \"github.com/rogaps/delugerpc/rencode\"\n")
+
+	var names []string
+	for _, st := range found {
+		if err := g.generateType(st); err != nil {
+			return nil, nil, err
+		}
+		names = append(names, st.name)
+	}
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, nil, fmt.Errorf("internal error: invalid generated code: %v", err)
+	}
+	return src, names, nil
+}
+
+func annotated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldKind is the way a field is encoded and decoded
+type fieldKind int
+
+const (
+	kindValue fieldKind = iota
+	kindString
+	kindBytes
+	kindBool
+	kindInt
+	kindUint
+	kindFloat32
+	kindFloat64
+)
+
+// genField is a struct field handled by the generated code
+type genField struct {
+	goName    string
+	key       string
+	typ       string
+	kind      fieldKind
+	bitSize   int
+	omitEmpty bool
+	emptyTest string
+}
+
+var basicKinds = map[string]struct {
+	kind    fieldKind
+	bitSize int
+}{
+	"string":  {kindString, 0},
+	"bool":    {kindBool, 0},
+	"int":     {kindInt, 0},
+	"int8":    {kindInt, 8},
+	"int16":   {kindInt, 16},
+	"int32":   {kindInt, 32},
+	"int64":   {kindInt, 64},
+	"uint":    {kindUint, 0},
+	"uint8":   {kindUint, 8},
+	"byte":    {kindUint, 8},
+	"uint16":  {kindUint, 16},
+	"uint32":  {kindUint, 32},
+	"uint64":  {kindUint, 64},
+	"float32": {kindFloat32, 32},
+	"float64": {kindFloat64, 64},
+}
+
+func fieldsOf(st structType) ([]genField, error) {
+	var fields []genField
+	for _, f := range st.typ.Fields.List {
+		if len(f.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded fields are not supported", st.name)
+		}
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			s, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(s)
+		}
+		tagValue := tag.Get("rencode")
+		if tagValue == "-" {
+			continue
+		}
+		parts := strings.Split(tagValue, ",")
+		omitEmpty := false
+		for _, o := range parts[1:] {
+			if o == "omitempty" {
+				omitEmpty = true
+			}
+		}
+
+		for _, name := range f.Names {
+			if !name.IsExported() {
+				continue
+			}
+			gf := genField{
+				goName:    name.Name,
+				key:       parts[0],
+				typ:       typeString(f.Type),
+				omitEmpty: omitEmpty,
+			}
+			if gf.key == "" {
+				gf.key = name.Name
+			}
+			gf.kind, gf.bitSize, gf.emptyTest = classify(f.Type, "v."+name.Name)
+			if omitEmpty && gf.emptyTest == "" {
+				return nil, fmt.Errorf("%s.%s: omitempty is not supported for type %s", st.name, name.Name, gf.typ)
+			}
+			fields = append(fields, gf)
+		}
+	}
+	// keys are sorted the same way the reflection based encoder sorts them
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].key < fields[j].key })
+	for i := 1; i < len(fields); i++ {
+		if fields[i].key == fields[i-1].key {
+			return nil, fmt.Errorf("%s: duplicate key %q", st.name, fields[i].key)
+		}
+	}
+	return fields, nil
+}
+
+// classify returns the kind of a field type and the expression testing the
+// field for emptiness, if one can be derived from the syntax alone
+func classify(expr ast.Expr, sel string) (fieldKind, int, string) {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if b, ok := basicKinds[t.Name]; ok {
+			switch b.kind {
+			case kindString:
+				return b.kind, b.bitSize, sel + ` == ""`
+			case kindBool:
+				return b.kind, b.bitSize, "!" + sel
+			}
+			return b.kind, b.bitSize, sel + " == 0"
+		}
+	case *ast.ArrayType:
+		if t.Len == nil {
+			if id, ok := t.Elt.(*ast.Ident); ok && (id.Name == "byte" || id.Name == "uint8") {
+				return kindBytes, 0, "len(" + sel + ") == 0"
+			}
+			return kindValue, 0, "len(" + sel + ") == 0"
+		}
+	case *ast.MapType:
+		return kindValue, 0, "len(" + sel + ") == 0"
+	case *ast.StarExpr, *ast.InterfaceType:
+		return kindValue, 0, sel + " == nil"
+	}
+	return kindValue, 0, ""
+}
+
+// typeString returns the source form of a type expression
+func typeString(expr ast.Expr) string {
+	var buf bytes.Buffer
+	format.Node(&buf, token.NewFileSet(), expr)
+	return buf.String()
+}
+
+type generator struct {
+	buf bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) generateType(st structType) error {
+	fields, err := fieldsOf(st)
+	if err != nil {
+		return err
+	}
+
+	g.printf("\n// MarshalRencode implements rencode.Marshaler\n")
+	g.printf("func (v %s) MarshalRencode(e *rencode.Encoder) error {\n", st.name)
+	g.printf("n := %d\n", len(fields))
+	for _, f := range fields {
+		if f.omitEmpty {
+			g.printf("if %s {\nn--\n}\n", f.emptyTest)
+		}
+	}
+	g.printf("if err := e.BeginDict(n); err != nil {\nreturn err\n}\n")
+	for _, f := range fields {
+		if f.omitEmpty {
+			g.printf("if !(%s) {\n", f.emptyTest)
+		}
+		g.printf("if err := e.EncodeString(%s); err != nil {\nreturn err\n}\n", strconv.Quote(f.key))
+		g.printf("if err := %s; err != nil {\nreturn err\n}\n", encodeCall(f))
+		if f.omitEmpty {
+			g.printf("}\n")
+		}
+	}
+	g.printf("return e.EndDict(n)\n}\n")
+
+	g.printf("\n// UnmarshalRencode implements rencode.Unmarshaler\n")
+	g.printf("func (v *%s) UnmarshalRencode(d *rencode.Decoder) error {\n", st.name)
+	g.printf("return d.DecodeDictFunc(func(d *rencode.Decoder, key string) error {\n")
+	g.printf("switch key {\n")
+	for _, f := range fields {
+		g.printf("case %s:\n", strconv.Quote(f.key))
+		g.decodeField(f)
+	}
+	g.printf("}\nreturn d.Skip()\n})\n}\n")
+	return nil
+}
+
+func encodeCall(f genField) string {
+	sel := "v." + f.goName
+	switch f.kind {
+	case kindString:
+		return "e.EncodeString(" + sel + ")"
+	case kindBytes:
+		return "e.EncodeBytes(" + sel + ")"
+	case kindBool:
+		return "e.EncodeBool(" + sel + ")"
+	case kindInt:
+		return "e.EncodeInt(int64(" + sel + "))"
+	case kindUint:
+		return "e.EncodeUint(uint64(" + sel + "))"
+	case kindFloat32:
+		return "e.EncodeFloat32(" + sel + ")"
+	case kindFloat64:
+		return "e.EncodeFloat64(" + sel + ")"
+	}
+	return "e.Encode(" + sel + ")"
+}
+
+func (g *generator) decodeField(f genField) {
+	sel := "v." + f.goName
+	var call string
+	switch f.kind {
+	case kindString:
+		call = "d.DecodeString()"
+	case kindBytes:
+		call = "d.DecodeBytes()"
+	case kindBool:
+		call = "d.DecodeBool()"
+	case kindInt:
+		call = fmt.Sprintf("d.DecodeInt(%d)", f.bitSize)
+	case kindUint:
+		call = fmt.Sprintf("d.DecodeUint(%d)", f.bitSize)
+	case kindFloat32:
+		call = "d.DecodeFloat(32)"
+	case kindFloat64:
+		call = "d.DecodeFloat(64)"
+	default:
+		g.printf("return d.Decode(&%s)\n", sel)
+		return
+	}
+	g.printf("x, err := %s\nif err != nil {\nreturn err\n}\n", call)
+	switch f.kind {
+	case kindString, kindBytes, kindBool:
+		g.printf("%s = x\n", sel)
+	default:
+		g.printf("%s = %s(x)\n", sel, f.typ)
+	}
+	g.printf("return nil\n")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	files, err := parseDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, names, err := generate(files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "TorrentStatus" {
+		t.Fatalf("unexpected types %v", names)
+	}
+
+	golden := filepath.Join("testdata", "torrentstatus_rencode.go.golden")
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, expected) {
+		t.Fatalf("generated code does not match %s:\n%s", golden, src)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		src   string
+		types []string
+	}{
+		{"package p\ntype T struct{ U }\ntype U struct{ A int }", []string{"T"}},
+		{"package p\ntype T struct{ A, B int `rencode:\"a\"` }", []string{"T"}},
+		{"package p\ntype T struct{ A struct{} `rencode:\",omitempty\"` }", []string{"T"}},
+		{"package p\ntype T struct{ A int }", []string{"Missing"}},
+		{"package p\ntype T struct{ A int }", nil},
+	}
+	for _, test := range tests {
+		f, err := parser.ParseFile(token.NewFileSet(), "p.go", test.src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := generate([]*ast.File{f}, test.types); err == nil {
+			t.Fatalf("expected an error for %q", test.src)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package testdata
+
+import "math/big"
+
+// TorrentStatus holds a subset of the torrent status keys
+//
+//rencodegen:generate
+type TorrentStatus struct {
+	Name          string            `rencode:"name"`
+	Progress      float32           `rencode:"progress"`
+	TotalSize     int64             `rencode:"total_size"`
+	NumPeers      int               `rencode:"num_peers"`
+	Ratio         float64           `rencode:"ratio"`
+	Paused        bool              `rencode:"paused"`
+	Label         string            `rencode:"label,omitempty"`
+	Hash          []byte            `rencode:"hash"`
+	Priority      uint8             `rencode:"priority"`
+	FilePriority  []int             `rencode:"file_priorities"`
+	Trackers      map[string]string `rencode:"trackers,omitempty"`
+	Downloaded    *big.Int          `rencode:"all_time_download"`
+	Ignored       string            `rencode:"-"`
+	Untagged      string
+	internalState int
+}
+
+type notAnnotated struct {
+	Name string
+}
@@ -0,0 +1,96 @@
+package delugerpc
+
+import (
+	"context"
+
+	"github.com/rogaps/delugerpc/rencode"
+)
+
+// WithCoalescing makes the concurrent calls of one of methods with the same
+// arguments share one request, such as the core.get_torrents_status calls of
+// the many viewers of a dashboard. Each call still decodes the response into
+// its own result. Only methods without side effects should be coalesced.
+func WithCoalescing(methods ...string) Option {
+	return func(o *options) {
+		if o.coalesced == nil {
+			o.coalesced = make(map[string]bool)
+		}
+		for _, method := range methods {
+			o.coalesced[method] = true
+		}
+	}
+}
+
+// flight is a request shared by concurrent calls
+type flight struct {
+	done chan struct{}
+	msg  *message
+	err  error
+	// waiters counts the calls waiting for the response, the request being
+	// given up on when they all are
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// coalesce is like roundTrip, but shares the request with the calls in
+// progress with the same method and arguments
+func (c *Client) coalesce(ctx context.Context, method string, args Args, kwargs KWArgs) (*message, error) {
+	if args == nil {
+		args = Args{}
+	}
+	if kwargs == nil {
+		kwargs = KWArgs{}
+	}
+	key, err := rencode.Append([]byte(method), []interface{}{args, kwargs})
+	if err != nil {
+		return nil, err
+	}
+
+	c.flightsMu.Lock()
+	f, ok := c.flights[string(key)]
+	if !ok {
+		fctx, cancel := context.WithCancel(context.Background())
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		c.flights[string(key)] = f
+		go func() {
+			f.msg, f.err = c.roundTrip(fctx, method, args, kwargs)
+			c.endFlight(string(key), f)
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	c.flightsMu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.msg, f.err
+	case <-ctx.Done():
+		c.flightsMu.Lock()
+		f.waiters--
+		last := f.waiters == 0
+		if last {
+			c.removeFlight(string(key), f)
+		}
+		c.flightsMu.Unlock()
+		if last {
+			f.cancel()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// endFlight removes f once its request is done
+func (c *Client) endFlight(key string, f *flight) {
+	c.flightsMu.Lock()
+	c.removeFlight(key, f)
+	c.flightsMu.Unlock()
+	f.cancel()
+}
+
+// removeFlight removes f, so that the next calls make a new request.
+// c.flightsMu must be held.
+func (c *Client) removeFlight(key string, f *flight) {
+	if c.flights[key] == f {
+		delete(c.flights, key)
+	}
+}
@@ -0,0 +1,75 @@
+package delugerpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientCoalescing(t *testing.T) {
+	c, d := newTestClient(t, WithCoalescing("core.get_torrents_status"))
+	requests := make(chan testRequest, 10)
+	go func() {
+		for i := 0; i < 2; i++ {
+			req := d.read()
+			requests <- req
+			// holds the response back for the other calls to join
+			time.Sleep(50 * time.Millisecond)
+			d.reply(req.id, map[string]interface{}{"abc": map[string]interface{}{"name": "ubuntu.iso"}})
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var status map[string]map[string]string
+			err := c.Call(context.Background(), "core.get_torrents_status", Args{KWArgs{}, []string{"name"}}, nil, &status)
+			if err != nil {
+				t.Error(err)
+			} else if status["abc"]["name"] != "ubuntu.iso" {
+				t.Errorf("status = %v", status)
+			}
+		}()
+	}
+	wg.Wait()
+	// a call made after the response makes a new request
+	if err := c.Call(context.Background(), "core.get_torrents_status", Args{KWArgs{}, []string{"name"}}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(requests); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+}
+
+func TestClientCoalescingCanceled(t *testing.T) {
+	c, d := newTestClient(t, WithCoalescing("daemon.info"))
+	go func() {
+		req := d.read()
+		time.Sleep(50 * time.Millisecond)
+		d.reply(req.id, "2.1.1")
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		first <- c.Call(ctx, "daemon.info", nil, nil, nil)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	// the call canceled leaves the request to the other
+	var version string
+	second := make(chan error, 1)
+	go func() {
+		second <- c.Call(context.Background(), "daemon.info", nil, nil, &version)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Errorf("first call: err = %v, want %v", err, context.Canceled)
+	}
+	if err := <-second; err != nil || version != "2.1.1" {
+		t.Errorf("second call: version = %q, err = %v", version, err)
+	}
+}
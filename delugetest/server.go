@@ -0,0 +1,287 @@
+// Package delugetest provides a mock Deluge daemon, speaking the protocol of
+// the real one over the loopback interface, for the integration tests of
+// delugerpc clients:
+//
+//	s := delugetest.NewServer()
+//	defer s.Close()
+//	s.Handle("core.get_free_space", func(args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+//		return 1 << 30, nil
+//	})
+//	c, err := delugerpc.DialClient(ctx, s.Addr, s.Options()...)
+package delugetest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rogaps/delugerpc"
+)
+
+// Handler handles the calls of a method, returning its return value or the
+// exception it raises. An error other than a *delugerpc.RPCError is raised
+// as a WrappedException of an Exception holding its message.
+type Handler func(args []interface{}, kwargs map[string]interface{}) (interface{}, error)
+
+// Call is a call received by a Server
+type Call struct {
+	Method string
+	Args   []interface{}
+	KWArgs map[string]interface{}
+}
+
+// Server is a mock daemon. Without a handler, daemon.login succeeds with
+// delugerpc.AuthLevelAdmin, daemon.info returns "2.0.0", and
+// daemon.set_event_interest registers the interest of the connection; the
+// other methods raise the exception of the methods unknown to the daemon.
+type Server struct {
+	// Addr is the address of the server, as host:port
+	Addr string
+	// Version is the framing spoken with the clients, ProtocolV2 by default
+	Version delugerpc.ProtocolVersion
+	// Plain disables TLS
+	Plain bool
+	// TLS is the configuration of TLS, with a self-signed certificate by
+	// default
+	TLS *tls.Config
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+	conns    map[*conn]struct{}
+	calls    []Call
+	closed   bool
+}
+
+// NewServer returns a started server speaking Deluge 2.x over TLS
+func NewServer() *Server {
+	s := NewUnstartedServer()
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a server to be configured, then started by
+// Start
+func NewUnstartedServer() *Server {
+	return &Server{
+		Version:  delugerpc.ProtocolV2,
+		handlers: make(map[string]Handler),
+		conns:    make(map[*conn]struct{}),
+	}
+}
+
+// Start starts serving on a port of the loopback interface
+func (s *Server) Start() {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("delugetest: listening: %v", err))
+	}
+	if !s.Plain {
+		if s.TLS == nil {
+			s.TLS = &tls.Config{Certificates: []tls.Certificate{selfSigned()}}
+		}
+		l = tls.NewListener(l, s.TLS)
+	}
+	s.listener = l
+	s.Addr = l.Addr().String()
+	s.wg.Add(1)
+	go s.serve()
+}
+
+// Options returns the options connecting to the server, to be given to
+// delugerpc.DialClient along with Addr
+func (s *Server) Options() []delugerpc.Option {
+	opts := []delugerpc.Option{delugerpc.WithProtocolVersion(s.Version)}
+	if s.Plain {
+		opts = append(opts, delugerpc.WithoutTLS())
+	}
+	return opts
+}
+
+// Handle sets the handler of method, replacing the previous one
+func (s *Server) Handle(method string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = h
+}
+
+// Calls returns the calls received, in order
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// Emit pushes the event name with args to the clients interested in it
+func (s *Server) Emit(name string, args ...interface{}) {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		if c.interested(name) {
+			c.WriteEvent(name, args...)
+		}
+	}
+}
+
+// Close stops the server, closing its connections, and waits for them
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{
+			ServerCodec: delugerpc.NewServerCodec(nc, delugerpc.WithProtocolVersion(s.Version)),
+			s:           s,
+			interest:    make(map[string]bool),
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go c.serve()
+	}
+}
+
+// conn is a connection of a client
+type conn struct {
+	*delugerpc.ServerCodec
+	s *Server
+
+	mu       sync.Mutex
+	interest map[string]bool
+}
+
+func (c *conn) serve() {
+	defer c.s.wg.Done()
+	defer func() {
+		c.s.mu.Lock()
+		delete(c.s.conns, c)
+		c.s.mu.Unlock()
+		c.Close()
+	}()
+	for {
+		reqs, err := c.ReadRequests()
+		if err != nil {
+			return
+		}
+		for _, req := range reqs {
+			call := Call{Method: req.Method, Args: req.Args, KWArgs: req.KWArgs}
+			result, err := c.handle(call)
+			if err != nil {
+				err = c.WriteError(req.ID, err)
+			} else {
+				err = c.WriteResponse(req.ID, result)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handle returns the return value of call, or the exception it raises
+func (c *conn) handle(call Call) (interface{}, error) {
+	c.s.mu.Lock()
+	c.s.calls = append(c.s.calls, call)
+	h := c.s.handlers[call.Method]
+	c.s.mu.Unlock()
+	if h == nil {
+		h = c.builtin(call.Method)
+	}
+	if h == nil {
+		return nil, &delugerpc.RPCError{
+			Type: "WrappedException",
+			Args: []interface{}{"RPC call on invalid function: " + call.Method, "AttributeError", ""},
+		}
+	}
+	return h(call.Args, call.KWArgs)
+}
+
+// builtin returns the default handler of method
+func (c *conn) builtin(method string) Handler {
+	switch method {
+	case "daemon.login":
+		return func([]interface{}, map[string]interface{}) (interface{}, error) {
+			return delugerpc.AuthLevelAdmin, nil
+		}
+	case "daemon.info":
+		return func([]interface{}, map[string]interface{}) (interface{}, error) {
+			return "2.0.0", nil
+		}
+	case "daemon.set_event_interest":
+		return func(args []interface{}, _ map[string]interface{}) (interface{}, error) {
+			var names []interface{}
+			if len(args) > 0 {
+				names, _ = args[0].([]interface{})
+			}
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			for _, name := range names {
+				c.interest[fmt.Sprint(name)] = true
+			}
+			return true, nil
+		}
+	}
+	return nil
+}
+
+func (c *conn) interested(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.interest[name]
+}
+
+// selfSigned returns a self-signed certificate for the loopback interface
+func selfSigned() tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("delugetest: generating key: %v", err))
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "delugetest"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:     []string{"localhost"},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(fmt.Sprintf("delugetest: creating certificate: %v", err))
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,106 @@
+package delugetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rogaps/delugerpc"
+)
+
+func TestServer(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Handle("core.get_free_space", func(args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+		return 1 << 30, nil
+	})
+	s.Handle("core.remove_torrent", func(args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+		return nil, &delugerpc.RPCError{Type: "InvalidTorrentError", Args: []interface{}{"torrent_id not in session"}}
+	})
+	s.Handle("core.pause_torrent", func(args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+		return nil, errors.New("disk full")
+	})
+
+	ctx := context.Background()
+	c, err := delugerpc.DialClient(ctx, s.Addr, s.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if level, err := c.Login(ctx, "localclient", "secret"); err != nil || level != delugerpc.AuthLevelAdmin {
+		t.Errorf("daemon.login = %d, %v", level, err)
+	}
+	var space int64
+	if err := c.Call(ctx, "core.get_free_space", nil, nil, &space); err != nil || space != 1<<30 {
+		t.Errorf("core.get_free_space = %d, %v", space, err)
+	}
+
+	var rpcErr *delugerpc.RPCError
+	err = c.Call(ctx, "core.remove_torrent", delugerpc.Args{"abc", false}, nil, nil)
+	if !errors.As(err, &rpcErr) || rpcErr.Type != "InvalidTorrentError" {
+		t.Errorf("got %v, want an InvalidTorrentError", err)
+	}
+	err = c.Call(ctx, "core.pause_torrent", delugerpc.Args{"abc"}, nil, nil)
+	var wrapped *delugerpc.WrappedException
+	if !errors.As(err, &wrapped) || wrapped.ExceptionType != "Exception" || wrapped.Message != "disk full" {
+		t.Errorf("got %v, want a wrapped Exception", err)
+	}
+	var unknown *delugerpc.UnknownMethodError
+	if err := c.Call(ctx, "core.no_such_method", nil, nil, nil); !errors.As(err, &unknown) {
+		t.Errorf("got %v, want an UnknownMethodError", err)
+	}
+
+	calls := s.Calls()
+	if len(calls) != 5 || calls[2].Method != "core.remove_torrent" || calls[2].Args[0] != "abc" {
+		t.Errorf("got calls %+v", calls)
+	}
+}
+
+func TestServerEvents(t *testing.T) {
+	s := NewUnstartedServer()
+	s.Version = delugerpc.ProtocolV1
+	s.Plain = true
+	s.Start()
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := delugerpc.DialClient(ctx, s.Addr, s.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	events, err := c.SubscribeEvents(ctx, "TorrentAddedEvent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the events the client is interested in are pushed
+	s.Emit("TorrentRemovedEvent", "abc")
+	s.Emit("TorrentAddedEvent", "abc", false)
+	select {
+	case e := <-events:
+		if e.Name != "TorrentAddedEvent" || len(e.Args) != 2 || e.Args[0] != "abc" {
+			t.Errorf("got event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event not received")
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	s := NewServer()
+	c, err := delugerpc.DialClient(context.Background(), s.Addr, s.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err == nil {
+		t.Error("call succeeded after Close")
+	}
+}
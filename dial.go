@@ -0,0 +1,394 @@
+package delugerpc
+
+import (
+	"compress/zlib"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// The default timeouts of the connection to the daemon
+const (
+	DefaultDialTimeout      = 30 * time.Second
+	DefaultHandshakeTimeout = 10 * time.Second
+)
+
+// Option configures the connection made by Dial, DialContext and DialClient
+type Option func(*options)
+
+type options struct {
+	version          ProtocolVersion
+	dialTimeout      time.Duration
+	handshakeTimeout time.Duration
+	compressionLevel int
+	tlsConfig        *tls.Config
+	clientCerts      []tls.Certificate
+	clientCertFiles  [][2]string
+	plain            bool
+	dialer           ContextDialer
+	proxy            func(forward ContextDialer) ContextDialer
+	eventHandlers    []EventHandler
+
+	eventQueueSize    int
+	eventDropPolicy   EventDropPolicy
+	eventBlockTimeout time.Duration
+	writeQueueSize    int
+
+	teardownOnTimeout bool
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	keepalive         time.Duration
+	reconnectMin      time.Duration
+	reconnectMax      time.Duration
+	logger            Logger
+	dumpMessages      bool
+	wireDump          io.Writer
+	recorder          *Recorder
+	localAuth         bool
+	authLevelCheck    bool
+	daemonVersion     bool
+	metrics           Metrics
+	breaker           *CircuitBreaker
+	rateLimit         *rateLimit
+	methodRateLimits  map[string]rateLimit
+	coalesced         map[string]bool
+	cache             map[string]cachePolicy
+	notifyErrors      func(method string, err error)
+
+	compressionThreshold int
+	serializer           Serializer
+	maxMessageSize       int64
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		version:          ProtocolV1,
+		dialTimeout:      DefaultDialTimeout,
+		handshakeTimeout: DefaultHandshakeTimeout,
+		compressionLevel: zlib.DefaultCompression,
+		serializer:       Rencode,
+		eventQueueSize:   DefaultEventQueueSize,
+		writeQueueSize:   DefaultWriteQueueSize,
+		maxMessageSize:   DefaultMaxMessageSize,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithDialTimeout bounds the time spent connecting to the daemon, including
+// the negotiation with a proxy, zero meaning no limit other than the
+// context's. Defaults to DefaultDialTimeout.
+func WithDialTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = d
+	}
+}
+
+// WithHandshakeTimeout bounds the time spent in the TLS handshake, zero
+// meaning no limit other than the context's. Defaults to
+// DefaultHandshakeTimeout.
+func WithHandshakeTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.handshakeTimeout = d
+	}
+}
+
+// WithProtocolVersion selects the framing spoken with the daemon. Deluge 2.x
+// daemons only accept ProtocolV2. Defaults to ProtocolV1.
+func WithProtocolVersion(v ProtocolVersion) Option {
+	return func(o *options) {
+		o.version = v
+	}
+}
+
+// WithCompressionLevel sets the zlib compression level of the requests, from
+// zlib.HuffmanOnly to zlib.BestCompression. Defaults to
+// zlib.DefaultCompression.
+func WithCompressionLevel(level int) Option {
+	return func(o *options) {
+		o.compressionLevel = level
+	}
+}
+
+// WithCompressionThreshold stores the requests whose encoded size is below
+// n bytes in zlib streams without compression, which the daemon decompresses
+// like the others, saving the CPU spent compressing the small requests of
+// frequent pollers. Defaults to 0, compressing every request.
+func WithCompressionThreshold(n int) Option {
+	return func(o *options) {
+		o.compressionThreshold = n
+	}
+}
+
+// WithMaxMessageSize bounds the size of the messages received, both as
+// announced by the header of a Deluge 2.x frame and once decompressed, so
+// that a small message cannot exhaust the memory. A larger message fails
+// with ErrMessageTooLarge and tears the connection down. Defaults to
+// DefaultMaxMessageSize.
+func WithMaxMessageSize(n int64) Option {
+	return func(o *options) {
+		o.maxMessageSize = n
+	}
+}
+
+// WithTLSConfig sets the TLS configuration of the connection. An empty
+// ServerName is filled with the host of the dialed address. Without this
+// option, the certificate of the daemon, which is self-signed by default, is
+// not verified.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = config
+	}
+}
+
+// WithClientCertificate presents cert to daemons requiring client
+// certificates. It adds to the certificates of the TLS configuration.
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(o *options) {
+		o.clientCerts = append(o.clientCerts, cert)
+	}
+}
+
+// WithClientCertificateFile is like WithClientCertificate, but loads the
+// PEM-encoded certificate and key from files when dialing
+func WithClientCertificateFile(certFile, keyFile string) Option {
+	return func(o *options) {
+		o.clientCertFiles = append(o.clientCertFiles, [2]string{certFile, keyFile})
+	}
+}
+
+// ContextDialer connects to an address, giving up when the context is done.
+// *net.Dialer implements it.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// WithDialer makes the connections with d, to route them through transports
+// such as SSH tunnels or VPN libraries. Proxies are reached through d, and
+// TLS is still layered on top of the returned connections.
+func WithDialer(d ContextDialer) Option {
+	return func(o *options) {
+		o.dialer = d
+	}
+}
+
+// WithTeardownOnTimeout closes the connection when the context of a call
+// expires while nothing was received from the daemon since the call was
+// made. The other pending calls then fail with ErrUnresponsive instead of
+// waiting on a hung daemon.
+func WithTeardownOnTimeout() Option {
+	return func(o *options) {
+		o.teardownOnTimeout = true
+	}
+}
+
+// WithReadTimeout bounds the time the daemon may stay silent while calls are
+// pending, and the time spent reading each message once it starts, zero
+// meaning no limit. An idle connection is not bounded, so a half-open
+// connection is detected by the next call. The connection is then torn down
+// and the pending calls fail with ErrUnresponsive.
+func WithReadTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.readTimeout = d
+	}
+}
+
+// WithWriteTimeout bounds the time spent writing each message, zero meaning
+// no limit. The connection is then torn down and the pending calls fail with
+// ErrUnresponsive.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.writeTimeout = d
+	}
+}
+
+// WithoutTLS talks to the daemon over the bare connection, for daemons
+// reached through a tunnel that already provides TLS, such as stunnel. The
+// TLS options are ignored.
+func WithoutTLS() Option {
+	return func(o *options) {
+		o.plain = true
+	}
+}
+
+// clientTLSConfig returns the TLS configuration used to connect to address
+func (o *options) clientTLSConfig(network, address string) (*tls.Config, error) {
+	var config *tls.Config
+	if o.tlsConfig != nil {
+		config = o.tlsConfig.Clone()
+	} else {
+		config = &tls.Config{InsecureSkipVerify: true}
+	}
+	if config.ServerName == "" && !isUnixNetwork(network) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+		}
+		config.ServerName = host
+	}
+	// copies the certificates, which Clone shares with the given config
+	config.Certificates = append(append([]tls.Certificate(nil), config.Certificates...), o.clientCerts...)
+	for _, files := range o.clientCertFiles {
+		cert, err := tls.LoadX509KeyPair(files[0], files[1])
+		if err != nil {
+			return nil, fmt.Errorf("delugerpc: loading client certificate: %w", err)
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+	return config, nil
+}
+
+func (o *options) validate() error {
+	if o.version != ProtocolV1 && o.version != ProtocolV2 {
+		return fmt.Errorf("delugerpc: unsupported protocol version %d", o.version)
+	}
+	if o.eventQueueSize < 1 {
+		return fmt.Errorf("delugerpc: invalid event queue size %d", o.eventQueueSize)
+	}
+	if o.writeQueueSize < 0 {
+		return fmt.Errorf("delugerpc: invalid write queue size %d", o.writeQueueSize)
+	}
+	if o.eventDropPolicy < DropOldest || o.eventDropPolicy > BlockWithTimeout {
+		return fmt.Errorf("delugerpc: unknown event drop policy %d", o.eventDropPolicy)
+	}
+	if o.readTimeout < 0 {
+		return fmt.Errorf("delugerpc: invalid read timeout %v", o.readTimeout)
+	}
+	if o.keepalive < 0 {
+		return fmt.Errorf("delugerpc: invalid keepalive interval %v", o.keepalive)
+	}
+	if o.reconnectMin < 0 || o.reconnectMin > 0 && o.reconnectMax < o.reconnectMin {
+		return fmt.Errorf("delugerpc: invalid reconnect delays %v and %v", o.reconnectMin, o.reconnectMax)
+	}
+	if o.writeTimeout < 0 {
+		return fmt.Errorf("delugerpc: invalid write timeout %v", o.writeTimeout)
+	}
+	if o.rateLimit != nil {
+		if err := o.rateLimit.validate(); err != nil {
+			return err
+		}
+	}
+	for method, limit := range o.methodRateLimits {
+		if err := limit.validate(); err != nil {
+			return fmt.Errorf("%w for %s", err, method)
+		}
+	}
+	if o.compressionLevel < zlib.HuffmanOnly || o.compressionLevel > zlib.BestCompression {
+		return fmt.Errorf("delugerpc: invalid compression level %d", o.compressionLevel)
+	}
+	if o.compressionThreshold < 0 {
+		return fmt.Errorf("delugerpc: invalid compression threshold %d", o.compressionThreshold)
+	}
+	if o.maxMessageSize < 1 {
+		return fmt.Errorf("delugerpc: invalid maximum message size %d", o.maxMessageSize)
+	}
+	return nil
+}
+
+// DefaultPort is the port deluged listens on by default
+const DefaultPort = "58846"
+
+// splitAddress returns the network and the address given to Dial
+func splitAddress(addr string) (network, address string) {
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		return "unix", strings.TrimPrefix(strings.TrimPrefix(addr, "unix:"), "//")
+	case strings.HasPrefix(addr, "/"):
+		return "unix", addr
+	}
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return "tcp", addr
+	}
+	// no port, or an IPv6 literal without brackets
+	host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	return "tcp", net.JoinHostPort(host, DefaultPort)
+}
+
+func isUnixNetwork(network string) bool {
+	return network == "unix" || network == "unixpacket"
+}
+
+// dial connects to the daemon and completes the TLS handshake, unless TLS is
+// disabled
+func (o *options) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := o.breaker.allow(); err != nil {
+		return nil, err
+	}
+	conn, err := o.dialConn(ctx, network, address)
+	switch {
+	case err == nil:
+		o.breaker.success()
+	case ctx.Err() == context.Canceled:
+		o.breaker.release()
+	default:
+		o.breaker.failure()
+	}
+	return conn, err
+}
+
+// setup fetches the version of the daemon when WithDaemonVersion is set,
+// and logs in with the local credentials when WithLocalAuth is set, closing
+// the client on failure
+func (o *options) setup(ctx context.Context, c *Client) error {
+	var err error
+	if o.daemonVersion {
+		_, err = c.DaemonVersion(ctx)
+	}
+	if err == nil && o.localAuth {
+		var e AuthEntry
+		if e, err = localCredentials(); err == nil {
+			_, err = c.Login(ctx, e.Username, e.Password)
+		}
+	}
+	if err != nil {
+		c.Close()
+		return err
+	}
+	return nil
+}
+
+// dialConn connects to the daemon and completes the TLS handshake
+func (o *options) dialConn(ctx context.Context, network, address string) (net.Conn, error) {
+	var tlsConfig *tls.Config
+	if !o.plain {
+		var err error
+		if tlsConfig, err = o.clientTLSConfig(network, address); err != nil {
+			return nil, err
+		}
+	}
+	dialer := o.dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	if o.proxy != nil {
+		dialer = o.proxy(dialer)
+	}
+	dialCtx := ctx
+	if o.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		dialCtx, cancel = context.WithTimeout(ctx, o.dialTimeout)
+		defer cancel()
+	}
+	conn, err := dialer.DialContext(dialCtx, network, address)
+	if err != nil || o.plain {
+		return conn, err
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	if o.handshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.handshakeTimeout)
+		defer cancel()
+	}
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
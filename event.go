@@ -0,0 +1,280 @@
+package delugerpc
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultEventQueueSize is the default number of events waiting for their
+// handlers
+const DefaultEventQueueSize = 64
+
+// EventDropPolicy selects what happens to the events arriving while the event
+// queue is full, because the handlers are slower than the daemon
+type EventDropPolicy int
+
+const (
+	// DropOldest drops the oldest queued event to make room for the new one
+	DropOldest EventDropPolicy = iota
+	// DropNewest drops the new event
+	DropNewest
+	// BlockWithTimeout waits for room in the queue, holding the responses
+	// to the calls back, and drops the new event once the timeout expires
+	BlockWithTimeout
+)
+
+// WithEventQueue sets the size of the queue of the events waiting for their
+// handlers and the policy applied when it is full. The timeout only applies
+// to BlockWithTimeout, zero meaning to wait forever. Defaults to
+// DefaultEventQueueSize and DropOldest, so that slow handlers never delay the
+// responses to the calls.
+func WithEventQueue(size int, policy EventDropPolicy, timeout time.Duration) Option {
+	return func(o *options) {
+		o.eventQueueSize = size
+		o.eventDropPolicy = policy
+		o.eventBlockTimeout = timeout
+	}
+}
+
+// DroppedEvents returns the number of events dropped because the event queue
+// was full
+func (c *Client) DroppedEvents() uint64 {
+	return atomic.LoadUint64(&c.droppedEvents)
+}
+
+// Event is an event pushed by the daemon, such as TorrentAddedEvent, to the
+// clients interested in it
+type Event struct {
+	Name string
+	Args []interface{}
+}
+
+// EventHandler handles the events pushed by the daemon
+type EventHandler func(Event)
+
+// eventHandler is a registered EventHandler
+type eventHandler struct {
+	id int
+	// name is the name of the handled events, empty for all events
+	name string
+	h    EventHandler
+}
+
+// WithEventHandler registers h for all the events pushed by the daemon, from
+// the start of the connection. The handlers of a client are called one event
+// at a time, in the order the events arrive.
+func WithEventHandler(h EventHandler) Option {
+	return func(o *options) {
+		o.eventHandlers = append(o.eventHandlers, h)
+	}
+}
+
+// OnEvent registers h for the events called name, or for all events when
+// name is empty, until the returned function is called. Handlers run on the
+// event dispatch loop of the client: while one runs, the next events wait,
+// and the events queued past the size of the queue are dropped according to
+// its policy. See WithEventQueue.
+func (c *Client) OnEvent(name string, h EventHandler) (cancel func()) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+	id := c.nextHandler
+	c.nextHandler++
+	c.handlers = append(c.handlers, eventHandler{id: id, name: name, h: h})
+	return func() {
+		c.handlersMu.Lock()
+		defer c.handlersMu.Unlock()
+		for i, eh := range c.handlers {
+			if eh.id == id {
+				c.handlers = append(c.handlers[:i:i], c.handlers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// NotifyEvents sends the events called by one of names, or all events when
+// no name is given, to ch until the returned function is called. The
+// dispatch loop waits for ch to accept each event.
+func (c *Client) NotifyEvents(ch chan<- Event, names ...string) (cancel func()) {
+	if len(names) == 0 {
+		return c.OnEvent("", func(e Event) { ch <- e })
+	}
+	cancels := make([]func(), len(names))
+	for i, name := range names {
+		cancels[i] = c.OnEvent(name, func(e Event) { ch <- e })
+	}
+	return func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}
+}
+
+// queueEvent decodes the arguments of an event and queues it for dispatch.
+// Events whose arguments are malformed are dropped.
+func (c *Client) queueEvent(msg *message) {
+	var args []interface{}
+	if err := c.serializer.Unmarshal(msg.payload, &args); err != nil {
+		return
+	}
+	e := Event{Name: msg.event, Args: args}
+	select {
+	case c.events <- e:
+		return
+	default:
+	}
+
+	switch c.eventDropPolicy {
+	case DropOldest:
+		for {
+			select {
+			case c.events <- e:
+				return
+			default:
+			}
+			select {
+			case old := <-c.events:
+				atomic.AddUint64(&c.droppedEvents, 1)
+				c.log(LogWarn, "event dropped", LogField{"event", old.Name})
+			default:
+			}
+		}
+	case BlockWithTimeout:
+		if c.eventBlockTimeout <= 0 {
+			c.events <- e
+			return
+		}
+		timer := time.NewTimer(c.eventBlockTimeout)
+		defer timer.Stop()
+		select {
+		case c.events <- e:
+			return
+		case <-timer.C:
+		}
+	}
+	atomic.AddUint64(&c.droppedEvents, 1)
+	c.log(LogWarn, "event dropped", LogField{"event", e.Name})
+}
+
+// dispatchEvents calls the handlers of the queued events until the queue is
+// closed
+func (c *Client) dispatchEvents() {
+	for e := range c.events {
+		c.handlersMu.Lock()
+		handlers := c.handlers
+		c.handlersMu.Unlock()
+		for _, eh := range handlers {
+			if eh.name == "" || eh.name == e.Name {
+				eh.h(e)
+			}
+		}
+	}
+}
+
+// SubscribeEvents asks the daemon to push the events called by one of names
+// and returns a channel receiving them, which is closed once ctx is done or
+// the client shuts down. Subscribers are independent: each receives all its
+// events, and a slow subscriber holds the dispatch of the events back. The
+// daemon cannot forget an interest, so events nobody subscribes to anymore
+// are dropped by the client.
+func (c *Client) SubscribeEvents(ctx context.Context, names ...string) (<-chan Event, error) {
+	if len(names) == 0 {
+		return nil, errors.New("delugerpc: no event to subscribe to")
+	}
+	if err := c.addEventInterest(ctx, names); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Event, DefaultEventQueueSize)
+	// done is closed once the subscription ends, and ch once the sends in
+	// progress gave up
+	done := make(chan struct{})
+	var mu sync.Mutex
+	var sends sync.WaitGroup
+	closed := false
+	cancels := make([]func(), len(names))
+	for i, name := range names {
+		cancels[i] = c.OnEvent(name, func(e Event) {
+			mu.Lock()
+			if closed {
+				mu.Unlock()
+				return
+			}
+			sends.Add(1)
+			mu.Unlock()
+			defer sends.Done()
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+			case <-c.shut:
+			case <-done:
+			}
+		})
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.shut:
+		}
+		close(done)
+		for _, cancel := range cancels {
+			cancel()
+		}
+		c.removeEventInterest(names)
+		mu.Lock()
+		closed = true
+		mu.Unlock()
+		sends.Wait()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// addEventInterest sends the names not in the interest set of the client to
+// the daemon, and adds them to the set
+func (c *Client) addEventInterest(ctx context.Context, names []string) error {
+	c.interestMu.Lock()
+	defer c.interestMu.Unlock()
+	var added []string
+	for _, name := range names {
+		if c.interest[name] == 0 {
+			added = append(added, name)
+		}
+	}
+	if len(added) > 0 {
+		if err := c.Call(ctx, "daemon.set_event_interest", Args{added}, nil, nil); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		c.interest[name]++
+	}
+	return nil
+}
+
+func (c *Client) removeEventInterest(names []string) {
+	c.interestMu.Lock()
+	defer c.interestMu.Unlock()
+	for _, name := range names {
+		if c.interest[name]--; c.interest[name] <= 0 {
+			delete(c.interest, name)
+		}
+	}
+}
+
+// EventInterest returns the names of the events subscribed to, to be given
+// to SubscribeEvents on a new connection to the daemon
+func (c *Client) EventInterest() []string {
+	c.interestMu.Lock()
+	defer c.interestMu.Unlock()
+	names := make([]string, 0, len(c.interest))
+	for name := range c.interest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
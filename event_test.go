@@ -0,0 +1,215 @@
+package delugerpc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClientEvents(t *testing.T) {
+	all := make(chan Event, 10)
+	c, d := newTestClient(t, WithEventHandler(func(e Event) { all <- e }))
+	added := make(chan Event, 10)
+	cancel := c.NotifyEvents(added, "TorrentAddedEvent")
+
+	go func() {
+		req := d.read()
+		d.send(int(rpcEvent), "TorrentAddedEvent", []interface{}{"abc", false})
+		d.send(int(rpcEvent), "TorrentRemovedEvent", []interface{}{"abc"})
+		d.reply(req.id, "2.1.1")
+	}()
+	var info string
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, &info); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Event{
+		{Name: "TorrentAddedEvent", Args: []interface{}{"abc", false}},
+		{Name: "TorrentRemovedEvent", Args: []interface{}{"abc"}},
+	}
+	for _, w := range want {
+		if e := <-all; !reflect.DeepEqual(e, w) {
+			t.Errorf("event = %+v, want %+v", e, w)
+		}
+	}
+	if e := <-added; !reflect.DeepEqual(e, want[0]) {
+		t.Errorf("added event = %+v, want %+v", e, want[0])
+	}
+
+	cancel()
+	go d.send(int(rpcEvent), "TorrentAddedEvent", []interface{}{"def", false})
+	<-all
+	select {
+	case e := <-added:
+		t.Errorf("event %+v sent after cancel", e)
+	default:
+	}
+}
+
+func TestEventTyped(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  interface{}
+	}{
+		{Event{Name: "TorrentAddedEvent", Args: []interface{}{"abc", true}}, &TorrentAddedEvent{TorrentID: "abc", FromState: true}},
+		{Event{Name: "TorrentStateChangedEvent", Args: []interface{}{"abc", "Seeding"}}, &TorrentStateChangedEvent{TorrentID: "abc", State: "Seeding"}},
+		{Event{Name: "TorrentFileRenamedEvent", Args: []interface{}{"abc", int64(2), "b.iso"}}, &TorrentFileRenamedEvent{TorrentID: "abc", Index: 2, Name: "b.iso"}},
+		{Event{Name: "ConfigValueChangedEvent", Args: []interface{}{"max_connections_global", int64(200)}}, &ConfigValueChangedEvent{Key: "max_connections_global", Value: int64(200)}},
+		{Event{Name: "SessionPausedEvent", Args: []interface{}{}}, &SessionPausedEvent{}},
+		{Event{Name: "PluginEvent", Args: []interface{}{"x"}}, Event{Name: "PluginEvent", Args: []interface{}{"x"}}},
+	}
+	for _, tt := range tests {
+		got, err := tt.event.Typed()
+		if err != nil {
+			t.Errorf("%s: %v", tt.event.Name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Typed() = %#v, want %#v", tt.event.Name, got, tt.want)
+		}
+	}
+
+	if _, err := (Event{Name: "TorrentFileCompletedEvent", Args: []interface{}{"abc", "one"}}).Typed(); err == nil {
+		t.Error("expected an error decoding a string index")
+	}
+}
+
+func TestSubscribeEvents(t *testing.T) {
+	c, d := newTestClient(t)
+	interests := make(chan []interface{}, 10)
+	go func() {
+		for i := 0; i < 2; i++ {
+			req := d.read()
+			interests <- req.args[0].([]interface{})
+			d.reply(req.id, true)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	added, err := c.SubscribeEvents(ctx, "TorrentAddedEvent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	both, err := c.SubscribeEvents(context.Background(), "TorrentAddedEvent", "TorrentRemovedEvent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-interests; !reflect.DeepEqual(got, []interface{}{"TorrentAddedEvent"}) {
+		t.Errorf("first interest = %v", got)
+	}
+	// only the new event is sent
+	if got := <-interests; !reflect.DeepEqual(got, []interface{}{"TorrentRemovedEvent"}) {
+		t.Errorf("second interest = %v", got)
+	}
+	if got := c.EventInterest(); !reflect.DeepEqual(got, []string{"TorrentAddedEvent", "TorrentRemovedEvent"}) {
+		t.Errorf("EventInterest() = %v", got)
+	}
+
+	d.send(int(rpcEvent), "TorrentAddedEvent", []interface{}{"abc", false})
+	d.send(int(rpcEvent), "TorrentRemovedEvent", []interface{}{"abc"})
+	if e := <-added; e.Name != "TorrentAddedEvent" {
+		t.Errorf("added: %+v", e)
+	}
+	for _, name := range []string{"TorrentAddedEvent", "TorrentRemovedEvent"} {
+		if e := <-both; e.Name != name {
+			t.Errorf("both: %+v, want %s", e, name)
+		}
+	}
+
+	cancel()
+	if _, ok := <-added; ok {
+		t.Error("channel not closed after cancel")
+	}
+	c.Close()
+	if _, ok := <-both; ok {
+		t.Error("channel not closed after Close")
+	}
+}
+
+func TestSubscribeEventsClose(t *testing.T) {
+	c, d := newTestClient(t)
+	go func() {
+		req := d.read()
+		d.reply(req.id, true)
+	}()
+	ch, err := c.SubscribeEvents(context.Background(), "TorrentAddedEvent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the subscriber falls behind, holding the dispatch back
+	for i := 0; i <= DefaultEventQueueSize; i++ {
+		d.send(int(rpcEvent), "TorrentAddedEvent", []interface{}{"abc", false})
+	}
+	for len(ch) < DefaultEventQueueSize {
+		time.Sleep(time.Millisecond)
+	}
+	c.Close()
+	waitDisconnected(t, c)
+	// the send held back is given up
+	n := 0
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				if n != DefaultEventQueueSize {
+					t.Errorf("received %d events, want %d", n, DefaultEventQueueSize)
+				}
+				return
+			}
+			n++
+		case <-timeout:
+			t.Fatal("channel not closed after Close")
+		}
+	}
+}
+
+func TestEventQueuePolicies(t *testing.T) {
+	tests := []struct {
+		policy  EventDropPolicy
+		timeout time.Duration
+		want    []string
+	}{
+		{DropOldest, 0, []string{"e2", "e3"}},
+		{DropNewest, 0, []string{"e0", "e1"}},
+		{BlockWithTimeout, 10 * time.Millisecond, []string{"e0", "e1"}},
+	}
+	for _, tt := range tests {
+		c, d := newTestClient(t, WithEventQueue(2, tt.policy, tt.timeout))
+		blocked, release := make(chan struct{}), make(chan struct{})
+		received := make(chan string, 10)
+		c.OnEvent("", func(e Event) {
+			if e.Name == "blocker" {
+				// holds the dispatch back while the queue fills up
+				close(blocked)
+				<-release
+				return
+			}
+			received <- e.Name
+		})
+
+		go func() {
+			d.send(int(rpcEvent), "blocker", []interface{}{})
+			<-blocked
+			for _, name := range []string{"e0", "e1", "e2", "e3"} {
+				d.send(int(rpcEvent), name, []interface{}{})
+			}
+			req := d.read()
+			d.reply(req.id, nil)
+		}()
+		// the response arrives after the events were queued or dropped
+		if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		close(release)
+		for _, want := range tt.want {
+			if got := <-received; got != want {
+				t.Errorf("policy %d: event %s, want %s", tt.policy, got, want)
+			}
+		}
+		if n := c.DroppedEvents(); n != 2 {
+			t.Errorf("policy %d: DroppedEvents() = %d, want 2", tt.policy, n)
+		}
+	}
+}
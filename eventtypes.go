@@ -0,0 +1,188 @@
+package delugerpc
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/rogaps/delugerpc/rencode"
+)
+
+// The events of the Deluge core. Their fields hold the arguments of the
+// event, in order.
+type (
+	// TorrentAddedEvent is pushed when a torrent is added, FromState being
+	// true when it is restored from the saved state
+	TorrentAddedEvent struct {
+		TorrentID string
+		FromState bool
+	}
+	// TorrentRemovedEvent is pushed when a torrent is removed
+	TorrentRemovedEvent struct {
+		TorrentID string
+	}
+	// PreTorrentRemovedEvent is pushed before a torrent is removed
+	PreTorrentRemovedEvent struct {
+		TorrentID string
+	}
+	// TorrentStateChangedEvent is pushed when the state of a torrent
+	// changes, such as from Downloading to Seeding
+	TorrentStateChangedEvent struct {
+		TorrentID string
+		State     string
+	}
+	// TorrentTrackerStatusEvent is pushed when the tracker status of a
+	// torrent changes
+	TorrentTrackerStatusEvent struct {
+		TorrentID string
+		Status    string
+	}
+	// TorrentQueueChangedEvent is pushed when the queue order changes
+	TorrentQueueChangedEvent struct{}
+	// TorrentFolderRenamedEvent is pushed when a folder of a torrent is
+	// renamed
+	TorrentFolderRenamedEvent struct {
+		TorrentID string
+		Old       string
+		New       string
+	}
+	// TorrentFileRenamedEvent is pushed when a file of a torrent is renamed
+	TorrentFileRenamedEvent struct {
+		TorrentID string
+		Index     int
+		Name      string
+	}
+	// TorrentFinishedEvent is pushed when a torrent finishes downloading
+	TorrentFinishedEvent struct {
+		TorrentID string
+	}
+	// TorrentResumedEvent is pushed when a torrent resumes
+	TorrentResumedEvent struct {
+		TorrentID string
+	}
+	// TorrentFileCompletedEvent is pushed when a file of a torrent
+	// finishes downloading
+	TorrentFileCompletedEvent struct {
+		TorrentID string
+		Index     int
+	}
+	// TorrentStorageMovedEvent is pushed when the storage of a torrent is
+	// moved
+	TorrentStorageMovedEvent struct {
+		TorrentID string
+		Path      string
+	}
+	// CreateTorrentProgressEvent reports the progress of the creation of a
+	// torrent
+	CreateTorrentProgressEvent struct {
+		PieceCount int
+		NumPieces  int
+	}
+	// NewVersionAvailableEvent is pushed when a new release of Deluge is
+	// available
+	NewVersionAvailableEvent struct {
+		NewRelease string
+	}
+	// SessionStartedEvent is pushed when the session starts
+	SessionStartedEvent struct{}
+	// SessionPausedEvent is pushed when the session is paused
+	SessionPausedEvent struct{}
+	// SessionResumedEvent is pushed when the session resumes
+	SessionResumedEvent struct{}
+	// ConfigValueChangedEvent is pushed when a value of the core
+	// configuration changes
+	ConfigValueChangedEvent struct {
+		Key   string
+		Value interface{}
+	}
+	// PluginEnabledEvent is pushed when a plugin is enabled
+	PluginEnabledEvent struct {
+		PluginName string
+	}
+	// PluginDisabledEvent is pushed when a plugin is disabled
+	PluginDisabledEvent struct {
+		PluginName string
+	}
+	// ClientDisconnectedEvent is pushed when a client disconnects
+	ClientDisconnectedEvent struct {
+		SessionID int
+	}
+	// ExternalIPEvent is pushed when the external IP address is received
+	ExternalIPEvent struct {
+		ExternalIP string
+	}
+)
+
+// eventTypes maps the names of the core events to their types
+var eventTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, e := range []interface{}{
+		TorrentAddedEvent{},
+		TorrentRemovedEvent{},
+		PreTorrentRemovedEvent{},
+		TorrentStateChangedEvent{},
+		TorrentTrackerStatusEvent{},
+		TorrentQueueChangedEvent{},
+		TorrentFolderRenamedEvent{},
+		TorrentFileRenamedEvent{},
+		TorrentFinishedEvent{},
+		TorrentResumedEvent{},
+		TorrentFileCompletedEvent{},
+		TorrentStorageMovedEvent{},
+		CreateTorrentProgressEvent{},
+		NewVersionAvailableEvent{},
+		SessionStartedEvent{},
+		SessionPausedEvent{},
+		SessionResumedEvent{},
+		ConfigValueChangedEvent{},
+		PluginEnabledEvent{},
+		PluginDisabledEvent{},
+		ClientDisconnectedEvent{},
+		ExternalIPEvent{},
+	} {
+		t := reflect.TypeOf(e)
+		eventTypes[t.Name()] = t
+	}
+}
+
+// Typed returns the typed form of a core event, a pointer to the struct
+// named after it such as *TorrentAddedEvent, or e itself for other events
+func (e Event) Typed() (interface{}, error) {
+	t, ok := eventTypes[e.Name]
+	if !ok {
+		return e, nil
+	}
+	v := reflect.New(t)
+	if err := e.Decode(v.Interface()); err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// Decode decodes the arguments of e into the exported fields of the struct
+// v points to, in order, following the conversion rules of rencode. Missing
+// arguments leave their fields unchanged and extra arguments are ignored.
+func (e Event) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("delugerpc: cannot decode an event into %T", v)
+	}
+	rv = rv.Elem()
+	i := 0
+	for f := 0; f < rv.NumField() && i < len(e.Args); f++ {
+		if rv.Type().Field(f).PkgPath != "" {
+			continue
+		}
+		data, err := rencode.Append(nil, e.Args[i])
+		if err != nil {
+			return err
+		}
+		d := rencode.NewDecoder(bytes.NewReader(data))
+		if err := d.Decode(rv.Field(f).Addr().Interface()); err != nil {
+			return fmt.Errorf("delugerpc: argument %d of %s: %w", i, e.Name, err)
+		}
+		i++
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package delugerpc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RPCError is an exception raised by the daemon while handling a call
+type RPCError struct {
+	// Type is the name of the class of the exception, such as
+	// InvalidTorrentError
+	Type   string
+	Args   []interface{}
+	KWArgs map[string]interface{}
+	// Traceback is the formatted traceback of the exception, on the daemon
+	Traceback string
+}
+
+func (e *RPCError) Error() string {
+	if len(e.Args) == 1 {
+		return fmt.Sprintf("%s: %v", e.Type, e.Args[0])
+	}
+	return fmt.Sprintf("%s: %v", e.Type, e.Args)
+}
+
+// arg returns the positional argument i of the exception as a string
+func (e *RPCError) arg(i int) string {
+	if i >= len(e.Args) {
+		return ""
+	}
+	s, _ := e.Args[i].(string)
+	return s
+}
+
+// intArg returns the positional argument i of the exception as an int
+func (e *RPCError) intArg(i int) int {
+	if i >= len(e.Args) {
+		return 0
+	}
+	n, _ := e.Args[i].(int64)
+	return int(n)
+}
+
+// BadLoginError is raised by daemon.login when the username or the password
+// is wrong
+type BadLoginError struct {
+	*RPCError
+	Message  string
+	Username string
+}
+
+func (e *BadLoginError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+func (e *BadLoginError) Unwrap() error {
+	return e.RPCError
+}
+
+// NotAuthorizedError is raised by the calls of methods requiring a higher
+// auth level than the one of the logged in user
+type NotAuthorizedError struct {
+	*RPCError
+	CurrentLevel  int
+	RequiredLevel int
+}
+
+func (e *NotAuthorizedError) Error() string {
+	return fmt.Sprintf("%s: auth level %d is below the required %d", e.Type, e.CurrentLevel, e.RequiredLevel)
+}
+
+func (e *NotAuthorizedError) Unwrap() error {
+	return e.RPCError
+}
+
+// WrappedException is an exception of the Python runtime or of a library,
+// wrapped by the daemon
+type WrappedException struct {
+	*RPCError
+	Message string
+	// ExceptionType is the name of the class of the wrapped exception, such
+	// as KeyError
+	ExceptionType string
+}
+
+func (e *WrappedException) Error() string {
+	return fmt.Sprintf("%s: %s", e.ExceptionType, e.Message)
+}
+
+func (e *WrappedException) Unwrap() error {
+	return e.RPCError
+}
+
+// UnknownMethodError is raised by the calls of methods the daemon does not
+// export, such as the methods of a disabled plugin
+type UnknownMethodError struct {
+	*WrappedException
+	Method string
+}
+
+func (e *UnknownMethodError) Unwrap() error {
+	return e.WrappedException
+}
+
+// unknownMethodPrefix starts the message of the exception raised by the
+// calls of unknown methods
+const unknownMethodPrefix = "RPC call on invalid function: "
+
+// exceptionError returns the error describing the exception raised by a
+// request. Deluge sends the exception type, arguments, keyword arguments and
+// traceback as separate fields, while older releases send the exception type,
+// message and traceback as one list.
+func exceptionError(fields []interface{}) error {
+	e := &RPCError{}
+	if len(fields) == 1 {
+		if nested, ok := fields[0].([]interface{}); ok {
+			fields = nested
+			if len(fields) == 3 {
+				// type, message and traceback
+				fields = []interface{}{fields[0], []interface{}{fields[1]}, nil, fields[2]}
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return fmt.Errorf("delugerpc: malformed exception")
+	}
+	e.Type = fmt.Sprint(fields[0])
+	if len(fields) > 1 {
+		if args, ok := fields[1].([]interface{}); ok {
+			e.Args = args
+		} else {
+			e.Args = []interface{}{fields[1]}
+		}
+	}
+	if len(fields) > 2 {
+		e.KWArgs, _ = fields[2].(map[string]interface{})
+	}
+	if len(fields) > 3 {
+		e.Traceback, _ = fields[3].(string)
+	}
+
+	switch e.Type {
+	case "BadLoginError":
+		return &BadLoginError{RPCError: e, Message: e.arg(0), Username: e.arg(1)}
+	case "NotAuthorizedError":
+		return &NotAuthorizedError{RPCError: e, CurrentLevel: e.intArg(0), RequiredLevel: e.intArg(1)}
+	case "WrappedException":
+		w := &WrappedException{RPCError: e, Message: e.arg(0), ExceptionType: e.arg(1)}
+		if e.Traceback == "" {
+			e.Traceback = e.arg(2)
+		}
+		if w.ExceptionType == "AttributeError" && strings.HasPrefix(w.Message, unknownMethodPrefix) {
+			return &UnknownMethodError{WrappedException: w, Method: strings.TrimPrefix(w.Message, unknownMethodPrefix)}
+		}
+		return w
+	}
+	return e
+}
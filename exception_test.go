@@ -0,0 +1,87 @@
+package delugerpc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExceptionError(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []interface{}
+		want   string
+		check  func(t *testing.T, err error)
+	}{
+		{
+			name:   "bad login",
+			fields: []interface{}{"BadLoginError", []interface{}{"Password does not match", "user"}, map[string]interface{}{}, "Traceback"},
+			want:   "BadLoginError: Password does not match",
+			check: func(t *testing.T, err error) {
+				var e *BadLoginError
+				if !errors.As(err, &e) {
+					t.Fatalf("%T is not a *BadLoginError", err)
+				}
+				if e.Message != "Password does not match" || e.Username != "user" || e.Traceback != "Traceback" {
+					t.Errorf("err = %+v", e)
+				}
+			},
+		},
+		{
+			name:   "not authorized",
+			fields: []interface{}{"NotAuthorizedError", []interface{}{int64(5), int64(10)}, map[string]interface{}{}, ""},
+			want:   "NotAuthorizedError: auth level 5 is below the required 10",
+			check: func(t *testing.T, err error) {
+				var e *NotAuthorizedError
+				if !errors.As(err, &e) || e.CurrentLevel != 5 || e.RequiredLevel != 10 {
+					t.Errorf("err = %#v", err)
+				}
+			},
+		},
+		{
+			name:   "unknown method",
+			fields: []interface{}{"WrappedException", []interface{}{"RPC call on invalid function: label.get_labels", "AttributeError", "Traceback"}, map[string]interface{}{}, ""},
+			want:   "AttributeError: RPC call on invalid function: label.get_labels",
+			check: func(t *testing.T, err error) {
+				var e *UnknownMethodError
+				if !errors.As(err, &e) || e.Method != "label.get_labels" {
+					t.Fatalf("err = %#v", err)
+				}
+				var w *WrappedException
+				if !errors.As(err, &w) || w.Traceback != "Traceback" {
+					t.Errorf("wrapped exception = %#v", w)
+				}
+			},
+		},
+		{
+			name:   "wrapped exception",
+			fields: []interface{}{"WrappedException", []interface{}{"'name'", "KeyError", "Traceback"}, map[string]interface{}{}, ""},
+			want:   "KeyError: 'name'",
+		},
+		{
+			name:   "older release",
+			fields: []interface{}{[]interface{}{"InvalidTorrentError", "no such torrent", "Traceback"}},
+			want:   "InvalidTorrentError: no such torrent",
+			check: func(t *testing.T, err error) {
+				var e *RPCError
+				if !errors.As(err, &e) || e.Type != "InvalidTorrentError" || e.Traceback != "Traceback" {
+					t.Errorf("err = %#v", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := exceptionError(tt.fields)
+			if err.Error() != tt.want {
+				t.Errorf("message = %q, want %q", err.Error(), tt.want)
+			}
+			var e *RPCError
+			if !errors.As(err, &e) {
+				t.Errorf("%T does not wrap an *RPCError", err)
+			}
+			if tt.check != nil {
+				tt.check(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package delugerpc
+
+import (
+	"context"
+	"time"
+)
+
+// WithKeepalive calls daemon.info every interval, keeping the mappings of the
+// NATs on the way alive, zero meaning never. A daemon not responding within
+// the interval is deemed dead: the connection is torn down and the pending
+// calls fail with ErrUnresponsive. The client then reconnects when
+// WithReconnect is set, and moves to Disconnected otherwise, so that
+// StateChanges tells the application to reconnect.
+func WithKeepalive(interval time.Duration) Option {
+	return func(o *options) {
+		o.keepalive = interval
+	}
+}
+
+// keepalive pings the daemon every interval until the client shuts down,
+// across the reconnections
+func (c *Client) keepalive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.shut:
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := c.Call(ctx, "daemon.info", nil, nil, nil)
+		cancel()
+		if err == context.DeadlineExceeded {
+			c.fail(ErrUnresponsive)
+			if c.redialer == nil {
+				return
+			}
+		}
+	}
+}
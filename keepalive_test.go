@@ -0,0 +1,63 @@
+package delugerpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestClientKeepalive(t *testing.T) {
+	c, d := newTestClient(t, WithKeepalive(20*time.Millisecond))
+	changes := c.StateChanges()
+	<-changes
+	for i := 0; i < 3; i++ {
+		req := d.read()
+		if req.method != "daemon.info" {
+			t.Fatalf("method = %q, want %q", req.method, "daemon.info")
+		}
+		d.reply(req.id, "2.1.1")
+	}
+	if s := c.State(); s != Connected {
+		t.Fatalf("state = %v, want %v", s, Connected)
+	}
+
+	// the daemon stops responding
+	go d.read()
+	select {
+	case s := <-changes:
+		if s != Disconnected {
+			t.Errorf("state = %v, want %v", s, Disconnected)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("connection not torn down")
+	}
+	if err := c.shutdownErr(); err != ErrUnresponsive {
+		t.Errorf("err = %v, want %v", err, ErrUnresponsive)
+	}
+}
+
+func TestClientKeepaliveReconnect(t *testing.T) {
+	l := listen(t)
+	daemons := acceptDaemons(t, l)
+	c, err := DialClient(context.Background(), l.Addr().String(), WithoutTLS(),
+		WithKeepalive(20*time.Millisecond), WithReconnect(10*time.Millisecond, 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// the daemon stops responding, the client dials it again
+	d := nextDaemon(t, daemons)
+	go d.read()
+	d = nextDaemon(t, daemons)
+	for i := 0; i < 2; i++ {
+		req := d.read()
+		if req.method != "daemon.info" {
+			t.Fatalf("method = %q, want %q", req.method, "daemon.info")
+		}
+		d.reply(req.id, "2.1.1")
+	}
+	if s := c.State(); s != Connected {
+		t.Errorf("state = %v, want %v", s, Connected)
+	}
+}
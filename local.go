@@ -0,0 +1,96 @@
+package delugerpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// LocalDaemon is the configuration of the local daemon, read from its
+// core.conf
+type LocalDaemon struct {
+	// ConfigDir is the config directory of the daemon
+	ConfigDir string
+	// Port is the port the daemon listens on
+	Port int
+	// AllowRemote is set when the daemon accepts the connections of other
+	// hosts
+	AllowRemote bool
+}
+
+// coreConfig holds the settings of core.conf read by ReadLocalDaemon
+type coreConfig struct {
+	DaemonPort  *int `json:"daemon_port"`
+	AllowRemote bool `json:"allow_remote"`
+}
+
+// ReadLocalDaemon reads the configuration of the local daemon from the
+// core.conf of its config directory: $DELUGE_CONFIG_DIR when set, otherwise
+// the deluge directory of the user config directory, such as ~/.config/deluge
+func ReadLocalDaemon() (*LocalDaemon, error) {
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "core.conf")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := parseCoreConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("delugerpc: %s: %w", path, err)
+	}
+	ld := &LocalDaemon{ConfigDir: dir, AllowRemote: config.AllowRemote}
+	ld.Port, _ = strconv.Atoi(DefaultPort)
+	if config.DaemonPort != nil {
+		ld.Port = *config.DaemonPort
+	}
+	return ld, nil
+}
+
+// parseCoreConfig parses a config file of Deluge: a header holding the
+// version of the file, followed by the settings, or the settings alone in
+// the files of Deluge 1.2 and older
+func parseCoreConfig(data []byte) (coreConfig, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	var first json.RawMessage
+	if err := d.Decode(&first); err != nil {
+		return coreConfig{}, err
+	}
+	var second json.RawMessage
+	switch err := d.Decode(&second); {
+	case err == io.EOF:
+		second = first
+	case err != nil:
+		return coreConfig{}, err
+	}
+	var config coreConfig
+	err := json.Unmarshal(second, &config)
+	return config, err
+}
+
+// DialLocal returns a client connected to the local daemon, at the port of
+// its core.conf, or DefaultPort without one, and logged in with its
+// localclient account. Deluge 2.x daemons require
+// WithProtocolVersion(ProtocolV2).
+func DialLocal(ctx context.Context, opts ...Option) (*Client, error) {
+	port := DefaultPort
+	ld, err := ReadLocalDaemon()
+	switch {
+	case err == nil:
+		port = strconv.Itoa(ld.Port)
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+	opts = append([]Option{WithLocalAuth()}, opts...)
+	return DialClient(ctx, net.JoinHostPort("127.0.0.1", port), opts...)
+}
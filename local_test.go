@@ -0,0 +1,75 @@
+package delugerpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadLocalDaemon(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DELUGE_CONFIG_DIR", dir)
+	path := filepath.Join(dir, "core.conf")
+	if _, err := ReadLocalDaemon(); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v without core.conf, want fs.ErrNotExist", err)
+	}
+
+	for _, tt := range []struct {
+		data string
+		want LocalDaemon
+	}{
+		{
+			`{"file": 1, "format": 1}{"daemon_port": 58900, "allow_remote": true, "download_location": "/srv"}`,
+			LocalDaemon{ConfigDir: dir, Port: 58900, AllowRemote: true},
+		},
+		{
+			"{\n  \"file\": 1,\n  \"format\": 1\n}\n{\n  \"allow_remote\": false\n}",
+			LocalDaemon{ConfigDir: dir, Port: 58846},
+		},
+		// Deluge 1.2 and older
+		{`{"daemon_port": 58901}`, LocalDaemon{ConfigDir: dir, Port: 58901}},
+	} {
+		writeFile(t, path, tt.data)
+		ld, err := ReadLocalDaemon()
+		if err != nil {
+			t.Errorf("%s: %v", tt.data, err)
+			continue
+		}
+		if *ld != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.data, *ld, tt.want)
+		}
+	}
+
+	writeFile(t, path, `{"file": 1}{"daemon_port": "58846"}`)
+	if _, err := ReadLocalDaemon(); err == nil {
+		t.Error("malformed core.conf read")
+	}
+}
+
+func TestDialLocal(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DELUGE_CONFIG_DIR", dir)
+	l := listen(t)
+	go Serve(l, func(c *ServerCodec, req *Request) (interface{}, error) {
+		if req.Method == "daemon.login" && req.Args[1] != "abc123" {
+			return nil, &RPCError{Type: "BadLoginError", Args: []interface{}{"Password does not match", req.Args[0]}}
+		}
+		return 10, nil
+	})
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	writeFile(t, filepath.Join(dir, "core.conf"), fmt.Sprintf(`{"file": 1, "format": 1}{"daemon_port": %s}`, port))
+	writeFile(t, filepath.Join(dir, "auth"), "localclient:abc123:10\n")
+
+	c, err := DialLocal(context.Background(), WithoutTLS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.AuthLevel() != 10 {
+		t.Errorf("auth level = %d", c.AuthLevel())
+	}
+}
@@ -0,0 +1,117 @@
+package delugerpc
+
+import (
+	"encoding/hex"
+	"time"
+)
+
+// LogLevel is the severity of a log entry
+type LogLevel int
+
+// The levels of the log entries, in increasing severity
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+var logLevelNames = [...]string{
+	LogDebug: "debug",
+	LogInfo:  "info",
+	LogWarn:  "warn",
+	LogError: "error",
+}
+
+func (l LogLevel) String() string {
+	if l < 0 || int(l) >= len(logLevelNames) {
+		return "invalid"
+	}
+	return logLevelNames[l]
+}
+
+// LogField is a named value attached to a log entry, such as the method, the
+// request id ("seq"), the duration, the number of bytes or the error of a
+// call
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger receives the log entries of a client. Log may be called
+// concurrently, and must not block.
+type Logger interface {
+	Log(level LogLevel, msg string, fields ...LogField)
+}
+
+// LoggerFunc adapts a function to the Logger interface
+type LoggerFunc func(level LogLevel, msg string, fields ...LogField)
+
+// Log calls f
+func (f LoggerFunc) Log(level LogLevel, msg string, fields ...LogField) {
+	f(level, msg, fields...)
+}
+
+// WithLogger sends the log entries of the client to l: the completed calls
+// at LogDebug, the shutdown of the connection at LogInfo, and the dropped
+// events and torn down connections at LogWarn
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithMessageDump also logs every message exchanged with the daemon at
+// LogDebug, with a hex dump of its decompressed body in the "dump" field. The
+// dumps hold the passwords given to daemon.login.
+func WithMessageDump() Option {
+	return func(o *options) {
+		o.dumpMessages = true
+	}
+}
+
+// log sends an entry to the logger of the client, if any
+func (c *Client) log(level LogLevel, msg string, fields ...LogField) {
+	if c.logger != nil {
+		c.logger.Log(level, msg, fields...)
+	}
+}
+
+// observeCall logs and measures the completion of a call of method started
+// at start, whose response is msg. A nil msg is delivered by shutdown, which
+// holds c.mu and has set c.err.
+func (c *Client) observeCall(method string, start time.Time, msg *message) {
+	d := time.Since(start)
+	var err error
+	if msg == nil {
+		err = c.err
+	} else {
+		err = msg.err
+	}
+	if c.metrics != nil {
+		c.metrics.CallCompleted(method, d, err)
+	}
+	if c.logger == nil {
+		return
+	}
+	fields := []LogField{
+		{"method", method},
+		{"duration", d},
+	}
+	if msg != nil {
+		fields = append(fields, LogField{"seq", msg.id})
+	}
+	if err != nil {
+		fields = append(fields, LogField{"error", err})
+	} else {
+		fields = append(fields, LogField{"bytes", len(msg.payload)})
+	}
+	c.logger.Log(LogDebug, "call completed", fields...)
+}
+
+// dump logs the decompressed body of a message, sent or received
+func (c *messageConn) dump(msg string, body []byte) {
+	if c.logger != nil && c.dumpMessages {
+		c.logger.Log(LogDebug, msg, LogField{"bytes", len(body)}, LogField{"dump", hex.Dump(body)})
+	}
+}
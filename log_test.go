@@ -0,0 +1,77 @@
+package delugerpc
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testLogger struct {
+	mu      sync.Mutex
+	entries []testLogEntry
+}
+
+type testLogEntry struct {
+	level  LogLevel
+	msg    string
+	fields map[string]interface{}
+}
+
+func (l *testLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e := testLogEntry{level: level, msg: msg, fields: make(map[string]interface{})}
+	for _, f := range fields {
+		e.fields[f.Key] = f.Value
+	}
+	l.entries = append(l.entries, e)
+}
+
+func (l *testLogger) find(msg string) []testLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var found []testLogEntry
+	for _, e := range l.entries {
+		if e.msg == msg {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+func TestClientLogger(t *testing.T) {
+	l := &testLogger{}
+	c, d := newTestClient(t, WithLogger(l), WithMessageDump())
+	go func() {
+		req := d.read()
+		d.reply(req.id, "2.1.1")
+		req = d.read()
+		d.send(int(rpcError), req.id, "InvalidTorrentError", []interface{}{"no such torrent"}, map[string]interface{}{}, "")
+	}()
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Call(context.Background(), "core.get_torrent_status", Args{"abc", []string{}}, nil, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	calls := l.find("call completed")
+	if len(calls) != 2 {
+		t.Fatalf("got %d calls logged, want 2", len(calls))
+	}
+	if f := calls[0].fields; calls[0].level != LogDebug || f["method"] != "daemon.info" || f["seq"] != int64(0) || f["bytes"] == nil || f["duration"] == nil {
+		t.Errorf("first call: %+v", calls[0])
+	}
+	if f := calls[1].fields; f["method"] != "core.get_torrent_status" || f["error"] == nil {
+		t.Errorf("second call: %+v", calls[1])
+	}
+	// the test daemon logs its messages too
+	sent := l.find("message sent")
+	if len(sent) != 4 || !strings.Contains(sent[0].fields["dump"].(string), "daemon.info") {
+		t.Errorf("messages sent: %+v", sent)
+	}
+	if received := l.find("message received"); len(received) != 4 {
+		t.Errorf("got %d messages received logged, want 4", len(received))
+	}
+}
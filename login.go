@@ -0,0 +1,43 @@
+package delugerpc
+
+import "context"
+
+// AuthLevel is the authentication level granted by the daemon to a user,
+// which bounds the methods the user may call
+type AuthLevel int
+
+// loginClientVersion is the client version given to the Deluge 2.x daemons,
+// which refuse the clients not giving one
+const loginClientVersion = "2.0.0"
+
+// Login logs in as username with password and returns the level granted. The
+// client version expected by Deluge 2.x is given when speaking ProtocolV2,
+// and left out for Deluge 1.3 otherwise. Wrong credentials fail with a
+// *BadLoginError.
+func (c *Client) Login(ctx context.Context, username, password string) (AuthLevel, error) {
+	var kwargs KWArgs
+	if c.protocol == ProtocolV2 {
+		kwargs = KWArgs{"client_version": loginClientVersion}
+	}
+	var level int
+	if err := c.Call(ctx, "daemon.login", Args{username, password}, kwargs, &level); err != nil {
+		return 0, err
+	}
+	return AuthLevel(level), nil
+}
+
+// AuthLevel returns the level granted by the last successful daemon.login,
+// made by Login or Call, or zero before
+func (c *Client) AuthLevel() AuthLevel {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.authLevel
+}
+
+// authenticated records the success of login, a call of daemon.login
+func (c *Client) authenticated(level AuthLevel, login *request) {
+	c.stateMu.Lock()
+	c.authLevel = level
+	c.login = login
+	c.stateMu.Unlock()
+}
@@ -0,0 +1,52 @@
+package delugerpc
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestClientLogin(t *testing.T) {
+	for _, tt := range []struct {
+		version ProtocolVersion
+		kwargs  map[string]interface{}
+	}{
+		{ProtocolV1, map[string]interface{}{}},
+		{ProtocolV2, map[string]interface{}{"client_version": loginClientVersion}},
+	} {
+		c, d := newTestClient(t, WithProtocolVersion(tt.version))
+		go func() {
+			req := d.read()
+			if !reflect.DeepEqual(req.args, []interface{}{"localclient", "secret"}) || !reflect.DeepEqual(req.kwargs, tt.kwargs) {
+				t.Errorf("protocol %d: got daemon.login%v %v", tt.version, req.args, req.kwargs)
+			}
+			d.reply(req.id, 10)
+		}()
+		if level := c.AuthLevel(); level != 0 {
+			t.Errorf("auth level %d before login", level)
+		}
+		level, err := c.Login(context.Background(), "localclient", "secret")
+		if err != nil || level != 10 {
+			t.Errorf("protocol %d: Login = %d, %v", tt.version, level, err)
+		}
+		if level := c.AuthLevel(); level != 10 || c.State() != Authenticated {
+			t.Errorf("protocol %d: auth level %d in state %v after login", tt.version, level, c.State())
+		}
+	}
+}
+
+func TestClientLoginBad(t *testing.T) {
+	c, d := newTestClient(t)
+	go func() {
+		req := d.read()
+		d.send(int(rpcError), req.id, "BadLoginError", []interface{}{"Password does not match", "localclient"}, map[string]interface{}{}, "")
+	}()
+	var bad *BadLoginError
+	if _, err := c.Login(context.Background(), "localclient", "wrong"); !errors.As(err, &bad) {
+		t.Errorf("got %v, want a BadLoginError", err)
+	}
+	if level := c.AuthLevel(); level != 0 || c.State() != Connected {
+		t.Errorf("auth level %d in state %v after a failed login", level, c.State())
+	}
+}
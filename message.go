@@ -0,0 +1,420 @@
+package delugerpc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+type rpcResponseTypeID int
+
+const (
+	rpcResponse rpcResponseTypeID = 1
+	rpcError    rpcResponseTypeID = 2
+	rpcEvent    rpcResponseTypeID = 3
+)
+
+// ProtocolVersion selects the framing of the messages exchanged with the
+// daemon
+type ProtocolVersion int
+
+const (
+	// ProtocolV1 is the framing of Deluge 1.x, where every message is a bare
+	// zlib stream
+	ProtocolV1 ProtocolVersion = 1
+	// ProtocolV2 is the framing of Deluge 2.x, where every message starts
+	// with the version byte 'D' and the big-endian 32-bit length of its zlib
+	// body
+	ProtocolV2 ProtocolVersion = 2
+)
+
+const (
+	protocolV2Version byte = 'D'
+	protocolV2Header       = 5
+	// maxMessageLength bounds the length announced by a Deluge 2.x header
+	maxMessageLength = 256 << 20
+)
+
+// DefaultMaxMessageSize is the default bound of the size of the messages
+// received
+const DefaultMaxMessageSize = 256 << 20
+
+// ErrMessageTooLarge is wrapped by the error of a message received whose
+// frame or decompressed size is over the bound set by WithMaxMessageSize
+var ErrMessageTooLarge = errors.New("delugerpc: message too large")
+
+// messageConn exchanges framed, compressed rencode messages with the daemon.
+// Writes are serialized, reads must not be concurrent.
+type messageConn struct {
+	conn       net.Conn
+	r          *bufio.Reader
+	version    ProtocolVersion
+	serializer Serializer
+	level      int
+	// threshold is the size below which messages are not compressed
+	threshold int
+	// maxSize bounds the decompressed size of the messages read
+	maxSize int64
+	// readTimeout bounds the reading of a message once it starts, and
+	// writeTimeout the writing of a message
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	logger       Logger
+	dumpMessages bool
+	// wireDump is set by WithWireDump, and raw records the frame of the
+	// Deluge 1.x message being read for it
+	wireDump io.Writer
+	wireMu   sync.Mutex
+	raw      bytes.Buffer
+	recorder *Recorder
+
+	metrics Metrics
+	// received counts the bytes read from conn, and consumed those of the
+	// messages read, when metrics is set
+	received *countingReader
+	consumed int64
+
+	// zr is the decompressor of the messages read, reset for each, and frame
+	// holds the compressed body of the last Deluge 2.x message
+	zr    io.ReadCloser
+	frame []byte
+	fr    bytes.Reader
+	// writers and storers hold the compressors of the messages written,
+	// storers those storing the messages below the threshold
+	writers sync.Pool
+	storers sync.Pool
+
+	wmu sync.Mutex
+}
+
+func newMessageConn(conn net.Conn, o options) *messageConn {
+	c := &messageConn{
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		version: o.version,
+		level:   o.compressionLevel,
+
+		serializer: o.serializer,
+
+		threshold: o.compressionThreshold,
+		maxSize:   o.maxMessageSize,
+
+		readTimeout:  o.readTimeout,
+		writeTimeout: o.writeTimeout,
+
+		logger:       o.logger,
+		dumpMessages: o.dumpMessages,
+		wireDump:     o.wireDump,
+		recorder:     o.recorder,
+
+		metrics: o.metrics,
+	}
+	if c.metrics != nil {
+		c.received = &countingReader{r: conn}
+		c.r = bufio.NewReader(c.received)
+	}
+	return c
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// writeMessage encodes, compresses and writes v as one message
+func (c *messageConn) writeMessage(v interface{}) error {
+	_, err := c.writeMessageContext(context.Background(), v)
+	return err
+}
+
+// encode returns the framed message holding v
+func (c *messageConn) encode(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if c.version == ProtocolV2 {
+		b.Write(make([]byte, protocolV2Header))
+	}
+	body, err := c.serializer.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	c.dump("message sent", body)
+	if c.recorder != nil {
+		c.recorder.record(c.version, recordSent, body)
+	}
+	pool, level := &c.writers, c.level
+	if len(body) < c.threshold {
+		pool, level = &c.storers, zlib.NoCompression
+	}
+	zw, ok := pool.Get().(*zlib.Writer)
+	if ok {
+		zw.Reset(&b)
+	} else if zw, err = zlib.NewWriterLevel(&b, level); err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	pool.Put(zw)
+
+	msg := b.Bytes()
+	if c.version == ProtocolV2 {
+		msg[0] = protocolV2Version
+		binary.BigEndian.PutUint32(msg[1:], uint32(len(msg)-protocolV2Header))
+	}
+	return msg, nil
+}
+
+// writeMessageContext is like writeMessage, but gives up writing when ctx is
+// done. It returns the number of bytes written: a message partially written
+// leaves the connection unusable.
+func (c *messageConn) writeMessageContext(ctx context.Context, v interface{}) (int, error) {
+	msg, err := c.encode(v)
+	if err != nil {
+		return 0, err
+	}
+	return c.writeContext(ctx, msg)
+}
+
+// writeContext writes msg, a framed message returned by encode, as
+// writeMessageContext does
+func (c *messageConn) writeContext(ctx context.Context, msg []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if c.writeTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	if ctx.Done() == nil && c.writeTimeout <= 0 {
+		return c.write(msg)
+	}
+	defer c.conn.SetWriteDeadline(time.Time{})
+	if ctx.Done() == nil {
+		return c.write(msg)
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			// unblocks the write, which then fails with ctx.Err()
+			c.conn.SetWriteDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	n, err := c.write(msg)
+	close(done)
+	<-stopped
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return n, err
+}
+
+// write writes msg to the connection, c.wmu being held
+func (c *messageConn) write(msg []byte) (int, error) {
+	if c.wireDump != nil {
+		// dumped first, as the response may be read before Write returns
+		c.dumpWire(">", msg, nil)
+	}
+	n, err := c.conn.Write(msg)
+	if c.metrics != nil && n > 0 {
+		c.metrics.BytesSent(n)
+	}
+	return n, err
+}
+
+// readMessage returns the decompressed body of the next message. The read
+// deadline set by the caller applies until the message starts, and the read
+// timeout from then on.
+func (c *messageConn) readMessage() ([]byte, error) {
+	// a connection closed between messages fails with io.EOF
+	if _, err := c.r.Peek(1); err != nil {
+		return nil, err
+	}
+	if c.readTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+
+	// the zlib reader reads a bufio.Reader byte by byte, never past the end
+	// of a Deluge 1.x message
+	var src io.Reader = c.r
+	if c.version == ProtocolV2 {
+		if err := c.readFrame(); err != nil {
+			return nil, err
+		}
+		c.fr.Reset(c.frame)
+		src = &c.fr
+	} else if c.wireDump != nil {
+		c.raw.Reset()
+		src = &teeReader{r: c.r, buf: &c.raw}
+	}
+	var err error
+	if c.zr == nil {
+		c.zr, err = zlib.NewReader(src)
+	} else {
+		err = c.zr.(zlib.Resetter).Reset(src, nil)
+	}
+	if err != nil {
+		if c.version == ProtocolV2 {
+			err = eofUnexpected(err)
+		}
+		return nil, err
+	}
+	zr := c.zr
+	body, err := io.ReadAll(io.LimitReader(zr, c.maxSize+1))
+	if err != nil {
+		return nil, eofUnexpected(err)
+	}
+	if int64(len(body)) > c.maxSize {
+		return nil, fmt.Errorf("%w: over %d bytes decompressed", ErrMessageTooLarge, c.maxSize)
+	}
+	c.dump("message received", body)
+	if c.recorder != nil {
+		c.recorder.record(c.version, recordReceived, body)
+	}
+	if c.wireDump != nil {
+		c.dumpWire("<", c.rawFrame(), body)
+	}
+	if c.metrics != nil {
+		consumed := c.received.n - int64(c.r.Buffered())
+		c.metrics.BytesReceived(int(consumed - c.consumed))
+		c.consumed = consumed
+	}
+	return body, zr.Close()
+}
+
+// rawFrame returns the message read last, as read from the connection
+func (c *messageConn) rawFrame() []byte {
+	if c.version != ProtocolV2 {
+		return c.raw.Bytes()
+	}
+	frame := make([]byte, protocolV2Header, protocolV2Header+len(c.frame))
+	frame[0] = protocolV2Version
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(c.frame)))
+	return append(frame, c.frame...)
+}
+
+// maxKeptFrame bounds the size of the frame buffer kept between messages
+const maxKeptFrame = 1 << 20
+
+// readFrame reads the compressed body of the next Deluge 2.x message into
+// c.frame
+func (c *messageConn) readFrame() error {
+	var header [protocolV2Header]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return err
+	}
+	if header[0] != protocolV2Version {
+		return fmt.Errorf("delugerpc: unexpected protocol version %q", header[0])
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > maxMessageLength {
+		return fmt.Errorf("delugerpc: message of %d bytes is too long", length)
+	}
+	// checked before allocating the frame
+	if int64(length) > c.maxSize {
+		return fmt.Errorf("%w: frame of %d bytes", ErrMessageTooLarge, length)
+	}
+	if cap(c.frame) < int(length) || cap(c.frame) > maxKeptFrame {
+		c.frame = make([]byte, length)
+	}
+	c.frame = c.frame[:length]
+	if _, err := io.ReadFull(c.r, c.frame); err != nil {
+		return eofUnexpected(err)
+	}
+	return nil
+}
+
+func (c *messageConn) Close() error {
+	return c.conn.Close()
+}
+
+func eofUnexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// message is a message sent by the daemon
+type message struct {
+	typ rpcResponseTypeID
+	// id is the request id of responses and errors
+	id int64
+	// event is the name of events
+	event string
+	// payload holds the encoded return value of responses and the encoded
+	// arguments of events
+	payload []byte
+	// err is the exception raised by a request
+	err error
+}
+
+// parseMessage parses the body of a message, encoded with s. The payload is
+// left encoded, to be decoded by its recipient.
+func parseMessage(s Serializer, body []byte) (*message, error) {
+	elems, err := s.SplitList(body)
+	if err != nil {
+		return nil, fmt.Errorf("delugerpc: malformed message: %w", err)
+	}
+	if len(elems) < 2 {
+		return nil, errors.New("delugerpc: malformed message: missing header")
+	}
+	var msg message
+	var typ int64
+	if err := s.Unmarshal(elems[0], &typ); err != nil {
+		return nil, fmt.Errorf("delugerpc: malformed message: %w", err)
+	}
+	msg.typ = rpcResponseTypeID(typ)
+	if msg.typ == rpcEvent {
+		err = s.Unmarshal(elems[1], &msg.event)
+	} else {
+		err = s.Unmarshal(elems[1], &msg.id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("delugerpc: malformed message: %w", err)
+	}
+
+	switch msg.typ {
+	case rpcResponse, rpcEvent:
+		if len(elems) < 3 {
+			return nil, errors.New("delugerpc: malformed message: missing payload")
+		}
+		msg.payload = elems[2]
+	case rpcError:
+		fields := make([]interface{}, len(elems)-2)
+		for i, elem := range elems[2:] {
+			if err := s.Unmarshal(elem, &fields[i]); err != nil {
+				return nil, fmt.Errorf("delugerpc: malformed message: %w", err)
+			}
+		}
+		msg.err = exceptionError(fields)
+	default:
+		return nil, fmt.Errorf("delugerpc: unknown message type %d", msg.typ)
+	}
+	return &msg, nil
+}
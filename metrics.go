@@ -0,0 +1,31 @@
+package delugerpc
+
+import "time"
+
+// Metrics receives the measurements of a client, to be exported to a
+// monitoring system. Its methods may be called concurrently, and must not
+// block. The prommetrics package exports them to Prometheus.
+type Metrics interface {
+	// CallCompleted reports a call of method which took d, err being the
+	// exception raised by the daemon, or the reason the response was not
+	// received, or nil. Calls given up on because of their context are not
+	// reported.
+	CallCompleted(method string, d time.Duration, err error)
+	// BytesSent and BytesReceived report the size of the messages, as
+	// framed and compressed on the connection
+	BytesSent(n int)
+	BytesReceived(n int)
+	// EventReceived reports an event pushed by the daemon
+	EventReceived(name string)
+	// ConnectionOpened and ConnectionClosed report the start and the end of
+	// the connection of a client, err being the reason it was closed
+	ConnectionOpened()
+	ConnectionClosed(err error)
+}
+
+// WithMetrics sends the measurements of the client to m
+func WithMetrics(m Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
@@ -0,0 +1,105 @@
+package delugerpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testMetrics struct {
+	mu           sync.Mutex
+	calls        map[string]int
+	errors       []error
+	sent         int
+	received     int
+	events       []string
+	opened       int
+	closed       []error
+	closedSignal chan struct{}
+}
+
+func (m *testMetrics) CallCompleted(method string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls[method]++
+	if err != nil {
+		m.errors = append(m.errors, err)
+	}
+}
+
+func (m *testMetrics) BytesSent(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent += n
+}
+
+func (m *testMetrics) BytesReceived(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.received += n
+}
+
+func (m *testMetrics) EventReceived(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, name)
+}
+
+func (m *testMetrics) ConnectionOpened() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.opened++
+}
+
+func (m *testMetrics) ConnectionClosed(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = append(m.closed, err)
+	close(m.closedSignal)
+}
+
+func TestClientMetrics(t *testing.T) {
+	m := &testMetrics{calls: make(map[string]int), closedSignal: make(chan struct{})}
+	c, d := newTestClient(t, WithMetrics(m), WithProtocolVersion(ProtocolV2))
+	daemonDone := make(chan struct{})
+	go func() {
+		defer close(daemonDone)
+		req := d.read()
+		d.send(int(rpcEvent), "TorrentAddedEvent", []interface{}{"abc", false})
+		d.reply(req.id, "2.1.1")
+		req = d.read()
+		d.send(int(rpcError), req.id, "InvalidTorrentError", []interface{}{"no such torrent"}, map[string]interface{}{}, "")
+	}()
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Call(context.Background(), "core.get_torrent_status", Args{"abc", []string{}}, nil, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	<-daemonDone
+	c.Close()
+	<-m.closedSignal
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.calls["daemon.info"] != 1 || m.calls["core.get_torrent_status"] != 1 {
+		t.Errorf("calls = %v", m.calls)
+	}
+	var e *RPCError
+	if len(m.errors) != 1 || !errors.As(m.errors[0], &e) || e.Type != "InvalidTorrentError" {
+		t.Errorf("errors = %v", m.errors)
+	}
+	// the test daemon measures its messages too, so every byte is counted
+	// once sent and once received
+	if m.sent == 0 || m.sent != m.received {
+		t.Errorf("sent %d bytes, received %d", m.sent, m.received)
+	}
+	if len(m.events) != 1 || m.events[0] != "TorrentAddedEvent" {
+		t.Errorf("events = %v", m.events)
+	}
+	if m.opened != 1 || len(m.closed) != 1 || m.closed[0] != ErrClosed {
+		t.Errorf("opened %d connections, closed %v", m.opened, m.closed)
+	}
+}
@@ -0,0 +1,212 @@
+package delugerpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Host is a daemon reached by a MultiClient, as listed by the connection
+// manager of Deluge
+type Host struct {
+	// ID identifies the host in the MultiClient
+	ID string
+	// Addr is the address of the daemon, in any of the forms accepted by
+	// Dial
+	Addr    string
+	Options []Option
+	// Setup, if set, prepares every new connection to the host before it is
+	// used, typically by logging in
+	Setup func(ctx context.Context, c *Client) error
+}
+
+// MultiClient makes calls to several daemons, such as a fleet of seedboxes.
+// The connection to each host is established on its first call, and again on
+// the first call after it is lost. A MultiClient is safe for concurrent use.
+type MultiClient struct {
+	mu     sync.Mutex
+	hosts  map[string]*multiHost
+	order  []string
+	closed bool
+	// next is the index in order of the next host tried by CallAny
+	next uint32
+}
+
+// multiHost is a host of a MultiClient and its connection
+type multiHost struct {
+	host Host
+
+	mu     sync.Mutex
+	client *Client
+	// closed is set once the host is removed or the MultiClient closed, so
+	// that a connection racing with it is not made
+	closed bool
+}
+
+// NewMultiClient returns a client of hosts
+func NewMultiClient(hosts ...Host) (*MultiClient, error) {
+	m := &MultiClient{hosts: make(map[string]*multiHost)}
+	for _, h := range hosts {
+		if err := m.AddHost(h); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// AddHost adds h to the hosts, without connecting to it
+func (m *MultiClient) AddHost(h Host) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	if _, ok := m.hosts[h.ID]; ok {
+		return fmt.Errorf("delugerpc: duplicate host %q", h.ID)
+	}
+	m.hosts[h.ID] = &multiHost{host: h}
+	m.order = append(m.order, h.ID)
+	return nil
+}
+
+// RemoveHost removes the host id and closes its connection
+func (m *MultiClient) RemoveHost(id string) error {
+	m.mu.Lock()
+	mh, ok := m.hosts[id]
+	if ok {
+		delete(m.hosts, id)
+		for i, hid := range m.order {
+			if hid == id {
+				m.order = append(m.order[:i:i], m.order[i+1:]...)
+				break
+			}
+		}
+	}
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("delugerpc: unknown host %q", id)
+	}
+	mh.close()
+	return nil
+}
+
+// Hosts returns the ids of the hosts, in the order they were added
+func (m *MultiClient) Hosts() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.order...)
+}
+
+// Client returns the client connected to the host id, connecting to it if
+// needed
+func (m *MultiClient) Client(ctx context.Context, id string) (*Client, error) {
+	m.mu.Lock()
+	mh, ok := m.hosts[id]
+	closed := m.closed
+	m.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	if !ok {
+		return nil, fmt.Errorf("delugerpc: unknown host %q", id)
+	}
+	return mh.connect(ctx)
+}
+
+// Call makes a call to the host id. See Client.Call.
+func (m *MultiClient) Call(ctx context.Context, id, method string, args Args, kwargs KWArgs, result interface{}) error {
+	c, err := m.Client(ctx, id)
+	if err != nil {
+		return err
+	}
+	return c.Call(ctx, method, args, kwargs, result)
+}
+
+// CallAny makes a call to one of the hosts, chosen in turn, and returns its
+// id. When the host cannot be reached, or the connection fails before the
+// response arrives, the call is made to the next host, so that only calls
+// without side effects, such as queries, should be made this way. The error
+// of the last host tried is returned when all of them fail.
+func (m *MultiClient) CallAny(ctx context.Context, method string, args Args, kwargs KWArgs, result interface{}) (string, error) {
+	ids := m.Hosts()
+	if len(ids) == 0 {
+		return "", errors.New("delugerpc: no host")
+	}
+	first := int(atomic.AddUint32(&m.next, 1)-1) % len(ids)
+	var err error
+	for i := range ids {
+		id := ids[(first+i)%len(ids)]
+		var c *Client
+		if c, err = m.Client(ctx, id); err == nil {
+			err = c.Call(ctx, method, args, kwargs, result)
+			if err == nil || ctx.Err() != nil {
+				return id, err
+			}
+			// exceptions and results not fitting are not the host's fault
+			if !c.broken() && err != ErrCircuitOpen {
+				return id, err
+			}
+		} else if ctx.Err() != nil || err == ErrClosed {
+			return "", err
+		}
+	}
+	return "", err
+}
+
+// Close closes the connections to all the hosts
+func (m *MultiClient) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrClosed
+	}
+	m.closed = true
+	hosts := m.hosts
+	m.mu.Unlock()
+	for _, mh := range hosts {
+		mh.close()
+	}
+	return nil
+}
+
+// connect returns the client connected to the host, connecting to it if
+// there is none or its connection was lost
+func (mh *multiHost) connect(ctx context.Context) (*Client, error) {
+	mh.mu.Lock()
+	defer mh.mu.Unlock()
+	if mh.closed {
+		return nil, ErrClosed
+	}
+	if mh.client != nil && !mh.client.broken() {
+		return mh.client, nil
+	}
+	if mh.client != nil {
+		// stops it reconnecting, see WithReconnect
+		mh.client.Close()
+		mh.client = nil
+	}
+	c, err := DialClient(ctx, mh.host.Addr, mh.host.Options...)
+	if err != nil {
+		return nil, err
+	}
+	if mh.host.Setup != nil {
+		if err := mh.host.Setup(ctx, c); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	mh.client = c
+	return c, nil
+}
+
+func (mh *multiHost) close() {
+	mh.mu.Lock()
+	defer mh.mu.Unlock()
+	mh.closed = true
+	if mh.client != nil {
+		mh.client.Close()
+		mh.client = nil
+	}
+}
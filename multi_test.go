@@ -0,0 +1,154 @@
+package delugerpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/rogaps/delugerpc/rencode"
+)
+
+// hostsDialer connects to daemons replying to every call with their address,
+// except for the addresses listed as down
+type hostsDialer struct {
+	mu    sync.Mutex
+	down  map[string]bool
+	dials map[string]int
+	conns []net.Conn
+}
+
+func (d *hostsDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dials[address]++
+	if d.down[address] {
+		return nil, errors.New("connection refused")
+	}
+	client, server := net.Pipe()
+	d.conns = append(d.conns, server)
+	go func() {
+		defer server.Close()
+		conn := newMessageConn(server, newOptions(nil))
+		for {
+			body, err := conn.readMessage()
+			if err != nil {
+				return
+			}
+			var reqs [][]interface{}
+			if err := rencode.NewDecoder(bytes.NewReader(body)).Decode(&reqs); err != nil {
+				return
+			}
+			for _, req := range reqs {
+				conn.writeMessage([]interface{}{int(rpcResponse), req[0], address})
+			}
+		}
+	}()
+	return client, nil
+}
+
+// drop closes the connections to the daemons
+func (d *hostsDialer) drop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, conn := range d.conns {
+		conn.Close()
+	}
+	d.conns = nil
+}
+
+func TestMultiClient(t *testing.T) {
+	d := &hostsDialer{down: map[string]bool{"down:58846": true}, dials: make(map[string]int)}
+	var setups int
+	setup := func(ctx context.Context, c *Client) error {
+		setups++
+		return nil
+	}
+	m, err := NewMultiClient(
+		Host{ID: "a", Addr: "down", Options: []Option{WithDialer(d), WithoutTLS()}, Setup: setup},
+		Host{ID: "b", Addr: "up", Options: []Option{WithDialer(d), WithoutTLS()}, Setup: setup},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	var addr string
+	if err := m.Call(context.Background(), "b", "daemon.info", nil, nil, &addr); err != nil || addr != "up:58846" {
+		t.Fatalf("addr = %q, err = %v", addr, err)
+	}
+	if err := m.Call(context.Background(), "a", "daemon.info", nil, nil, &addr); err == nil {
+		t.Error("expected an error for a host down")
+	}
+	if err := m.Call(context.Background(), "c", "daemon.info", nil, nil, &addr); err == nil {
+		t.Error("expected an error for an unknown host")
+	}
+
+	// the calls fail over to the host up
+	for i := 0; i < 2; i++ {
+		id, err := m.CallAny(context.Background(), "daemon.info", nil, nil, &addr)
+		if err != nil || id != "b" || addr != "up:58846" {
+			t.Fatalf("CallAny: id = %q, addr = %q, err = %v", id, addr, err)
+		}
+	}
+
+	// a lost connection is established again
+	c, err := m.Client(context.Background(), "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := c.StateChanges()
+	d.drop()
+	for s := range changes {
+		if s == Disconnected {
+			break
+		}
+	}
+	if _, err := m.CallAny(context.Background(), "daemon.info", nil, nil, &addr); err != nil {
+		t.Fatal(err)
+	}
+	d.mu.Lock()
+	dials := d.dials["up:58846"]
+	d.mu.Unlock()
+	if dials != 2 || setups != 2 {
+		t.Errorf("dialed %d times, set up %d times, want 2", dials, setups)
+	}
+
+	if err := m.RemoveHost("b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CallAny(context.Background(), "daemon.info", nil, nil, &addr); err == nil {
+		t.Error("expected an error with all the hosts down")
+	}
+	if hosts := m.Hosts(); len(hosts) != 1 || hosts[0] != "a" {
+		t.Errorf("hosts = %q", hosts)
+	}
+	if err := m.AddHost(Host{ID: "a"}); err == nil {
+		t.Error("expected an error for a duplicate host")
+	}
+}
+
+func TestMultiClientCloseRace(t *testing.T) {
+	d := &hostsDialer{dials: make(map[string]int)}
+	m, err := NewMultiClient(Host{ID: "a", Addr: "up", Options: []Option{WithDialer(d), WithoutTLS()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a call that passed the check of Close before it ran
+	m.mu.Lock()
+	mh := m.hosts["a"]
+	m.mu.Unlock()
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mh.connect(context.Background()); err != ErrClosed {
+		t.Fatalf("err = %v, want %v", err, ErrClosed)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dials["up:58846"] != 0 {
+		t.Error("host dialed after Close")
+	}
+}
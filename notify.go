@@ -0,0 +1,37 @@
+package delugerpc
+
+import "context"
+
+// WithNotifyErrors passes the exceptions raised by the calls made by Notify,
+// and the shutdown of the client before their responses, to h. h runs on its
+// own goroutine, and may be called concurrently.
+func WithNotifyErrors(h func(method string, err error)) Option {
+	return func(o *options) {
+		o.notifyErrors = h
+	}
+}
+
+// Notify calls method with args and kwargs, returning once the request is
+// sent, for calls whose outcome does not matter, such as core.queue_top. The
+// daemon still responds; the response is dropped unless WithNotifyErrors is
+// set. Notify only returns the errors of the sending of the request.
+func (c *Client) Notify(ctx context.Context, method string, args Args, kwargs KWArgs) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if h := c.notifyErrors; h != nil {
+		_, err := c.start(ctx, method, args, kwargs, func(msg *message) {
+			if msg == nil || msg.err != nil {
+				// shutdownErr locks c.mu, held while shutting down
+				go func() { h(method, c.decodeResult(msg, nil)) }()
+			}
+		})
+		return err
+	}
+	id, err := c.start(ctx, method, args, kwargs, func(*message) {})
+	if err != nil {
+		return err
+	}
+	c.unregister(id).outcome.release()
+	return nil
+}
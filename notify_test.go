@@ -0,0 +1,85 @@
+package delugerpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClientNotify(t *testing.T) {
+	c, d := newTestClient(t)
+	read := make(chan testRequest)
+	go func() {
+		read <- d.read()
+	}()
+
+	if err := c.Notify(context.Background(), "core.queue_top", Args{[]string{"abc"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	req := <-read
+	if req.method != "core.queue_top" {
+		t.Errorf("got method %q", req.method)
+	}
+	c.mu.Lock()
+	pending := len(c.pending)
+	c.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d calls pending after Notify", pending)
+	}
+
+	// the response is dropped, and the client still works
+	d.reply(req.id, nil)
+	go func() {
+		req := d.read()
+		d.reply(req.id, "2.1.1")
+	}()
+	var version string
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, &version); err != nil || version != "2.1.1" {
+		t.Errorf("got %q, %v", version, err)
+	}
+}
+
+func TestClientNotifyErrors(t *testing.T) {
+	type notifyErr struct {
+		method string
+		err    error
+	}
+	errs := make(chan notifyErr, 2)
+	c, d := newTestClient(t, WithNotifyErrors(func(method string, err error) {
+		errs <- notifyErr{method, err}
+	}))
+	go func() {
+		ok, failed := d.read(), d.read()
+		d.reply(ok.id, nil)
+		d.send(int(rpcError), failed.id, "InvalidTorrentError", []interface{}{"no such torrent"}, map[string]interface{}{}, "")
+		d.read()
+		c.Close()
+	}()
+
+	for _, method := range []string{"core.queue_top", "core.queue_bottom", "core.queue_up"} {
+		if err := c.Notify(context.Background(), method, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the handler runs on its own goroutine, so errors arrive in any order
+	got := make(map[string]error)
+	for len(got) < 2 {
+		select {
+		case e := <-errs:
+			got[e.method] = e.err
+		case <-time.After(time.Second):
+			t.Fatalf("got errors %v, want two", got)
+		}
+	}
+	var rpcErr *RPCError
+	if err := got["core.queue_bottom"]; !errors.As(err, &rpcErr) {
+		t.Errorf("got %v for core.queue_bottom, want an RPCError", err)
+	}
+	if err := got["core.queue_up"]; !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v for core.queue_up, want ErrClosed", err)
+	}
+	if err := c.Notify(context.Background(), "core.queue_top", nil, nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v after Close, want ErrClosed", err)
+	}
+}
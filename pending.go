@@ -0,0 +1,90 @@
+package delugerpc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Pending is a call made by Client.Go, whose response is awaited
+type Pending struct {
+	c      *Client
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+	// msg is the response, nil if the client shut down first, and err the
+	// reason it was not received
+	msg *message
+	err error
+}
+
+// Go calls method with args and kwargs without waiting for the response, and
+// returns the pending call. The request is sent before Go returns, so calls
+// made one after another by Go reach the daemon in order, unless their
+// responses are cached or coalesced. The call is given up when ctx is done or
+// Cancel is called.
+func (c *Client) Go(ctx context.Context, method string, args Args, kwargs KWArgs) *Pending {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &Pending{c: c, cancel: cancel, done: make(chan struct{})}
+	if err := ctx.Err(); err != nil {
+		p.complete(nil, err)
+		return p
+	}
+	if c.shared(method) {
+		go func() {
+			p.complete(c.callShared(ctx, method, args, kwargs))
+		}()
+		return p
+	}
+
+	sent := time.Now().UnixNano()
+	id, err := c.start(ctx, method, args, kwargs, func(msg *message) { p.complete(msg, nil) })
+	if err != nil {
+		p.complete(nil, err)
+		return p
+	}
+	go func() {
+		<-ctx.Done()
+		select {
+		case <-p.done:
+		default:
+			c.abandon(ctx, sent, id)
+			p.complete(nil, ctx.Err())
+		}
+	}()
+	return p
+}
+
+// complete sets the outcome of the call, unless it is already set
+func (p *Pending) complete(msg *message, err error) {
+	p.once.Do(func() {
+		p.msg, p.err = msg, err
+		close(p.done)
+		p.cancel()
+	})
+}
+
+// Done returns a channel closed once the response arrived or the call was
+// given up
+func (p *Pending) Done() <-chan struct{} {
+	return p.done
+}
+
+// Result waits for the call to be done and decodes its return value into
+// into, as Client.Call does. It may be called more than once.
+func (p *Pending) Result(into interface{}) error {
+	<-p.done
+	if p.err != nil {
+		return p.err
+	}
+	if err := checkResult(into); err != nil {
+		return err
+	}
+	return p.c.decodeResult(p.msg, into)
+}
+
+// Cancel gives up the call, whose Result then returns context.Canceled,
+// unless the response already arrived
+func (p *Pending) Cancel() {
+	p.cancel()
+}
@@ -0,0 +1,96 @@
+package delugerpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClientGo(t *testing.T) {
+	c, d := newTestClient(t)
+	go func() {
+		// replies in the reverse order of the requests
+		first, second := d.read(), d.read()
+		d.reply(second.id, second.method)
+		d.reply(first.id, first.method)
+	}()
+
+	p1 := c.Go(context.Background(), "daemon.info", nil, nil)
+	p2 := c.Go(context.Background(), "core.get_free_space", nil, nil)
+	for _, tt := range []struct {
+		p    *Pending
+		want string
+	}{{p1, "daemon.info"}, {p2, "core.get_free_space"}} {
+		select {
+		case <-tt.p.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("%s not done", tt.want)
+		}
+		var got string
+		if err := tt.p.Result(&got); err != nil || got != tt.want {
+			t.Errorf("got %q, %v, want %q", got, err, tt.want)
+		}
+		// the result may be decoded again
+		if err := tt.p.Result(&got); err != nil || got != tt.want {
+			t.Errorf("got %q, %v on second Result, want %q", got, err, tt.want)
+		}
+	}
+	if err := p1.Result(0); err == nil {
+		t.Error("result decoded into a non-pointer")
+	}
+}
+
+func TestClientGoCancel(t *testing.T) {
+	c, d := newTestClient(t)
+	read := make(chan testRequest)
+	go func() {
+		read <- d.read()
+	}()
+
+	p := c.Go(context.Background(), "daemon.info", nil, nil)
+	req := <-read
+	p.Cancel()
+	if err := p.Result(nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	// the late response is discarded
+	d.reply(req.id, "2.1.1")
+	c.mu.Lock()
+	pending := len(c.pending)
+	c.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d calls still pending", pending)
+	}
+}
+
+func TestClientGoDeadline(t *testing.T) {
+	c, d := newTestClient(t)
+	read := make(chan testRequest)
+	go func() {
+		read <- d.read()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	p := c.Go(ctx, "daemon.info", nil, nil)
+	<-read
+	if err := p.Result(nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestClientGoClosed(t *testing.T) {
+	c, _ := newTestClient(t)
+	c.Close()
+	p := c.Go(context.Background(), "daemon.info", nil, nil)
+	if err := p.Result(nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v, want ErrClosed", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p = c.Go(ctx, "daemon.info", nil, nil)
+	if err := p.Result(nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
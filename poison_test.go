@@ -0,0 +1,81 @@
+package delugerpc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// panicSerializer is Rencode, but panics decoding into a *panicky, and
+// splitting the lists once split is set
+type panicSerializer struct {
+	split *int32
+}
+
+type panicky struct{}
+
+func (s panicSerializer) Marshal(v interface{}) ([]byte, error) {
+	return Rencode.Marshal(v)
+}
+
+func (s panicSerializer) Unmarshal(data []byte, v interface{}) error {
+	if _, ok := v.(*panicky); ok {
+		panic("reflect: call of reflect.Value.SetInt on zero Value")
+	}
+	return Rencode.Unmarshal(data, v)
+}
+
+func (s panicSerializer) SplitList(data []byte) ([][]byte, error) {
+	if atomic.LoadInt32(s.split) != 0 {
+		panic("index out of range")
+	}
+	return Rencode.SplitList(data)
+}
+
+// waitDisconnected waits for the connection of c to be torn down
+func waitDisconnected(t *testing.T, c *Client) {
+	t.Helper()
+	for {
+		select {
+		case s, ok := <-c.StateChanges():
+			if !ok || s == Disconnected {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("state = %v, want %v", c.State(), Disconnected)
+		}
+	}
+}
+
+func TestClientDecodePanic(t *testing.T) {
+	c, d := newTestClient(t, WithSerializer(panicSerializer{split: new(int32)}))
+	go func() {
+		req := d.read()
+		d.reply(req.id, 1)
+	}()
+	err := c.Call(context.Background(), "daemon.info", nil, nil, &panicky{})
+	if !errors.Is(err, ErrPoisoned) {
+		t.Fatalf("got %v, want ErrPoisoned", err)
+	}
+	waitDisconnected(t, c)
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); !errors.Is(err, ErrPoisoned) {
+		t.Errorf("got %v after the panic, want ErrPoisoned", err)
+	}
+}
+
+func TestClientReadLoopPanic(t *testing.T) {
+	split := new(int32)
+	c, d := newTestClient(t, WithSerializer(panicSerializer{split: split}))
+	go func() {
+		req := d.read()
+		atomic.StoreInt32(split, 1)
+		d.reply(req.id, 1)
+	}()
+	err := c.Call(context.Background(), "daemon.info", nil, nil, nil)
+	if !errors.Is(err, ErrPoisoned) {
+		t.Fatalf("got %v, want ErrPoisoned", err)
+	}
+	waitDisconnected(t, c)
+}
@@ -0,0 +1,132 @@
+//go:build prometheus
+
+// Package prommetrics exports the measurements of delugerpc clients to
+// Prometheus. It is only built with the prometheus build tag, so that
+// delugerpc does not depend on the Prometheus client otherwise:
+//
+//	go build -tags prometheus
+package prommetrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rogaps/delugerpc"
+)
+
+// Collector implements delugerpc.Metrics with Prometheus metrics. One
+// Collector may be shared by several clients.
+type Collector struct {
+	calls         *prometheus.CounterVec
+	errors        *prometheus.CounterVec
+	latency       *prometheus.HistogramVec
+	bytesSent     prometheus.Counter
+	bytesReceived prometheus.Counter
+	events        *prometheus.CounterVec
+	connections   prometheus.Counter
+	disconnects   *prometheus.CounterVec
+}
+
+// New returns a collector whose metrics, named delugerpc_*, are registered
+// with reg
+func New(reg prometheus.Registerer) (*Collector, error) {
+	c := &Collector{
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "delugerpc",
+			Name:      "calls_total",
+			Help:      "Calls completed, by method.",
+		}, []string{"method"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "delugerpc",
+			Name:      "call_errors_total",
+			Help:      "Calls failed, by method and exception type, \"transport\" for the calls whose response was not received.",
+		}, []string{"method", "type"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "delugerpc",
+			Name:      "call_duration_seconds",
+			Help:      "Duration of the calls, by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		bytesSent: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "delugerpc",
+			Name:      "sent_bytes_total",
+			Help:      "Bytes of the messages sent to the daemon.",
+		}),
+		bytesReceived: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "delugerpc",
+			Name:      "received_bytes_total",
+			Help:      "Bytes of the messages received from the daemon.",
+		}),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "delugerpc",
+			Name:      "events_total",
+			Help:      "Events pushed by the daemon, by name.",
+		}, []string{"event"}),
+		connections: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "delugerpc",
+			Name:      "connections_total",
+			Help:      "Connections opened to the daemon, reconnections included.",
+		}),
+		disconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "delugerpc",
+			Name:      "disconnections_total",
+			Help:      "Connections closed, by reason: \"closed\" when closed by the application.",
+		}, []string{"reason"}),
+	}
+	for _, m := range []prometheus.Collector{
+		c.calls, c.errors, c.latency, c.bytesSent, c.bytesReceived, c.events, c.connections, c.disconnects,
+	} {
+		if err := reg.Register(m); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// CallCompleted implements delugerpc.Metrics
+func (c *Collector) CallCompleted(method string, d time.Duration, err error) {
+	c.calls.WithLabelValues(method).Inc()
+	c.latency.WithLabelValues(method).Observe(d.Seconds())
+	if err == nil {
+		return
+	}
+	typ := "transport"
+	var e *delugerpc.RPCError
+	if errors.As(err, &e) {
+		typ = e.Type
+	}
+	c.errors.WithLabelValues(method, typ).Inc()
+}
+
+// BytesSent implements delugerpc.Metrics
+func (c *Collector) BytesSent(n int) {
+	c.bytesSent.Add(float64(n))
+}
+
+// BytesReceived implements delugerpc.Metrics
+func (c *Collector) BytesReceived(n int) {
+	c.bytesReceived.Add(float64(n))
+}
+
+// EventReceived implements delugerpc.Metrics
+func (c *Collector) EventReceived(name string) {
+	c.events.WithLabelValues(name).Inc()
+}
+
+// ConnectionOpened implements delugerpc.Metrics
+func (c *Collector) ConnectionOpened() {
+	c.connections.Inc()
+}
+
+// ConnectionClosed implements delugerpc.Metrics
+func (c *Collector) ConnectionClosed(err error) {
+	reason := "error"
+	switch {
+	case errors.Is(err, delugerpc.ErrClosed):
+		reason = "closed"
+	case errors.Is(err, delugerpc.ErrUnresponsive):
+		reason = "unresponsive"
+	}
+	c.disconnects.WithLabelValues(reason).Inc()
+}
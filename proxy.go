@@ -0,0 +1,310 @@
+package delugerpc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ProxyAuth holds the credentials of a SOCKS5 proxy
+type ProxyAuth struct {
+	User     string
+	Password string
+}
+
+// WithSOCKS5 connects to the daemon through the SOCKS5 proxy listening on
+// addr, authenticating with auth unless it is nil. The proxy resolves the
+// host name of the daemon.
+func WithSOCKS5(addr string, auth *ProxyAuth) Option {
+	return func(o *options) {
+		o.proxy = func(forward ContextDialer) ContextDialer {
+			return &socks5Dialer{addr: addr, auth: auth, forward: forward}
+		}
+	}
+}
+
+// WithHTTPProxy connects to the daemon through the HTTP proxy at proxyURL,
+// with the CONNECT method. Credentials held by proxyURL are sent as basic
+// authentication, and an https scheme secures the connection to the proxy.
+func WithHTTPProxy(proxyURL *url.URL) Option {
+	return func(o *options) {
+		o.proxy = func(forward ContextDialer) ContextDialer {
+			return &httpProxyDialer{url: proxyURL, forward: forward}
+		}
+	}
+}
+
+// errNotTCP is returned when dialing a network other than TCP through a proxy
+var errNotTCP = errors.New("delugerpc: proxies only reach TCP addresses")
+
+func isTCPNetwork(network string) bool {
+	return network == "tcp" || network == "tcp4" || network == "tcp6"
+}
+
+// handshake runs f on conn, interrupting it when ctx is done
+func handshake(ctx context.Context, conn net.Conn, f func() error) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			// unblocks f
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+
+	err := f()
+	close(done)
+	<-stopped
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	conn.SetDeadline(time.Time{})
+	return err
+}
+
+type socks5Dialer struct {
+	addr    string
+	auth    *ProxyAuth
+	forward ContextDialer
+}
+
+// The SOCKS5 protocol constants of RFC 1928 and RFC 1929
+const (
+	socks5Version         = 5
+	socks5AuthNone        = 0
+	socks5AuthPassword    = 2
+	socks5PasswordVersion = 1
+	socks5Connect         = 1
+	socks5IPv4            = 1
+	socks5Domain          = 3
+	socks5IPv6            = 4
+)
+
+var socks5Replies = [...]string{
+	1: "general SOCKS server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+func (d *socks5Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if !isTCPNetwork(network) {
+		return nil, errNotTCP
+	}
+	conn, err := d.forward.DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := handshake(ctx, conn, func() error { return d.connect(conn, address) }); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("delugerpc: socks5 proxy %s: %w", d.addr, err)
+	}
+	return conn, nil
+}
+
+func (d *socks5Dialer) connect(conn net.Conn, address string) error {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portString)
+	}
+
+	method := byte(socks5AuthNone)
+	if d.auth != nil {
+		method = socks5AuthPassword
+	}
+	if _, err := conn.Write([]byte{socks5Version, 1, method}); err != nil {
+		return err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("unexpected version %d", reply[0])
+	}
+	if reply[1] != method {
+		return errors.New("no acceptable authentication method")
+	}
+	if method == socks5AuthPassword {
+		if err := d.authenticate(conn); err != nil {
+			return err
+		}
+	}
+
+	req := []byte{socks5Version, socks5Connect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return fmt.Errorf("host name %q is too long", host)
+		}
+		req = append(req, socks5Domain, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, socks5IPv4)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, socks5IPv6)
+		req = append(req, ip...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return err
+	}
+	if header[0] != socks5Version {
+		return fmt.Errorf("unexpected version %d", header[0])
+	}
+	if rep := header[1]; rep != 0 {
+		if int(rep) < len(socks5Replies) {
+			return errors.New(socks5Replies[rep])
+		}
+		return fmt.Errorf("unknown error %d", rep)
+	}
+	// skips the bound address
+	var size int
+	switch header[3] {
+	case socks5IPv4:
+		size = net.IPv4len
+	case socks5IPv6:
+		size = net.IPv6len
+	case socks5Domain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return err
+		}
+		size = int(n[0])
+	default:
+		return fmt.Errorf("unknown address type %d", header[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, size+2))
+	return err
+}
+
+func (d *socks5Dialer) authenticate(conn net.Conn) error {
+	if len(d.auth.User) > 255 || len(d.auth.Password) > 255 {
+		return errors.New("user or password is too long")
+	}
+	req := []byte{socks5PasswordVersion, byte(len(d.auth.User))}
+	req = append(req, d.auth.User...)
+	req = append(req, byte(len(d.auth.Password)))
+	req = append(req, d.auth.Password...)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		return errors.New("authentication failed")
+	}
+	return nil
+}
+
+type httpProxyDialer struct {
+	url     *url.URL
+	forward ContextDialer
+}
+
+func (d *httpProxyDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if !isTCPNetwork(network) {
+		return nil, errNotTCP
+	}
+	proxyAddr := d.url.Host
+	if d.url.Port() == "" {
+		port := "80"
+		if d.url.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(d.url.Hostname(), port)
+	}
+	if d.url.Scheme != "http" && d.url.Scheme != "https" {
+		return nil, fmt.Errorf("delugerpc: unsupported proxy scheme %q", d.url.Scheme)
+	}
+
+	conn, err := d.forward.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if d.url.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{ServerName: d.url.Hostname()})
+	}
+	var br *bufio.Reader
+	err = handshake(ctx, conn, func() (err error) {
+		br, err = d.connect(conn, address)
+		return
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("delugerpc: http proxy %s: %w", proxyAddr, err)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+func (d *httpProxyDialer) connect(conn net.Conn, address string) (*bufio.Reader, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if u := d.url.User; u != nil {
+		password, _ := u.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	return br, nil
+}
+
+// bufferedConn reads the bytes buffered while reading the proxy's response
+// before those of the connection
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
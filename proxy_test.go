@@ -0,0 +1,160 @@
+package delugerpc
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// daemonListener serves a single daemon.info call over a plain connection
+func daemonListener(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		serveOne(t, conn, ProtocolV1, "2.1.1")
+	}()
+	return l
+}
+
+// proxyListener runs serve on every accepted connection
+func proxyListener(t *testing.T, serve func(conn net.Conn)) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return l
+}
+
+// relay copies between the proxied connection and target until either ends
+func relay(conn io.ReadWriter, r io.Reader, target string) {
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+	go io.Copy(upstream, r)
+	io.Copy(conn, upstream)
+}
+
+func callInfo(t *testing.T, addr string, opts ...Option) {
+	t.Helper()
+	c, err := Dial(addr, append(opts, WithoutTLS())...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var info interface{}
+	if err := c.Call("daemon.info", []interface{}{}, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info != "2.1.1" {
+		t.Errorf("info = %v, want 2.1.1", info)
+	}
+}
+
+func TestDialSOCKS5(t *testing.T) {
+	daemon := daemonListener(t)
+	defer daemon.Close()
+	_, port, _ := net.SplitHostPort(daemon.Addr().String())
+
+	var gotUser, gotPassword, gotHost string
+	proxy := proxyListener(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		greeting := make([]byte, 3)
+		io.ReadFull(r, greeting)
+		conn.Write([]byte{5, greeting[2]})
+		if greeting[2] == socks5AuthPassword {
+			header := make([]byte, 2)
+			io.ReadFull(r, header)
+			user := make([]byte, header[1])
+			io.ReadFull(r, user)
+			n, _ := r.ReadByte()
+			password := make([]byte, n)
+			io.ReadFull(r, password)
+			gotUser, gotPassword = string(user), string(password)
+			conn.Write([]byte{1, 0})
+		}
+		req := make([]byte, 5)
+		io.ReadFull(r, req)
+		host := make([]byte, req[4])
+		io.ReadFull(r, host)
+		portBytes := make([]byte, 2)
+		io.ReadFull(r, portBytes)
+		gotHost = string(host)
+		if gotHost != "localhost" {
+			conn.Write([]byte{5, 4, 0, 1, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+		target := net.JoinHostPort("127.0.0.1", strconv.Itoa(int(portBytes[0])<<8|int(portBytes[1])))
+		relay(conn, r, target)
+	})
+	defer proxy.Close()
+
+	callInfo(t, net.JoinHostPort("localhost", port), WithSOCKS5(proxy.Addr().String(), &ProxyAuth{User: "user", Password: "secret"}))
+	if gotUser != "user" || gotPassword != "secret" {
+		t.Errorf("credentials = %q, %q, want user, secret", gotUser, gotPassword)
+	}
+
+	_, err := Dial(net.JoinHostPort("unknown.invalid", port), WithoutTLS(), WithSOCKS5(proxy.Addr().String(), nil))
+	if err == nil {
+		t.Error("expected an error from the proxy")
+	}
+}
+
+func TestDialHTTPProxy(t *testing.T) {
+	daemon := daemonListener(t)
+	defer daemon.Close()
+
+	var gotAuth string
+	proxy := proxyListener(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return
+		}
+		gotAuth = req.Header.Get("Proxy-Authorization")
+		if req.Method != http.MethodConnect {
+			io.WriteString(conn, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+			return
+		}
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		relay(conn, r, req.Host)
+	})
+	defer proxy.Close()
+
+	proxyURL := &url.URL{Scheme: "http", Host: proxy.Addr().String(), User: url.UserPassword("user", "secret")}
+	callInfo(t, daemon.Addr().String(), WithHTTPProxy(proxyURL))
+	if gotAuth != "Basic dXNlcjpzZWNyZXQ=" {
+		t.Errorf("Proxy-Authorization = %q", gotAuth)
+	}
+
+	if _, err := Dial("/run/deluged.sock", WithHTTPProxy(proxyURL)); err == nil {
+		t.Error("expected an error dialing a unix socket through a proxy")
+	}
+}
@@ -0,0 +1,129 @@
+package delugerpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WithRateLimit limits the calls of the client to rate per second on
+// average, with bursts of up to burst calls, so that aggressive pollers do
+// not starve the daemon, which handles the calls one at a time. Calls over
+// the limit wait for their turn, or until their context is done. The methods
+// given their own limit by WithMethodRateLimit are not counted.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(o *options) {
+		o.rateLimit = &rateLimit{rate: rate, burst: burst}
+	}
+}
+
+// WithMethodRateLimit limits the calls of method to rate per second on
+// average, with bursts of up to burst calls, overriding WithRateLimit
+func WithMethodRateLimit(method string, rate float64, burst int) Option {
+	return func(o *options) {
+		if o.methodRateLimits == nil {
+			o.methodRateLimits = make(map[string]rateLimit)
+		}
+		o.methodRateLimits[method] = rateLimit{rate: rate, burst: burst}
+	}
+}
+
+// rateLimit is a limit set by WithRateLimit or WithMethodRateLimit
+type rateLimit struct {
+	rate  float64
+	burst int
+}
+
+func (l rateLimit) validate() error {
+	if l.rate <= 0 || l.burst < 1 {
+		return fmt.Errorf("delugerpc: invalid rate limit of %v calls per second in bursts of %d", l.rate, l.burst)
+	}
+	return nil
+}
+
+// rateLimiter applies the rate limits of a client
+type rateLimiter struct {
+	all     *tokenBucket
+	methods map[string]*tokenBucket
+}
+
+func newRateLimiter(o options) *rateLimiter {
+	if o.rateLimit == nil && len(o.methodRateLimits) == 0 {
+		return nil
+	}
+	l := &rateLimiter{methods: make(map[string]*tokenBucket)}
+	if o.rateLimit != nil {
+		l.all = newTokenBucket(*o.rateLimit)
+	}
+	for method, limit := range o.methodRateLimits {
+		l.methods[method] = newTokenBucket(limit)
+	}
+	return l
+}
+
+// wait waits for the turn of a call of method. A nil limiter never waits.
+func (l *rateLimiter) wait(ctx context.Context, method string) error {
+	if l == nil {
+		return nil
+	}
+	if b, ok := l.methods[method]; ok {
+		return b.wait(ctx)
+	}
+	if l.all != nil {
+		return l.all.wait(ctx)
+	}
+	return nil
+}
+
+// tokenBucket holds up to burst tokens, refilled at rate per second, each
+// call taking one
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit rateLimit) *tokenBucket {
+	return &tokenBucket{
+		rate:   limit.rate,
+		burst:  float64(limit.burst),
+		tokens: float64(limit.burst),
+		last:   time.Now(),
+	}
+}
+
+// wait takes a token, waiting for it to be refilled if needed
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	// the token is reserved, even if it is refilled later, so that the
+	// waiting calls proceed in order
+	b.tokens--
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// gives the reservation back
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,64 @@
+package delugerpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(rateLimit{rate: 20, burst: 2})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := b.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the burst passes at once, the third call waits for a token
+	if d := time.Since(start); d < 40*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("3 calls took %v, want about 50ms", d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	// the reservation given up on is given back
+	b.mu.Lock()
+	tokens := b.tokens
+	b.mu.Unlock()
+	if tokens < -0.5 {
+		t.Errorf("tokens = %v after a canceled wait", tokens)
+	}
+}
+
+func TestClientRateLimit(t *testing.T) {
+	c, d := newTestClient(t, WithRateLimit(0.1, 1), WithMethodRateLimit("daemon.info", 1000, 10))
+	go func() {
+		// the call given up on is never sent
+		for i := 0; i < 7; i++ {
+			req := d.read()
+			d.reply(req.id, nil)
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Call(context.Background(), "core.get_session_state", nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	// the next call is due in 10 seconds
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Call(ctx, "core.get_session_state", nil, nil, nil); err != context.DeadlineExceeded {
+		t.Errorf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	// other methods are limited separately
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,195 @@
+package delugerpc
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// WithReconnect makes the clients returned by DialClient and DialContext
+// dial the daemon again when the connection is lost, instead of shutting
+// down. The attempts are min apart at first, then twice as far apart each
+// time up to max. Once connected, the client logs in again with the
+// arguments of the last successful daemon.login and asks for the events of
+// EventInterest again, before moving back to Authenticated; the calls
+// pending when the connection was lost fail with its error, and the calls
+// made until it is restored fail at once. Only Close moves the client to
+// Disconnected. Zero, the default, never reconnects.
+func WithReconnect(min, max time.Duration) Option {
+	return func(o *options) {
+		o.reconnectMin = min
+		o.reconnectMax = max
+	}
+}
+
+// redialer dials the daemon again for a client, see WithReconnect
+type redialer struct {
+	o                options
+	network, address string
+	// wait is the delay before the next attempt, guarded by the mutex of
+	// the client
+	wait time.Duration
+}
+
+// redialer returns the redialer of a client dialing address, nil without
+// WithReconnect
+func (o *options) redialer(network, address string) *redialer {
+	if o.reconnectMin == 0 {
+		return nil
+	}
+	return &redialer{o: *o, network: network, address: address, wait: o.reconnectMin}
+}
+
+// backoff doubles the delay before the next attempt, up to the maximum
+func (r *redialer) backoff() {
+	if r.wait *= 2; r.wait > r.o.reconnectMax {
+		r.wait = r.o.reconnectMax
+	}
+}
+
+// restoreKey marks the context of the calls restoring a new connection,
+// which go through while the other calls are refused
+type restoreKey struct{}
+
+// lose fails the pending calls with err, the reason the connection was lost,
+// and reports whether the client should reconnect rather than shut down
+func (c *Client) lose(err error) bool {
+	c.mu.Lock()
+	if c.closing {
+		c.mu.Unlock()
+		return false
+	}
+	if c.failErr != nil {
+		err = c.failErr
+	}
+	c.down = err
+	c.log(LogInfo, "connection lost", LogField{"error", err})
+	if c.metrics != nil {
+		c.metrics.ConnectionClosed(err)
+	}
+	for id, p := range c.pending {
+		delete(c.pending, id)
+		p.outcome.failure()
+		p.deliver(&message{typ: rpcError, id: id, err: err})
+	}
+	c.conn.Close()
+	c.mu.Unlock()
+	c.stateMu.Lock()
+	c.authLevel = 0
+	c.stateMu.Unlock()
+	c.setState(Connecting)
+	return true
+}
+
+// reconnect dials the daemon until it succeeds or the client is closed, in
+// which case it returns ErrClosed
+func (c *Client) reconnect() error {
+	for {
+		c.mu.Lock()
+		wait := c.redialer.wait
+		c.mu.Unlock()
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-c.quit:
+			t.Stop()
+			return ErrClosed
+		}
+		err := c.redial()
+		if err == nil || err == ErrClosed {
+			return err
+		}
+		c.log(LogWarn, "reconnecting failed", LogField{"error", err})
+		c.mu.Lock()
+		c.redialer.backoff()
+		c.mu.Unlock()
+	}
+}
+
+// redial dials the daemon once, and restores the new connection in the
+// background, the read loop having to run for its calls to complete
+func (c *Client) redial() error {
+	r := c.redialer
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	conn, err := r.o.dial(ctx, r.network, r.address)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ErrClosed
+		}
+		return err
+	}
+	mc := newMessageConn(conn, r.o)
+	c.mu.Lock()
+	if c.closing {
+		c.mu.Unlock()
+		mc.Close()
+		return ErrClosed
+	}
+	c.conn = mc
+	c.failErr = nil
+	c.mu.Unlock()
+	atomic.StoreInt64(&c.lastRead, time.Now().UnixNano())
+	if c.metrics != nil {
+		c.metrics.ConnectionOpened()
+	}
+	c.log(LogInfo, "reconnected", LogField{"address", r.address})
+	go c.restore(mc)
+	return nil
+}
+
+// restore logs in again on mc, the new connection, fetches the version of
+// the daemon again when WithDaemonVersion is set, and sends the event
+// interest again, before letting the calls through. On failure, mc is torn
+// down to be dialed again.
+func (c *Client) restore(mc *messageConn) {
+	ctx := context.WithValue(context.Background(), restoreKey{}, true)
+	if t := c.redialer.o.handshakeTimeout; t > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t)
+		defer cancel()
+	}
+	c.stateMu.Lock()
+	login := c.login
+	c.stateMu.Unlock()
+	var err error
+	if login != nil {
+		err = c.Call(ctx, login.method, login.args, login.kwargs, nil)
+	}
+	if err == nil && c.redialer.o.daemonVersion {
+		c.versionMu.Lock()
+		c.version = nil
+		c.versionMu.Unlock()
+		_, err = c.DaemonVersion(ctx)
+	}
+	if names := c.EventInterest(); err == nil && len(names) > 0 {
+		err = c.Call(ctx, "daemon.set_event_interest", Args{names}, nil, nil)
+	}
+	if err != nil {
+		c.failConn(mc, fmt.Errorf("delugerpc: restoring the connection: %w", err))
+		return
+	}
+	c.mu.Lock()
+	restored := c.conn == mc && c.failErr == nil
+	if restored {
+		c.down = nil
+		c.redialer.wait = c.redialer.o.reconnectMin
+	}
+	c.mu.Unlock()
+	if !restored {
+		return
+	}
+	if login != nil {
+		c.setState(Authenticated)
+	} else {
+		c.setState(Connected)
+	}
+}
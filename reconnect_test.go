@@ -0,0 +1,173 @@
+package delugerpc
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// acceptDaemons returns the daemons serving the connections accepted by l
+func acceptDaemons(t *testing.T, l net.Listener) <-chan *testDaemon {
+	daemons := make(chan *testDaemon, 4)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			daemons <- &testDaemon{t: t, conn: newMessageConn(conn, newOptions(nil))}
+		}
+	}()
+	return daemons
+}
+
+// nextDaemon returns the daemon serving the next connection
+func nextDaemon(t *testing.T, daemons <-chan *testDaemon) *testDaemon {
+	t.Helper()
+	select {
+	case d := <-daemons:
+		t.Cleanup(func() { d.conn.Close() })
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("no connection")
+		return nil
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	l := listen(t)
+	daemons := acceptDaemons(t, l)
+	ctx := context.Background()
+	c, err := DialClient(ctx, l.Addr().String(), WithoutTLS(), WithReconnect(10*time.Millisecond, 40*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	changes := c.StateChanges()
+	d := nextDaemon(t, daemons)
+	go func() {
+		req := d.read()
+		d.reply(req.id, 5)
+	}()
+	if _, err := c.Login(ctx, "user", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the calls pending when the connection is lost fail
+	done := make(chan error, 1)
+	go func() { done <- c.Call(ctx, "core.get_session_state", nil, nil, nil) }()
+	d.read()
+	d.conn.Close()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("pending call succeeded")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pending call not failed")
+	}
+
+	// the client logs in again before letting the calls through
+	d = nextDaemon(t, daemons)
+	req := d.read()
+	if req.method != "daemon.login" || !reflect.DeepEqual(req.args, []interface{}{"user", "secret"}) {
+		t.Fatalf("got %s%v, want daemon.login[user secret]", req.method, req.args)
+	}
+	if err := c.Call(ctx, "daemon.info", nil, nil, nil); err == nil {
+		t.Error("call made while restoring the connection succeeded")
+	}
+	d.reply(req.id, 5)
+
+	var states []ConnState
+	for len(states) < 4 {
+		select {
+		case s := <-changes:
+			states = append(states, s)
+		case <-time.After(time.Second):
+			t.Fatalf("states = %v", states)
+		}
+	}
+	if want := []ConnState{Connected, Authenticated, Connecting, Authenticated}; !reflect.DeepEqual(states, want) {
+		t.Fatalf("states = %v, want %v", states, want)
+	}
+	if level := c.AuthLevel(); level != 5 {
+		t.Errorf("auth level = %d, want 5", level)
+	}
+	go func() {
+		req := d.read()
+		d.reply(req.id, "2.1.1")
+	}()
+	var v string
+	if err := c.Call(ctx, "daemon.info", nil, nil, &v); err != nil || v != "2.1.1" {
+		t.Errorf("got %q, %v, want 2.1.1", v, err)
+	}
+}
+
+func TestClientReconnectClose(t *testing.T) {
+	l := listen(t)
+	daemons := acceptDaemons(t, l)
+	c, err := DialClient(context.Background(), l.Addr().String(), WithoutTLS(), WithReconnect(10*time.Millisecond, 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := c.StateChanges()
+	<-changes
+	d := nextDaemon(t, daemons)
+	l.Close()
+	d.conn.Close()
+	select {
+	case s := <-changes:
+		if s != Connecting {
+			t.Fatalf("state = %v, want %v", s, Connecting)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("connection loss not noticed")
+	}
+	// dialing fails until the client is closed
+	time.Sleep(30 * time.Millisecond)
+	c.Close()
+	waitDisconnected(t, c)
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err != ErrClosed {
+		t.Errorf("err = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestClientReconnectEventInterest(t *testing.T) {
+	l := listen(t)
+	daemons := acceptDaemons(t, l)
+	ctx := context.Background()
+	c, err := DialClient(ctx, l.Addr().String(), WithoutTLS(), WithReconnect(10*time.Millisecond, 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	d := nextDaemon(t, daemons)
+	go func() {
+		req := d.read()
+		d.reply(req.id, true)
+	}()
+	events, err := c.SubscribeEvents(ctx, "TorrentAddedEvent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.conn.Close()
+
+	// the daemon is asked for the events again on the new connection
+	d = nextDaemon(t, daemons)
+	req := d.read()
+	if req.method != "daemon.set_event_interest" || !reflect.DeepEqual(req.args, []interface{}{[]interface{}{"TorrentAddedEvent"}}) {
+		t.Fatalf("got %s%v, want daemon.set_event_interest[[TorrentAddedEvent]]", req.method, req.args)
+	}
+	d.reply(req.id, true)
+	d.send(int(rpcEvent), "TorrentAddedEvent", []interface{}{"abc", false})
+	select {
+	case e := <-events:
+		if e.Name != "TorrentAddedEvent" {
+			t.Errorf("event = %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event after reconnecting")
+	}
+}
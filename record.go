@@ -0,0 +1,272 @@
+package delugerpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/rogaps/delugerpc/rencode"
+)
+
+// recordingMagic starts a recording, followed by its protocol version
+const recordingMagic = "delugerpc recording"
+
+// The directions of the recorded messages
+const (
+	recordSent     = ">"
+	recordReceived = "<"
+)
+
+// Recorder records the messages exchanged by a client with the daemon, for a
+// Replayer to serve them back in tests. A recording is a stream of rencode
+// values, and holds the passwords given to daemon.login.
+type Recorder struct {
+	mu      sync.Mutex
+	w       io.Writer
+	started bool
+	err     error
+}
+
+// NewRecorder returns a recorder writing its recording to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// WithRecorder records the messages of the connection with r, which records
+// one connection. The messages must be encoded with Rencode.
+func WithRecorder(r *Recorder) Option {
+	return func(o *options) {
+		o.recorder = r
+	}
+}
+
+// Err returns the first error met recording, which stops the recording
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// record appends the body of a message, sent or received according to dir
+func (r *Recorder) record(version ProtocolVersion, dir string, body []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	var b []byte
+	if !r.started {
+		r.started = true
+		if b, r.err = rencode.Append(b, []interface{}{recordingMagic, int(version)}); r.err != nil {
+			return
+		}
+	}
+	if b, r.err = rencode.Append(b, []interface{}{dir, rencode.RawMessage(body)}); r.err != nil {
+		return
+	}
+	_, r.err = r.w.Write(b)
+}
+
+// Replayer plays the daemon of a recording made by a Recorder: the requests
+// are answered with the recorded responses to the same calls, and the
+// events recorded after a request are sent after its response. The calls
+// not recorded fail with a ReplayError. Replayer is a ContextDialer, whose
+// connections each replay the whole recording; see Options.
+type Replayer struct {
+	version ProtocolVersion
+	// initial holds the events received before the first request
+	initial   []replyRecord
+	exchanges []*exchange
+}
+
+// exchange is a recorded request, and the messages received after it
+type exchange struct {
+	// call identifies the request by its method and arguments
+	call    string
+	replies []replyRecord
+}
+
+// replyRecord is a recorded message received, whose request id is replaced
+// when it is a response
+type replyRecord struct {
+	body     rencode.RawMessage
+	response bool
+}
+
+// NewReplayer returns a replayer of the recording read from r
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	d := rencode.NewDecoder(r)
+	var header []interface{}
+	if err := d.Decode(&header); err != nil {
+		return nil, fmt.Errorf("delugerpc: reading recording: %w", err)
+	}
+	if len(header) != 2 || header[0] != recordingMagic {
+		return nil, errors.New("delugerpc: not a recording")
+	}
+	version, _ := header[1].(int64)
+	rp := &Replayer{version: ProtocolVersion(version)}
+	// byID finds the exchanges by the request id of the recording
+	byID := make(map[int64]*exchange)
+	for {
+		var rec []rencode.RawMessage
+		if err := d.Decode(&rec); err == io.EOF {
+			return rp, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("delugerpc: reading recording: %w", err)
+		}
+		var dir string
+		if len(rec) != 2 || Rencode.Unmarshal(rec[0], &dir) != nil {
+			return nil, errors.New("delugerpc: malformed recording")
+		}
+		body := rec[1]
+		switch dir {
+		case recordSent:
+			reqs, err := parseRequests(body)
+			if err != nil {
+				return nil, err
+			}
+			for _, req := range reqs {
+				x := &exchange{call: req.call()}
+				byID[req.id] = x
+				rp.exchanges = append(rp.exchanges, x)
+			}
+		case recordReceived:
+			msg, err := parseMessage(Rencode, body)
+			if err != nil {
+				return nil, err
+			}
+			reply := replyRecord{body: body}
+			if msg.typ == rpcEvent {
+				if len(rp.exchanges) == 0 {
+					rp.initial = append(rp.initial, reply)
+				} else {
+					x := rp.exchanges[len(rp.exchanges)-1]
+					x.replies = append(x.replies, reply)
+				}
+			} else if x := byID[msg.id]; x != nil {
+				reply.response = true
+				x.replies = append(x.replies, reply)
+			}
+		default:
+			return nil, fmt.Errorf("delugerpc: unknown recorded direction %q", dir)
+		}
+	}
+}
+
+// requestRecord is a request as encoded in a message
+type requestRecord struct {
+	id     int64
+	method string
+	args   rencode.RawMessage
+	kwargs rencode.RawMessage
+}
+
+// call identifies the call, the arguments being encoded in a canonical way
+func (r requestRecord) call() string {
+	return r.method + "\x00" + string(r.args) + "\x00" + string(r.kwargs)
+}
+
+// parseRequests parses the requests of a message sent to the daemon
+func parseRequests(body []byte) ([]requestRecord, error) {
+	var raw [][]rencode.RawMessage
+	if err := Rencode.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("delugerpc: malformed request: %w", err)
+	}
+	reqs := make([]requestRecord, len(raw))
+	for i, elems := range raw {
+		if len(elems) != 4 {
+			return nil, errors.New("delugerpc: malformed request")
+		}
+		req := requestRecord{args: elems[2], kwargs: elems[3]}
+		if err := Rencode.Unmarshal(elems[0], &req.id); err != nil {
+			return nil, fmt.Errorf("delugerpc: malformed request: %w", err)
+		}
+		if err := Rencode.Unmarshal(elems[1], &req.method); err != nil {
+			return nil, fmt.Errorf("delugerpc: malformed request: %w", err)
+		}
+		reqs[i] = req
+	}
+	return reqs, nil
+}
+
+// Options returns the options connecting to the replayer instead of the
+// daemon, to be given to DialClient along with the address of the daemon
+func (rp *Replayer) Options() []Option {
+	return []Option{WithDialer(rp), WithoutTLS(), WithProtocolVersion(rp.version)}
+}
+
+// DialContext returns a connection to a new replay of the recording
+func (rp *Replayer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	client, server := net.Pipe()
+	go rp.serve(server)
+	return client, nil
+}
+
+// serve replays the recording on conn until the connection is closed
+func (rp *Replayer) serve(conn net.Conn) {
+	defer conn.Close()
+	mc := newMessageConn(conn, newOptions([]Option{WithProtocolVersion(rp.version)}))
+	used := make([]bool, len(rp.exchanges))
+	if rp.replay(mc, 0, rp.initial) != nil {
+		return
+	}
+	for {
+		body, err := mc.readMessage()
+		if err != nil {
+			return
+		}
+		reqs, err := parseRequests(body)
+		if err != nil {
+			return
+		}
+		for _, req := range reqs {
+			x := rp.find(req.call(), used)
+			if x == nil {
+				err = mc.writeMessage([]interface{}{int(rpcError), req.id, "ReplayError",
+					[]interface{}{"no recorded response to " + req.method}, map[string]interface{}{}, ""})
+			} else {
+				err = rp.replay(mc, req.id, x.replies)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// find returns the first exchange of call not used yet, marking it used
+func (rp *Replayer) find(call string, used []bool) *exchange {
+	for i, x := range rp.exchanges {
+		if !used[i] && x.call == call {
+			used[i] = true
+			return x
+		}
+	}
+	return nil
+}
+
+// replay sends replies, the responses being given the request id
+func (rp *Replayer) replay(mc *messageConn, id int64, replies []replyRecord) error {
+	for _, reply := range replies {
+		var msg interface{} = reply.body
+		if reply.response {
+			var elems []rencode.RawMessage
+			if err := Rencode.Unmarshal(reply.body, &elems); err != nil {
+				return err
+			}
+			rawID, err := rencode.Append(nil, id)
+			if err != nil {
+				return err
+			}
+			elems[1] = rawID
+			msg = elems
+		}
+		if err := mc.writeMessage(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package delugerpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRecordReplay(t *testing.T) {
+	var recording bytes.Buffer
+	rec := NewRecorder(&recording)
+	client, server := net.Pipe()
+	c, err := NewClient(client, WithProtocolVersion(ProtocolV2), WithRecorder(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &testDaemon{t: t, conn: newMessageConn(server, newOptions([]Option{WithProtocolVersion(ProtocolV2)}))}
+	go func() {
+		req := d.read()
+		d.reply(req.id, "2.1.1")
+		req = d.read()
+		d.send(int(rpcEvent), "TorrentAddedEvent", []interface{}{"abc", false})
+		d.reply(req.id, map[string]interface{}{"abc": map[string]interface{}{"name": "ubuntu.iso"}})
+		req = d.read()
+		d.send(int(rpcError), req.id, "InvalidTorrentError", []interface{}{"no such torrent"}, map[string]interface{}{}, "")
+	}()
+	// session makes the same calls against the daemon and the replay
+	session := func(c *Client) {
+		t.Helper()
+		events := make(chan Event, 1)
+		c.OnEvent("TorrentAddedEvent", func(e Event) { events <- e })
+		var version string
+		if err := c.Call(context.Background(), "daemon.info", nil, nil, &version); err != nil || version != "2.1.1" {
+			t.Errorf("got version %q, %v", version, err)
+		}
+		var status map[string]map[string]string
+		err := c.Call(context.Background(), "core.get_torrents_status", Args{map[string]interface{}{"id": "abc"}, []string{"name"}}, nil, &status)
+		if err != nil || status["abc"]["name"] != "ubuntu.iso" {
+			t.Errorf("got status %v, %v", status, err)
+		}
+		select {
+		case e := <-events:
+			if e.Args[0] != "abc" {
+				t.Errorf("got event %+v", e)
+			}
+		case <-time.After(time.Second):
+			t.Error("event not received")
+		}
+		err = c.Call(context.Background(), "core.remove_torrent", Args{"xyz", false}, nil, nil)
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) || rpcErr.Type != "InvalidTorrentError" {
+			t.Errorf("got %v, want an InvalidTorrentError", err)
+		}
+	}
+	session(c)
+	c.Close()
+	server.Close()
+	if err := rec.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	rp, err := NewReplayer(bytes.NewReader(recording.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		c, err := DialClient(context.Background(), "deluge.internal", rp.Options()...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		session(c)
+		err = c.Call(context.Background(), "core.pause_torrent", Args{"abc"}, nil, nil)
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) || rpcErr.Type != "ReplayError" {
+			t.Errorf("got %v for a call not recorded, want a ReplayError", err)
+		}
+		c.Close()
+	}
+}
+
+func TestNewReplayerInvalid(t *testing.T) {
+	for _, data := range []string{"", "not a recording", "l2:ab2:cde"} {
+		if _, err := NewReplayer(bytes.NewReader([]byte(data))); err == nil {
+			t.Errorf("%q: expected an error", data)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package rencode
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// EncodeFunc encodes v, a value of the type it is registered for, typically
+// through the Encode* primitives of e
+type EncodeFunc func(e *Encoder, v interface{}) error
+
+// DecodeFunc decodes the next value of d and returns it as a value of the
+// type it is registered for
+type DecodeFunc func(d *Decoder) (interface{}, error)
+
+type typeAdapter struct {
+	enc EncodeFunc
+	dec DecodeFunc
+}
+
+var (
+	adapters   sync.Map
+	adaptersMu sync.Mutex
+	// adapted is the number of registered types, to skip the lookups when
+	// there is none
+	adapted int32
+)
+
+// RegisterTypeAdapter registers the functions encoding and decoding the
+// values of type t, for types of other packages that cannot implement
+// Marshaler and Unmarshaler, such as netip.Addr. Adapters take precedence
+// over the methods of the type. Either function may be nil to adapt a single
+// direction, and registering two nil functions removes the adapter of t. It
+// is typically called from an init function.
+func RegisterTypeAdapter(t reflect.Type, enc EncodeFunc, dec DecodeFunc) {
+	adaptersMu.Lock()
+	defer adaptersMu.Unlock()
+	_, registered := adapters.Load(t)
+	switch {
+	case enc == nil && dec == nil:
+		if registered {
+			adapters.Delete(t)
+			atomic.AddInt32(&adapted, -1)
+		}
+	default:
+		adapters.Store(t, &typeAdapter{enc: enc, dec: dec})
+		if !registered {
+			atomic.AddInt32(&adapted, 1)
+		}
+	}
+}
+
+func adapterOf(t reflect.Type) *typeAdapter {
+	if atomic.LoadInt32(&adapted) == 0 {
+		return nil
+	}
+	a, ok := adapters.Load(t)
+	if !ok {
+		return nil
+	}
+	return a.(*typeAdapter)
+}
+
+// encoderAdapter returns the EncodeFunc registered for the type of v
+func encoderAdapter(v reflect.Value) (EncodeFunc, bool) {
+	if a := adapterOf(v.Type()); a != nil && a.enc != nil && v.CanInterface() {
+		return a.enc, true
+	}
+	return nil, false
+}
+
+// decodeAdapted decodes the next value into v with the DecodeFunc registered
+// for its type, and reports whether there is one
+func (d *Decoder) decodeAdapted(v reflect.Value) (bool, error) {
+	a := adapterOf(v.Type())
+	if a == nil || a.dec == nil {
+		return false, nil
+	}
+	d.only = nil
+	x, err := a.dec(d)
+	if err != nil {
+		return true, err
+	}
+	xv := reflect.ValueOf(x)
+	if !xv.IsValid() {
+		v.Set(reflect.Zero(v.Type()))
+		return true, nil
+	}
+	if !xv.Type().AssignableTo(v.Type()) {
+		return true, fmt.Errorf("rencode: the adapter of %s returned a %s", v.Type(), xv.Type())
+	}
+	v.Set(xv)
+	return true, nil
+}
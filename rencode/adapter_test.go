@@ -0,0 +1,81 @@
+package rencode
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// hostPort is a type whose adapter encodes it as "host:port"
+type hostPort struct {
+	Host string
+	Port int
+}
+
+var hostPortType = reflect.TypeOf(hostPort{})
+
+func registerHostPort() {
+	RegisterTypeAdapter(hostPortType,
+		func(e *Encoder, v interface{}) error {
+			hp := v.(hostPort)
+			return e.EncodeString(net.JoinHostPort(hp.Host, fmt.Sprint(hp.Port)))
+		},
+		func(d *Decoder) (interface{}, error) {
+			var s string
+			if err := d.Decode(&s); err != nil {
+				return nil, err
+			}
+			host, port, err := net.SplitHostPort(s)
+			if err != nil {
+				return nil, err
+			}
+			hp := hostPort{Host: host}
+			_, err = fmt.Sscan(port, &hp.Port)
+			return hp, err
+		})
+}
+
+func TestTypeAdapter(t *testing.T) {
+	registerHostPort()
+	defer RegisterTypeAdapter(hostPortType, nil, nil)
+
+	type peer struct {
+		Addr  hostPort  `rencode:"addr"`
+		Proxy *hostPort `rencode:"proxy"`
+	}
+	p := peer{Addr: hostPort{"10.0.0.1", 6881}}
+	data, err := Append(nil, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "h\x84addr\x8d10.0.0.1:6881\x85proxyE"
+	if string(data) != expected {
+		t.Fatalf("\nexpected: %+q\nactual  : %+q", expected, data)
+	}
+
+	var decoded peer
+	data = []byte("h\x84addr\x8d10.0.0.1:6881\x85proxy\x88[::1]:80")
+	if err := NewDecoder(bytes.NewReader(data)).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	expectedPeer := peer{Addr: p.Addr, Proxy: &hostPort{"::1", 80}}
+	if !reflect.DeepEqual(decoded, expectedPeer) {
+		t.Fatalf("\nexpected: %+v\nactual  : %+v", expectedPeer, decoded)
+	}
+
+	if err := NewDecoder(bytes.NewBufferString("\x83foo")).Decode(&decoded.Addr); err == nil {
+		t.Fatal("expected an error from the adapter")
+	}
+
+	// removing the adapter restores the default encoding
+	RegisterTypeAdapter(hostPortType, nil, nil)
+	data, err = Append(nil, p.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "h\x84Host\x8810.0.0.1\x84Port?\x1a\xe1"; string(data) != expected {
+		t.Fatalf("\nexpected: %+q\nactual  : %+q", expected, data)
+	}
+}
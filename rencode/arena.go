@@ -0,0 +1,68 @@
+package rencode
+
+// defaultArenaChunkSize is the size of the chunks of an Arena created with a
+// chunk size of zero
+const defaultArenaChunkSize = 64 << 10
+
+// Arena is a memory region the decoded strings and byte slices are carved
+// from, when set with Decoder.UseArena, instead of being allocated one by
+// one. Reset releases them all at once, making the region available for the
+// next decodes: the values decoded from the arena must not be used after
+// Reset. Services decoding many short-lived frames save most of their
+// allocations this way. An Arena is not safe for concurrent use.
+type Arena struct {
+	chunkSize int
+	chunks    [][]byte
+	// used is the number of chunks in use, the last one being filled
+	used int
+}
+
+// NewArena returns an Arena allocating memory by chunks of chunkSize bytes,
+// 64KiB when zero. Values larger than a quarter of a chunk are allocated
+// separately.
+func NewArena(chunkSize int) *Arena {
+	if chunkSize <= 0 {
+		chunkSize = defaultArenaChunkSize
+	}
+	return &Arena{chunkSize: chunkSize}
+}
+
+// fits reports whether a value of n bytes is carved from the arena
+func (a *Arena) fits(n int64) bool {
+	return n <= int64(a.chunkSize/4)
+}
+
+// alloc returns n bytes of the arena, which must fit in it
+func (a *Arena) alloc(n int) []byte {
+	if a.used > 0 {
+		c := &a.chunks[a.used-1]
+		if start := len(*c); cap(*c)-start >= n {
+			*c = (*c)[:start+n]
+			return (*c)[start : start+n : start+n]
+		}
+	}
+	if a.used == len(a.chunks) {
+		a.chunks = append(a.chunks, make([]byte, 0, a.chunkSize))
+	}
+	c := &a.chunks[a.used]
+	a.used++
+	*c = (*c)[:n]
+	return (*c)[:n:n]
+}
+
+// Reset releases all the values carved from the arena, keeping its memory
+// for the next ones
+func (a *Arena) Reset() {
+	for i := 0; i < a.used; i++ {
+		a.chunks[i] = a.chunks[i][:0]
+	}
+	a.used = 0
+}
+
+// UseArena sets the arena the decoded strings and byte slices are carved
+// from, nil to allocate them separately again. Strings then share the memory
+// of the arena, like with ZeroCopyStrings, and are only valid until the
+// arena is reset.
+func (d *Decoder) UseArena(a *Arena) {
+	d.arena = a
+}
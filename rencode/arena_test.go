@@ -0,0 +1,57 @@
+package rencode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDecoderArena(t *testing.T) {
+	var names []string
+	for i := 0; i < 50; i++ {
+		names = append(names, strings.Repeat("x", i))
+	}
+	names = append(names, strings.Repeat("large", 1000))
+	data, err := Append(nil, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arena := NewArena(1024)
+	decode := func() []string {
+		var decoded []string
+		d := NewDecoder(bytes.NewReader(data))
+		d.UseArena(arena)
+		if err := d.Decode(&decoded); err != nil {
+			t.Fatal(err)
+		}
+		return decoded
+	}
+	decoded := decode()
+	for i := range names {
+		if decoded[i] != names[i] {
+			t.Fatalf("unexpected string %d: %q", i, decoded[i])
+		}
+	}
+	if arena.used < 2 {
+		t.Fatalf("expected the strings to span several chunks, got %d", arena.used)
+	}
+
+	// the chunks are reused after Reset
+	used := arena.used
+	arena.Reset()
+	allocs := testing.AllocsPerRun(10, func() {
+		arena.Reset()
+		decode()
+	})
+	if arena.used != used || len(arena.chunks) != used {
+		t.Fatalf("chunks not reused: %d used, %d allocated", arena.used, len(arena.chunks))
+	}
+	withoutArena := testing.AllocsPerRun(10, func() {
+		var decoded []string
+		NewDecoder(bytes.NewReader(data)).Decode(&decoded)
+	})
+	if allocs > withoutArena-40 {
+		t.Fatalf("%v allocations with an arena, %v without", allocs, withoutArena)
+	}
+}
@@ -0,0 +1,39 @@
+//go:build !race
+
+package benchmarks
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rogaps/delugerpc/rencode"
+)
+
+// allocsMargin is the share of allocations above the baselines tolerated
+const allocsMargin = 0.05
+
+// TestAllocs fails when the allocations of a payload grow past its
+// baselines. Baselines lowered by an optimization should be updated too.
+func TestAllocs(t *testing.T) {
+	for _, p := range payloads {
+		data := encode(t, p.value)
+		buf := make([]byte, 0, len(data))
+		allocs := testing.AllocsPerRun(10, func() {
+			if _, err := rencode.Append(buf[:0], p.value); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs > p.encodeAllocs*(1+allocsMargin) {
+			t.Errorf("%s: encoding allocates %v times, baseline %v", p.name, allocs, p.encodeAllocs)
+		}
+
+		allocs = testing.AllocsPerRun(10, func() {
+			if err := rencode.NewDecoder(bytes.NewReader(data)).Decode(p.decoded()); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs > p.decodeAllocs*(1+allocsMargin) {
+			t.Errorf("%s: decoding allocates %v times, baseline %v", p.name, allocs, p.decodeAllocs)
+		}
+	}
+}
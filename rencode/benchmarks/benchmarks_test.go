@@ -0,0 +1,66 @@
+package benchmarks
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rogaps/delugerpc/rencode"
+)
+
+// payload is a value to encode, along with the destination to decode it into
+// and the allocations per encode and decode measured when the payload was
+// added, which TestAllocs checks against
+type payload struct {
+	name  string
+	value interface{}
+	// decoded returns a new destination
+	decoded      func() interface{}
+	encodeAllocs float64
+	decodeAllocs float64
+}
+
+var payloads = []payload{
+	{"Status100", statusPayload(100), func() interface{} { return new(map[string]torrentStatus) }, 1302, 4574},
+	{"StatusInterface100", statusPayload(100), func() interface{} { return new(interface{}) }, 1302, 8765},
+	{"FileTree1000", fileTreePayload(1000), func() interface{} { return new(fileTree) }, 5005, 11950},
+	{"Session", sessionPayload(), func() interface{} { return new(map[string]interface{}) }, 62, 122},
+}
+
+func encode(tb testing.TB, v interface{}) []byte {
+	data, err := rencode.Append(nil, v)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, p := range payloads {
+		b.Run(p.name, func(b *testing.B) {
+			buf := encode(b, p.value)
+			b.SetBytes(int64(len(buf)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var err error
+				if buf, err = rencode.Append(buf[:0], p.value); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, p := range payloads {
+		b.Run(p.name, func(b *testing.B) {
+			data := encode(b, p.value)
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := rencode.NewDecoder(bytes.NewReader(data)).Decode(p.decoded()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+// Package benchmarks measures the encoding and decoding of representative
+// Deluge payloads: the status of a hundred torrents, decoded into structs and
+// into an interface{}, the file tree of a thousand file torrent, and the
+// session status. It only holds tests.
+//
+// The allocations per operation of each payload are recorded as baselines
+// next to it, and TestAllocs fails when they grow by more than 5%, so that
+// allocation regressions are caught by go test. TestAllocs is left out of
+// -race builds, whose instrumentation allocates. Run the benchmarks with
+//
+//	go test -bench . -benchmem ./rencode/benchmarks
+package benchmarks
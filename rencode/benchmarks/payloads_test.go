@@ -0,0 +1,124 @@
+package benchmarks
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// torrentStatus holds the fields the web UI polls for every torrent
+type torrentStatus struct {
+	Name                string  `rencode:"name"`
+	State               string  `rencode:"state"`
+	Progress            float64 `rencode:"progress"`
+	TotalSize           int64   `rencode:"total_size"`
+	TotalDone           int64   `rencode:"total_done"`
+	DownloadPayloadRate int64   `rencode:"download_payload_rate"`
+	UploadPayloadRate   int64   `rencode:"upload_payload_rate"`
+	NumPeers            int     `rencode:"num_peers"`
+	TotalPeers          int     `rencode:"total_peers"`
+	NumSeeds            int     `rencode:"num_seeds"`
+	TotalSeeds          int     `rencode:"total_seeds"`
+	Eta                 int64   `rencode:"eta"`
+	Ratio               float64 `rencode:"ratio"`
+	Queue               int     `rencode:"queue"`
+	TimeAdded           float64 `rencode:"time_added"`
+	TrackerHost         string  `rencode:"tracker_host"`
+	SavePath            string  `rencode:"save_path"`
+	Label               string  `rencode:"label"`
+	IsFinished          bool    `rencode:"is_finished"`
+	Paused              bool    `rencode:"paused"`
+}
+
+// statusPayload returns the response of core.get_torrents_status for n
+// torrents
+func statusPayload(n int) map[string]torrentStatus {
+	torrents := make(map[string]torrentStatus, n)
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("%040x", i*7919)
+		torrents[id] = torrentStatus{
+			Name:                fmt.Sprintf("ubuntu-%d.04-desktop-amd64.iso", i),
+			State:               "Downloading",
+			Progress:            float64(i%100) + 0.5,
+			TotalSize:           6114656256,
+			TotalDone:           int64(i) * 61146562,
+			DownloadPayloadRate: int64(i) * 1000,
+			UploadPayloadRate:   int64(i) * 100,
+			NumPeers:            i % 50,
+			TotalPeers:          120,
+			NumSeeds:            i % 20,
+			TotalSeeds:          400,
+			Eta:                 int64(i) * 60,
+			Ratio:               1.25,
+			Queue:               i,
+			TimeAdded:           1.7e9 + float64(i),
+			TrackerHost:         "torrent.ubuntu.com",
+			SavePath:            "/srv/downloads",
+			Label:               "linux",
+		}
+	}
+	return torrents
+}
+
+type torrentFile struct {
+	Index  int    `rencode:"index"`
+	Path   string `rencode:"path"`
+	Size   int64  `rencode:"size"`
+	Offset int64  `rencode:"offset"`
+}
+
+type fileTree struct {
+	Files          []torrentFile `rencode:"files"`
+	FileProgress   []float64     `rencode:"file_progress"`
+	FilePriorities []int         `rencode:"file_priorities"`
+}
+
+// fileTreePayload returns the file list of a torrent of n files
+func fileTreePayload(n int) fileTree {
+	tree := fileTree{
+		Files:          make([]torrentFile, n),
+		FileProgress:   make([]float64, n),
+		FilePriorities: make([]int, n),
+	}
+	var offset int64
+	for i := range tree.Files {
+		size := int64(1+i%13) << 20
+		tree.Files[i] = torrentFile{
+			Index:  i,
+			Path:   "album/disc " + strconv.Itoa(i/20) + "/track " + strconv.Itoa(i) + ".flac",
+			Size:   size,
+			Offset: offset,
+		}
+		offset += size
+		tree.FileProgress[i] = float64(i%10) / 10
+		tree.FilePriorities[i] = 1 + i%7
+	}
+	return tree
+}
+
+// sessionPayload returns the response of core.get_session_status, decoded
+// into an interface{} by clients that do not know its keys in advance
+func sessionPayload() map[string]interface{} {
+	keys := []string{
+		"payload_download_rate", "payload_upload_rate", "download_rate",
+		"upload_rate", "total_download", "total_upload", "num_peers",
+		"dht_nodes", "dht_torrents", "dht_global_nodes", "has_incoming_connections",
+		"total_payload_download", "total_payload_upload", "ip_overhead_download_rate",
+		"ip_overhead_upload_rate", "tracker_download_rate", "tracker_upload_rate",
+		"dht_download_rate", "dht_upload_rate", "num_unchoked", "allowed_upload_slots",
+		"optimistic_unchoke_counter", "unchoke_counter", "disk_read_queue",
+		"disk_write_queue", "peerlist_size", "total_redundant_bytes",
+		"total_failed_bytes", "up_bandwidth_queue", "down_bandwidth_queue",
+	}
+	session := make(map[string]interface{}, len(keys))
+	for i, k := range keys {
+		switch i % 3 {
+		case 0:
+			session[k] = float64(i) * 1024.5
+		case 1:
+			session[k] = int64(i) << 30
+		default:
+			session[k] = i%2 == 0
+		}
+	}
+	return session
+}
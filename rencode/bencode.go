@@ -0,0 +1,265 @@
+package rencode
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+)
+
+// ToBencode reads one rencode value from r and writes it to w as bencode,
+// keeping byte strings as is. Booleans are written as the integers 1 and 0.
+// Bencode requires the keys of dicts to be sorted, so the entries of a dict
+// are held in memory until its end; values outside of dicts are streamed.
+// None, floats and dict keys that are not strings have no bencode form and
+// are rejected.
+func ToBencode(r io.Reader, w io.Writer) error {
+	t := &bencodeTranscoder{d: NewDecoder(r), w: w}
+	if err := t.value(); err != nil {
+		return err
+	}
+	return t.flush()
+}
+
+type bencodeTranscoder struct {
+	d *Decoder
+	w io.Writer
+	// buf holds the output not yet written to w
+	buf []byte
+	// dicts is the number of dicts being transcoded
+	dicts int
+}
+
+func (t *bencodeTranscoder) flush() error {
+	_, err := t.w.Write(t.buf)
+	t.buf = t.buf[:0]
+	return err
+}
+
+func (t *bencodeTranscoder) value() error {
+	c, err := t.d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch {
+	case c == chrTrue:
+		t.buf = append(t.buf, "i1e"...)
+	case c == chrFalse:
+		t.buf = append(t.buf, "i0e"...)
+	case isInt(c):
+		s, err := t.d.readInt(c)
+		if err != nil {
+			return err
+		}
+		if c == chrInt {
+			// drops leading zeros, which bencode forbids
+			bi, ok := new(big.Int).SetString(s, 10)
+			if !ok {
+				return corruptf("invalid integer %q", s)
+			}
+			s = bi.String()
+		}
+		t.buf = append(t.buf, 'i')
+		t.buf = append(t.buf, s...)
+		t.buf = append(t.buf, 'e')
+	case isFixedString(c), isString(c):
+		size, err := t.d.readStringSize(c)
+		if err != nil {
+			return err
+		}
+		bp, err := t.d.readScratch(size)
+		if err != nil {
+			return err
+		}
+		t.buf = strconv.AppendInt(t.buf, size, 10)
+		t.buf = append(t.buf, ':')
+		t.buf = append(t.buf, *bp...)
+		putScratch(bp)
+	case c == chrList:
+		return t.list(-1)
+	case isFixedSlice(c):
+		return t.list(int(c - listFixedStart))
+	case c == chrDict:
+		return t.dict(-1)
+	case isFixedMap(c):
+		return t.dict(int(c - dictFixedStart))
+	case c == chrNone, c == chrFloat32, c == chrFloat64:
+		return fmt.Errorf("rencode: %s cannot be represented in bencode", codeName(c))
+	default:
+		return corruptf("unsupported code %v", c)
+	}
+	if t.dicts == 0 && len(t.buf) >= bufferSize {
+		return t.flush()
+	}
+	return nil
+}
+
+func (t *bencodeTranscoder) list(size int) error {
+	if err := t.d.enter(); err != nil {
+		return err
+	}
+	defer t.d.leave()
+
+	t.buf = append(t.buf, 'l')
+	for i := 0; ; i++ {
+		more, err := t.d.more(i, size)
+		if err != nil {
+			return eofUnexpected(err)
+		}
+		if !more {
+			break
+		}
+		if err := t.value(); err != nil {
+			return eofUnexpected(err)
+		}
+	}
+	t.buf = append(t.buf, 'e')
+	return nil
+}
+
+func (t *bencodeTranscoder) dict(size int) error {
+	if err := t.d.enter(); err != nil {
+		return err
+	}
+	defer t.d.leave()
+	t.dicts++
+	defer func() { t.dicts-- }()
+
+	// key is the offset of the raw key, after its length prefix
+	type pair struct {
+		start, key, keyEnd, end int
+	}
+	start := len(t.buf)
+	var pairs []pair
+	for {
+		more, err := t.d.more(len(pairs), size)
+		if err != nil {
+			return eofUnexpected(err)
+		}
+		if !more {
+			break
+		}
+		c, err := t.d.peekByte()
+		if err != nil {
+			return eofUnexpected(err)
+		}
+		if !isFixedString(c) && !isString(c) {
+			return fmt.Errorf("rencode: %s dict keys cannot be represented in bencode", codeName(c))
+		}
+		p := pair{start: len(t.buf) - start}
+		if err := t.value(); err != nil {
+			return eofUnexpected(err)
+		}
+		p.keyEnd = len(t.buf) - start
+		p.key = p.start + bytes.IndexByte(t.buf[start+p.start:], ':') + 1
+		if err := t.value(); err != nil {
+			return eofUnexpected(err)
+		}
+		p.end = len(t.buf) - start
+		pairs = append(pairs, p)
+	}
+
+	body := append([]byte(nil), t.buf[start:]...)
+	t.buf = append(t.buf[:start], 'd')
+	key := func(p pair) []byte {
+		return body[p.key:p.keyEnd]
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return bytes.Compare(key(pairs[i]), key(pairs[j])) < 0
+	})
+	for i, p := range pairs {
+		if i > 0 && bytes.Equal(key(pairs[i-1]), key(p)) {
+			return fmt.Errorf("rencode: duplicate dict key %q", key(p))
+		}
+		t.buf = append(t.buf, body[p.start:p.end]...)
+	}
+	t.buf = append(t.buf, 'e')
+	return nil
+}
+
+// FromBencode reads one bencode value from r and writes it to w as rencode,
+// without materializing the decoded value. Since the number of elements is
+// not known in advance, lists and dicts are written as terminated lists and
+// dicts. Malformed bencode is reported as ErrCorrupted.
+func FromBencode(r io.Reader, w io.Writer) error {
+	d := NewDecoder(r)
+	e := NewEncoder(w)
+
+	depth := 0
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && depth > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		switch {
+		case c == 'i':
+			err = transcodeBencodeInt(d, e)
+		case '0' <= c && c <= '9':
+			err = transcodeBencodeString(d, e, c)
+		case c == 'l':
+			depth++
+			err = e.writeByte(chrList)
+		case c == 'd':
+			depth++
+			err = e.writeByte(chrDict)
+		case c == 'e' && depth > 0:
+			depth--
+			err = e.writeByte(chrTerm)
+		default:
+			return corruptf("invalid bencode code %q", c)
+		}
+		if err != nil {
+			return err
+		}
+		if depth == 0 {
+			return e.Flush()
+		}
+	}
+}
+
+func transcodeBencodeInt(d *Decoder, e *Encoder) error {
+	b, err := d.readUntil(nil, 'e', int(maxIntLength))
+	if err != nil {
+		return eofUnexpected(err)
+	}
+	if !validBencodeInt(b) {
+		return corruptf("invalid bencode integer %q", b)
+	}
+	if i, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+		return e.EncodeInt(i)
+	}
+	return e.encodeIntString(string(b))
+}
+
+func transcodeBencodeString(d *Decoder, e *Encoder, c byte) error {
+	size, err := d.decodeStringSize(c)
+	if err != nil {
+		return eofUnexpected(err)
+	}
+	bp, err := d.readScratch(size)
+	if err != nil {
+		return eofUnexpected(err)
+	}
+	defer putScratch(bp)
+	return e.EncodeBytes(*bp)
+}
+
+// validBencodeInt reports whether b is a bencode integer, which has no
+// leading zeros and no negative zero
+func validBencodeInt(b []byte) bool {
+	if !validInt(b) {
+		return false
+	}
+	if b[0] == '-' {
+		b = b[1:]
+		if b[0] == '0' {
+			return false
+		}
+	}
+	return len(b) == 1 || b[0] != '0'
+}
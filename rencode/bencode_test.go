@@ -0,0 +1,91 @@
+package rencode
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestToBencode(t *testing.T) {
+	tests := []struct {
+		rencode string
+		bencode string
+	}{
+		{"C", "i1e"},
+		{"\x05", "i5e"},
+		{"?\xfc\x18", "i-1000e"},
+		{"=0018446744073709551616\x7f", "i18446744073709551616e"},
+		{"\x84\x00\xff:a", "4:\x00\xff:a"},
+		{"\xc3\x01\xc0f", "li1eledee"},
+		{";\x01\x02\x7f", "li1ei2ee"},
+		{"h\x84spam\x01\x82eg\x02", "d2:egi2e4:spami1ee"},
+		{"<\x83zzz\xc1h\x81b\x01\x81a\x02\x7f", "d3:zzzld1:ai2e1:bi1eeee"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := ToBencode(bytes.NewBufferString(test.rencode), &buf); err != nil {
+			t.Fatal(err)
+		}
+		if actual := buf.String(); actual != test.bencode {
+			t.Fatalf("\nFor     : %+q\nexpected: %+q\nactual  : %+q", test.rencode, test.bencode, actual)
+		}
+	}
+
+	errorTests := []string{
+		"E",
+		"\xc1,?\xf8\x00\x00\x00\x00\x00\x00",
+		"g\x01\x02",
+		"h\x81a\x01\x81a\x02",
+	}
+	for _, test := range errorTests {
+		if err := ToBencode(bytes.NewBufferString(test), io.Discard); err == nil {
+			t.Fatalf("expected an error for %+q", test)
+		}
+	}
+	if err := ToBencode(bytes.NewBufferString("\xc2\x01"), io.Discard); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestFromBencode(t *testing.T) {
+	tests := []struct {
+		bencode string
+		rencode string
+	}{
+		{"i0e", "\x00"},
+		{"i-1000e", "?\xfc\x18"},
+		{"i18446744073709551616e", "=18446744073709551616\x7f"},
+		{"0:", "\x80"},
+		{"4:\x00\xff:a", "\x84\x00\xff:a"},
+		{"li1elee", ";\x01;\x7f\x7f"},
+		{"d4:spaml1:a1:bee", "<\x84spam;\x81a\x81b\x7f\x7f"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := FromBencode(bytes.NewBufferString(test.bencode), &buf); err != nil {
+			t.Fatal(err)
+		}
+		if actual := buf.String(); actual != test.rencode {
+			t.Fatalf("\nFor     : %+q\nexpected: %+q\nactual  : %+q", test.bencode, test.rencode, actual)
+		}
+		var out bytes.Buffer
+		if err := ToBencode(&buf, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != test.bencode {
+			t.Fatalf("%+q does not round trip: %+q", test.bencode, out.String())
+		}
+	}
+
+	for _, test := range []string{"i03e", "i-0e", "ie", "i1.5e", "e", "x", strings.Repeat("9", 30) + ":"} {
+		err := FromBencode(bytes.NewBufferString(test), io.Discard)
+		if !errors.Is(err, ErrCorrupted) && err != io.ErrUnexpectedEOF {
+			t.Fatalf("expected a corruption error for %+q, got %v", test, err)
+		}
+	}
+	if err := FromBencode(bytes.NewBufferString("li1e"), io.Discard); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package rencode
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"sort"
+)
+
+// Canonical re-encodes the value held by data in its canonical form: the
+// smallest representation of every value, with the keys of dicts sorted by
+// their encoding. Equal values have the same canonical form, whatever the
+// encoder that produced them. Dicts with duplicate keys are rejected.
+func Canonical(data []byte) ([]byte, error) {
+	c := canonicalizer{d: NewDecoder(bytes.NewReader(data)), e: &Encoder{}}
+	if err := c.value(); err != nil {
+		return nil, eofUnexpected(err)
+	}
+	if _, err := c.d.peekByte(); err != io.EOF {
+		return nil, corruptf("unexpected data after the value")
+	}
+	return c.e.buf, nil
+}
+
+// Hash returns the SHA-256 hash of the canonical form of the value held by
+// data, so that equal values have the same hash
+func Hash(data []byte) ([sha256.Size]byte, error) {
+	canonical, err := Canonical(data)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(canonical), nil
+}
+
+// canonicalizer transcodes values from d to e, whose writer is nil so that
+// containers can be rewritten in its buffer
+type canonicalizer struct {
+	d *Decoder
+	e *Encoder
+}
+
+func (c *canonicalizer) value() error {
+	code, err := c.d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch {
+	case code == chrNone:
+		return c.e.EncodeNone()
+	case code == chrTrue, code == chrFalse:
+		return c.e.EncodeBool(code == chrTrue)
+	case isInt(code):
+		s, err := c.d.readInt(code)
+		if err != nil {
+			return err
+		}
+		n := Number(s)
+		if i, err := n.Int64(); err == nil {
+			return c.e.EncodeInt(i)
+		}
+		bi, err := n.BigInt()
+		if err != nil {
+			return err
+		}
+		// drops leading zeros
+		return c.e.encodeIntString(bi.String())
+	case code == chrFloat32, code == chrFloat64:
+		f, err := c.d.readFloat(code)
+		if err != nil {
+			return err
+		}
+		// the narrowest width holding the value exactly, whatever the
+		// width it was written with
+		if float64(float32(f)) == f {
+			return c.e.EncodeFloat32(float32(f))
+		}
+		return c.e.EncodeFloat64(f)
+	case isFixedString(code), isString(code):
+		size, err := c.d.readStringSize(code)
+		if err != nil {
+			return err
+		}
+		bp, err := c.d.readScratch(size)
+		if err != nil {
+			return err
+		}
+		defer putScratch(bp)
+		return c.e.EncodeBytes(*bp)
+	case code == chrList:
+		return c.list(-1)
+	case isFixedSlice(code):
+		return c.list(int(code - listFixedStart))
+	case code == chrDict:
+		return c.dict(-1)
+	case isFixedMap(code):
+		return c.dict(int(code - dictFixedStart))
+	}
+	return corruptf("unsupported code %v", code)
+}
+
+func (c *canonicalizer) list(size int) error {
+	if err := c.d.enter(); err != nil {
+		return err
+	}
+	defer c.d.leave()
+
+	// the elements are encoded first, since the header depends on their
+	// number
+	start := len(c.e.buf)
+	n := 0
+	for ; ; n++ {
+		more, err := c.d.more(n, size)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+		if err := c.value(); err != nil {
+			return err
+		}
+	}
+	body := append([]byte(nil), c.e.buf[start:]...)
+	c.e.buf = c.e.buf[:start]
+	if err := c.e.BeginList(n); err != nil {
+		return err
+	}
+	if err := c.e.write(body); err != nil {
+		return err
+	}
+	return c.e.EndList(n)
+}
+
+func (c *canonicalizer) dict(size int) error {
+	if err := c.d.enter(); err != nil {
+		return err
+	}
+	defer c.d.leave()
+
+	type pair struct {
+		start, keyEnd, end int
+	}
+	start := len(c.e.buf)
+	var pairs []pair
+	for {
+		more, err := c.d.more(len(pairs), size)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+		p := pair{start: len(c.e.buf) - start}
+		if err := c.value(); err != nil {
+			return err
+		}
+		p.keyEnd = len(c.e.buf) - start
+		if err := c.value(); err != nil {
+			return err
+		}
+		p.end = len(c.e.buf) - start
+		pairs = append(pairs, p)
+	}
+
+	body := append([]byte(nil), c.e.buf[start:]...)
+	c.e.buf = c.e.buf[:start]
+	key := func(p pair) []byte {
+		return body[p.start:p.keyEnd]
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return bytes.Compare(key(pairs[i]), key(pairs[j])) < 0
+	})
+
+	if err := c.e.BeginDict(len(pairs)); err != nil {
+		return err
+	}
+	for i, p := range pairs {
+		if i > 0 && bytes.Equal(key(pairs[i-1]), key(p)) {
+			return corruptf("duplicate dict key %q", key(p))
+		}
+		if err := c.e.write(body[p.start:p.end]); err != nil {
+			return err
+		}
+	}
+	return c.e.EndDict(len(pairs))
+}
@@ -0,0 +1,73 @@
+package rencode
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	data := []byte("<\x81bA\x00\x00\x00\x00\x00\x00\x00\x052:aa;\x01\x7f\x81c=0005\x7f\x7f")
+	expected := "i\x81b\x05\x81c\x05\x82aa\xc1\x01"
+	canonical, err := Canonical(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(canonical) != expected {
+		t.Fatalf("expected %q, got %q", expected, canonical)
+	}
+
+	h1, err := Hash(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := Hash(canonical)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h1 != h2 {
+		t.Fatal("expected the same hash for both forms")
+	}
+
+	// values that are already canonical are unchanged
+	long, err := Append(nil, []interface{}{bytes.Repeat([]byte("x"), 100), bigIntFromString("-123456789012345678901234567890"), 0.1, float32(2.5)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if canonical, err := Canonical(long); err != nil || !bytes.Equal(canonical, long) {
+		t.Fatalf("expected %q, got %q, %v", long, canonical, err)
+	}
+
+	// floats are written with the narrowest width holding them exactly
+	for _, pair := range [][2]interface{}{{float32(1.5), 1.5}, {float32(0.1), float64(float32(0.1))}} {
+		a, err := Append(nil, pair[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := Append(nil, pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		ca, err := Canonical(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cb, err := Canonical(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(ca, cb) || !bytes.Equal(ca, a) {
+			t.Errorf("%v: expected %q for both widths, got %q and %q", pair[1], a, ca, cb)
+		}
+	}
+
+	invalid := []string{
+		"g\x81a\x01\x81a\x02", // duplicate keys
+		"\x01\x02",            // trailing data
+		"\xc2\x01",            // truncated list
+	}
+	for _, data := range invalid {
+		if _, err := Canonical([]byte(data)); err == nil {
+			t.Errorf("%q: expected an error", data)
+		}
+	}
+}
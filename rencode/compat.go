@@ -0,0 +1,61 @@
+package rencode
+
+import "io"
+
+// CompatVersion selects the Python rencode release whose output an Encoder
+// reproduces
+type CompatVersion int
+
+const (
+	// CompatCurrent writes float64 values as 64-bit floats, like rencode
+	// 1.0.x dumps called with float_bits=64
+	CompatCurrent CompatVersion = iota
+	// CompatRencode1 reproduces rencode 1.0.x dumps called with its default
+	// float_bits of 32, as Deluge does: float64 values are written as 32-bit
+	// floats, and integers of 64 characters or more are rejected
+	CompatRencode1
+)
+
+// EncoderOptions configures the encoders returned by NewEncoderWithOptions
+type EncoderOptions struct {
+	// CompatVersion is the Python rencode release whose output is
+	// reproduced, CompatCurrent by default
+	CompatVersion CompatVersion
+	// MaxIntLength is the maximum number of characters of the integers
+	// too large for 64 bits, which are encoded as decimal strings. Zero
+	// selects the limit of the compatibility version, 64 by default.
+	MaxIntLength int
+	// LengthPrefixedStrings makes every string be written with a decimal
+	// length prefix, as in 3:foo, instead of the type codes embedding the
+	// length of strings shorter than 64 bytes. Some embedded decoders
+	// mishandle these codes.
+	LengthPrefixedStrings bool
+}
+
+// NewEncoderWithOptions returns a new rencode encoder writing to w,
+// configured by opts. Like NewEncoder, it buffers its output.
+func NewEncoderWithOptions(w io.Writer, opts EncoderOptions) *Encoder {
+	return &Encoder{
+		w:             w,
+		compat:        opts.CompatVersion,
+		maxIntLen:     opts.MaxIntLength,
+		prefixStrings: opts.LengthPrefixedStrings,
+	}
+}
+
+// float32Only reports whether float64 values are written as 32-bit floats
+func (e *Encoder) float32Only() bool {
+	return e.compat == CompatRencode1
+}
+
+// maxIntChars returns the maximum number of characters of the integers
+// encoded as strings
+func (e *Encoder) maxIntChars() int {
+	if e.maxIntLen > 0 {
+		return e.maxIntLen
+	}
+	if e.compat == CompatRencode1 {
+		return int(maxIntLength) - 1
+	}
+	return int(maxIntLength)
+}
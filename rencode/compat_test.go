@@ -0,0 +1,105 @@
+package rencode
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEncoderCompatVersion(t *testing.T) {
+	tests := []struct {
+		compat   CompatVersion
+		value    interface{}
+		expected string
+	}{
+		{CompatCurrent, 1.5, ",?\xf8\x00\x00\x00\x00\x00\x00"},
+		{CompatRencode1, 1.5, "B?\xc0\x00\x00"},
+		{CompatRencode1, float32(1.5), "B?\xc0\x00\x00"},
+		{CompatRencode1, []interface{}{0.5, 1}, "\xc2B?\x00\x00\x00\x01"},
+		{CompatCurrent, Number(strings.Repeat("9", 64)), "=" + strings.Repeat("9", 64) + "\x7f"},
+		{CompatRencode1, Number(strings.Repeat("9", 63)), "=" + strings.Repeat("9", 63) + "\x7f"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		e := NewEncoderWithOptions(&buf, EncoderOptions{CompatVersion: test.compat})
+		if err := e.Encode(test.value); err != nil {
+			t.Fatal(err)
+		}
+		if actual := buf.String(); actual != test.expected {
+			t.Fatalf("\nFor     : %v\nexpected: %+q\nactual  : %+q", test.value, test.expected, actual)
+		}
+	}
+
+	e := NewEncoderWithOptions(&bytes.Buffer{}, EncoderOptions{CompatVersion: CompatRencode1})
+	if err := e.Encode(Number(strings.Repeat("9", 64))); err == nil {
+		t.Fatal("expected an error for a 64 character integer")
+	}
+}
+
+func TestMaxIntLength(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoderWithOptions(&buf, EncoderOptions{MaxIntLength: 20})
+	if err := e.Encode(Number("18446744073709551616")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Encode(Number("-18446744073709551616")); err == nil {
+		t.Fatal("expected an error for a 21 character integer")
+	}
+
+	d := NewDecoder(bytes.NewReader(buf.Bytes()))
+	d.MaxIntLength(19)
+	var n Number
+	if err := d.Decode(&n); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expected ErrCorrupted, got %v", err)
+	}
+	d = NewDecoder(bytes.NewReader(buf.Bytes()))
+	d.MaxIntLength(20)
+	if err := d.Decode(&n); err != nil || n != "18446744073709551616" {
+		t.Fatalf("unexpected result %v, %v", n, err)
+	}
+
+	// the limit is enforced before the terminator is found
+	d = NewDecoder(io.MultiReader(strings.NewReader("="+strings.Repeat("1", 100)), neverReader{}))
+	if err := d.Decode(&n); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expected ErrCorrupted, got %v", err)
+	}
+	d = NewDecoder(strings.NewReader("=" + strings.Repeat("1", 64) + "\x7f"))
+	if err := d.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	d = NewDecoder(strings.NewReader("=" + strings.Repeat("1", 64) + "\x7f"))
+	d.MaxIntLength(63)
+	if err := d.Skip(); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expected ErrCorrupted, got %v", err)
+	}
+}
+
+// neverReader fails the test reading past the end of a value
+type neverReader struct{}
+
+func (neverReader) Read(p []byte) (int, error) {
+	panic("read past the limit")
+}
+
+func TestLengthPrefixedStrings(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoderWithOptions(&buf, EncoderOptions{LengthPrefixedStrings: true})
+	v := map[string]interface{}{"name": "foo", "data": []byte{}}
+	if err := e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	expected := "h4:data0:4:name3:foo"
+	if actual := buf.String(); actual != expected {
+		t.Fatalf("\nexpected: %+q\nactual  : %+q", expected, actual)
+	}
+
+	var decoded map[string]interface{}
+	if err := NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["name"] != "foo" || decoded["data"] != "" {
+		t.Fatalf("unexpected value %v", decoded)
+	}
+}
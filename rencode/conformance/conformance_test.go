@@ -0,0 +1,208 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/rogaps/delugerpc/rencode"
+)
+
+type vector struct {
+	Name      string `json:"name"`
+	FloatBits int    `json:"float_bits"`
+	Value     node   `json:"value"`
+	Hex       string `json:"hex"`
+}
+
+// node is the description of a Python value
+type node struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+func loadVectors(t *testing.T) []vector {
+	data, err := os.ReadFile(filepath.Join("testdata", "vectors.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		Vectors []vector `json:"vectors"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Vectors) == 0 {
+		t.Fatal("no vectors")
+	}
+	return file.Vectors
+}
+
+// build returns the Go value encoded like the described Python value
+func (n node) build(floatBits int) (interface{}, error) {
+	switch n.Type {
+	case "none":
+		return nil, nil
+	case "bool":
+		var b bool
+		err := json.Unmarshal(n.Value, &b)
+		return b, err
+	case "int":
+		var s string
+		if err := json.Unmarshal(n.Value, &s); err != nil {
+			return nil, err
+		}
+		bi, ok := new(big.Int).SetString(s, 10)
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("invalid int %q", s)
+		case bi.IsInt64():
+			return bi.Int64(), nil
+		case bi.IsUint64():
+			return bi.Uint64(), nil
+		}
+		return bi, nil
+	case "float":
+		var s string
+		if err := json.Unmarshal(n.Value, &s); err != nil {
+			return nil, err
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		if floatBits == 32 {
+			return float32(f), nil
+		}
+		return f, nil
+	case "bytes":
+		var s string
+		if err := json.Unmarshal(n.Value, &s); err != nil {
+			return nil, err
+		}
+		return hex.DecodeString(s)
+	case "str":
+		var s string
+		err := json.Unmarshal(n.Value, &s)
+		return s, err
+	case "list":
+		var nodes []node
+		if err := json.Unmarshal(n.Value, &nodes); err != nil {
+			return nil, err
+		}
+		list := make([]interface{}, len(nodes))
+		for i := range nodes {
+			v, err := nodes[i].build(floatBits)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = v
+		}
+		return list, nil
+	case "dict":
+		var pairs [][2]node
+		if err := json.Unmarshal(n.Value, &pairs); err != nil {
+			return nil, err
+		}
+		dict := make(map[string]interface{}, len(pairs))
+		for _, p := range pairs {
+			k, err := p[0].build(floatBits)
+			if err != nil {
+				return nil, err
+			}
+			v, err := p[1].build(floatBits)
+			if err != nil {
+				return nil, err
+			}
+			switch k := k.(type) {
+			case string:
+				dict[k] = v
+			case []byte:
+				dict[string(k)] = v
+			default:
+				return nil, fmt.Errorf("unsupported dict key %v", k)
+			}
+		}
+		return dict, nil
+	}
+	return nil, fmt.Errorf("unsupported type %q", n.Type)
+}
+
+func TestEncode(t *testing.T) {
+	for _, vec := range loadVectors(t) {
+		v, err := vec.Value.build(vec.FloatBits)
+		if err != nil {
+			t.Fatalf("%s: %v", vec.Name, err)
+		}
+		data, err := rencode.Append(nil, v)
+		if err != nil {
+			t.Errorf("%s: %v", vec.Name, err)
+			continue
+		}
+		if actual := hex.EncodeToString(data); actual != vec.Hex {
+			t.Errorf("%s:\nexpected: %s\nactual  : %s", vec.Name, vec.Hex, actual)
+		}
+		if n, err := rencode.EncodedLen(v); err != nil || n != len(data) {
+			t.Errorf("%s: EncodedLen returned %d, %v instead of %d", vec.Name, n, err, len(data))
+		}
+	}
+}
+
+// TestEncodeFloat32 checks that CompatRencode1 encodes float64 values like
+// rencode does with its default float_bits of 32
+func TestEncodeFloat32(t *testing.T) {
+	for _, vec := range loadVectors(t) {
+		if vec.FloatBits != 32 {
+			continue
+		}
+		v, err := vec.Value.build(64)
+		if err != nil {
+			t.Fatalf("%s: %v", vec.Name, err)
+		}
+		var buf bytes.Buffer
+		e := rencode.NewEncoderWithOptions(&buf, rencode.EncoderOptions{CompatVersion: rencode.CompatRencode1})
+		if err := e.Encode(v); err != nil {
+			t.Errorf("%s: %v", vec.Name, err)
+			continue
+		}
+		if actual := hex.EncodeToString(buf.Bytes()); actual != vec.Hex {
+			t.Errorf("%s:\nexpected: %s\nactual  : %s", vec.Name, vec.Hex, actual)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, vec := range loadVectors(t) {
+		data, err := hex.DecodeString(vec.Hex)
+		if err != nil {
+			t.Fatalf("%s: %v", vec.Name, err)
+		}
+		if err := rencode.Validate(bytes.NewReader(data)); err != nil {
+			t.Errorf("%s: %v", vec.Name, err)
+			continue
+		}
+
+		d := rencode.NewDecoder(bytes.NewReader(data))
+		d.KeepFloat32(true)
+		var v interface{}
+		if err := d.Decode(&v); err != nil {
+			t.Errorf("%s: %v", vec.Name, err)
+			continue
+		}
+		// the decoded value encodes back to the same bytes
+		reencoded, err := rencode.Append(nil, v)
+		if err != nil {
+			t.Errorf("%s: %v", vec.Name, err)
+			continue
+		}
+		if !bytes.Equal(reencoded, data) {
+			t.Errorf("%s: decoded value %v encodes as %x", vec.Name, v, reencoded)
+		}
+	}
+}
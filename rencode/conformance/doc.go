@@ -0,0 +1,6 @@
+// Package conformance checks the rencode package against golden vectors
+// generated by the reference Python rencode, byte for byte. It only holds
+// tests; testdata/vectors.json is regenerated with gen_vectors.py.
+package conformance
+
+//go:generate python3 gen_vectors.py
@@ -0,0 +1,124 @@
+#!/usr/bin/env python3
+"""Generates testdata/vectors.json, the golden vectors of the conformance suite.
+
+Each vector holds a value, described in a form the Go tests can rebuild, and
+its encoding by the reference Python rencode:
+
+    pip install rencode
+    python3 gen_vectors.py
+
+Dict keys are inserted in sorted order, since the Go encoder sorts map keys.
+"""
+
+import json
+import os
+import sys
+
+import rencode
+
+
+def describe(x):
+    """Returns the JSON description of the value x."""
+    if x is None:
+        return {"type": "none"}
+    if isinstance(x, bool):
+        return {"type": "bool", "value": x}
+    if isinstance(x, int):
+        return {"type": "int", "value": str(x)}
+    if isinstance(x, float):
+        return {"type": "float", "value": repr(x)}
+    if isinstance(x, bytes):
+        return {"type": "bytes", "value": x.hex()}
+    if isinstance(x, str):
+        return {"type": "str", "value": x}
+    if isinstance(x, (list, tuple)):
+        return {"type": "list", "value": [describe(v) for v in x]}
+    if isinstance(x, dict):
+        return {"type": "dict", "value": [[describe(k), describe(v)] for k, v in x.items()]}
+    raise TypeError("unsupported type %s" % type(x).__name__)
+
+
+def sorted_dict(pairs):
+    return dict(sorted(pairs, key=lambda kv: kv[0]))
+
+
+def values():
+    """Yields the name, value and float bits of every vector."""
+    for i in [0, 1, 43, 44, 127, 128, 255, 256, 32767, 32768, 2**31 - 1, 2**31,
+              2**63 - 1, 2**63, 2**64, 10**40, 10**62,
+              -1, -31, -32, -33, -128, -129, -32768, -32769, -2**31, -2**31 - 1,
+              -2**63, -2**63 - 1, -2**64, -10**40, -10**61]:
+        yield "int %d" % i, i, 64
+
+    for f in [0.0, -0.0, 1.5, -2.25, 0.1, 1e300, -1e-300, float("inf"), float("-inf")]:
+        yield "float64 %r" % f, f, 64
+    for f in [0.0, 1.5, -2.25, 0.1, 3.4e38, float("inf")]:
+        yield "float32 %r" % f, f, 32
+
+    yield "none", None, 64
+    yield "true", True, 64
+    yield "false", False, 64
+
+    for n in [0, 1, 63, 64, 65, 100, 1000, 5000]:
+        yield "bytes %d" % n, bytes(i % 256 for i in range(n)), 64
+    yield "str ascii", "deluge", 64
+    yield "str utf-8", "fööbar ✓ 日本", 64
+    yield "str utf-8 63 bytes", "é" * 31 + "x", 64
+    yield "str utf-8 64 bytes", "é" * 32, 64
+
+    for n in [0, 1, 63, 64, 65, 200]:
+        yield "list %d" % n, list(range(n)), 64
+    yield "tuple", (1, "two", 3.0), 64
+    yield "nested lists", [[], [[]], [[[1]]], [None, True, False]], 64
+
+    for n in [0, 1, 24, 25, 26, 100]:
+        yield "dict %d" % n, sorted_dict(("k%03d" % i, i) for i in range(n)), 64
+    yield "dict bytes keys", sorted_dict([(b"\x00\xff", 1), (b"a", 2)]), 64
+
+    yield "torrent status", sorted_dict([
+        ("name", "ubuntu-24.04-desktop-amd64.iso"),
+        ("progress", 42.5),
+        ("state", "Downloading"),
+        ("total_size", 6114656256),
+        ("download_payload_rate", 1234567),
+        ("num_peers", 12),
+        ("is_finished", False),
+        ("eta", -1),
+        ("tracker_host", None),
+        ("files", [sorted_dict([("index", 0), ("path", "ubuntu.iso"), ("size", 6114656256)])]),
+        ("file_priorities", [1] * 70),
+        ("peers", [sorted_dict([("ip", "10.0.0.%d" % i), ("up_speed", i * 1000)]) for i in range(30)]),
+    ]), 64
+    yield "torrent status float32", sorted_dict([
+        ("progress", 42.5), ("ratio", 0.1), ("distributed_copies", 1.25),
+    ]), 32
+    yield "rpc request", [[1, "core.get_torrents_status", [sorted_dict([("id", ["abc"])]), ["name"]], {}]], 64
+    yield "rpc response", [1, 7, sorted_dict([("abc", sorted_dict([("name", "x")]))])], 64
+    yield "rpc error", [2, 7, ["BadLoginError", ["Password does not match"], {}, "Traceback..."]], 64
+
+
+def main():
+    vectors = []
+    for name, value, float_bits in values():
+        data = rencode.dumps(value, float_bits)
+        if rencode.dumps(rencode.loads(data), float_bits) != data:
+            raise ValueError("%s does not round trip" % name)
+        vectors.append({
+            "name": name,
+            "float_bits": float_bits,
+            "value": describe(value),
+            "hex": data.hex(),
+        })
+
+    path = os.path.join(os.path.dirname(os.path.abspath(__file__)), "testdata", "vectors.json")
+    os.makedirs(os.path.dirname(path), exist_ok=True)
+    with open(path, "w") as f:
+        f.write('{\n"generator": %s,\n"vectors": [\n' % json.dumps(
+            "rencode %s" % getattr(rencode, "__version__", "unknown")))
+        f.write(",\n".join(json.dumps(v, ensure_ascii=False) for v in vectors))
+        f.write("\n]\n}\n")
+    print("wrote %d vectors to %s" % (len(vectors), path), file=sys.stderr)
+
+
+if __name__ == "__main__":
+    main()
@@ -1,137 +1,1101 @@
 package rencode
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"encoding"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
 	"reflect"
-	"runtime"
 	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
 	"unsafe"
 )
 
 // Decoder represents rencoder decoder
 type Decoder struct {
-	r *bufio.Reader
+	r byteScanner
+
+	useNumber       bool
+	stringsAsBytes  bool
+	decodeUTF8      bool
+	keepFloat32     bool
+	zeroCopy        bool
+	truncateArrays  bool
+	weaklyTyped     bool
+	foldFields      bool
+	snakeCaseFields bool
+	disallowUnknown bool
+	maxIntLen       int
+	arena           *Arena
+	stats           StatsCollector
+
+	overflowPolicy OverflowPolicy
+	overflows      []error
+
+	memoryLimit int64
+	memoryUsed  int64
+	depth       int
+	nesting     int
+
+	// only holds the keys to decode from the next dict, set by DecodeKeys
+	only map[string]bool
+
+	hook     DecodeHookFunc
+	skipHook bool
+
+	interned map[string]string
+	keyBuf   [maxInternedLength]byte
+}
+
+// InternKeys sets whether dict keys are interned: decoding the same key
+// again then returns the string allocated the first time, instead of a new
+// one. This saves memory on responses repeating the same keys, such as
+// torrent status dicts.
+func (d *Decoder) InternKeys(enabled bool) {
+	if !enabled {
+		d.interned = nil
+	} else if d.interned == nil {
+		d.interned = make(map[string]string)
+	}
+}
+
+// DecodeStringsAsBytes sets whether strings decoded into an interface{} are
+// stored as []byte instead of string, for byte strings that are not text.
+// Dict keys are still decoded as strings.
+func (d *Decoder) DecodeStringsAsBytes(enabled bool) {
+	d.stringsAsBytes = enabled
+}
+
+// DecodeUTF8 sets whether strings are decoded as UTF-8 text, like the
+// decode_utf8 flag of Python's rencode.loads: every string must then be valid
+// UTF-8, or decoding fails with an *InvalidUTF8Error, and strings decoded into
+// an interface{} are always stored as string, even if DecodeStringsAsBytes is
+// set.
+func (d *Decoder) DecodeUTF8(enabled bool) {
+	d.decodeUTF8 = enabled
+}
+
+// ZeroCopyStrings sets whether decoded strings share the memory the bytes are
+// read into, instead of being copied out of a reused buffer. This saves a
+// copy per string, which matters for large strings, but each string then
+// keeps its own read buffer alive. Strings are copied by default.
+func (d *Decoder) ZeroCopyStrings(enabled bool) {
+	d.zeroCopy = enabled
+}
+
+// TruncateArrays sets whether the elements of a list, or the bytes of a
+// string, that do not fit into a Go array are silently dropped. By default
+// decoding them fails with a *DecodeTypeError. Arrays longer than the decoded
+// value always have their remaining elements zeroed.
+func (d *Decoder) TruncateArrays(enabled bool) {
+	d.truncateArrays = enabled
+}
+
+// KeepFloat32 sets whether 32-bit floats decoded into an interface{} are
+// stored as float32 instead of being widened to float64. Encoding the decoded
+// value again then produces the same bytes.
+func (d *Decoder) KeepFloat32(enabled bool) {
+	d.keepFloat32 = enabled
+}
+
+// WeaklyTypedInput sets whether values are converted to the kind of their
+// destination when they differ: numeric strings decode into numbers and
+// booleans, integers into floats, and booleans into numbers as 0 or 1. Deluge
+// and its plugins are not consistent about the types they send for the same
+// field.
+func (d *Decoder) WeaklyTypedInput(enabled bool) {
+	d.weaklyTyped = enabled
+}
+
+// CaseInsensitiveFields sets whether dict keys that do not match the name of
+// a struct field exactly are matched regardless of case, like encoding/json
+// does
+func (d *Decoder) CaseInsensitiveFields(enabled bool) {
+	d.foldFields = enabled
+}
+
+// SnakeCaseFields sets whether dict keys that do not match the name of a
+// struct field exactly are matched against the snake_case form of the names
+// of untagged fields, so that the Deluge key max_connections decodes into a
+// MaxConnections field without a tag. Acronyms are kept together:
+// TrackerURL matches tracker_url.
+func (d *Decoder) SnakeCaseFields(enabled bool) {
+	d.snakeCaseFields = enabled
+}
+
+// DisallowUnknownFields sets whether decoding a dict into a struct fails
+// when some of its keys match no field, like the method of the same name of
+// encoding/json. The other fields are still decoded, and the error is an
+// *UnknownFieldsError listing all the unknown keys of the dict.
+func (d *Decoder) DisallowUnknownFields(enabled bool) {
+	d.disallowUnknown = enabled
+}
+
+// MaxIntLength sets the maximum number of characters of the integers encoded
+// as decimal strings, 64 by default like Python's rencode. Longer integers
+// fail the decoding with ErrCorrupted as soon as the limit is reached,
+// instead of being read until their terminator. A limit of zero or less
+// restores the default.
+func (d *Decoder) MaxIntLength(n int) {
+	d.maxIntLen = n
+}
+
+// maxIntChars returns the maximum number of characters of the integers
+// encoded as decimal strings
+func (d *Decoder) maxIntChars() int {
+	if d.maxIntLen > 0 {
+		return d.maxIntLen
+	}
+	return int(maxIntLength)
+}
+
+// OverflowPolicy selects what the Decoder does with an integer that does not
+// fit into its destination
+type OverflowPolicy int
+
+const (
+	// OverflowError fails the decoding with a *DecodeTypeError
+	OverflowError OverflowPolicy = iota
+	// OverflowClamp stores the closest value in the range of the destination
+	OverflowClamp
+	// OverflowSkip leaves the destination zero
+	OverflowSkip
+)
+
+// HandleOverflow sets the overflow policy of the decoder, OverflowError by
+// default. With the other policies, the overflows are recorded and returned
+// by Overflows instead of failing the decoding.
+func (d *Decoder) HandleOverflow(policy OverflowPolicy) {
+	d.overflowPolicy = policy
+}
+
+// Overflows returns the *DecodeTypeError of each integer clamped or skipped
+// since the last call, and clears them
+func (d *Decoder) Overflows() []error {
+	errs := d.overflows
+	d.overflows = nil
+	return errs
+}
+
+// ErrMemoryLimit is returned when decoding a value would allocate more than
+// the limit set by MemoryLimit
+var ErrMemoryLimit = errors.New("rencode: memory limit exceeded")
+
+// MemoryLimit bounds the memory allocated to decode a single value passed to
+// Decode, counting the bytes of strings and the elements of lists and dicts,
+// so that a malicious value cannot exhaust the memory. A limit of 0, the
+// default, disables it.
+func (d *Decoder) MemoryLimit(n int64) {
+	d.memoryLimit = n
+}
+
+// charge accounts for n more bytes allocated for the value being decoded
+func (d *Decoder) charge(n int64) error {
+	if d.memoryLimit <= 0 {
+		return nil
+	}
+	if d.depth == 0 {
+		// a value decoded by one of the Decode* primitives
+		d.memoryUsed = 0
+	}
+	d.memoryUsed += n
+	if d.memoryUsed > d.memoryLimit {
+		return ErrMemoryLimit
+	}
+	return nil
+}
+
+// DecodeHookFunc is called for every value decoded into a Go value other
+// than a pointer, with the kind of the value on the wire, the value as it
+// would be decoded into an interface{} and the type of the destination. The
+// value it returns is stored in the destination when assignable to it, and
+// decoded into the destination like a rencode value otherwise.
+type DecodeHookFunc func(kind Kind, value interface{}, target reflect.Type) (interface{}, error)
+
+// DecodeHook sets a hook converting values before they are stored, such as
+// epoch seconds into a custom time type. A nil hook removes it.
+func (d *Decoder) DecodeHook(hook DecodeHookFunc) {
+	d.hook = hook
+}
+
+// UseNumber causes the Decoder to decode integers into an interface{} as a
+// Number instead of an int64 or a big.Int
+func (d *Decoder) UseNumber() {
+	d.useNumber = true
+}
+
+// Decode decodes stream
+func (d *Decoder) Decode(v interface{}) error {
+	vv := reflect.ValueOf(v)
+	if vv.Kind() != reflect.Ptr || vv.IsNil() {
+		return &DecodeInvalidArgError{Type: vv.Type()}
+	}
+
+	vv = vv.Elem()
+	if !vv.IsValid() {
+		return &DecodeInvalidArgError{Type: vv.Type()}
+	}
+
+	if d.depth == 0 {
+		d.memoryUsed = 0
+		// io.EOF is only returned when there is no value at all
+		if _, err := d.peekByte(); err != nil {
+			return err
+		}
+	}
+	var sr *statsReader
+	if d.depth == 0 && d.stats != nil {
+		sr = d.startStats()
+	}
+	d.depth++
+	err := d.decodeValue(vv)
+	d.depth--
+	if d.depth == 0 {
+		err = eofUnexpected(err)
+	}
+	if sr != nil {
+		d.reportStats(sr, err)
+	}
+	return err
+}
+
+// maxNesting bounds the depth of nested lists and dicts, so that malicious
+// data cannot exhaust the stack
+const maxNesting = 10000
+
+// enter accounts for one more level of nested containers, which must be
+// matched by a call to leave when it succeeds
+func (d *Decoder) enter() error {
+	d.nesting++
+	if d.nesting > maxNesting {
+		d.nesting--
+		return corruptf("nesting deeper than %d", maxNesting)
+	}
+	return nil
+}
+
+func (d *Decoder) leave() {
+	d.nesting--
+}
+
+// DecodeKeys decodes the next value like Decode, but when it is a dict, only
+// the given keys are decoded: the values of the other keys are skipped
+// without being allocated. Nested dicts are decoded entirely.
+func (d *Decoder) DecodeKeys(v interface{}, keys ...string) error {
+	k, _, err := d.PeekKind()
+	if err != nil {
+		return err
+	}
+	if k == Dict {
+		d.only = make(map[string]bool, len(keys))
+		for _, key := range keys {
+			d.only[key] = true
+		}
+		defer func() { d.only = nil }()
+	}
+	return d.Decode(v)
+}
+
+// DecodeString decodes the next value, which must be a string. None is
+// decoded as the empty string.
+func (d *Decoder) DecodeString() (string, error) {
+	size, err := d.readStringHeader()
+	if err != nil || size < 0 {
+		return "", err
+	}
+	return d.readString(size)
+}
+
+// DecodeBytes decodes the next value, which must be a string, as raw bytes.
+// None is decoded as a nil slice.
+func (d *Decoder) DecodeBytes() ([]byte, error) {
+	size, err := d.readStringHeader()
+	if err != nil || size < 0 {
+		return nil, err
+	}
+	return d.readBytes(size)
+}
+
+// readStringHeader reads the header of the next value, which must be a
+// string or None, returning its size, or -1 for None
+func (d *Decoder) readStringHeader() (int64, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if c == chrNone {
+		return -1, nil
+	}
+	return d.readStringSize(c)
+}
+
+// readStringSize returns the size of the string introduced by c
+func (d *Decoder) readStringSize(c byte) (int64, error) {
+	switch {
+	case isFixedString(c):
+		return int64(c - strFixedStart), nil
+	case isString(c):
+		return d.decodeStringSize(c)
+	}
+	if kindOf(c) == Invalid {
+		return 0, corruptf("unsupported code %v", c)
+	}
+	return 0, &DecodeTypeError{Value: codeName(c), Type: reflect.TypeOf("")}
+}
+
+const (
+	// maxInternedKeys bounds the size of the interning table
+	maxInternedKeys = 4096
+	// maxInternedLength is the length above which keys are not interned
+	maxInternedLength = 64
+)
+
+// decodeKey decodes a dict key, which must be a string
+func (d *Decoder) decodeKey() (string, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	size, err := d.readStringSize(c)
+	if err != nil {
+		return "", err
+	}
+	if d.interned == nil || size > maxInternedLength {
+		return d.readString(size)
+	}
+	buf := d.keyBuf[:size]
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return "", err
+	}
+	if d.decodeUTF8 && !utf8.Valid(buf) {
+		return "", &InvalidUTF8Error{Value: append([]byte(nil), buf...)}
+	}
+	if s, ok := d.interned[string(buf)]; ok {
+		return s, nil
+	}
+	s := string(buf)
+	if len(d.interned) < maxInternedKeys {
+		d.interned[s] = s
+	}
+	return s, nil
+}
+
+// DecodeInt decodes the next value, which must be an integer fitting in
+// bitSize bits. A bitSize of 0 means the size of int. None is decoded as 0.
+func (d *Decoder) DecodeInt(bitSize int) (int64, error) {
+	var i int64
+	err := d.decodeIntPrimitive(reflect.ValueOf(&i).Elem(), intTypes[bitSize])
+	return i, err
+}
+
+// DecodeUint decodes the next value, which must be a non-negative integer
+// fitting in bitSize bits. A bitSize of 0 means the size of uint. None is
+// decoded as 0.
+func (d *Decoder) DecodeUint(bitSize int) (uint64, error) {
+	var i uint64
+	err := d.decodeIntPrimitive(reflect.ValueOf(&i).Elem(), uintTypes[bitSize])
+	return i, err
+}
+
+var intTypes = map[int]reflect.Type{
+	0:  reflect.TypeOf(int(0)),
+	8:  reflect.TypeOf(int8(0)),
+	16: reflect.TypeOf(int16(0)),
+	32: reflect.TypeOf(int32(0)),
+	64: reflect.TypeOf(int64(0)),
+}
+
+var uintTypes = map[int]reflect.Type{
+	0:  reflect.TypeOf(uint(0)),
+	8:  reflect.TypeOf(uint8(0)),
+	16: reflect.TypeOf(uint16(0)),
+	32: reflect.TypeOf(uint32(0)),
+	64: reflect.TypeOf(uint64(0)),
+}
+
+// decodeIntPrimitive decodes an integer into the 64-bit value v, checking
+// that it fits into typ
+func (d *Decoder) decodeIntPrimitive(v reflect.Value, typ reflect.Type) error {
+	if typ == nil {
+		return fmt.Errorf("rencode: invalid bit size")
+	}
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if c == chrNone {
+		return nil
+	}
+	if !isInt(c) {
+		return &DecodeTypeError{Value: codeName(c), Type: typ}
+	}
+	s, err := d.readInt(c)
+	if err != nil {
+		return err
+	}
+	x := reflect.New(typ).Elem()
+	if err := d.setInt(s, x); err != nil {
+		return err
+	}
+	if v.Kind() == reflect.Int64 {
+		v.SetInt(x.Int())
+	} else {
+		v.SetUint(x.Uint())
+	}
+	return nil
+}
+
+// DecodeFloat decodes the next value, which must be a float, and rounds it
+// to bitSize (32 or 64) bits. None is decoded as 0.
+func (d *Decoder) DecodeFloat(bitSize int) (float64, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if c == chrNone {
+		return 0, nil
+	}
+	if c != chrFloat32 && c != chrFloat64 {
+		return 0, &DecodeTypeError{Value: codeName(c), Type: reflect.TypeOf(float64(0))}
+	}
+	f, err := d.readFloat(c)
+	if err != nil {
+		return 0, err
+	}
+	if bitSize == 32 {
+		f = float64(float32(f))
+	}
+	return f, nil
+}
+
+// DecodeBool decodes the next value, which must be a boolean. None is
+// decoded as false.
+func (d *Decoder) DecodeBool() (bool, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return false, err
+	}
+	switch c {
+	case chrTrue:
+		return true, nil
+	case chrFalse, chrNone:
+		return false, nil
+	}
+	return false, &DecodeTypeError{Value: codeName(c), Type: reflect.TypeOf(false)}
+}
+
+// DecodeDictFunc decodes the next value, which must be a dict with string
+// keys, calling fn for every key. fn must consume the value of the key,
+// either by decoding it or by calling Skip. None is decoded as an empty dict.
+func (d *Decoder) DecodeDictFunc(fn func(d *Decoder, key string) error) error {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	size := -1
+	switch {
+	case c == chrNone:
+		return nil
+	case c == chrDict:
+	case isFixedMap(c):
+		size = int(c - dictFixedStart)
+	default:
+		return &DecodeTypeError{Value: codeName(c), Type: reflect.TypeOf(map[string]interface{}{})}
+	}
+
+	return d.iterate(size, func() error {
+		key, err := d.decodeKey()
+		if err != nil {
+			return err
+		}
+		return fn(d, key)
+	})
+}
+
+// DecodeListFunc decodes the next value, which must be a list, calling fn
+// for every element without accumulating them. fn must consume the element,
+// either by decoding it or by calling Skip. None is decoded as an empty list.
+func (d *Decoder) DecodeListFunc(fn func(d *Decoder) error) error {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	size := -1
+	switch {
+	case c == chrNone:
+		return nil
+	case c == chrList:
+	case isFixedSlice(c):
+		size = int(c - listFixedStart)
+	default:
+		return &DecodeTypeError{Value: codeName(c), Type: reflect.TypeOf([]interface{}{})}
+	}
+
+	return d.iterate(size, func() error {
+		return fn(d)
+	})
+}
+
+// DecodeListToChan decodes the next value, which must be a list, sending
+// each element to ch, a channel of any element type, as soon as it is
+// decoded. Sends block until the receiver is ready, so that a slow consumer
+// slows the decoding down instead of the elements piling up in memory. It
+// returns ctx.Err() once ctx is done. The channel is not closed.
+func (d *Decoder) DecodeListToChan(ctx context.Context, ch interface{}) error {
+	cv := reflect.ValueOf(ch)
+	if cv.Kind() != reflect.Chan || cv.Type().ChanDir()&reflect.SendDir == 0 {
+		return fmt.Errorf("rencode: DecodeListToChan needs a send channel, not %T", ch)
+	}
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectSend, Chan: cv},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	}
+	return d.DecodeListFunc(func(d *Decoder) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		elem := reflect.New(cv.Type().Elem())
+		if err := d.Decode(elem.Interface()); err != nil {
+			return err
+		}
+		cases[0].Send = elem.Elem()
+		if chosen, _, _ := reflect.Select(cases); chosen == 1 {
+			return ctx.Err()
+		}
+		return nil
+	})
+}
+
+// iterate calls fn size times, or until the terminator is reached when size
+// is negative
+func (d *Decoder) iterate(size int, fn func() error) error {
+	for i := 0; (0 <= size && i < size) || size < 0; i++ {
+		if size < 0 {
+			c, err := d.peekByte()
+			if err != nil {
+				return err
+			}
+			if c == chrTerm {
+				_, err := d.r.ReadByte()
+				return err
+			}
+		}
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Skip consumes the next value without storing it
+func (d *Decoder) Skip() error {
+	return d.skipValue()
+}
+
+func (d *Decoder) peekByte() (b byte, err error) {
+	if b, err = d.r.ReadByte(); err != nil {
+		return
+	}
+	err = d.r.UnreadByte()
+	return
+}
+
+// Unmarshaler is implemented by types that decode themselves from rencode,
+// typically through the Decode* primitives of the Decoder. UnmarshalRencode
+// must consume exactly one value from the decoder.
+type Unmarshaler interface {
+	UnmarshalRencode(d *Decoder) error
+}
+
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+func unmarshaler(v reflect.Value) (Unmarshaler, bool) {
+	if v.Kind() != reflect.Ptr && v.CanAddr() &&
+		reflect.PtrTo(v.Type()).Implements(unmarshalerType) {
+		return v.Addr().Interface().(Unmarshaler), true
+	}
+	return nil, false
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// textUnmarshaler returns the encoding.TextUnmarshaler of v, which decodes
+// strings, unless v has a rencode representation of its own
+func textUnmarshaler(v reflect.Value) (encoding.TextUnmarshaler, bool) {
+	if t := v.Type(); t == timeType || t == bigIntType {
+		return nil, false
+	}
+	if v.Kind() != reflect.Ptr && v.CanAddr() &&
+		reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler), true
+	}
+	return nil, false
+}
+
+// decodeText decodes the next value with u when it is a string, and reports
+// whether it was
+func (d *Decoder) decodeText(u encoding.TextUnmarshaler) (bool, error) {
+	c, err := d.peekByte()
+	if err != nil {
+		return false, err
+	}
+	if !isFixedString(c) && !isString(c) {
+		return false, nil
+	}
+	size, err := d.readStringHeader()
+	if err != nil {
+		return true, err
+	}
+	bp, err := d.readScratch(size)
+	if err != nil {
+		return true, err
+	}
+	defer putScratch(bp)
+	return true, u.UnmarshalText(*bp)
+}
+
+func (d *Decoder) decodeValue(v reflect.Value) error {
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		c, err := d.peekByte()
+		if err != nil {
+			return err
+		}
+		if c == chrNone {
+			d.r.ReadByte()
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			return d.decodeValue(v.Elem())
+		}
+	}
+
+	if d.hook != nil {
+		if !d.skipHook {
+			return d.decodeHooked(v)
+		}
+		d.skipHook = false
+	}
+
+	if ok, err := d.decodeAdapted(v); ok {
+		return err
+	}
+	if u, ok := unmarshaler(v); ok {
+		d.only = nil
+		return u.UnmarshalRencode(d)
+	}
+	if u, ok := textUnmarshaler(v); ok {
+		// other kinds of values are decoded as usual
+		if ok, err := d.decodeText(u); ok {
+			return err
+		}
+	}
+	if s, ok := scanner(v); ok {
+		return d.decodeScan(s)
+	}
+
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch c {
+	case chrNone:
+		return nil
+	case chrFalse:
+		return d.decodeBool(v, false)
+	case chrTrue:
+		return d.decodeBool(v, true)
+	case chrInt1, chrInt2, chrInt4, chrInt8, chrInt:
+		return d.decodeInt(v, c)
+	case chrFloat32, chrFloat64:
+		return d.decodeFloat(v, c)
+	case chrList:
+		return d.decodeSlice(v, -1)
+	case chrDict:
+		return d.decodeMap(v, -1)
+	default:
+		if isFixedPosInt(c) || isFixedNegInt(c) {
+			return d.decodeInt(v, c)
+		}
+		if isFixedString(c) {
+			size := int64(c - strFixedStart)
+			return d.decodeString(v, size)
+		}
+		if isString(c) {
+			size, err := d.decodeStringSize(c)
+			if err != nil {
+				return err
+			}
+			return d.decodeString(v, size)
+		}
+		if isFixedSlice(c) {
+			size := int(c - listFixedStart)
+			return d.decodeSlice(v, size)
+		}
+		if isFixedMap(c) {
+			size := int(c - dictFixedStart)
+			return d.decodeMap(v, size)
+		}
+	}
+	return corruptf("unsupported code %v", c)
+}
+
+// anyKeys copies the map[string]interface{} m into a new
+// map[interface{}]interface{}
+func anyKeys(m reflect.Value) reflect.Value {
+	x := make(map[interface{}]interface{}, m.Len())
+	iter := m.MapRange()
+	for iter.Next() {
+		x[iter.Key().String()] = iter.Value().Interface()
+	}
+	return reflect.ValueOf(&x).Elem()
+}
+
+// decodeMapKeys decodes a dict into the map v, whose keys are not strings,
+// starting at the i-th entry
+func (d *Decoder) decodeMapKeys(v, mapElem reflect.Value, i, size int) error {
+	mapKey := reflect.New(v.Type().Key()).Elem()
+	for ; ; i++ {
+		more, err := d.more(i, size)
+		if err != nil || !more {
+			return err
+		}
+		mapKey.Set(reflect.Zero(mapKey.Type()))
+		if err := d.decodeValue(mapKey); err != nil {
+			return err
+		}
+		key := mapKey
+		if key.Kind() == reflect.Interface && !key.IsNil() {
+			if b, ok := key.Interface().([]byte); ok {
+				// byte strings are not hashable
+				key = reflect.ValueOf(string(b))
+			} else if !key.Elem().Type().Comparable() {
+				return &DecodeTypeError{Value: "unhashable " + key.Elem().Kind().String(), Type: mapKey.Type()}
+			}
+		}
+
+		mapElem.Set(reflect.Zero(mapElem.Type()))
+		if err := d.decodeValue(mapElem); err != nil {
+			return err
+		}
+		if err := d.charge(int64(mapKey.Type().Size() + mapElem.Type().Size())); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, mapElem)
+	}
+}
+
+// decodeHooked decodes the next value into an interface{}, passes it through
+// the hook and stores the result in v
+func (d *Decoder) decodeHooked(v reflect.Value) error {
+	c, err := d.peekByte()
+	if err != nil {
+		return err
+	}
+
+	var x interface{}
+	hook := d.hook
+	d.hook = nil
+	rr := d.startRecording()
+	err = d.decodeValue(reflect.ValueOf(&x).Elem())
+	d.stopRecording(rr)
+	d.hook = hook
+	if err != nil {
+		return err
+	}
+
+	y, err := hook(kindOf(c), x, v.Type())
+	if err != nil {
+		return err
+	}
+	if y != nil {
+		if yv := reflect.ValueOf(y); yv.Type().AssignableTo(v.Type()) {
+			v.Set(yv)
+			return nil
+		}
+	}
+
+	// the hook did not produce the destination type, decode its result as if
+	// it had been read instead, still calling the hook on nested values. A
+	// value returned as is is decoded from the bytes it was read from.
+	data := rr.buf
+	if !sameValue(x, y) {
+		if data, err = Append(nil, y); err != nil {
+			return err
+		}
+	}
+	sub := *d
+	sub.r = bytes.NewReader(data)
+	sub.skipHook = true
+	err = sub.decodeValue(v)
+	d.overflows = sub.overflows
+	d.memoryUsed = sub.memoryUsed
+	return err
+}
+
+// sameValue reports whether y is x, as returned unchanged by a hook
+func sameValue(x, y interface{}) bool {
+	xv, yv := reflect.ValueOf(x), reflect.ValueOf(y)
+	if !xv.IsValid() || !yv.IsValid() || xv.Type() != yv.Type() {
+		return !xv.IsValid() && !yv.IsValid()
+	}
+	switch xv.Kind() {
+	case reflect.Map:
+		return xv.Pointer() == yv.Pointer()
+	case reflect.Slice:
+		return xv.Pointer() == yv.Pointer() && xv.Len() == yv.Len()
+	}
+	return xv.Type().Comparable() && x == y
+}
+
+// maxLengthDigits is the number of digits of the largest string length
+const maxLengthDigits = 19
+
+func (d *Decoder) decodeStringSize(c byte) (int64, error) {
+	size, err := d.readUntil([]byte{c}, ':', maxLengthDigits)
+	if err != nil {
+		return 0, err
+	}
+	return parseStringSize(size)
+}
+
+func parseStringSize(b []byte) (int64, error) {
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || n < 0 {
+		return 0, corruptf("invalid string length %q", b)
+	}
+	return n, nil
+}
+
+// readUntil appends the bytes preceding delim to b, consuming delim. There
+// must be at most max of them.
+func (d *Decoder) readUntil(b []byte, delim byte, max int) ([]byte, error) {
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if c == delim {
+			return b, nil
+		}
+		if len(b) >= max {
+			return nil, corruptf("value longer than %d characters", max)
+		}
+		b = append(b, c)
+	}
+}
+
+// readChunkSize is the size above which strings are read in chunks, so that
+// the memory allocated grows with the data actually read rather than with
+// the length announced
+const readChunkSize = 64 << 10
+
+// readFull reads size bytes into b, reusing its capacity
+func (d *Decoder) readFull(b []byte, size int64) ([]byte, error) {
+	if size <= readChunkSize || int64(cap(b)) >= size {
+		if int64(cap(b)) < size {
+			b = make([]byte, size)
+		}
+		b = b[:size]
+		_, err := io.ReadFull(d.r, b)
+		return b, err
+	}
+	b = b[:0]
+	for int64(len(b)) < size {
+		n := int64(len(b))
+		if n < readChunkSize {
+			n = readChunkSize
+		}
+		if n > size-int64(len(b)) {
+			n = size - int64(len(b))
+		}
+		start := len(b)
+		b = append(b, make([]byte, n)...)
+		if _, err := io.ReadFull(d.r, b[start:]); err != nil {
+			return nil, eofUnexpected(err)
+		}
+	}
+	return b, nil
 }
 
-// Decode decodes stream
-func (d *Decoder) Decode(v interface{}) error {
-	vv := reflect.ValueOf(v)
-	if vv.Kind() != reflect.Ptr || vv.IsNil() {
-		return &DecodeInvalidArgError{Type: vv.Type()}
+func (d *Decoder) readBytes(size int64) ([]byte, error) {
+	if err := d.charge(size); err != nil {
+		return nil, err
 	}
-
-	vv = vv.Elem()
-	if !vv.IsValid() {
-		return &DecodeInvalidArgError{Type: vv.Type()}
+	var buf []byte
+	if d.arena != nil && d.arena.fits(size) {
+		buf = d.arena.alloc(int(size))
+	}
+	data, err := d.readFull(buf, size)
+	if err != nil {
+		return nil, err
 	}
+	if d.decodeUTF8 && !utf8.Valid(data) {
+		return nil, &InvalidUTF8Error{Value: data}
+	}
+	return data, nil
+}
 
-	return d.decodeValue(vv)
+// maxPooledSize is the capacity above which buffers are not put back into
+// scratchPool
+const maxPooledSize = 64 << 10
+
+// scratchPool holds the buffers strings are read into before being copied to
+// their destination
+var scratchPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 256)
+		return &b
+	},
 }
 
-func (d *Decoder) peekByte() (b byte, err error) {
-	ch, err := d.r.Peek(1)
+// readScratch reads a string of the given size into a pooled buffer, which
+// must be released with putScratch once its content has been copied
+func (d *Decoder) readScratch(size int64) (*[]byte, error) {
+	if err := d.charge(size); err != nil {
+		return nil, err
+	}
+	bp := scratchPool.Get().(*[]byte)
+	b, err := d.readFull(*bp, size)
 	if err != nil {
-		return
+		putScratch(bp)
+		return nil, err
 	}
-	b = ch[0]
-	return
+	*bp = b
+	if d.decodeUTF8 && !utf8.Valid(*bp) {
+		err := &InvalidUTF8Error{Value: append([]byte(nil), *bp...)}
+		putScratch(bp)
+		return nil, err
+	}
+	return bp, nil
 }
 
-func (d *Decoder) decodeValue(v reflect.Value) error {
-	c, err := d.r.ReadByte()
+func putScratch(bp *[]byte) {
+	if cap(*bp) <= maxPooledSize {
+		scratchPool.Put(bp)
+	}
+}
+
+// readString reads a string of the given size, copying it out of a pooled
+// buffer unless ZeroCopyStrings is set
+func (d *Decoder) readString(size int64) (string, error) {
+	if d.zeroCopy || d.arena != nil {
+		data, err := d.readBytes(size)
+		return bytesAsString(data), err
+	}
+	bp, err := d.readScratch(size)
 	if err != nil {
-		return err
+		return "", err
 	}
-	switch c {
-	case chrNone:
-		return nil
-	case chrFalse:
-		return d.decodeBool(v, false)
-	case chrTrue:
-		return d.decodeBool(v, true)
-	case chrInt1, chrInt2, chrInt4, chrInt8, chrInt:
-		return d.decodeInt(v, c)
-	case chrFloat32, chrFloat64:
-		return d.decodeFloat(v, c)
-	case chrList:
-		return d.decodeSlice(v, -1)
-	case chrDict:
-		return d.decodeMap(v, -1)
-	default:
-		if isFixedPosInt(c) {
-			data := int64(c - intPosFixedStart)
-			return setInt(strconv.FormatInt(data, 10), v)
+	s := string(*bp)
+	putScratch(bp)
+	return s, nil
+}
+
+func (d *Decoder) decodeString(v reflect.Value, size int64) error {
+	switch v.Kind() {
+	case reflect.String:
+		s, err := d.readString(size)
+		if err != nil {
+			return err
 		}
-		if isFixedNegInt(c) {
-			data := int64(c-intNegFixedStart+1) * -1
-			return setInt(strconv.FormatInt(data, 10), v)
+		v.SetString(s)
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data, err := d.readBytes(size)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(data)
+			return nil
 		}
-		if isFixedString(c) {
-			size := int64(c - strFixedStart)
-			return d.decodeString(v, size)
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			// only the empty interface can hold a string
+			break
 		}
-		if isString(c) {
-			size, err := d.decodeStringSize(c)
+		if d.stringsAsBytes && !d.decodeUTF8 {
+			data, err := d.readBytes(size)
 			if err != nil {
 				return err
 			}
-			return d.decodeString(v, size)
-		}
-		if isFixedSlice(c) {
-			size := int(c - listFixedStart)
-			return d.decodeSlice(v, size)
+			v.Set(reflect.ValueOf(data))
+			return nil
 		}
-		if isFixedMap(c) {
-			size := int(c - dictFixedStart)
-			return d.decodeMap(v, size)
+		s, err := d.readString(size)
+		if err != nil {
+			return err
 		}
+		v.Set(reflect.ValueOf(s))
+		return nil
 	}
-	return fmt.Errorf("rencode: unsupported code %v", c)
-}
 
-func (d *Decoder) decodeStringSize(c byte) (int64, error) {
-	size, err := d.r.ReadBytes(':')
+	// the other destinations only need the bytes until they are converted
+	bp, err := d.readScratch(size)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	size = append([]byte{byte(c)}, size[:len(size)-1]...)
+	defer putScratch(bp)
+	data := *bp
 
-	return strconv.ParseInt(string(size), 10, 64)
-}
+	if v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8 {
+		if len(data) > v.Len() && !d.truncateArrays {
+			return &DecodeTypeError{
+				Value: fmt.Sprintf("string longer than %d", v.Len()),
+				Type:  v.Type(),
+			}
+		}
+		zeroFrom(v, reflect.Copy(v, reflect.ValueOf(data)))
+		return nil
+	}
 
-func (d *Decoder) decodeString(v reflect.Value, size int64) error {
-	data := make([]byte, size)
-	n, err := io.ReadFull(d.r, data)
-	if n != len(data) {
-		return err
+	if d.weaklyTyped {
+		return d.setWeakString(strings.TrimSpace(string(data)), v)
+	}
+	return &DecodeTypeError{
+		Value: "string",
+		Type:  v.Type(),
 	}
+}
+
+// setWeakString stores the number or boolean held by s in v, in weakly typed
+// mode
+func (d *Decoder) setWeakString(s string, v reflect.Value) error {
+	var err error
 	switch v.Kind() {
-	case reflect.String:
-		v.SetString(bytesAsString(data))
-		return nil
-	case reflect.Slice:
-		if v.Type().Elem().Kind() != reflect.Uint8 {
-			break
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if err = d.setInt(s, v); err == nil {
+			return nil
 		}
-		v.SetBytes(data)
-		return nil
-	case reflect.Array:
-		if v.Type().Elem().Kind() != reflect.Uint8 {
-			break
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(s, 64); err == nil {
+			return setFloat(f, v)
+		}
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(s); err == nil {
+			v.SetBool(b)
+			return nil
 		}
-		reflect.Copy(v, reflect.ValueOf(data))
-		return nil
-	case reflect.Interface:
-		v.Set(reflect.ValueOf(bytesAsString(data)))
-		return nil
 	}
-
+	if _, ok := err.(*DecodeTypeError); ok {
+		return err
+	}
 	return &DecodeTypeError{
-		Value: "string",
+		Value: "string " + strconv.Quote(s),
 		Type:  v.Type(),
 	}
 }
@@ -141,58 +1105,148 @@ func (d *Decoder) decodeBool(v reflect.Value, b bool) error {
 		v.SetBool(b)
 		return nil
 	}
-	if v.Kind() == reflect.Interface || v.Type().ConvertibleTo(reflect.TypeOf(b)) {
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 || v.Type().ConvertibleTo(reflect.TypeOf(b)) {
 		v.Set(reflect.ValueOf(b))
 		return nil
 	}
+	if d.weaklyTyped {
+		s := "0"
+		if b {
+			s = "1"
+		}
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return d.setInt(s, v)
+		}
+	}
 	return &DecodeTypeError{
 		Value: "bool",
 		Type:  v.Type(),
 	}
 }
 
-func setInt(s string, v reflect.Value) error {
+// overflow handles the integer s not fitting into v according to the
+// overflow policy of the decoder
+func (d *Decoder) overflow(s string, v reflect.Value) error {
+	err := &DecodeTypeError{
+		Value: "integer " + s,
+		Type:  v.Type(),
+	}
+	switch d.overflowPolicy {
+	case OverflowClamp:
+		bits := uint(v.Type().Bits())
+		unsigned := v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uintptr
+		switch {
+		case unsigned && strings.HasPrefix(s, "-"):
+			v.SetUint(0)
+		case unsigned:
+			v.SetUint(math.MaxUint64 >> (64 - bits))
+		case strings.HasPrefix(s, "-"):
+			v.SetInt(-1 << (bits - 1))
+		default:
+			v.SetInt(1<<(bits-1) - 1)
+		}
+	case OverflowSkip:
+		v.Set(reflect.Zero(v.Type()))
+	default:
+		return err
+	}
+	d.overflows = append(d.overflows, err)
+	return nil
+}
+
+func isRangeError(err error) bool {
+	ne, ok := err.(*strconv.NumError)
+	return ok && ne.Err == strconv.ErrRange
+}
+
+func (d *Decoder) setInt(s string, v reflect.Value) error {
 	switch v.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		i, err := strconv.ParseInt(s, 10, 64)
-		if err != nil {
+		if err != nil && !isRangeError(err) {
 			return err
 		}
-		if v.OverflowInt(i) {
-			return &DecodeTypeError{
-				Value: "integer " + s,
-				Type:  v.Type(),
-			}
+		if err != nil || v.OverflowInt(i) {
+			return d.overflow(s, v)
 		}
 		v.SetInt(i)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if strings.HasPrefix(s, "-") {
+			return d.overflow(s, v)
+		}
 		i, err := strconv.ParseUint(s, 10, 64)
-		if err != nil {
+		if err != nil && !isRangeError(err) {
 			return err
 		}
-		if v.OverflowUint(i) {
+		if err != nil || v.OverflowUint(i) {
+			return d.overflow(s, v)
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		if !d.weaklyTyped {
 			return &DecodeTypeError{
 				Value: "integer " + s,
 				Type:  v.Type(),
 			}
 		}
-		v.SetUint(i)
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		return setFloat(f, v)
 	case reflect.Bool:
 		v.SetBool(s != "0")
 	case reflect.Struct:
-		if v.Type() == reflect.TypeOf(big.Int{}) {
-			var bi big.Int
-			if _, err := fmt.Sscan(s, &bi); err != nil {
+		switch v.Type() {
+		case bigIntType:
+			// set the value in place, big.Int values should not be copied
+			if _, ok := v.Addr().Interface().(*big.Int).SetString(s, 10); !ok {
+				return corruptf("invalid integer %q", s)
+			}
+		case timeType:
+			i, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
 				return err
 			}
-			v.Set(reflect.ValueOf(bi))
+			v.Set(reflect.ValueOf(timeFromInt(i)))
+		default:
+			return &DecodeTypeError{
+				Value: "integer " + s,
+				Type:  v.Type(),
+			}
+		}
+	case reflect.String:
+		if v.Type() != numberType {
+			return &DecodeTypeError{
+				Value: "integer " + s,
+				Type:  v.Type(),
+			}
 		}
+		v.SetString(s)
 	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return &DecodeTypeError{
+				Value: "integer " + s,
+				Type:  v.Type(),
+			}
+		}
+		if d.useNumber {
+			v.Set(reflect.ValueOf(Number(s)))
+			return nil
+		}
 		n, err := strconv.ParseInt(s, 10, 64)
-		if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+		if isRangeError(err) {
+			// values beyond int64 are kept as uint64 when they fit
+			if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+				v.Set(reflect.ValueOf(u))
+				return nil
+			}
 			var bi big.Int
-			if _, err := fmt.Sscan(s, &bi); err != nil {
-				return err
+			if _, ok := bi.SetString(s, 10); !ok {
+				return corruptf("invalid integer %q", s)
 			}
 			v.Set(reflect.ValueOf(bi))
 		} else {
@@ -211,82 +1265,135 @@ func setInt(s string, v reflect.Value) error {
 }
 
 func (d *Decoder) decodeInt(v reflect.Value, code byte) error {
-	var s string
+	s, err := d.readInt(code)
+	if err != nil {
+		return err
+	}
+	return d.setInt(s, v)
+}
 
+// readInt reads the integer introduced by code and returns it in decimal form
+func (d *Decoder) readInt(code byte) (s string, err error) {
 	switch code {
 	case chrInt1:
 		var data int8
 		if err := binary.Read(d.r, binary.BigEndian, &data); err != nil {
-			return err
+			return "", err
 		}
 		s = strconv.FormatInt(int64(data), 10)
 	case chrInt2:
 		var data int16
 		if err := binary.Read(d.r, binary.BigEndian, &data); err != nil {
-			return err
+			return "", err
 		}
 		s = strconv.FormatInt(int64(data), 10)
 	case chrInt4:
 		var data int32
 		if err := binary.Read(d.r, binary.BigEndian, &data); err != nil {
-			return err
+			return "", err
 		}
 		s = strconv.FormatInt(int64(data), 10)
 	case chrInt8:
 		var data int64
 		if err := binary.Read(d.r, binary.BigEndian, &data); err != nil {
-			return err
+			return "", err
 		}
 		s = strconv.FormatInt(int64(data), 10)
 	case chrInt:
-		var ibytes []byte
-		ibytes, err := d.r.ReadBytes(chrTerm)
+		ibytes, err := d.readUntil(nil, chrTerm, d.maxIntChars())
 		if err != nil {
-			return err
+			return "", err
+		}
+		if !validInt(ibytes) {
+			return "", corruptf("invalid integer %q", ibytes)
 		}
-		ibytes = ibytes[:len(ibytes)-1]
 		s = string(ibytes)
+	default:
+		if isFixedPosInt(code) {
+			s = strconv.FormatInt(int64(code-intPosFixedStart), 10)
+		} else if isFixedNegInt(code) {
+			s = strconv.FormatInt(int64(code-intNegFixedStart+1)*-1, 10)
+		} else {
+			err = corruptf("unsupported code %v for type integer", code)
+		}
 	}
-	return setInt(s, v)
+	return
 }
 
-func setFloat(f float64, v reflect.Value) error {
-	defer func() error {
-		r := recover()
-		runtimeErr, ok := r.(runtime.Error)
-		if ok {
-			return runtimeErr
+// validInt reports whether b is a decimal integer, as held by chrInt values
+func validInt(b []byte) bool {
+	if len(b) > 0 && b[0] == '-' {
+		b = b[1:]
+	}
+	if len(b) == 0 {
+		return false
+	}
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
 		}
-		err, ok := r.(error)
-		if !ok && r != nil {
-			panic(r)
+	}
+	return true
+}
+
+// setFloat stores f in v, which must be a float, an empty interface or a
+// time.Time
+func setFloat(f float64, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if v.OverflowFloat(f) {
+			return &DecodeTypeError{
+				Value: "float " + strconv.FormatFloat(f, 'g', -1, 64),
+				Type:  v.Type(),
+			}
 		}
-		return err
-	}()
-	if v.Kind() == reflect.Interface {
-		v.Set(reflect.ValueOf(f))
-	} else {
 		v.SetFloat(f)
+		return nil
+	case reflect.Interface:
+		if v.NumMethod() == 0 {
+			v.Set(reflect.ValueOf(f))
+			return nil
+		}
+	case reflect.Struct:
+		if v.Type() == timeType {
+			v.Set(reflect.ValueOf(timeFromFloat(f)))
+			return nil
+		}
 	}
-	return nil
+	return &DecodeTypeError{Value: "float", Type: v.Type()}
 }
 
-func (d *Decoder) decodeFloat(v reflect.Value, code byte) error {
+// readFloat reads the float following code, which must be chrFloat32 or
+// chrFloat64
+func (d *Decoder) readFloat(code byte) (float64, error) {
 	switch code {
 	case chrFloat32:
 		var data float32
 		if err := binary.Read(d.r, binary.BigEndian, &data); err != nil {
+			return 0, eofUnexpected(err)
 		}
-		return setFloat(float64(data), v)
+		return float64(data), nil
 	case chrFloat64:
 		var data float64
 		if err := binary.Read(d.r, binary.BigEndian, &data); err != nil {
-			return err
+			return 0, eofUnexpected(err)
 		}
-		return setFloat(data, v)
-	default:
-		return fmt.Errorf("rencode: unsupported code %v for type float", code)
+		return data, nil
+	}
+	return 0, corruptf("unsupported code %v for type float", code)
+}
+
+func (d *Decoder) decodeFloat(v reflect.Value, code byte) error {
+	f, err := d.readFloat(code)
+	if err != nil {
+		return err
+	}
+	if code == chrFloat32 && d.keepFloat32 &&
+		v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		v.Set(reflect.ValueOf(float32(f)))
+		return nil
 	}
+	return setFloat(f, v)
 }
 
 func (d *Decoder) decodeSliceElem(i int, v reflect.Value) error {
@@ -295,6 +1402,9 @@ func (d *Decoder) decodeSliceElem(i int, v reflect.Value) error {
 		if newcap < 4 {
 			newcap = 4
 		}
+		if err := d.charge(int64(newcap) * int64(v.Type().Elem().Size())); err != nil {
+			return err
+		}
 		newv := reflect.MakeSlice(v.Type(), v.Len(), newcap)
 		reflect.Copy(newv, v)
 		v.Set(newv)
@@ -307,7 +1417,12 @@ func (d *Decoder) decodeSliceElem(i int, v reflect.Value) error {
 }
 
 func (d *Decoder) decodeSlice(v reflect.Value, size int) error {
-	if v.Kind() == reflect.Interface {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
 		var x []interface{}
 		defer func(p reflect.Value) { p.Set(v) }(v)
 		v = reflect.ValueOf(&x).Elem()
@@ -319,26 +1434,66 @@ func (d *Decoder) decodeSlice(v reflect.Value, size int) error {
 			Type:  v.Type(),
 		}
 	}
-	for i := 0; (0 <= size && i < size) || size < 0; i++ {
+	i := 0
+	for ; (0 <= size && i < size) || size < 0; i++ {
 		if size < 0 {
 			c, err := d.peekByte()
 			if err != nil {
 				return err
 			}
 			if c == chrTerm {
-				_, err := d.r.ReadByte()
+				if _, err := d.r.ReadByte(); err != nil {
+					return err
+				}
+				break
+			}
+		}
+		if v.Kind() == reflect.Array && i >= v.Len() {
+			if !d.truncateArrays {
+				return &DecodeTypeError{
+					Value: fmt.Sprintf("slice longer than %d", v.Len()),
+					Type:  v.Type(),
+				}
+			}
+			if err := d.skipValue(); err != nil {
 				return err
 			}
+			continue
 		}
 		if err := d.decodeSliceElem(i, v); err != nil {
 			return err
 		}
 	}
+
+	switch {
+	case v.Kind() == reflect.Array:
+		// zero the elements missing from a shorter list
+		zeroFrom(v, i)
+	case i < v.Len():
+		v.SetLen(i)
+	}
 	return nil
 }
 
+// zeroFrom zeroes the elements of the array v from index i
+func zeroFrom(v reflect.Value, i int) {
+	if i >= v.Len() {
+		return
+	}
+	zero := reflect.Zero(v.Type().Elem())
+	for ; i < v.Len(); i++ {
+		v.Index(i).Set(zero)
+	}
+}
+
 func (d *Decoder) decodeMap(v reflect.Value, size int) error {
-	if v.Kind() == reflect.Interface {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
+	iface := v.Kind() == reflect.Interface && v.NumMethod() == 0
+	if iface {
 		var x map[string]interface{}
 		defer func(p reflect.Value) { p.Set(v) }(v)
 		v = reflect.ValueOf(&x).Elem()
@@ -346,25 +1501,27 @@ func (d *Decoder) decodeMap(v reflect.Value, size int) error {
 	var (
 		mapElem reflect.Value
 		isMap   bool
-		vals    map[string]reflect.Value
+		fields  *structFields
+		unknown []string
+		only    = d.only
 	)
+	d.only = nil
 	switch v.Kind() {
 	case reflect.Map:
 		t := v.Type()
-		if t.Key() != reflect.TypeOf("") {
-			return &DecodeTypeError{
-				Value: "string ",
-				Type:  t.Key(),
-			}
-		}
 		if v.IsNil() {
 			v.Set(reflect.MakeMap(t))
 		}
 
 		isMap = true
 		mapElem = reflect.New(t.Elem()).Elem()
+		if t.Key().Kind() != reflect.String {
+			// keys of any type, such as the int keys Deluge mixes with
+			// string keys in some dicts
+			return d.decodeMapKeys(v, mapElem, 0, size)
+		}
 	case reflect.Struct:
-		// TODO
+		fields = cachedTypeFields(v.Type())
 	default:
 		return &DecodeTypeError{
 			Value: "map",
@@ -380,29 +1537,40 @@ func (d *Decoder) decodeMap(v reflect.Value, size int) error {
 		if err != nil {
 			return err
 		}
-		if ch == chrTerm {
-			_, err := d.r.ReadByte()
-			return err
+		if size < 0 && ch == chrTerm {
+			if _, err := d.r.ReadByte(); err != nil {
+				return err
+			}
+			break
+		}
+
+		if iface && !isFixedString(ch) && !isString(ch) {
+			// a key that is not a string, the dict is decoded into a
+			// map[interface{}]interface{} from there
+			v = anyKeys(v)
+			return d.decodeMapKeys(v, reflect.New(v.Type().Elem()).Elem(), i, size)
 		}
 
 		// peek the next value we're suppsed to read
-		var key string
-		if err := d.decodeValue(reflect.ValueOf(&key).Elem()); err != nil {
+		key, err := d.decodeKey()
+		if err != nil {
 			return err
 		}
 
-		if isMap {
+		if only != nil && !only[key] {
+			// not selected by DecodeKeys, skip the value
+		} else if isMap {
 			mapElem.Set(reflect.Zero(v.Type().Elem()))
 			subv = mapElem
-		} else {
-			subv = vals[key]
+		} else if f := fields.lookup(key, d.snakeCaseFields, d.foldFields); f != nil {
+			subv = fieldByIndex(v, f.index, true)
+		} else if d.disallowUnknown {
+			unknown = append(unknown, key)
 		}
 
 		if !subv.IsValid() {
-			// if it's invalid, grab but ignore the next value
-			var x interface{}
-			err := d.decodeValue(reflect.ValueOf(&x).Elem())
-			if err != nil {
+			// if it's invalid, skip the next value
+			if err := d.skipValue(); err != nil {
 				return err
 			}
 
@@ -415,20 +1583,25 @@ func (d *Decoder) decodeMap(v reflect.Value, size int) error {
 		}
 
 		if isMap {
-			v.SetMapIndex(reflect.ValueOf(key), subv)
+			if err := d.charge(int64(len(key)) + int64(mapElem.Type().Size())); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), subv)
 		}
 	}
+	if len(unknown) > 0 {
+		return &UnknownFieldsError{Type: v.Type(), Keys: unknown}
+	}
 	return nil
 }
 
+// bytesAsString returns a string sharing the memory of b, which must not be
+// modified afterwards
 func bytesAsString(b []byte) string {
 	if len(b) == 0 {
 		return ""
 	}
-	return *(*string)(unsafe.Pointer(&reflect.StringHeader{
-		uintptr(unsafe.Pointer(&b[0])),
-		len(b),
-	}))
+	return *(*string)(unsafe.Pointer(&b))
 }
 
 // DecodeTypeError represents decode type error
@@ -441,6 +1614,31 @@ func (e *DecodeTypeError) Error() string {
 	return fmt.Sprintf("cannot decode a rencode %s into a %s", e.Value, e.Type)
 }
 
+// UnknownFieldsError lists the keys of a dict that match no field of the
+// struct it is decoded into, while DisallowUnknownFields is set
+type UnknownFieldsError struct {
+	Type reflect.Type
+	Keys []string
+}
+
+func (e *UnknownFieldsError) Error() string {
+	keys := make([]string, len(e.Keys))
+	for i, k := range e.Keys {
+		keys[i] = strconv.Quote(k)
+	}
+	return fmt.Sprintf("rencode: unknown keys %s for %s", strings.Join(keys, ", "), e.Type)
+}
+
+// InvalidUTF8Error represents a string that is not valid UTF-8, decoded while
+// DecodeUTF8 is set
+type InvalidUTF8Error struct {
+	Value []byte
+}
+
+func (e *InvalidUTF8Error) Error() string {
+	return fmt.Sprintf("rencode: invalid UTF-8 in string %q", e.Value)
+}
+
 // DecodeInvalidArgError represents decode invalid argument error
 type DecodeInvalidArgError struct {
 	Type reflect.Type
@@ -457,6 +1655,35 @@ func (e *DecodeInvalidArgError) Error() string {
 	return "rencode: decode(nil " + e.Type.String() + ")"
 }
 
+func isInt(code byte) bool {
+	switch code {
+	case chrInt, chrInt1, chrInt2, chrInt4, chrInt8:
+		return true
+	}
+	return isFixedPosInt(code) || isFixedNegInt(code)
+}
+
+// codeName returns the name of the rencode type introduced by code
+func codeName(code byte) string {
+	switch {
+	case code == chrNone:
+		return "none"
+	case code == chrTrue, code == chrFalse:
+		return "bool"
+	case isInt(code):
+		return "integer"
+	case code == chrFloat32, code == chrFloat64:
+		return "float"
+	case isFixedString(code), isString(code):
+		return "string"
+	case code == chrList, isFixedSlice(code):
+		return "slice"
+	case code == chrDict, isFixedMap(code):
+		return "map"
+	}
+	return fmt.Sprintf("code %v", code)
+}
+
 func isFixedPosInt(code byte) bool {
 	return intPosFixedStart <= code && code < intPosFixedStart+intPosFixedCount
 }
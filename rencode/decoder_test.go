@@ -1,11 +1,21 @@
 package rencode
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"math"
+	"math/big"
+	"net"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 type decodeTestCase struct {
@@ -23,7 +33,9 @@ var decodeTestCases = []decodeTestCase{
 	{int64(32767), "?\x7f\xff"},
 	{int64(2147483647), "@\x7f\xff\xff\xff"},
 	{int64(9223372036854775807), "A\x7f\xff\xff\xff\xff\xff\xff\xff"},
-	{*bigIntFromString("18446744073709551615"), "=18446744073709551615\x7f"},
+	{uint64(18446744073709551615), "=18446744073709551615\x7f"},
+	{*bigIntFromString("18446744073709551616"), "=18446744073709551616\x7f"},
+	{*bigIntFromString("-9223372036854775809"), "=-9223372036854775809\x7f"},
 	{float64(math.MaxFloat32), "B\x7f\x7f\xff\xff"},
 	{float64(math.MaxFloat64), ",\x7f\xef\xff\xff\xff\xff\xff\xff"},
 	{"fööbar", "\x88fööbar"},
@@ -52,3 +64,906 @@ func TestDecode(t *testing.T) {
 		}
 	}
 }
+
+func TestDecodeStruct(t *testing.T) {
+	var opts torrentOptions
+	d := NewDecoder(bytes.NewBufferString("j\x8fmax_connections\x05\x86pausedC\x84path\x84/tmp\x85extra\x01"))
+	if err := d.Decode(&opts); err != nil {
+		t.Fatal(err)
+	}
+	expected := torrentOptions{
+		BaseTorrentOptions: BaseTorrentOptions{MaxConnections: 5, Paused: true},
+		Path:               "/tmp",
+	}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Fatalf("\nexpected: %+v\nactual  : %+v", expected, opts)
+	}
+
+	var req addTorrentRequest
+	d = NewDecoder(bytes.NewBufferString("i\x88filename\x89a.torrent\x8fmax_connections\x05\x86paused\x88shadowed"))
+	if err := d.Decode(&req); err != nil {
+		t.Fatal(err)
+	}
+	if req.BaseTorrentOptions == nil || req.MaxConnections != 5 {
+		t.Fatalf("embedded pointer not allocated: %+v", req)
+	}
+	if req.Filename != "a.torrent" || req.Paused != "shadowed" || req.BaseTorrentOptions.Paused {
+		t.Fatalf("unexpected decoded value: %+v", req)
+	}
+}
+
+func TestDecodeUnmarshaler(t *testing.T) {
+	var v struct {
+		Count peerCount `rencode:"count"`
+	}
+	d := NewDecoder(bytes.NewBufferString("g\x85count\xc2\x03?\x03\xe8"))
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Count != (peerCount{3, 1000}) {
+		t.Fatalf("unexpected value %+v", v.Count)
+	}
+}
+
+func TestDecodePrimitives(t *testing.T) {
+	d := NewDecoder(bytes.NewBufferString("i\x84name\x83foo\x84size?\x03\xe8\x85ratio,?\xf8\x00\x00\x00\x00\x00\x00"))
+	var name string
+	var size int64
+	err := d.DecodeDictFunc(func(d *Decoder, key string) (err error) {
+		switch key {
+		case "name":
+			name, err = d.DecodeString()
+		case "size":
+			size, err = d.DecodeInt(16)
+		default:
+			err = d.Skip()
+		}
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "foo" || size != 1000 {
+		t.Fatalf("unexpected values %q %d", name, size)
+	}
+
+	if _, err := NewDecoder(bytes.NewBufferString("?\x03\xe8")).DecodeInt(8); err == nil {
+		t.Fatal("expected an overflow error")
+	}
+	if _, err := NewDecoder(bytes.NewBufferString("\x83foo")).DecodeBool(); err == nil {
+		t.Fatal("expected a type error")
+	}
+	if f, err := NewDecoder(bytes.NewBufferString("E")).DecodeFloat(64); err != nil || f != 0 {
+		t.Fatalf("unexpected result %v %v", f, err)
+	}
+}
+
+func TestDecodeTime(t *testing.T) {
+	var v struct {
+		Added time.Time `rencode:"time_added"`
+		Seen  time.Time `rencode:"last_seen_complete"`
+	}
+	d := NewDecoder(bytes.NewBufferString("h\x92last_seen_complete@]u\xc8\x00\x8atime_added,A\xd7]r\x00 \x00\x00"))
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if !v.Seen.Equal(time.Unix(1568000000, 0)) {
+		t.Fatalf("unexpected time %v", v.Seen)
+	}
+	if !v.Added.Equal(time.Unix(1568000000, 500000000)) {
+		t.Fatalf("unexpected time %v", v.Added)
+	}
+}
+
+func TestDecodeUseNumber(t *testing.T) {
+	var v []interface{}
+	d := NewDecoder(bytes.NewBufferString("\xc3\x05=18446744073709551616\x7f\x83foo"))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{Number("5"), Number("18446744073709551616"), "foo"}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("\nexpected: %#v\nactual  : %#v", expected, v)
+	}
+	if i, err := v[0].(Number).Int64(); err != nil || i != 5 {
+		t.Fatalf("unexpected Int64 result %v %v", i, err)
+	}
+	if _, err := v[1].(Number).Uint64(); err == nil {
+		t.Fatal("expected a range error")
+	}
+	if bi, err := v[1].(Number).BigInt(); err != nil || bi.String() != "18446744073709551616" {
+		t.Fatalf("unexpected BigInt result %v %v", bi, err)
+	}
+
+	var n Number
+	if err := NewDecoder(bytes.NewBufferString("?\x03\xe8")).Decode(&n); err != nil || n != "1000" {
+		t.Fatalf("unexpected result %q %v", n, err)
+	}
+}
+
+func TestDecodeStringsAsBytes(t *testing.T) {
+	var v interface{}
+	d := NewDecoder(bytes.NewBufferString("g\x86pieces\xc2\x82\xff\x00\x83foo"))
+	d.DecodeStringsAsBytes(true)
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"pieces": []interface{}{[]byte{0xff, 0x00}, []byte("foo")},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("\nexpected: %#v\nactual  : %#v", expected, v)
+	}
+
+	var s string
+	if err := d.Decode(&s); err == nil {
+		t.Fatal("expected EOF")
+	}
+}
+
+func TestDecodeUTF8(t *testing.T) {
+	var v interface{}
+	d := NewDecoder(bytes.NewBufferString("\xc2\x88fööbar\x82\xff\x00"))
+	d.DecodeStringsAsBytes(true)
+	d.DecodeUTF8(true)
+	err := d.Decode(&v)
+	if _, ok := err.(*InvalidUTF8Error); !ok {
+		t.Fatalf("expected an *InvalidUTF8Error, got %v", err)
+	}
+
+	d = NewDecoder(bytes.NewBufferString("\xc1\x88fööbar"))
+	d.DecodeStringsAsBytes(true)
+	d.DecodeUTF8(true)
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, []interface{}{"fööbar"}) {
+		t.Fatalf("unexpected value %#v", v)
+	}
+}
+
+func TestDecodeUint64(t *testing.T) {
+	var u uint64
+	if err := NewDecoder(bytes.NewBufferString("=18446744073709551615\x7f")).Decode(&u); err != nil {
+		t.Fatal(err)
+	}
+	if u != math.MaxUint64 {
+		t.Fatalf("unexpected value %v", u)
+	}
+	if err := NewDecoder(bytes.NewBufferString("=18446744073709551616\x7f")).Decode(&u); err == nil {
+		t.Fatal("expected a range error")
+	}
+	if err := NewDecoder(bytes.NewBufferString("\x65")).Decode(&u); err == nil {
+		t.Fatal("expected an error for a negative value")
+	}
+}
+
+func TestDecodeListFunc(t *testing.T) {
+	type status struct {
+		Name string `rencode:"name"`
+	}
+	var names []string
+	d := NewDecoder(bytes.NewBufferString(";g\x84name\x81ag\x84name\x81b\x7f\x01"))
+	err := d.DecodeListFunc(func(d *Decoder) error {
+		var s status
+		if err := d.Decode(&s); err != nil {
+			return err
+		}
+		names = append(names, s.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Fatalf("unexpected names %v", names)
+	}
+
+	var next int
+	if err := d.Decode(&next); err != nil || next != 1 {
+		t.Fatalf("decoder not positioned after the list: %v %v", next, err)
+	}
+
+	if err := NewDecoder(bytes.NewBufferString("\x83foo")).DecodeListFunc(nil); err == nil {
+		t.Fatal("expected a type error")
+	}
+}
+
+func TestNewDecoderByteScanner(t *testing.T) {
+	br := bufio.NewReader(strings.NewReader("\x83foo\x01"))
+	d := NewDecoder(br)
+	if d.r != br {
+		t.Fatal("expected the *bufio.Reader to be used directly")
+	}
+	var s string
+	if err := d.Decode(&s); err != nil || s != "foo" {
+		t.Fatalf("unexpected result %q %v", s, err)
+	}
+	if b, err := br.ReadByte(); err != nil || b != 1 {
+		t.Fatalf("decoder read past the value: %v %v", b, err)
+	}
+
+	r := strings.NewReader(";\x01\x02\x7f\x03")
+	var v []int
+	if err := NewDecoder(r).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() != 1 {
+		t.Fatalf("expected 1 unread byte, got %d", r.Len())
+	}
+}
+
+func TestDecodeInternKeys(t *testing.T) {
+	var v []map[string]int
+	d := NewDecoder(bytes.NewBufferString("\xc2g\x84name\x01g\x84name\x02"))
+	d.InternKeys(true)
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, m := range v {
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) != 2 || keys[0] != "name" || keys[1] != "name" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	if unsafe.StringData(keys[0]) != unsafe.StringData(keys[1]) {
+		t.Fatal("expected the keys to share their allocation")
+	}
+}
+
+func TestDecodePointers(t *testing.T) {
+	var pp **string
+	if err := NewDecoder(bytes.NewBufferString("\x83foo")).Decode(&pp); err != nil {
+		t.Fatal(err)
+	}
+	if pp == nil || *pp == nil || **pp != "foo" {
+		t.Fatalf("unexpected value %v", pp)
+	}
+
+	var v struct {
+		Seeds *int64          `rencode:"seeds"`
+		Label *string         `rencode:"label"`
+		Peers map[string]*int `rencode:"peers"`
+	}
+	label := "old"
+	v.Label = &label
+	d := NewDecoder(bytes.NewBufferString("i\x85seeds\x05\x85labelE\x85peersh\x81a\x01\x81bE"))
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Seeds == nil || *v.Seeds != 5 {
+		t.Fatalf("unexpected seeds %v", v.Seeds)
+	}
+	if v.Label != nil {
+		t.Fatalf("expected a nil label, got %q", *v.Label)
+	}
+	if len(v.Peers) != 2 || *v.Peers["a"] != 1 || v.Peers["b"] != nil {
+		t.Fatalf("unexpected peers %v", v.Peers)
+	}
+}
+
+func TestDecodeFloatErrors(t *testing.T) {
+	var f32 float32
+	if err := NewDecoder(bytes.NewBufferString("B\x3f\x80")).Decode(&f32); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	var s string
+	err := NewDecoder(bytes.NewBufferString("B\x3f\x80\x00\x00")).Decode(&s)
+	if _, ok := err.(*DecodeTypeError); !ok {
+		t.Fatalf("expected a DecodeTypeError, got %v", err)
+	}
+
+	// 1e300 does not fit into a float32
+	err = NewDecoder(bytes.NewBufferString(",\x7e\x37\xe4\x3c\x88\x00\x75\x9c")).Decode(&f32)
+	if _, ok := err.(*DecodeTypeError); !ok {
+		t.Fatalf("expected a DecodeTypeError, got %v", err)
+	}
+}
+
+func TestDecodeNonEmptyInterface(t *testing.T) {
+	for _, v := range []interface{}{
+		"abc", 1, int64(1) << 40, true, 1.5,
+		[]interface{}{1}, map[string]interface{}{"a": 1},
+	} {
+		data, err := Append(nil, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s fmt.Stringer
+		err = NewDecoder(bytes.NewReader(data)).Decode(&s)
+		if _, ok := err.(*DecodeTypeError); !ok {
+			t.Errorf("%v: expected a DecodeTypeError, got %v", v, err)
+		}
+	}
+
+	// a field of a struct
+	var st struct{ Err error }
+	data, err := Append(nil, map[string]interface{}{"Err": "failed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewDecoder(bytes.NewReader(data)).Decode(&st)
+	if _, ok := err.(*DecodeTypeError); !ok {
+		t.Errorf("expected a DecodeTypeError, got %v", err)
+	}
+}
+
+func TestDecodeKeepFloat32(t *testing.T) {
+	data := "\xc2B\x3d\xcc\xcc\xcd,\x3f\xb9\x99\x99\x99\x99\x99\x9a"
+
+	var v interface{}
+	d := NewDecoder(bytes.NewBufferString(data))
+	d.KeepFloat32(true)
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{float32(0.1), 0.1}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, v)
+	}
+
+	var b bytes.Buffer
+	e := NewEncoder(&b)
+	if err := e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != data {
+		t.Fatalf("expected %q, got %q", data, b.String())
+	}
+}
+
+func TestDecodeHook(t *testing.T) {
+	type peer struct {
+		IP      net.IP        `rencode:"ip"`
+		Port    int32         `rencode:"port"`
+		Elapsed time.Duration `rencode:"elapsed"`
+	}
+	data, err := Append(nil, map[string]interface{}{
+		"peers": []interface{}{
+			map[string]interface{}{"ip": "10.0.0.1", "port": "6881", "elapsed": 90},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v struct {
+		Peers []peer `rencode:"peers"`
+	}
+	d := NewDecoder(bytes.NewReader(data))
+	d.DecodeHook(func(kind Kind, value interface{}, target reflect.Type) (interface{}, error) {
+		switch {
+		case kind == String && target == reflect.TypeOf(net.IP{}):
+			return net.ParseIP(value.(string)), nil
+		case kind == String && target.Kind() == reflect.Int32:
+			return strconv.ParseInt(value.(string), 10, 32)
+		case kind == Int && target == reflect.TypeOf(time.Duration(0)):
+			return time.Duration(value.(int64)) * time.Second, nil
+		}
+		return value, nil
+	})
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	expected := []peer{{IP: net.ParseIP("10.0.0.1"), Port: 6881, Elapsed: 90 * time.Second}}
+	if !reflect.DeepEqual(v.Peers, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, v.Peers)
+	}
+}
+
+func TestDecodeHookOncePerValue(t *testing.T) {
+	type peer struct {
+		IP   string `rencode:"ip"`
+		Port int    `rencode:"port"`
+	}
+	data, err := Append(nil, map[string]interface{}{
+		"name":  "foo",
+		"peers": []interface{}{map[string]interface{}{"ip": "10.0.0.1", "port": 6881}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		Name  string `rencode:"name"`
+		Peers []peer `rencode:"peers"`
+	}
+	var calls []Kind
+	d := NewDecoder(bytes.NewReader(data))
+	d.DecodeHook(func(kind Kind, value interface{}, target reflect.Type) (interface{}, error) {
+		calls = append(calls, kind)
+		return value, nil
+	})
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Name != "foo" || len(v.Peers) != 1 || v.Peers[0] != (peer{"10.0.0.1", 6881}) {
+		t.Fatalf("unexpected value %+v", v)
+	}
+	// the outer dict, name, peers, the peer and its 2 fields
+	expected := []Kind{Dict, String, List, Dict, String, Int}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("expected hook calls %v, got %v", expected, calls)
+	}
+}
+
+func TestDecodeWeaklyTypedInput(t *testing.T) {
+	type status struct {
+		Seeds  int     `rencode:"seeds"`
+		Ratio  float64 `rencode:"ratio"`
+		Paused bool    `rencode:"paused"`
+		Queue  uint8   `rencode:"queue"`
+		Total  float32 `rencode:"total"`
+		Active int     `rencode:"active"`
+	}
+	data, err := Append(nil, map[string]interface{}{
+		"seeds":  " 12 ",
+		"ratio":  2,
+		"paused": "1",
+		"queue":  "3",
+		"total":  "1.5",
+		"active": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v status
+	if err := NewDecoder(bytes.NewReader(data)).Decode(&v); err == nil {
+		t.Fatal("expected an error without WeaklyTypedInput")
+	}
+
+	v = status{}
+	d := NewDecoder(bytes.NewReader(data))
+	d.WeaklyTypedInput(true)
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	expected := status{Seeds: 12, Ratio: 2, Paused: true, Queue: 3, Total: 1.5, Active: 1}
+	if v != expected {
+		t.Fatalf("expected %+v, got %+v", expected, v)
+	}
+
+	d = NewDecoder(bytes.NewBufferString("\x84-300"))
+	d.WeaklyTypedInput(true)
+	var u uint8
+	if err := d.Decode(&u); err == nil {
+		t.Fatal("expected an error decoding -300 into an uint8")
+	} else if _, ok := err.(*DecodeTypeError); !ok {
+		t.Fatalf("expected a DecodeTypeError, got %v", err)
+	}
+}
+
+func TestDecodeOverflowPolicy(t *testing.T) {
+	type counts struct {
+		A int8   `rencode:"a"`
+		B int8   `rencode:"b"`
+		C uint16 `rencode:"c"`
+		D uint8  `rencode:"d"`
+		E int64  `rencode:"e"`
+	}
+	data, err := Append(nil, map[string]interface{}{
+		"a": 300,
+		"b": -300,
+		"c": -1,
+		"d": 7,
+		"e": bigIntFromString("123456789012345678901234567890"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy   OverflowPolicy
+		expected counts
+	}{
+		{OverflowClamp, counts{A: 127, B: -128, C: 0, D: 7, E: math.MaxInt64}},
+		{OverflowSkip, counts{D: 7}},
+	}
+	for _, tt := range tests {
+		v := counts{A: 1, B: 1, C: 1, E: 1}
+		d := NewDecoder(bytes.NewReader(data))
+		d.HandleOverflow(tt.policy)
+		if err := d.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		if v != tt.expected {
+			t.Errorf("%v: expected %+v, got %+v", tt.policy, tt.expected, v)
+		}
+		if errs := d.Overflows(); len(errs) != 4 {
+			t.Errorf("%v: expected 4 overflows, got %v", tt.policy, errs)
+		}
+		if errs := d.Overflows(); len(errs) != 0 {
+			t.Errorf("%v: expected the overflows to be cleared, got %v", tt.policy, errs)
+		}
+	}
+
+	var v counts
+	err = NewDecoder(bytes.NewReader(data)).Decode(&v)
+	if _, ok := err.(*DecodeTypeError); !ok {
+		t.Fatalf("expected a DecodeTypeError, got %v", err)
+	}
+}
+
+func TestDecodeKeys(t *testing.T) {
+	data, err := Append(nil, map[string]interface{}{
+		"name":     "ubuntu.iso",
+		"progress": 50.5,
+		"files":    []interface{}{map[string]interface{}{"path": "a", "size": 1}},
+		"state":    "Seeding",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m map[string]interface{}
+	if err := NewDecoder(bytes.NewReader(data)).DecodeKeys(&m, "files", "state"); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"files": []interface{}{map[string]interface{}{"path": "a", "size": int64(1)}},
+		"state": "Seeding",
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("expected %v, got %v", expected, m)
+	}
+
+	var s struct {
+		Name     string  `rencode:"name"`
+		Progress float64 `rencode:"progress"`
+		State    string  `rencode:"state"`
+	}
+	d := NewDecoder(bytes.NewReader(append(data, data...)))
+	if err := d.DecodeKeys(&s, "name"); err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "ubuntu.iso" || s.Progress != 0 || s.State != "" {
+		t.Fatalf("unexpected value %+v", s)
+	}
+	// the selection only applies to a single value
+	if err := d.Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Progress != 50.5 || s.State != "Seeding" {
+		t.Fatalf("unexpected value %+v", s)
+	}
+}
+
+func BenchmarkDecodeKeys(b *testing.B) {
+	torrents := make(map[string]interface{})
+	for i := 0; i < 1000; i++ {
+		torrents[strconv.Itoa(i)] = map[string]interface{}{
+			"name":     "torrent " + strconv.Itoa(i),
+			"progress": float64(i) / 10,
+			"peers":    []interface{}{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+			"trackers": []interface{}{map[string]interface{}{"url": "http://tracker.example.com/announce"}},
+		}
+	}
+	data, err := Append(nil, map[string]interface{}{"torrents": torrents, "stats": map[string]int{"peers": 3}})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("all", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var v map[string]interface{}
+			if err := NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("keys", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var v map[string]interface{}
+			if err := NewDecoder(bytes.NewReader(data)).DecodeKeys(&v, "stats"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestDecodeMemoryLimit(t *testing.T) {
+	small, err := Append(nil, []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := Append(nil, strings.Split(strings.Repeat("x", 100), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	long, err := Append(nil, strings.Repeat("x", 2000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(bytes.NewReader(bytes.Join([][]byte{small, large, small, long, small}, nil)))
+	d.MemoryLimit(1024)
+	var v []string
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Decode(&v); err != ErrMemoryLimit {
+		t.Fatalf("expected ErrMemoryLimit, got %v", err)
+	}
+
+	d = NewDecoder(bytes.NewReader(bytes.Join([][]byte{small, small, small, long}, nil)))
+	d.MemoryLimit(1024)
+	// the budget applies to each value
+	for i := 0; i < 3; i++ {
+		if err := d.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := d.DecodeString(); err != ErrMemoryLimit {
+		t.Fatalf("expected ErrMemoryLimit, got %v", err)
+	}
+}
+
+func BenchmarkDecodeStruct(b *testing.B) {
+	data, err := Append(nil, torrentOptions{
+		BaseTorrentOptions: BaseTorrentOptions{MaxConnections: 50, Paused: true},
+		Path:               "/downloads",
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := bytes.NewReader(data)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(data)
+		var v torrentOptions
+		if err := NewDecoder(r).Decode(&v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecodeStringAllocs(t *testing.T) {
+	data := []byte("\x8bhello world")
+	r := bytes.NewReader(data)
+	d := NewDecoder(r)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		r.Reset(data)
+		if s, err := d.DecodeString(); err != nil || s != "hello world" {
+			t.Fatalf("unexpected result %q, %v", s, err)
+		}
+	})
+	// only the returned string is allocated
+	if allocs != 1 {
+		t.Fatalf("expected 1 allocation, got %v", allocs)
+	}
+
+	var a [11]byte
+	v := reflect.ValueOf(&a).Elem()
+	allocs = testing.AllocsPerRun(100, func() {
+		r.Reset(data)
+		if err := d.decodeValue(v); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > 1 || string(a[:]) != "hello world" {
+		t.Fatalf("unexpected %v allocations decoding %q", allocs, a)
+	}
+}
+
+func TestDecodeZeroCopyStrings(t *testing.T) {
+	data, err := Append(nil, []string{"first", "second", strings.Repeat("x", 300)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, zeroCopy := range []bool{false, true} {
+		d := NewDecoder(bytes.NewReader(append(data, data...)))
+		d.ZeroCopyStrings(zeroCopy)
+		var first, second []string
+		if err := d.Decode(&first); err != nil {
+			t.Fatal(err)
+		}
+		// decoding more strings must not change the first ones, whether
+		// their buffer was reused or kept
+		if err := d.Decode(&second); err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{"first", "second", strings.Repeat("x", 300)}
+		if !reflect.DeepEqual(first, expected) || !reflect.DeepEqual(second, expected) {
+			t.Fatalf("zero copy %v: unexpected strings %q, %q", zeroCopy, first, second)
+		}
+	}
+}
+
+func TestDecodeBigIntPointers(t *testing.T) {
+	large := "123456789012345678901234567890"
+	data, err := Append(nil, map[string]interface{}{
+		"total":  bigIntFromString(large),
+		"small":  7,
+		"none":   nil,
+		"counts": map[string]interface{}{"a": bigIntFromString("-" + large), "b": 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v struct {
+		Total  *big.Int            `rencode:"total"`
+		Small  *big.Int            `rencode:"small"`
+		None   *big.Int            `rencode:"none"`
+		Counts map[string]*big.Int `rencode:"counts"`
+	}
+	v.None = big.NewInt(1)
+	if err := NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Total.String() != large || v.Small.Int64() != 7 || v.None != nil {
+		t.Fatalf("unexpected value %+v", v)
+	}
+	if v.Counts["a"].String() != "-"+large || v.Counts["b"].Int64() != 1 {
+		t.Fatalf("unexpected counts %v", v.Counts)
+	}
+}
+
+func TestDecodeArrayLength(t *testing.T) {
+	a := [3]int{7, 7, 7}
+	if err := NewDecoder(bytes.NewBufferString("\xc2\x01\x02")).Decode(&a); err != nil {
+		t.Fatal(err)
+	}
+	if a != [3]int{1, 2, 0} {
+		t.Fatalf("expected the missing elements to be zeroed, got %v", a)
+	}
+
+	// a terminated list, as sent for lists of 64 elements and more
+	err := NewDecoder(bytes.NewBufferString(";\x01\x02\x03\x04\x7f")).Decode(&a)
+	if _, ok := err.(*DecodeTypeError); !ok {
+		t.Fatalf("expected a DecodeTypeError, got %v", err)
+	}
+
+	d := NewDecoder(bytes.NewBufferString(";\x01\x02\x03\x04\x7f\x01"))
+	d.TruncateArrays(true)
+	if err := d.Decode(&a); err != nil {
+		t.Fatal(err)
+	}
+	if a != [3]int{1, 2, 3} {
+		t.Fatalf("unexpected array %v", a)
+	}
+	// the extra elements were consumed
+	if i, err := d.DecodeInt(0); err != nil || i != 1 {
+		t.Fatalf("unexpected next value %v, %v", i, err)
+	}
+
+	b := [4]byte{9, 9, 9, 9}
+	if err := NewDecoder(bytes.NewBufferString("\x82ab")).Decode(&b); err != nil {
+		t.Fatal(err)
+	}
+	if b != [4]byte{'a', 'b', 0, 0} {
+		t.Fatalf("unexpected bytes %v", b)
+	}
+	err = NewDecoder(bytes.NewBufferString("\x85abcde")).Decode(&b)
+	if _, ok := err.(*DecodeTypeError); !ok {
+		t.Fatalf("expected a DecodeTypeError, got %v", err)
+	}
+
+	s := []int{7, 7, 7}
+	if err := NewDecoder(bytes.NewBufferString("\xc1\x01")).Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, []int{1}) {
+		t.Fatalf("expected the slice to be shortened, got %v", s)
+	}
+}
+
+func TestDecodeFieldMatching(t *testing.T) {
+	type status struct {
+		MaxConnections int
+		TrackerURL     string
+		HTTPProxy      string
+		Ipv6Enabled    bool
+		Name           string `rencode:"torrent_name"`
+	}
+	data := "k\x8fmax_connections\x05\x8btracker_url\x83foo\x8ahttp_proxy\x83bar\x8cipv6_enabledC\x8cTORRENT_NAME\x81x"
+	tests := []struct {
+		snake, fold bool
+		expected    status
+	}{
+		{false, false, status{}},
+		{true, false, status{MaxConnections: 5, TrackerURL: "foo", HTTPProxy: "bar", Ipv6Enabled: true}},
+		{false, true, status{Name: "x"}},
+		{true, true, status{MaxConnections: 5, TrackerURL: "foo", HTTPProxy: "bar", Ipv6Enabled: true, Name: "x"}},
+	}
+	for _, test := range tests {
+		var s status
+		d := NewDecoder(bytes.NewBufferString(data))
+		d.SnakeCaseFields(test.snake)
+		d.CaseInsensitiveFields(test.fold)
+		if err := d.Decode(&s); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(s, test.expected) {
+			t.Fatalf("snake %v, fold %v\nexpected: %+v\nactual  : %+v", test.snake, test.fold, test.expected, s)
+		}
+	}
+
+	// exact matches take precedence
+	var v struct {
+		Name  string
+		NAME  string
+		Other string `rencode:"name"`
+	}
+	d := NewDecoder(bytes.NewBufferString("g\x84NAME\x81x"))
+	d.CaseInsensitiveFields(true)
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.NAME != "x" || v.Name != "" || v.Other != "" {
+		t.Fatalf("unexpected value %+v", v)
+	}
+}
+
+func TestDecodeDisallowUnknownFields(t *testing.T) {
+	var opts torrentOptions
+	d := NewDecoder(bytes.NewBufferString("<\x8fmax_connections\x05\x85extra\x01\x84path\x84/tmp\x84moreE\x7f"))
+	d.DisallowUnknownFields(true)
+	err := d.Decode(&opts)
+	var unknown *UnknownFieldsError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("expected an *UnknownFieldsError, got %v", err)
+	}
+	if !reflect.DeepEqual(unknown.Keys, []string{"extra", "more"}) || unknown.Type != reflect.TypeOf(opts) {
+		t.Fatalf("unexpected error %+v", unknown)
+	}
+	if opts.MaxConnections != 5 || opts.Path != "/tmp" {
+		t.Fatalf("known fields not decoded: %+v", opts)
+	}
+
+	// maps and keys left out by DecodeKeys accept any key
+	d = NewDecoder(bytes.NewBufferString("h\x84path\x84/tmp\x85extra\x01h\x84path\x84/tmp\x85extra\x01"))
+	d.DisallowUnknownFields(true)
+	var m map[string]interface{}
+	if err := d.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DecodeKeys(&opts, "path"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeListToChan(t *testing.T) {
+	type status struct {
+		Name string `rencode:"name"`
+	}
+	ch := make(chan status)
+	done := make(chan error, 1)
+	go func() {
+		d := NewDecoder(bytes.NewBufferString(";g\x84name\x81ag\x84name\x81b\x7f"))
+		done <- d.DecodeListToChan(context.Background(), ch)
+		close(ch)
+	}()
+	var names []string
+	for s := range ch {
+		names = append(names, s.Name)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Fatalf("unexpected names %v", names)
+	}
+
+	// a send blocked on a missing receiver is interrupted by the context
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		d := NewDecoder(bytes.NewBufferString("\xc2\x01\x02"))
+		done <- d.DecodeListToChan(ctx, make(chan int))
+	}()
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	if err := NewDecoder(bytes.NewBufferString("\xc0")).DecodeListToChan(context.Background(), make(<-chan int)); err == nil {
+		t.Fatal("expected an error for a receive-only channel")
+	}
+}
@@ -0,0 +1,210 @@
+package rencode
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Dump writes an indented, Python repr-like rendering of every value encoded
+// in data to w. Strings that are valid UTF-8 are shown as 'str', any other
+// string as b'bytes'.
+func Dump(w io.Writer, data []byte) error {
+	dm := &dumper{d: NewDecoder(bytes.NewReader(data)), w: w}
+	for {
+		if _, err := dm.d.peekByte(); err == io.EOF {
+			return nil
+		}
+		if err := dm.dumpValue(0); err != nil {
+			return err
+		}
+		if err := dm.print("\n"); err != nil {
+			return err
+		}
+	}
+}
+
+const dumpIndent = "    "
+
+type dumper struct {
+	d *Decoder
+	w io.Writer
+}
+
+func (dm *dumper) print(s string) error {
+	_, err := io.WriteString(dm.w, s)
+	return err
+}
+
+func (dm *dumper) dumpValue(depth int) error {
+	c, err := dm.d.r.ReadByte()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	switch {
+	case c == chrNone:
+		return dm.print("None")
+	case c == chrTrue:
+		return dm.print("True")
+	case c == chrFalse:
+		return dm.print("False")
+	case isInt(c):
+		s, err := dm.d.readInt(c)
+		if err != nil {
+			return err
+		}
+		return dm.print(s)
+	case c == chrFloat32, c == chrFloat64:
+		f, err := dm.d.readFloat(c)
+		if err != nil {
+			return err
+		}
+		bitSize := 64
+		if c == chrFloat32 {
+			bitSize = 32
+		}
+		return dm.print(pyFloat(f, bitSize))
+	case isFixedString(c), isString(c):
+		size := int64(c - strFixedStart)
+		if isString(c) {
+			if size, err = dm.d.decodeStringSize(c); err != nil {
+				return err
+			}
+		}
+		bp, err := dm.d.readScratch(size)
+		if err != nil {
+			return err
+		}
+		defer putScratch(bp)
+		return dm.print(pyRepr(*bp))
+	case c == chrList, isFixedSlice(c):
+		size := -1
+		if c != chrList {
+			size = int(c - listFixedStart)
+		}
+		return dm.dumpContainer("[", "]", size, depth, false)
+	case c == chrDict, isFixedMap(c):
+		size := -1
+		if c != chrDict {
+			size = int(c - dictFixedStart)
+		}
+		return dm.dumpContainer("{", "}", size, depth, true)
+	}
+	return corruptf("unsupported code %v", c)
+}
+
+// dumpContainer dumps the elements of a list, or the pairs of a dict, one per
+// line. A negative size means the container ends with a terminator.
+func (dm *dumper) dumpContainer(open, close string, size, depth int, dict bool) error {
+	if err := dm.d.enter(); err != nil {
+		return err
+	}
+	defer dm.d.leave()
+
+	if err := dm.print(open); err != nil {
+		return err
+	}
+	indent := strings.Repeat(dumpIndent, depth+1)
+	n := 0
+	for ; size < 0 || n < size; n++ {
+		if size < 0 {
+			c, err := dm.d.peekByte()
+			if err != nil {
+				return io.ErrUnexpectedEOF
+			}
+			if c == chrTerm {
+				dm.d.r.ReadByte()
+				break
+			}
+		}
+		if err := dm.print("\n" + indent); err != nil {
+			return err
+		}
+		if dict {
+			if err := dm.dumpValue(depth + 1); err != nil {
+				return err
+			}
+			if err := dm.print(": "); err != nil {
+				return err
+			}
+		}
+		if err := dm.dumpValue(depth + 1); err != nil {
+			return err
+		}
+		if err := dm.print(","); err != nil {
+			return err
+		}
+	}
+	if n > 0 {
+		if err := dm.print("\n" + strings.Repeat(dumpIndent, depth)); err != nil {
+			return err
+		}
+	}
+	return dm.print(close)
+}
+
+// pyFloat formats f the way Python's repr does
+func pyFloat(f float64, bitSize int) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, bitSize)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// pyRepr quotes a string the way Python's repr does, as str when it is valid
+// UTF-8 and as bytes otherwise
+func pyRepr(data []byte) string {
+	isText := utf8.Valid(data)
+	var b strings.Builder
+	if !isText {
+		b.WriteByte('b')
+	}
+	b.WriteByte('\'')
+	for i := 0; i < len(data); {
+		r, size := rune(data[i]), 1
+		if isText {
+			r, size = utf8.DecodeRune(data[i:])
+		}
+		i += size
+		switch {
+		case r == '\\' || r == '\'':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f || (!isText && r >= 0x80):
+			fmt.Fprintf(&b, `\x%02x`, r)
+		case r >= 0x80 && !unicode.IsPrint(r):
+			if r > 0xffff {
+				fmt.Fprintf(&b, `\U%08x`, r)
+			} else {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
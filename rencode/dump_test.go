@@ -0,0 +1,46 @@
+package rencode
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	data := "\xc4\x01\x03\xc3>\x7f\x88fööbarB?\xc0\x00\x00" +
+		"j\x84nameE\x84listf\x84dict\xc0\x84hash\x83\xff\x00'" +
+		"<\x83key;C\x7f\x7f" +
+		"D"
+	expected := `[
+    1,
+    3,
+    [
+        127,
+        'fööbar',
+        1.5,
+    ],
+    {
+        'name': None,
+        'list': {},
+        'dict': [],
+        'hash': b'\xff\x00\'',
+    },
+]
+{
+    'key': [
+        True,
+    ],
+}
+False
+`
+	var buf bytes.Buffer
+	if err := Dump(&buf, []byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if actual := buf.String(); actual != expected {
+		t.Fatalf("\nexpected:\n%s\nactual:\n%s", expected, actual)
+	}
+
+	if err := Dump(&buf, []byte("\xc2\x01")); err == nil {
+		t.Fatal("expected an error for truncated data")
+	}
+}
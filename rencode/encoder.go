@@ -1,6 +1,7 @@
 package rencode
 
 import (
+	"encoding"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -8,15 +9,59 @@ import (
 	"math/big"
 	"reflect"
 	"sort"
+	"strconv"
+	"sync"
+	"time"
 )
 
-// Encoder represents rencode encoder
+// Encoder represents rencode encoder. The encoded bytes are collected in an
+// internal buffer and written to the underlying writer at the end of every
+// Encode call, which writes nothing when it fails. The streaming primitives
+// (BeginDict, EncodeInt, ...) only write once the buffer is full or Flush is
+// called.
 type Encoder struct {
-	w io.Writer
+	w             io.Writer
+	buf           []byte
+	scratch       [24]byte
+	compat        CompatVersion
+	maxIntLen     int
+	prefixStrings bool
+
+	// depth counts the nested Encode calls, the outermost one flushes
+	depth int
+}
+
+// bufferSize is the size above which the buffer is written out
+const bufferSize = 4096
+
+// Flush writes the buffered bytes to the underlying writer
+func (e *Encoder) Flush() error {
+	if e.w == nil || len(e.buf) == 0 {
+		return nil
+	}
+	_, err := e.w.Write(e.buf)
+	e.buf = e.buf[:0]
+	return err
 }
 
-// Encode encodes value
+// Encode encodes value and writes it to the underlying writer
 func (e *Encoder) Encode(v interface{}) error {
+	start := len(e.buf)
+	e.depth++
+	err := e.encode(v)
+	e.depth--
+	if e.depth > 0 {
+		return err
+	}
+	if err != nil {
+		// drops the part of the value encoded, kept in the buffer until now
+		e.buf = e.buf[:start]
+		return err
+	}
+	return e.Flush()
+}
+
+func (e *Encoder) encode(v interface{}) error {
 	switch v.(type) {
 	case nil:
 		return e.encodeNil()
@@ -32,24 +77,103 @@ func (sv stringValues) Swap(i, j int)      { sv[i], sv[j] = sv[j], sv[i] }
 func (sv stringValues) Less(i, j int) bool { return sv.get(i) < sv.get(j) }
 func (sv stringValues) get(i int) string   { return sv[i].String() }
 
+// Marshaler is implemented by types that encode themselves into rencode,
+// typically through the Encode* primitives of the Encoder
+type Marshaler interface {
+	MarshalRencode(e *Encoder) error
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// implementer returns v, or its address when addressable, if it implements
+// the interface typ
+func implementer(v reflect.Value, typ reflect.Type) (interface{}, bool) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, false
+	}
+	if v.Type().Implements(typ) && v.CanInterface() {
+		return v.Interface(), true
+	}
+	if v.Kind() != reflect.Ptr && v.CanAddr() &&
+		reflect.PtrTo(v.Type()).Implements(typ) && v.Addr().CanInterface() {
+		return v.Addr().Interface(), true
+	}
+	return nil, false
+}
+
+func marshaler(v reflect.Value) (Marshaler, bool) {
+	if i, ok := implementer(v, marshalerType); ok {
+		return i.(Marshaler), true
+	}
+	return nil, false
+}
+
+// textMarshaler returns the encoding.TextMarshaler of v, which is then
+// encoded as a string, unless v has a rencode representation of its own
+func textMarshaler(v reflect.Value) (encoding.TextMarshaler, bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		// checked on the element, in case it is a time.Time or a big.Int
+		return nil, false
+	}
+	if t := v.Type(); t == timeType || t == bigIntType {
+		return nil, false
+	}
+	if i, ok := implementer(v, textMarshalerType); ok {
+		return i.(encoding.TextMarshaler), true
+	}
+	return nil, false
+}
+
 func (e *Encoder) encodeValue(v reflect.Value) error {
+	if enc, ok := encoderAdapter(v); ok {
+		return enc(e, v.Interface())
+	}
+	if m, ok := marshaler(v); ok {
+		return m.MarshalRencode(e)
+	}
+	if m, ok := textMarshaler(v); ok {
+		text, err := m.MarshalText()
+		if err != nil {
+			return err
+		}
+		return e.encodeBytes(text)
+	}
+	if m, ok := valuer(v); ok {
+		value, err := m.Value()
+		if err != nil {
+			return err
+		}
+		return e.Encode(value)
+	}
+
 	switch v.Kind() {
 	case reflect.Bool:
-		return e.encodeBool(v)
+		return e.encodeBool(v.Bool())
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return e.encodeInt(v)
+		return e.encodeInt(v.Int())
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return e.encodeUint(v)
+		return e.encodeUint(v.Uint())
 	case reflect.Float32:
-		return e.encodeFloat32(v)
+		return e.encodeFloat32(float32(v.Float()))
 	case reflect.Float64:
-		return e.encodeFloat64(v)
+		return e.encodeFloat64(v.Float())
 	case reflect.Struct:
-		if v.Type() == reflect.TypeOf(big.Int{}) {
+		if v.Type() == bigIntType {
 			return e.encodeBigInt(v)
 		}
+		if v.Type() == timeType {
+			return e.encodeTime(v.Interface().(time.Time), false)
+		}
+		return e.encodeStruct(v)
 	case reflect.String:
-		return e.encodeBytes([]byte(v.String()))
+		if v.Type() == numberType {
+			return e.encodeNumber(Number(v.String()))
+		}
+		return e.encodeString(v.String())
 	case reflect.Slice, reflect.Array:
 		if v.Type().Elem().Kind() == reflect.Uint8 {
 			return e.encodeBytes(v.Bytes())
@@ -57,37 +181,109 @@ func (e *Encoder) encodeValue(v reflect.Value) error {
 		return e.encodeSlice(v)
 	case reflect.Map:
 		return e.encodeMap(v)
-	case reflect.Ptr:
+	case reflect.Ptr, reflect.Interface:
 		if v.IsNil() {
 			return e.encodeNil()
 		}
-		v = v.Elem()
-		return e.encodeValue(v)
+		return e.encodeValue(v.Elem())
 	}
 
-	return nil
+	return &EncodeUnsupportedTypeError{Type: v.Type()}
+}
+
+// EncodeNone writes a None value
+func (e *Encoder) EncodeNone() error {
+	return e.encodeNil()
+}
+
+// EncodeBool writes a boolean value
+func (e *Encoder) EncodeBool(b bool) error {
+	return e.encodeBool(b)
+}
+
+// EncodeInt writes a signed integer using the shortest representation
+func (e *Encoder) EncodeInt(i int64) error {
+	return e.encodeInt(i)
+}
+
+// EncodeUint writes an unsigned integer using the shortest representation
+func (e *Encoder) EncodeUint(i uint64) error {
+	return e.encodeUint(i)
+}
+
+// EncodeFloat32 writes a 32-bit float
+func (e *Encoder) EncodeFloat32(f float32) error {
+	return e.encodeFloat32(f)
+}
+
+// EncodeFloat64 writes a 64-bit float, or a 32-bit one when the
+// compatibility version of the encoder requires it
+func (e *Encoder) EncodeFloat64(f float64) error {
+	return e.encodeFloat64(f)
+}
+
+// EncodeString writes a string
+func (e *Encoder) EncodeString(s string) error {
+	return e.encodeString(s)
+}
+
+// EncodeBytes writes a byte string
+func (e *Encoder) EncodeBytes(b []byte) error {
+	return e.encodeBytes(b)
+}
+
+// BeginDict writes the header of a dict holding n key/value pairs.
+// The pairs must follow, and the dict must be closed with EndDict(n).
+func (e *Encoder) BeginDict(n int) error {
+	if n < int(dictFixedCount) {
+		return e.writeByte(dictFixedStart + byte(n))
+	}
+	return e.writeByte(chrDict)
+}
+
+// EndDict closes a dict opened with BeginDict(n)
+func (e *Encoder) EndDict(n int) error {
+	if n < int(dictFixedCount) {
+		return nil
+	}
+	return e.writeByte(chrTerm)
+}
+
+// BeginList writes the header of a list holding n values.
+// The values must follow, and the list must be closed with EndList(n).
+func (e *Encoder) BeginList(n int) error {
+	if n < int(listFixedCount) {
+		return e.writeByte(listFixedStart + byte(n))
+	}
+	return e.writeByte(chrList)
+}
+
+// EndList closes a list opened with BeginList(n)
+func (e *Encoder) EndList(n int) error {
+	if n < int(listFixedCount) {
+		return nil
+	}
+	return e.writeByte(chrTerm)
 }
 
 func (e *Encoder) encodeNil() error {
-	return e.write([]byte{chrNone})
+	return e.writeByte(chrNone)
 }
 
 func (e *Encoder) encodeMap(v reflect.Value) error {
-	var err error
 	vLen := v.Len()
-	fixedCount := byte(vLen) < dictFixedCount
-
-	if fixedCount {
-		err = e.write([]byte{dictFixedStart + byte(vLen)})
-	} else {
-		err = e.write([]byte{chrDict})
-	}
-	if err != nil {
+	if err := e.BeginDict(vLen); err != nil {
 		return err
 	}
 
 	keys := stringValues(v.MapKeys())
-	sort.Sort(keys)
+	if v.Type().Key().Kind() == reflect.String {
+		sort.Sort(keys)
+	} else {
+		sort.Slice(keys, func(i, j int) bool {
+			return compareKeys(keys[i], keys[j]) < 0
+		})
+	}
 	for i := range keys {
 		val := v.MapIndex(keys[i])
 		if err := e.Encode(keys[i].Interface()); err != nil {
@@ -98,152 +294,250 @@ func (e *Encoder) encodeMap(v reflect.Value) error {
 		}
 	}
 
-	if !fixedCount {
-		err = e.write([]byte{byte(chrTerm)})
+	return e.EndDict(vLen)
+}
+
+func (e *Encoder) encodeStruct(v reflect.Value) error {
+	var fvs []reflect.Value
+	var fields []field
+
+	for _, f := range cachedTypeFields(v.Type()).list {
+		fv := fieldByIndex(v, f.index, false)
+		if !fv.IsValid() || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		fvs = append(fvs, fv)
+		fields = append(fields, f)
+	}
+
+	vLen := len(fvs)
+	if err := e.BeginDict(vLen); err != nil {
+		return err
 	}
-	return err
+
+	for i, fv := range fvs {
+		if err := e.encodeString(fields[i].name); err != nil {
+			return err
+		}
+		if fv.Kind() == reflect.Ptr && fv.Type().Elem() == timeType && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		var err error
+		if fv.Type() == timeType {
+			err = e.encodeTime(fv.Interface().(time.Time), fields[i].floatTime)
+		} else if fv.Kind() == reflect.Interface {
+			err = e.Encode(fv.Interface())
+		} else {
+			err = e.encodeValue(fv)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.EndDict(vLen)
 }
 
 func (e *Encoder) encodeSlice(v reflect.Value) error {
-	var err error
 	vLen := v.Len()
-	fixedCount := byte(vLen) < listFixedCount
-
-	if fixedCount {
-		err = e.write([]byte{listFixedStart + byte(vLen)})
-	} else {
-		err = e.write([]byte{chrList})
-	}
-	if err != nil {
+	if err := e.BeginList(vLen); err != nil {
 		return err
 	}
 
 	for i := 0; i < vLen; i++ {
-		if err := e.Encode(v.Index(i).Interface()); err != nil {
+		if err := e.encodeValue(v.Index(i)); err != nil {
 			return err
 		}
 	}
 
-	if !fixedCount {
-		err = e.write([]byte{byte(chrTerm)})
-	}
-	return err
+	return e.EndList(vLen)
 }
 
-func (e *Encoder) encodeBool(v reflect.Value) error {
-	if v.Bool() {
-		return e.write([]byte{chrTrue})
+func (e *Encoder) encodeBool(b bool) error {
+	if b {
+		return e.writeByte(chrTrue)
 	}
-	return e.write([]byte{chrFalse})
+	return e.writeByte(chrFalse)
 }
 
-func (e *Encoder) encodeInt(v reflect.Value) error {
-	i := v.Int()
+func (e *Encoder) encodeInt(i int64) error {
 	if 0 <= i && i < int64(intPosFixedCount) {
-		return e.write([]byte{intPosFixedStart + byte(i)})
+		return e.writeByte(intPosFixedStart + byte(i))
 	}
 	if -int64(intNegFixedCount) <= i && i < 0 {
-		return e.write([]byte{intNegFixedStart - 1 - byte(i)})
-	}
-	if math.MinInt8 <= i && i <= math.MaxInt8 {
-		return e.write([]byte{chrInt1, byte(i)})
-	}
-	if math.MinInt16 <= i && i <= math.MaxInt16 {
-		if err := e.write([]byte{chrInt2}); err != nil {
-			return err
-		}
-		return binary.Write(e.w, binary.BigEndian, int16(i))
+		return e.writeByte(intNegFixedStart - 1 - byte(i))
 	}
-	if math.MinInt32 <= i && i <= math.MaxInt32 {
-		if err := e.write([]byte{chrInt4}); err != nil {
-			return err
-		}
-		return binary.Write(e.w, binary.BigEndian, int32(i))
+	b := e.scratch[:]
+	switch {
+	case math.MinInt8 <= i && i <= math.MaxInt8:
+		b[0], b[1] = chrInt1, byte(i)
+		return e.write(b[:2])
+	case math.MinInt16 <= i && i <= math.MaxInt16:
+		b[0] = chrInt2
+		binary.BigEndian.PutUint16(b[1:], uint16(i))
+		return e.write(b[:3])
+	case math.MinInt32 <= i && i <= math.MaxInt32:
+		b[0] = chrInt4
+		binary.BigEndian.PutUint32(b[1:], uint32(i))
+		return e.write(b[:5])
 	}
-	if err := e.write([]byte{chrInt8}); err != nil {
-		return err
-	}
-	return binary.Write(e.w, binary.BigEndian, int64(i))
+	b[0] = chrInt8
+	binary.BigEndian.PutUint64(b[1:], uint64(i))
+	return e.write(b[:9])
 }
 
-func (e *Encoder) encodeUint(v reflect.Value) error {
-	i := v.Uint()
-	if i < uint64(intPosFixedCount) {
-		return e.write([]byte{intPosFixedStart + byte(i)})
-	}
-	if i <= math.MaxInt8 {
-		return e.write([]byte{chrInt1, byte(i)})
-	}
-	if i <= math.MaxInt16 {
-		if err := e.write([]byte{chrInt2}); err != nil {
-			return err
-		}
-		return binary.Write(e.w, binary.BigEndian, int16(i))
-	}
-	if i <= math.MaxInt32 {
-		if err := e.write([]byte{chrInt4}); err != nil {
-			return err
-		}
-		return binary.Write(e.w, binary.BigEndian, int32(i))
-	}
+func (e *Encoder) encodeUint(i uint64) error {
 	if i <= math.MaxInt64 {
-		if err := e.write([]byte{chrInt8}); err != nil {
-			return err
-		}
-		return binary.Write(e.w, binary.BigEndian, int64(i))
+		return e.encodeInt(int64(i))
 	}
-	bi := new(big.Int).SetUint64(i)
-	return e.encodeBigInt(reflect.ValueOf(bi).Elem())
+	return e.encodeIntString(strconv.FormatUint(i, 10))
 }
 
 func (e *Encoder) encodeBigInt(v reflect.Value) error {
 	bi := v.Interface().(big.Int)
-	s := bi.String()
-	if len(s) > int(maxIntLength) {
-		return fmt.Errorf("rencode: Number is longer than %d characters", maxIntLength)
+	return e.encodeIntString(bi.String())
+}
+
+// encodeIntString writes the decimal integer s as a chrInt payload
+func (e *Encoder) encodeIntString(s string) error {
+	if len(s) > e.maxIntChars() {
+		return fmt.Errorf("rencode: Number is longer than %d characters", e.maxIntChars())
 	}
-	if err := e.write([]byte{chrInt}); err != nil {
+	if err := e.writeByte(chrInt); err != nil {
 		return err
 	}
-	if err := e.write([]byte(s)); err != nil {
+	if err := e.writeString(s); err != nil {
 		return err
 	}
-	return e.write([]byte{chrTerm})
+	return e.writeByte(chrTerm)
+}
+
+func (e *Encoder) encodeFloat32(f float32) error {
+	b := e.scratch[:5]
+	b[0] = chrFloat32
+	binary.BigEndian.PutUint32(b[1:], math.Float32bits(f))
+	return e.write(b)
+}
+
+func (e *Encoder) encodeFloat64(f float64) error {
+	if e.float32Only() {
+		return e.encodeFloat32(float32(f))
+	}
+	b := e.scratch[:9]
+	b[0] = chrFloat64
+	binary.BigEndian.PutUint64(b[1:], math.Float64bits(f))
+	return e.write(b)
 }
 
-func (e *Encoder) encodeFloat32(v reflect.Value) error {
-	if err := e.write([]byte{chrFloat32}); err != nil {
+// encodeStringHeader writes the prefix of a string of n bytes
+func (e *Encoder) encodeStringHeader(n int) error {
+	if n < int(strFixedCount) && !e.prefixStrings {
+		return e.writeByte(strFixedStart + byte(n))
+	}
+	b := strconv.AppendInt(e.scratch[:0], int64(n), 10)
+	return e.write(append(b, ':'))
+}
+
+func (e *Encoder) encodeBytes(v []byte) error {
+	if err := e.encodeStringHeader(len(v)); err != nil {
 		return err
 	}
-	return binary.Write(e.w, binary.BigEndian, float32(v.Float()))
+	return e.write(v)
 }
 
-func (e *Encoder) encodeFloat64(v reflect.Value) error {
-	if err := e.write([]byte{chrFloat64}); err != nil {
+func (e *Encoder) encodeString(s string) error {
+	if err := e.encodeStringHeader(len(s)); err != nil {
 		return err
 	}
-	return binary.Write(e.w, binary.BigEndian, v.Float())
+	return e.writeString(s)
 }
 
-func (e *Encoder) encodeBytes(v []byte) error {
-	lv := len(v)
-	if byte(lv) < strFixedCount {
-		if err := e.write([]byte{strFixedStart + byte(lv)}); err != nil {
+// full reports whether the buffer should be written out. Encode keeps the
+// whole value in it.
+func (e *Encoder) full(n int) bool {
+	return e.w != nil && e.depth == 0 && n >= bufferSize
+}
+
+func (e *Encoder) write(b []byte) error {
+	if e.full(len(b)) {
+		// large strings bypass the buffer
+		if err := e.Flush(); err != nil {
 			return err
 		}
-		return e.write(v)
+		_, err := e.w.Write(b)
+		return err
+	}
+	e.buf = append(e.buf, b...)
+	if e.full(len(e.buf)) {
+		return e.Flush()
 	}
+	return nil
+}
 
-	prefix := []byte(fmt.Sprintf("%d:", lv))
+func (e *Encoder) writeByte(c byte) error {
+	e.scratch[0] = c
+	return e.write(e.scratch[:1])
+}
 
-	if err := e.write(prefix); err != nil {
-		return err
+func (e *Encoder) writeString(s string) error {
+	e.buf = append(e.buf, s...)
+	if e.full(len(e.buf)) {
+		return e.Flush()
 	}
+	return nil
+}
 
-	return e.write(v)
+// EncodedLen returns the number of bytes the encoding of v takes, without
+// writing them anywhere
+func EncodedLen(v interface{}) (int, error) {
+	var cw countingWriter
+	e := NewEncoder(&cw)
+	if err := e.Encode(v); err != nil {
+		return 0, err
+	}
+	return cw.n, nil
 }
 
-func (e *Encoder) write(b []byte) error {
-	_, err := e.w.Write(b)
-	return err
+// Append appends the encoding of v to dst and returns the extended buffer.
+// It does not allocate when dst has enough capacity and v is made of lists,
+// scalars and strings.
+func Append(dst []byte, v interface{}) ([]byte, error) {
+	e := appendEncoderPool.Get().(*Encoder)
+	e.buf = dst
+	err := e.Encode(v)
+	out := e.buf
+	e.buf = nil
+	appendEncoderPool.Put(e)
+	if err != nil {
+		return dst, err
+	}
+	return out, nil
+}
+
+// appendEncoderPool holds encoders without writer, which only fill their
+// buffer
+var appendEncoderPool = sync.Pool{
+	New: func() interface{} {
+		return &Encoder{}
+	},
+}
+
+// countingWriter discards the bytes written to it, only counting them
+type countingWriter struct {
+	n int
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.n += len(p)
+	return len(p), nil
+}
+
+// EncodeUnsupportedTypeError is returned when encoding a value whose type has
+// no rencode representation, such as a channel, a function or a complex number
+type EncodeUnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *EncodeUnsupportedTypeError) Error() string {
+	return "rencode: unsupported type: " + e.Type.String()
 }
@@ -3,11 +3,14 @@ package rencode
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"math"
 	"math/big"
+	"net"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 type encodeTestCase struct {
@@ -34,6 +37,8 @@ var encodeTestCases = []encodeTestCase{
 	{uint64(18446744073709551615), "=18446744073709551615\x7f"},
 	{bigIntFromString("9223372036854775808"), "=9223372036854775808\x7f"},
 	{*bigIntFromString("9223372036854775808"), "=9223372036854775808\x7f"},
+	{Number("-1000"), "?\xfc\x18"},
+	{Number("18446744073709551616"), "=18446744073709551616\x7f"},
 	{float32(math.MaxFloat32), "B\x7f\x7f\xff\xff"},
 	{float64(math.MaxFloat64), ",\x7f\xef\xff\xff\xff\xff\xff\xff"},
 	{"fööbar", "\x88fööbar"},
@@ -49,6 +54,38 @@ var encodeTestCases = []encodeTestCase{
 		"g\x88fööbarE"},
 	{mapWithLength(25),
 		"<\x83ö0\x00\x83ö1\x01\x84ö10\n\x84ö11\v\x84ö12\f\x84ö13\r\x84ö14\x0e\x84ö15\x0f\x84ö16\x10\x84ö17\x11\x84ö18\x12\x84ö19\x13\x83ö2\x02\x84ö20\x14\x84ö21\x15\x84ö22\x16\x84ö23\x17\x84ö24\x18\x83ö3\x03\x83ö4\x04\x83ö5\x05\x83ö6\x06\x83ö7\a\x83ö8\b\x83ö9\t\u007f"},
+	{torrentOptions{
+		BaseTorrentOptions: BaseTorrentOptions{MaxConnections: 5, Paused: true},
+		Path:               "/tmp",
+	}, "i\x8fmax_connections\x05\x84path\x84/tmp\x86pausedC"},
+	{&addTorrentRequest{
+		BaseTorrentOptions: &BaseTorrentOptions{MaxConnections: 5},
+		Filename:           "a.torrent",
+		Paused:             "shadowed",
+	}, "i\x88filename\x89a.torrent\x8fmax_connections\x05\x86paused\x88shadowed"},
+	{struct {
+		Name    string `rencode:"name"`
+		Ignored string `rencode:"-"`
+		Empty   string `rencode:",omitempty"`
+		private int
+	}{Name: "x", Ignored: "y"}, "g\x84name\x81x"},
+}
+
+// BaseTorrentOptions is embedded into several request types
+type BaseTorrentOptions struct {
+	MaxConnections int  `rencode:"max_connections"`
+	Paused         bool `rencode:"paused"`
+}
+
+type torrentOptions struct {
+	BaseTorrentOptions
+	Path string `rencode:"path"`
+}
+
+type addTorrentRequest struct {
+	*BaseTorrentOptions
+	Filename string `rencode:"filename"`
+	Paused   string `rencode:"paused"`
 }
 
 func bigIntFromString(s string) *big.Int {
@@ -90,3 +127,269 @@ func TestEncode(t *testing.T) {
 		}
 	}
 }
+
+// peerCount encodes itself as a [seeds, peers] list
+type peerCount struct {
+	seeds, peers int
+}
+
+func (p peerCount) MarshalRencode(e *Encoder) error {
+	if err := e.BeginList(2); err != nil {
+		return err
+	}
+	if err := e.EncodeInt(int64(p.seeds)); err != nil {
+		return err
+	}
+	if err := e.EncodeInt(int64(p.peers)); err != nil {
+		return err
+	}
+	return e.EndList(2)
+}
+
+func (p *peerCount) UnmarshalRencode(d *Decoder) error {
+	var v []int
+	if err := d.Decode(&v); err != nil {
+		return err
+	}
+	p.seeds, p.peers = v[0], v[1]
+	return nil
+}
+
+func TestEncodeMarshaler(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	v := map[string]interface{}{"count": peerCount{3, 1000}, "ptr": &peerCount{1, 2}}
+	if err := e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	expected := "h\x85count\xc2\x03?\x03\xe8\x83ptr\xc2\x01\x02"
+	if actual := buf.String(); actual != expected {
+		t.Fatalf("\nexpected: %+q\nactual  : %+q", expected, actual)
+	}
+}
+
+func TestEncodeTime(t *testing.T) {
+	added := time.Unix(1568000000, 500000000)
+	v := struct {
+		Added    time.Time  `rencode:"time_added,float"`
+		Seen     *time.Time `rencode:"last_seen_complete"`
+		Finished time.Time  `rencode:"completed_time,omitempty"`
+	}{Added: added, Seen: &added}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	expected := "h\x92last_seen_complete@]u\xc8\x00\x8atime_added,A\xd7]r\x00 \x00\x00"
+	if actual := buf.String(); actual != expected {
+		t.Fatalf("\nexpected: %+q\nactual  : %+q", expected, actual)
+	}
+}
+
+func TestEncodedLen(t *testing.T) {
+	for _, test := range encodeTestCases {
+		n, err := EncodedLen(test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(test.expected) {
+			t.Fatalf("For %v: expected %d bytes, got %d", test.value, len(test.expected), n)
+		}
+	}
+	if _, err := EncodedLen(bigIntFromString(strings.Repeat("9", 65))); err == nil {
+		t.Fatal("expected an error for a too long number")
+	}
+}
+
+func TestAppend(t *testing.T) {
+	for _, test := range encodeTestCases {
+		prefix := []byte("prefix")
+		actual, err := Append(prefix, test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "prefix" + test.expected; string(actual) != expected {
+			t.Fatalf("\nFor     : %v\nexpected: %+q\nactual  : %+q", test.value, expected, actual)
+		}
+	}
+
+	dst := []byte("prefix")
+	if out, err := Append(dst, bigIntFromString(strings.Repeat("9", 65))); err == nil || string(out) != "prefix" {
+		t.Fatalf("expected an error and an unchanged buffer, got %q %v", out, err)
+	}
+}
+
+func TestAppendAllocs(t *testing.T) {
+	var v interface{} = []interface{}{int64(1), "fööbar", 2.5, true, nil, []interface{}{int64(70000), "x"}}
+	buf := make([]byte, 0, 256)
+	allocs := testing.AllocsPerRun(100, func() {
+		var err error
+		if buf, err = Append(buf[:0], v); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations, got %v", allocs)
+	}
+}
+
+// countingWrites counts the Write calls made to it
+type countingWrites struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWrites) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestEncodeErrorWritesNothing(t *testing.T) {
+	var w bytes.Buffer
+	e := NewEncoder(&w)
+	if err := e.Encode([]interface{}{1, 2, make(chan int)}); err == nil {
+		t.Fatal("expected an error encoding a channel")
+	}
+	// the string is larger than the buffer
+	if err := e.Encode([]interface{}{strings.Repeat("o", 2*bufferSize), make(chan int)}); err == nil {
+		t.Fatal("expected an error encoding a channel")
+	}
+	if w.Len() != 0 {
+		t.Fatalf("failed Encode calls wrote %+q", w.String())
+	}
+	if err := e.Encode(5); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "\x05"; w.String() != expected {
+		t.Fatalf("\nexpected: %+q\nactual  : %+q", expected, w.String())
+	}
+}
+
+func TestEncoderFlush(t *testing.T) {
+	var w countingWrites
+	e := NewEncoder(&w)
+	if err := e.Encode(sliceWithLength(65)); err != nil {
+		t.Fatal(err)
+	}
+	if w.writes != 1 {
+		t.Fatalf("expected a single write, got %d", w.writes)
+	}
+	if err := e.Encode(mapWithLength(25)); err != nil {
+		t.Fatal(err)
+	}
+	if w.writes != 2 {
+		t.Fatalf("expected a write per value, got %d", w.writes)
+	}
+
+	w = countingWrites{}
+	e = NewEncoder(&w)
+	if err := e.BeginList(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.EncodeInt(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.EncodeString("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.EndList(2); err != nil {
+		t.Fatal(err)
+	}
+	if w.writes != 0 {
+		t.Fatalf("expected no writes before Flush, got %d", w.writes)
+	}
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "\xc2\x01\x81a"; w.String() != expected {
+		t.Fatalf("\nexpected: %+q\nactual  : %+q", expected, w.String())
+	}
+
+	w = countingWrites{}
+	e = NewEncoder(&w)
+	if err := e.Encode(strings.Repeat("o", 3*bufferSize)); err != nil {
+		t.Fatal(err)
+	}
+	if w.Len() != 3*bufferSize+6 {
+		t.Fatalf("unexpected length %d", w.Len())
+	}
+}
+
+func TestEncodeUnsupportedType(t *testing.T) {
+	values := []interface{}{
+		make(chan int),
+		func() {},
+		complex(1, 2),
+		[]interface{}{1, make(chan int)},
+		map[string]interface{}{"a": func() {}},
+		struct{ C complex64 }{},
+	}
+	for _, v := range values {
+		var b bytes.Buffer
+		err := NewEncoder(&b).Encode(v)
+		if _, ok := err.(*EncodeUnsupportedTypeError); !ok {
+			t.Errorf("%T: expected an EncodeUnsupportedTypeError, got %v", v, err)
+		}
+	}
+}
+
+func BenchmarkEncodeStruct(b *testing.B) {
+	v := torrentOptions{
+		BaseTorrentOptions: BaseTorrentOptions{MaxConnections: 50, Paused: true},
+		Path:               "/downloads",
+	}
+	e := NewEncoder(io.Discard)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := e.Encode(&v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type torrentState int
+
+func (s torrentState) MarshalText() ([]byte, error) {
+	return []byte([]string{"Paused", "Seeding"}[s]), nil
+}
+
+func (s *torrentState) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "Paused":
+		*s = 0
+	case "Seeding":
+		*s = 1
+	default:
+		return fmt.Errorf("unknown state %q", text)
+	}
+	return nil
+}
+
+func TestEncodeTextMarshaler(t *testing.T) {
+	type peer struct {
+		IP    net.IP       `rencode:"ip"`
+		State torrentState `rencode:"state"`
+	}
+	v := peer{IP: net.IPv4(10, 0, 0, 1), State: 1}
+	data, err := Append(nil, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "\x68\x82ip\x8810.0.0.1\x85state\x87Seeding"
+	if string(data) != expected {
+		t.Fatalf("expected %q, got %q", expected, data)
+	}
+
+	var decoded peer
+	if err := NewDecoder(bytes.NewReader(data)).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.IP.Equal(v.IP) || decoded.State != v.State {
+		t.Fatalf("expected %+v, got %+v", v, decoded)
+	}
+
+	// non-string values are still decoded natively
+	if err := NewDecoder(bytes.NewBufferString("\x00")).Decode(&decoded.State); err != nil || decoded.State != 0 {
+		t.Fatalf("unexpected state %v, %v", decoded.State, err)
+	}
+}
@@ -0,0 +1,294 @@
+package rencode
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// field represents a single struct field mapped to a rencode dict key
+type field struct {
+	name      string
+	index     []int
+	typ       reflect.Type
+	tagged    bool
+	omitEmpty bool
+	floatTime bool
+}
+
+type byIndex []field
+
+func (x byIndex) Len() int      { return len(x) }
+func (x byIndex) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
+func (x byIndex) Less(i, j int) bool {
+	for k, xik := range x[i].index {
+		if k >= len(x[j].index) {
+			return false
+		}
+		if xik != x[j].index[k] {
+			return xik < x[j].index[k]
+		}
+	}
+	return len(x[i].index) < len(x[j].index)
+}
+
+// parseTag splits a struct field's rencode tag into its name and options
+func parseTag(tag string) (string, []string) {
+	parts := strings.Split(tag, ",")
+	return parts[0], parts[1:]
+}
+
+func hasOption(opts []string, name string) bool {
+	for _, o := range opts {
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
+
+// structFields holds the fields of a struct type, as a list sorted by name
+// and indexed by name, by lower case name, and by the snake_case form of the
+// untagged names
+type structFields struct {
+	list    []field
+	byName  map[string]*field
+	byFold  map[string]*field
+	bySnake map[string]*field
+}
+
+// fieldCache maps struct types to their *structFields
+var fieldCache sync.Map
+
+// cachedTypeFields is like typeFields, but computes the fields of each type
+// only once
+func cachedTypeFields(t reflect.Type) *structFields {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.(*structFields)
+	}
+	fields := &structFields{list: typeFields(t)}
+	fields.byName = make(map[string]*field, len(fields.list))
+	fields.byFold = make(map[string]*field, len(fields.list))
+	fields.bySnake = make(map[string]*field, len(fields.list))
+	for i := range fields.list {
+		f := &fields.list[i]
+		fields.byName[f.name] = f
+		// the first field of the sorted list wins on conflicts
+		if fold := strings.ToLower(f.name); fields.byFold[fold] == nil {
+			fields.byFold[fold] = f
+		}
+		snake := f.name
+		if !f.tagged {
+			snake = snakeCase(f.name)
+		}
+		if fields.bySnake[snake] == nil {
+			fields.bySnake[snake] = f
+		}
+	}
+	f, _ := fieldCache.LoadOrStore(t, fields)
+	return f.(*structFields)
+}
+
+// lookup returns the field for the dict key, matched exactly, then with its
+// snake_case name when snake is true, then regardless of case when fold is
+// true
+func (sf *structFields) lookup(key string, snake, fold bool) *field {
+	if f := sf.byName[key]; f != nil || (!snake && !fold) {
+		return f
+	}
+	if fold {
+		key = strings.ToLower(key)
+	}
+	if snake {
+		if f := sf.bySnake[key]; f != nil {
+			return f
+		}
+	}
+	if fold {
+		return sf.byFold[key]
+	}
+	return nil
+}
+
+// snakeCase converts a Go field name to snake_case, keeping acronyms
+// together: TrackerURL becomes tracker_url and HTTPProxy http_proxy
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// typeFields returns the fields that should be encoded for the given struct
+// type. Fields of anonymous embedded structs are promoted into the parent
+// following the same visibility rules as encoding/json.
+func typeFields(t reflect.Type) []field {
+	current := []field{}
+	next := []field{{typ: t}}
+
+	count := map[reflect.Type]int{}
+	nextCount := map[reflect.Type]int{}
+	visited := map[reflect.Type]bool{}
+
+	var fields []field
+
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		count, nextCount = nextCount, map[reflect.Type]int{}
+
+		for _, f := range current {
+			if visited[f.typ] {
+				continue
+			}
+			visited[f.typ] = true
+
+			for i := 0; i < f.typ.NumField(); i++ {
+				sf := f.typ.Field(i)
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if sf.Anonymous {
+					if !sf.IsExported() && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !sf.IsExported() {
+					continue
+				}
+
+				tag := sf.Tag.Get("rencode")
+				if tag == "-" {
+					continue
+				}
+				name, opts := parseTag(tag)
+
+				index := make([]int, len(f.index)+1)
+				copy(index, f.index)
+				index[len(f.index)] = i
+
+				if name != "" || !sf.Anonymous || ft.Kind() != reflect.Struct {
+					tagged := name != ""
+					if name == "" {
+						name = sf.Name
+					}
+					fields = append(fields, field{
+						name:      name,
+						index:     index,
+						typ:       sf.Type,
+						tagged:    tagged,
+						omitEmpty: hasOption(opts, "omitempty"),
+						floatTime: hasOption(opts, "float"),
+					})
+					if count[f.typ] > 1 {
+						// the same type was embedded twice at this depth,
+						// annihilate the duplicate
+						fields = append(fields, fields[len(fields)-1])
+					}
+					continue
+				}
+
+				nextCount[ft]++
+				if nextCount[ft] == 1 {
+					next = append(next, field{name: ft.Name(), index: index, typ: ft})
+				}
+			}
+		}
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		x := fields
+		if x[i].name != x[j].name {
+			return x[i].name < x[j].name
+		}
+		if len(x[i].index) != len(x[j].index) {
+			return len(x[i].index) < len(x[j].index)
+		}
+		if x[i].tagged != x[j].tagged {
+			return x[i].tagged
+		}
+		return byIndex(x).Less(i, j)
+	})
+
+	// drop the fields hidden by a shallower or tagged field of the same name
+	out := fields[:0]
+	for advance, i := 0, 0; i < len(fields); i += advance {
+		fi := fields[i]
+		for advance = 1; i+advance < len(fields); advance++ {
+			if fields[i+advance].name != fi.name {
+				break
+			}
+		}
+		if advance == 1 {
+			out = append(out, fi)
+			continue
+		}
+		if dominant, ok := dominantField(fields[i : i+advance]); ok {
+			out = append(out, dominant)
+		}
+	}
+
+	// out is sorted by name, so keys are emitted in the same order as maps
+	return out
+}
+
+func dominantField(fields []field) (field, bool) {
+	if len(fields) > 1 &&
+		len(fields[0].index) == len(fields[1].index) &&
+		fields[0].tagged == fields[1].tagged {
+		return field{}, false
+	}
+	return fields[0], true
+}
+
+// fieldByIndex returns the struct field at the given index path, allocating
+// nil embedded struct pointers along the way when alloc is true. It returns
+// an invalid value when a nil pointer is met and alloc is false.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface().(time.Time).IsZero()
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+//go:build go1.18
+
+package rencode
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func fuzzSeeds(f *testing.F) {
+	seeds := []interface{}{
+		nil, true, 0, -1, 100, -100, 1 << 20, int64(1) << 40, bigIntFromString("123456789012345678901234567890"),
+		1.5, float32(2.5), "abc", bytes.Repeat([]byte("x"), 100),
+		[]interface{}{1, "a", nil}, sliceWithLength(70), mapWithLength(30),
+		map[string]interface{}{"a": []interface{}{map[string]interface{}{"b": 1}}},
+	}
+	for _, v := range seeds {
+		data, err := Append(nil, v)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+}
+
+// checkFuzzError fails on errors that are neither a corruption, a truncation
+// nor a type mismatch
+func checkFuzzError(t *testing.T, err error) {
+	var typeErr *DecodeTypeError
+	var utf8Err *InvalidUTF8Error
+	if err == nil || errors.Is(err, ErrCorrupted) || err == io.ErrUnexpectedEOF || err == io.EOF ||
+		errors.As(err, &typeErr) || errors.As(err, &utf8Err) {
+		return
+	}
+	t.Fatalf("unexpected error %T: %v", err, err)
+}
+
+func FuzzDecode(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v interface{}
+		err := NewDecoder(bytes.NewReader(data)).Decode(&v)
+		checkFuzzError(t, err)
+		var typeErr *DecodeTypeError
+		if errors.As(err, &typeErr) {
+			// valid data that does not fit an interface{}, such as dicts
+			// with integer keys
+			return
+		}
+		if valid := Validate(bytes.NewReader(data)) == nil; valid != (err == nil) {
+			t.Fatalf("Validate returned %v, Decode returned %v", valid, err)
+		}
+		if err != nil {
+			return
+		}
+
+		// decoded values encode to canonical data decoding to the same value
+		encoded, err := Append(nil, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v2 interface{}
+		if err := NewDecoder(bytes.NewReader(encoded)).Decode(&v2); err != nil {
+			t.Fatalf("decoding %q: %v", encoded, err)
+		}
+		encoded2, err := Append(nil, v2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, encoded2) {
+			t.Fatalf("encoding is not stable: %q, %q", encoded, encoded2)
+		}
+	})
+}
+
+func FuzzTranscode(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkFuzzError(t, Dump(io.Discard, data))
+		err := ToJSON(bytes.NewReader(data), io.Discard)
+		if err != nil && !errors.Is(err, ErrCorrupted) && err != io.ErrUnexpectedEOF && err != io.EOF {
+			// values that JSON cannot represent
+			return
+		}
+		_, err = Canonical(data)
+		checkFuzzError(t, err)
+		// bencode cannot represent every value either
+		ToBencode(bytes.NewReader(data), io.Discard)
+	})
+}
@@ -0,0 +1,17 @@
+//go:build go1.18
+
+package rencode
+
+import "bytes"
+
+// UnmarshalAs decodes the first value of data into a new value of type T
+func UnmarshalAs[T any](data []byte) (T, error) {
+	return DecodeAs[T](NewDecoder(bytes.NewReader(data)))
+}
+
+// DecodeAs decodes the next value of the stream into a new value of type T
+func DecodeAs[T any](d *Decoder) (T, error) {
+	var v T
+	err := d.Decode(&v)
+	return v, err
+}
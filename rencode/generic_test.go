@@ -0,0 +1,50 @@
+//go:build go1.18
+
+package rencode
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshalAs(t *testing.T) {
+	s, err := UnmarshalAs[string]([]byte("\x88fööbar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "fööbar" {
+		t.Fatalf("unexpected value %q", s)
+	}
+
+	opts, err := UnmarshalAs[torrentOptions]([]byte("h\x8fmax_connections\x05\x84path\x84/tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := torrentOptions{BaseTorrentOptions: BaseTorrentOptions{MaxConnections: 5}, Path: "/tmp"}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Fatalf("\nexpected: %+v\nactual  : %+v", expected, opts)
+	}
+
+	if _, err := UnmarshalAs[int]([]byte("\x83foo")); err == nil {
+		t.Fatal("expected a type error")
+	}
+}
+
+func TestDecodeAs(t *testing.T) {
+	d := NewDecoder(bytes.NewBufferString("\xc2\x01\x02\x83foo"))
+	list, err := DecodeAs[[]int64](d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(list, []int64{1, 2}) {
+		t.Fatalf("unexpected value %v", list)
+	}
+	s, err := DecodeAs[string](d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "foo" {
+		t.Fatalf("unexpected value %q", s)
+	}
+}
@@ -0,0 +1,105 @@
+package rencode
+
+import (
+	"errors"
+	"io"
+	"reflect"
+)
+
+// DictIterator iterates over the keys of a dict without decoding it as a
+// whole. After each key, the value can be decoded with Decode or skipped;
+// values left unconsumed are skipped by the next call to NextKey.
+type DictIterator struct {
+	d       *Decoder
+	size    int
+	n       int
+	pending bool
+	done    bool
+}
+
+// DictIterator starts iterating over the next value, which must be a dict
+// with string keys. None is treated as an empty dict.
+func (d *Decoder) DictIterator() (*DictIterator, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	it := &DictIterator{d: d, size: -1}
+	switch {
+	case c == chrNone:
+		it.done = true
+	case c == chrDict:
+	case isFixedMap(c):
+		it.size = int(c - dictFixedStart)
+	default:
+		return nil, &DecodeTypeError{Value: codeName(c), Type: reflect.TypeOf(map[string]interface{}{})}
+	}
+	return it, nil
+}
+
+// NextKey returns the next key of the dict, or io.EOF once all the keys
+// have been read
+func (it *DictIterator) NextKey() (string, error) {
+	if it.pending {
+		if err := it.Skip(); err != nil {
+			return "", err
+		}
+	}
+	if it.done || (it.size >= 0 && it.n >= it.size) {
+		it.done = true
+		return "", io.EOF
+	}
+	if it.size < 0 {
+		c, err := it.d.peekByte()
+		if err != nil {
+			return "", eofUnexpected(err)
+		}
+		if c == chrTerm {
+			it.done = true
+			if _, err := it.d.r.ReadByte(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
+		}
+	}
+	key, err := it.d.decodeKey()
+	if err != nil {
+		return "", eofUnexpected(err)
+	}
+	it.n++
+	it.pending = true
+	return key, nil
+}
+
+var errNoPendingValue = errors.New("rencode: no dict value to consume, call NextKey first")
+
+// Decode decodes the value of the current key into v
+func (it *DictIterator) Decode(v interface{}) error {
+	if !it.pending {
+		return errNoPendingValue
+	}
+	it.pending = false
+	return it.d.Decode(v)
+}
+
+// Skip skips the value of the current key
+func (it *DictIterator) Skip() error {
+	if !it.pending {
+		return errNoPendingValue
+	}
+	it.pending = false
+	return it.d.skipValue()
+}
+
+// Close skips the remaining keys and values, leaving the decoder positioned
+// after the dict. It allows stopping the iteration early.
+func (it *DictIterator) Close() error {
+	for {
+		if _, err := it.NextKey(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
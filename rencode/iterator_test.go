@@ -0,0 +1,80 @@
+package rencode
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestDictIterator(t *testing.T) {
+	data := "<\x84name\x83foo\x85peers\xc2\x01\x02\x88progress,?\xf8\x00\x00\x00\x00\x00\x00\x85state\x87Seeding\x7f\x01"
+	d := NewDecoder(bytes.NewBufferString(data))
+	it, err := d.DictIterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var name string
+	var progress float64
+	var keys []string
+	for k, err := it.NextKey(); err != io.EOF; k, err = it.NextKey() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, k)
+		switch k {
+		case "name":
+			err = it.Decode(&name)
+		case "progress":
+			err = it.Decode(&progress)
+		case "peers":
+			err = it.Skip()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != "" && progress != 0 {
+			break
+		}
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if name != "foo" || progress != 1.5 || len(keys) != 3 {
+		t.Fatalf("unexpected result %q %v %v", name, progress, keys)
+	}
+	if err := it.Decode(&name); err != errNoPendingValue {
+		t.Fatalf("expected errNoPendingValue, got %v", err)
+	}
+
+	var next int
+	if err := d.Decode(&next); err != nil || next != 1 {
+		t.Fatalf("decoder not positioned after the dict: %v %v", next, err)
+	}
+}
+
+func TestDictIteratorFixed(t *testing.T) {
+	d := NewDecoder(bytes.NewBufferString("h\x81a\x01\x81b\x02"))
+	it, err := d.DictIterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, err := it.NextKey(); err != io.EOF; _, err = it.NextKey() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 keys, got %d", n)
+	}
+
+	it, err = NewDecoder(bytes.NewBufferString("<\x81a\x01")).DictIterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := it.Close(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package rencode
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ToJSON reads one rencode value from r and writes it to w as JSON, without
+// materializing the decoded value. Byte strings that are not valid UTF-8 have
+// their invalid bytes replaced by U+FFFD, and dict keys that are not strings
+// are written in their JSON form as strings.
+func ToJSON(r io.Reader, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	t := &jsonTranscoder{d: NewDecoder(r), w: bw}
+	if err := t.value(false); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+type jsonTranscoder struct {
+	d *Decoder
+	w *bufio.Writer
+}
+
+// value transcodes the next value. When key is true the value is a dict key
+// and is written as a JSON string.
+func (t *jsonTranscoder) value(key bool) error {
+	c, err := t.d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	var s string
+	switch {
+	case c == chrNone:
+		s = "null"
+	case c == chrTrue:
+		s = "true"
+	case c == chrFalse:
+		s = "false"
+	case isInt(c):
+		if s, err = t.d.readInt(c); err != nil {
+			return err
+		}
+	case c == chrFloat32, c == chrFloat64:
+		f, err := t.d.readFloat(c)
+		if err != nil {
+			return err
+		}
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return fmt.Errorf("rencode: %v cannot be represented in JSON", f)
+		}
+		bitSize := 64
+		if c == chrFloat32 {
+			bitSize = 32
+		}
+		s = strconv.FormatFloat(f, 'g', -1, bitSize)
+	case isFixedString(c), isString(c):
+		size := int64(c - strFixedStart)
+		if isString(c) {
+			if size, err = t.d.decodeStringSize(c); err != nil {
+				return err
+			}
+		}
+		bp, err := t.d.readScratch(size)
+		if err != nil {
+			return err
+		}
+		writeJSONString(t.w, *bp)
+		putScratch(bp)
+		return nil
+	case c == chrList, isFixedSlice(c), c == chrDict, isFixedMap(c):
+		if key {
+			return fmt.Errorf("rencode: %s dict keys cannot be represented in JSON", codeName(c))
+		}
+		return t.container(c)
+	default:
+		return corruptf("unsupported code %v", c)
+	}
+	if key {
+		writeJSONString(t.w, []byte(s))
+	} else {
+		t.w.WriteString(s)
+	}
+	return nil
+}
+
+func (t *jsonTranscoder) container(c byte) error {
+	if err := t.d.enter(); err != nil {
+		return err
+	}
+	defer t.d.leave()
+
+	dict := c == chrDict || isFixedMap(c)
+	size := -1
+	switch {
+	case isFixedSlice(c):
+		size = int(c - listFixedStart)
+	case isFixedMap(c):
+		size = int(c - dictFixedStart)
+	}
+
+	open, close := byte('['), byte(']')
+	if dict {
+		open, close = '{', '}'
+	}
+	t.w.WriteByte(open)
+	for i := 0; size < 0 || i < size; i++ {
+		if size < 0 {
+			c, err := t.d.peekByte()
+			if err != nil {
+				return io.ErrUnexpectedEOF
+			}
+			if c == chrTerm {
+				t.d.r.ReadByte()
+				break
+			}
+		}
+		if i > 0 {
+			t.w.WriteByte(',')
+		}
+		if dict {
+			if err := t.value(true); err != nil {
+				return eofUnexpected(err)
+			}
+			t.w.WriteByte(':')
+		}
+		if err := t.value(false); err != nil {
+			return eofUnexpected(err)
+		}
+	}
+	return t.w.WriteByte(close)
+}
+
+func eofUnexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+const hex = "0123456789abcdef"
+
+// writeJSONString writes data as a JSON string, replacing invalid UTF-8
+func writeJSONString(w *bufio.Writer, data []byte) {
+	w.WriteByte('"')
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		i += size
+		switch {
+		case r == '"' || r == '\\':
+			w.WriteByte('\\')
+			w.WriteByte(byte(r))
+		case r == '\n':
+			w.WriteString(`\n`)
+		case r == '\r':
+			w.WriteString(`\r`)
+		case r == '\t':
+			w.WriteString(`\t`)
+		case r < 0x20:
+			w.WriteString(`\u00`)
+			w.WriteByte(hex[r>>4])
+			w.WriteByte(hex[r&0xf])
+		default:
+			w.WriteRune(r)
+		}
+	}
+	w.WriteByte('"')
+}
+
+// FromJSON reads one JSON value from r and writes it to w as rencode, without
+// materializing the decoded value. Since the number of elements is not known
+// in advance, arrays and objects are written as terminated lists and dicts.
+// Numbers without a fraction or exponent are written as integers, all other
+// numbers as 64-bit floats.
+func FromJSON(r io.Reader, w io.Writer) error {
+	jd := json.NewDecoder(r)
+	jd.UseNumber()
+	e := NewEncoder(w)
+
+	depth := 0
+	for {
+		tok, err := jd.Token()
+		if err != nil {
+			if err == io.EOF && depth > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		switch tok := tok.(type) {
+		case json.Delim:
+			switch tok {
+			case '[':
+				depth++
+				err = e.writeByte(chrList)
+			case '{':
+				depth++
+				err = e.writeByte(chrDict)
+			default:
+				depth--
+				err = e.writeByte(chrTerm)
+			}
+		case json.Number:
+			err = encodeJSONNumber(e, tok)
+		case string:
+			err = e.EncodeString(tok)
+		case bool:
+			err = e.EncodeBool(tok)
+		case nil:
+			err = e.EncodeNone()
+		}
+		if err != nil {
+			return err
+		}
+		if depth == 0 {
+			return e.Flush()
+		}
+	}
+}
+
+func encodeJSONNumber(e *Encoder, n json.Number) error {
+	s := n.String()
+	if !strings.ContainsAny(s, ".eE") {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return e.EncodeInt(i)
+		}
+		return e.encodeIntString(s)
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return err
+	}
+	return e.EncodeFloat64(f)
+}
@@ -0,0 +1,73 @@
+package rencode
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+var jsonTestCases = []struct {
+	rencode string
+	json    string
+}{
+	{"E", "null"},
+	{"C", "true"},
+	{">\x7f", "127"},
+	{"=18446744073709551615\x7f", "18446744073709551615"},
+	{"B?\xc0\x00\x00", "1.5"},
+	{"\x88fööbar", `"fööbar"`},
+	{"\x84a\"\n\x01", `"a\"\n\u0001"`},
+	{"\xc3\x01\xc0f", "[1,[],{}]"},
+	{"h\x84name\x83foo\x01\xc1E", `{"name":"foo","1":[null]}`},
+}
+
+func TestToJSON(t *testing.T) {
+	for _, test := range jsonTestCases {
+		var buf bytes.Buffer
+		if err := ToJSON(bytes.NewBufferString(test.rencode), &buf); err != nil {
+			t.Fatal(err)
+		}
+		if actual := buf.String(); actual != test.json {
+			t.Fatalf("\nFor     : %+q\nexpected: %s\nactual  : %s", test.rencode, test.json, actual)
+		}
+	}
+
+	if err := ToJSON(bytes.NewBufferString("\xc2\x01"), io.Discard); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if err := ToJSON(bytes.NewBufferString("g\xc0\x01"), io.Discard); err == nil {
+		t.Fatal("expected an error for a list key")
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		rencode string
+	}{
+		{"null", "E"},
+		{"false", "D"},
+		{"-1000", "?\xfc\x18"},
+		{"18446744073709551615", "=18446744073709551615\x7f"},
+		{"1.5", ",?\xf8\x00\x00\x00\x00\x00\x00"},
+		{`"fööbar"`, "\x88fööbar"},
+		{`[1, {"a": [true]}, []]`, ";\x01<\x81a;C\x7f\x7f;\x7f\x7f"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := FromJSON(bytes.NewBufferString(test.json), &buf); err != nil {
+			t.Fatal(err)
+		}
+		if actual := buf.String(); actual != test.rencode {
+			t.Fatalf("\nFor     : %s\nexpected: %+q\nactual  : %+q", test.json, test.rencode, actual)
+		}
+		var out bytes.Buffer
+		if err := ToJSON(&buf, &out); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := FromJSON(bytes.NewBufferString("[1, 2"), io.Discard); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package rencode
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// Dict keys of different types are sorted like Python 2 does: None first,
+// then numbers, booleans included, by value, then strings by their bytes,
+// and finally the other values by their encoding.
+const (
+	keyRankNone = iota
+	keyRankNumber
+	keyRankString
+	keyRankOther
+)
+
+func keyRank(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return keyRankNone
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return keyRankNumber
+	case reflect.String:
+		if v.Type() == numberType {
+			return keyRankNumber
+		}
+		return keyRankString
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return keyRankString
+		}
+	case reflect.Struct:
+		if v.Type() == bigIntType {
+			return keyRankNumber
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			return keyRankNone
+		}
+		if v.Type().Elem() == bigIntType {
+			return keyRankNumber
+		}
+	}
+	return keyRankOther
+}
+
+// unwrapKey returns the dynamic value of interface keys
+func unwrapKey(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	return v
+}
+
+// compareKeys returns -1, 0 or 1 depending on whether the dict key a sorts
+// before, with, or after b
+func compareKeys(a, b reflect.Value) int {
+	a, b = unwrapKey(a), unwrapKey(b)
+	ra, rb := keyRank(a), keyRank(b)
+	switch {
+	case ra != rb:
+		return compareInts(ra, rb)
+	case ra == keyRankNumber:
+		return compareNumbers(a, b)
+	case ra == keyRankString:
+		return bytes.Compare(keyBytes(a), keyBytes(b))
+	case ra == keyRankOther:
+		ea, _ := Append(nil, a.Interface())
+		eb, _ := Append(nil, b.Interface())
+		return bytes.Compare(ea, eb)
+	}
+	return 0
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func keyBytes(v reflect.Value) []byte {
+	if v.Kind() == reflect.String {
+		return []byte(v.String())
+	}
+	if v.Kind() == reflect.Array {
+		b := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(b), v)
+		return b
+	}
+	return v.Bytes()
+}
+
+// compareNumbers compares numbers exactly, as big floats, unless both are
+// within the range of int64
+func compareNumbers(a, b reflect.Value) int {
+	ia, aok := keyInt64(a)
+	ib, bok := keyInt64(b)
+	if aok && bok {
+		switch {
+		case ia < ib:
+			return -1
+		case ia > ib:
+			return 1
+		}
+		return 0
+	}
+	fa, fb := keyFloat(a), keyFloat(b)
+	if fa == nil || fb == nil {
+		// NaN sorts first
+		return compareInts(boolInt(fa != nil), boolInt(fb != nil))
+	}
+	return fa.Cmp(fb)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func keyInt64(v reflect.Value) (int64, bool) {
+	switch v.Kind() {
+	case reflect.Bool:
+		return int64(boolInt(v.Bool())), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		return int64(u), u <= math.MaxInt64
+	}
+	return 0, false
+}
+
+// keyFloat returns the number v as a big float, nil for NaN
+func keyFloat(v reflect.Value) *big.Float {
+	if i, ok := keyInt64(v); ok {
+		return new(big.Float).SetInt64(i)
+	}
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return new(big.Float).SetUint64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) {
+			return nil
+		}
+		return big.NewFloat(f)
+	case reflect.String:
+		bi, ok := new(big.Int).SetString(v.String(), 10)
+		if !ok {
+			f, _ := new(big.Float).SetString(v.String())
+			return f
+		}
+		return new(big.Float).SetInt(bi)
+	case reflect.Struct:
+		bi := v.Interface().(big.Int)
+		return new(big.Float).SetInt(&bi)
+	case reflect.Ptr:
+		return new(big.Float).SetInt(v.Interface().(*big.Int))
+	}
+	return nil
+}
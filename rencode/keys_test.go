@@ -0,0 +1,110 @@
+package rencode
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeMixedKeys(t *testing.T) {
+	m := map[interface{}]interface{}{
+		"b":                            1,
+		int64(2):                       "x",
+		"a":                            2,
+		1.5:                            3,
+		true:                           4,
+		nil:                            5,
+		uint64(1 << 63):                6,
+		Number("-4611686018427387904"): 7,
+	}
+	expected := "n" + "E\x05" + "A\xc0\x00\x00\x00\x00\x00\x00\x00\x07" + "C\x04" +
+		",?\xf8\x00\x00\x00\x00\x00\x00\x03" + "\x02\x81x" +
+		"=9223372036854775808\x7f\x06" + "\x81a\x02" + "\x81b\x01"
+	for i := 0; i < 10; i++ {
+		data, err := Append(nil, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Fatalf("\nexpected: %+q\nactual  : %+q", expected, data)
+		}
+	}
+
+	data, err := Append(nil, map[int]string{3: "c", -1: "a", 2: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "iF\x81a\x02\x81b\x03\x81c"; string(data) != expected {
+		t.Fatalf("\nexpected: %+q\nactual  : %+q", expected, data)
+	}
+}
+
+func TestDecodeMixedKeys(t *testing.T) {
+	data := "j\x00\x01\x01\x02\x812\x03\x81a\x04"
+	var m map[interface{}]interface{}
+	if err := NewDecoder(bytes.NewBufferString(data)).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[interface{}]interface{}{int64(0): int64(1), int64(1): int64(2), "2": int64(3), "a": int64(4)}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("\nexpected: %#v\nactual  : %#v", expected, m)
+	}
+	reencoded, err := Append(nil, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reencoded) != data {
+		t.Fatalf("unstable encoding %+q", reencoded)
+	}
+
+	// byte strings are decoded as strings to be hashable
+	d := NewDecoder(bytes.NewBufferString("g\x81a\x01"))
+	d.DecodeStringsAsBytes(true)
+	m = nil
+	if err := d.Decode(&m); err != nil || m["a"] != int64(1) {
+		t.Fatalf("unexpected result %v, %v", m, err)
+	}
+
+	var ints map[int]string
+	if err := NewDecoder(bytes.NewBufferString("h\x01\x81a\x02\x81b")).Decode(&ints); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ints, map[int]string{1: "a", 2: "b"}) {
+		t.Fatalf("unexpected value %v", ints)
+	}
+
+	if err := NewDecoder(bytes.NewBufferString("g\xc0\x01")).Decode(&m); err == nil {
+		t.Fatal("expected an error for a list key")
+	}
+}
+
+func TestDecodeMixedKeysInterface(t *testing.T) {
+	expected := map[interface{}]interface{}{int64(1): "a", "x": int64(2)}
+	for _, data := range []string{"h\x01\x81a\x81x\x02", "h\x81x\x02\x01\x81a", "<\x81x\x02\x01\x81a\x7f"} {
+		var x interface{}
+		if err := NewDecoder(bytes.NewBufferString(data)).Decode(&x); err != nil {
+			t.Fatalf("%+q: %v", data, err)
+		}
+		if !reflect.DeepEqual(x, expected) {
+			t.Fatalf("%+q:\nexpected: %#v\nactual  : %#v", data, expected, x)
+		}
+	}
+
+	v, err := ParseValue([]byte("g\x81mh\x01\x81a\x81x\x02"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := v.Get("m")
+	if m.Kind() != Dict {
+		t.Fatalf("unexpected kind %v", m.Kind())
+	}
+	if s := m.Get(1).String(); s != "a" {
+		t.Errorf("unexpected value %q for key 1", s)
+	}
+	if i := m.Get("x").Int(); i != 2 {
+		t.Errorf("unexpected value %v for key x", i)
+	}
+	if entries := m.Map(); len(entries) != 2 || entries["1"].String() != "a" {
+		t.Errorf("unexpected entries %v", entries)
+	}
+}
@@ -0,0 +1,146 @@
+package rencode
+
+import (
+	"bufio"
+)
+
+// Kind is the kind of a rencode value, as read from its type code
+type Kind int
+
+// The kinds of rencode values
+const (
+	Invalid Kind = iota
+	None
+	Bool
+	Int
+	Float
+	String
+	List
+	Dict
+)
+
+var kindNames = [...]string{
+	Invalid: "invalid",
+	None:    "none",
+	Bool:    "bool",
+	Int:     "int",
+	Float:   "float",
+	String:  "string",
+	List:    "list",
+	Dict:    "dict",
+}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "invalid"
+	}
+	return kindNames[k]
+}
+
+// kindOf returns the kind of the value introduced by code
+func kindOf(code byte) Kind {
+	switch {
+	case code == chrNone:
+		return None
+	case code == chrTrue, code == chrFalse:
+		return Bool
+	case isInt(code):
+		return Int
+	case code == chrFloat32, code == chrFloat64:
+		return Float
+	case isFixedString(code), isString(code):
+		return String
+	case code == chrList, isFixedSlice(code):
+		return List
+	case code == chrDict, isFixedMap(code):
+		return Dict
+	}
+	return Invalid
+}
+
+// PeekKind returns the kind of the next value without consuming it, along
+// with the length in bytes of strings. It lets callers pick the destination
+// of a value before decoding it.
+func (d *Decoder) PeekKind() (Kind, int64, error) {
+	if u, ok := d.r.(*unreader); ok && u.drained() {
+		d.r = u.r
+	}
+
+	c, err := d.peekByte()
+	if err != nil {
+		return Invalid, 0, err
+	}
+	switch {
+	case isFixedString(c):
+		return String, int64(c - strFixedStart), nil
+	case isString(c):
+		size, err := d.peekStringSize()
+		return String, size, err
+	}
+	if k := kindOf(c); k != Invalid {
+		return k, 0, nil
+	}
+	return Invalid, 0, corruptf("unsupported code %v", c)
+}
+
+// peekStringSize reads the length prefix of the next string and pushes it
+// back, since the reader can only unread a single byte
+func (d *Decoder) peekStringSize() (int64, error) {
+	b, err := d.readUntil(nil, ':', maxLengthDigits)
+	if err != nil {
+		return 0, eofUnexpected(err)
+	}
+	b = append(b, ':')
+	if u, ok := d.r.(*unreader); ok {
+		u.buf = append(b, u.buf[u.off:]...)
+		u.off = 0
+	} else {
+		d.r = &unreader{buf: b, r: d.r}
+	}
+	return parseStringSize(b[:len(b)-1])
+}
+
+// unreader reads the bytes pushed back by PeekKind before those of r
+type unreader struct {
+	buf     []byte
+	off     int
+	r       byteScanner
+	fromBuf bool
+}
+
+func (u *unreader) drained() bool {
+	return u.off == len(u.buf)
+}
+
+func (u *unreader) Read(p []byte) (int, error) {
+	if u.drained() {
+		u.fromBuf = false
+		return u.r.Read(p)
+	}
+	n := copy(p, u.buf[u.off:])
+	u.off += n
+	u.fromBuf = true
+	return n, nil
+}
+
+func (u *unreader) ReadByte() (byte, error) {
+	if u.drained() {
+		u.fromBuf = false
+		return u.r.ReadByte()
+	}
+	c := u.buf[u.off]
+	u.off++
+	u.fromBuf = true
+	return c, nil
+}
+
+func (u *unreader) UnreadByte() error {
+	if !u.fromBuf {
+		return u.r.UnreadByte()
+	}
+	if u.off == 0 {
+		return bufio.ErrInvalidUnreadByte
+	}
+	u.off--
+	return nil
+}
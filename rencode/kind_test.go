@@ -0,0 +1,57 @@
+package rencode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPeekKind(t *testing.T) {
+	long := strings.Repeat("a", 100)
+	data, err := Append(nil, []interface{}{nil, true, 1, 2.5, "abc", long, []int{}, map[string]int{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(bytes.NewReader(data))
+	if k, _, err := d.PeekKind(); err != nil || k != List {
+		t.Fatalf("expected a list, got %v, %v", k, err)
+	}
+	expected := []struct {
+		kind Kind
+		size int64
+	}{
+		{None, 0}, {Bool, 0}, {Int, 0}, {Float, 0}, {String, 3}, {String, 100}, {List, 0}, {Dict, 0},
+	}
+	i := 0
+	err = d.DecodeListFunc(func(d *Decoder) error {
+		// peeking twice must not consume anything
+		d.PeekKind()
+		k, size, err := d.PeekKind()
+		if err != nil {
+			return err
+		}
+		if k != expected[i].kind || size != expected[i].size {
+			t.Errorf("%d: expected %v %d, got %v %d", i, expected[i].kind, expected[i].size, k, size)
+		}
+		if k == String && size == 100 {
+			s, err := d.DecodeString()
+			if err != nil {
+				return err
+			}
+			if s != long {
+				t.Errorf("unexpected string %q", s)
+			}
+		} else if err := d.Skip(); err != nil {
+			return err
+		}
+		i++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != len(expected) {
+		t.Fatalf("expected %d values, got %d", len(expected), i)
+	}
+}
@@ -0,0 +1,50 @@
+package rencode
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+)
+
+// Number represents a rencode integer in its decimal form. It is what
+// integers are decoded into interface{} as when the Decoder's UseNumber is
+// set, so that values exceeding int64 are preserved.
+type Number string
+
+var (
+	numberType = reflect.TypeOf(Number(""))
+	bigIntType = reflect.TypeOf(big.Int{})
+)
+
+// String returns the literal text of the number
+func (n Number) String() string { return string(n) }
+
+// Int64 returns the number as an int64
+func (n Number) Int64() (int64, error) {
+	return strconv.ParseInt(string(n), 10, 64)
+}
+
+// Uint64 returns the number as a uint64
+func (n Number) Uint64() (uint64, error) {
+	return strconv.ParseUint(string(n), 10, 64)
+}
+
+// BigInt returns the number as a big.Int
+func (n Number) BigInt() (*big.Int, error) {
+	bi, ok := new(big.Int).SetString(string(n), 10)
+	if !ok {
+		return nil, fmt.Errorf("rencode: invalid number %q", string(n))
+	}
+	return bi, nil
+}
+
+func (e *Encoder) encodeNumber(n Number) error {
+	if i, err := n.Int64(); err == nil {
+		return e.encodeInt(i)
+	}
+	if _, err := n.BigInt(); err != nil {
+		return err
+	}
+	return e.encodeIntString(n.String())
+}
@@ -0,0 +1,72 @@
+package rencode
+
+// progressInterval is the number of bytes consumed between two calls of the
+// progress callback
+const progressInterval = 64 << 10
+
+// OnProgress sets a callback invoked with the total number of bytes consumed
+// by the decoder each time 64KiB more are read, to report the progress of
+// long decodes. A nil callback removes it.
+func (d *Decoder) OnProgress(fn func(bytesConsumed int64)) {
+	if pr := d.progressReader(); pr != nil {
+		pr.fn = fn
+		return
+	}
+	if fn == nil {
+		return
+	}
+	pr := &progressReader{r: d.r, fn: fn, next: progressInterval}
+	if u, ok := d.r.(*unreader); ok {
+		pr.r = u.r
+		u.r = pr
+	} else {
+		d.r = pr
+	}
+}
+
+func (d *Decoder) progressReader() *progressReader {
+	r := d.r
+	if u, ok := r.(*unreader); ok {
+		r = u.r
+	}
+	pr, _ := r.(*progressReader)
+	return pr
+}
+
+// progressReader counts the bytes read from r, reporting them to fn
+type progressReader struct {
+	r    byteScanner
+	fn   func(int64)
+	n    int64
+	next int64
+}
+
+func (pr *progressReader) advance(n int64) {
+	pr.n += n
+	if pr.n >= pr.next && pr.fn != nil {
+		pr.next = pr.n + progressInterval
+		pr.fn(pr.n)
+	}
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.advance(int64(n))
+	return n, err
+}
+
+func (pr *progressReader) ReadByte() (byte, error) {
+	c, err := pr.r.ReadByte()
+	if err == nil {
+		pr.advance(1)
+	}
+	return c, err
+}
+
+func (pr *progressReader) UnreadByte() error {
+	if err := pr.r.UnreadByte(); err != nil {
+		return err
+	}
+	pr.n--
+	return nil
+}
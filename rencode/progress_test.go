@@ -0,0 +1,36 @@
+package rencode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDecodeOnProgress(t *testing.T) {
+	values := make([]string, 1000)
+	for i := range values {
+		values[i] = strings.Repeat("x", 1000)
+	}
+	data, err := Append(nil, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var progress []int64
+	d := NewDecoder(bytes.NewReader(data))
+	d.OnProgress(func(n int64) {
+		progress = append(progress, n)
+	})
+	var v []string
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) != len(data)/progressInterval {
+		t.Fatalf("expected %d calls, got %v", len(data)/progressInterval, progress)
+	}
+	for i, n := range progress {
+		if n < int64(i+1)*progressInterval || n > int64(len(data)) {
+			t.Fatalf("unexpected progress %v", progress)
+		}
+	}
+}
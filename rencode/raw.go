@@ -0,0 +1,31 @@
+package rencode
+
+import "errors"
+
+// RawMessage is a raw encoded rencode value. It implements Marshaler and
+// Unmarshaler, so that the decoding of a value can be delayed, or a value
+// encoded beforehand can be embedded as is.
+type RawMessage []byte
+
+// MarshalRencode writes m verbatim, or None when m is empty
+func (m RawMessage) MarshalRencode(e *Encoder) error {
+	if len(m) == 0 {
+		return e.EncodeNone()
+	}
+	if !Valid(m) {
+		return errors.New("rencode: invalid RawMessage")
+	}
+	return e.write(m)
+}
+
+// UnmarshalRencode sets *m to a copy of the next value
+func (m *RawMessage) UnmarshalRencode(d *Decoder) error {
+	rr := d.startRecording()
+	err := d.Skip()
+	d.stopRecording(rr)
+	if err != nil {
+		return err
+	}
+	*m = append((*m)[:0], rr.buf...)
+	return nil
+}
@@ -0,0 +1,54 @@
+package rencode
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRawMessage(t *testing.T) {
+	data, err := Append(nil, map[string]interface{}{
+		"name":  "ubuntu.iso",
+		"files": []interface{}{"a", "b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v struct {
+		Name  string     `rencode:"name"`
+		Files RawMessage `rencode:"files"`
+	}
+	if err := NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	if err := NewDecoder(bytes.NewReader(v.Files)).Decode(&files); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, []string{"a", "b"}) {
+		t.Errorf("files = %q", files)
+	}
+
+	// re-encoding embeds the raw value as is
+	again, err := Append(nil, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := NewDecoder(bytes.NewReader(again)).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m["files"], []interface{}{"a", "b"}) {
+		t.Errorf("files = %v", m["files"])
+	}
+}
+
+func TestRawMessageEncode(t *testing.T) {
+	if data, err := Append(nil, RawMessage(nil)); err != nil || !bytes.Equal(data, []byte{chrNone}) {
+		t.Errorf("empty message: data = %x, err = %v", data, err)
+	}
+	if _, err := Append(nil, RawMessage{chrList}); err == nil {
+		t.Error("expected an error for a truncated message")
+	}
+}
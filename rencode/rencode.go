@@ -1,3 +1,20 @@
+// Package rencode implements encoding and decoding of rencode, the
+// serialization format used by the Deluge RPC protocol.
+//
+// Structs are encoded as dicts keyed by field name. The key of a field can be
+// customized with the "rencode" struct tag, whose options are:
+//
+//	`rencode:"name"`           encode the field under the key "name"
+//	`rencode:"-"`              never encode the field
+//	`rencode:",omitempty"`     leave the field out when it is empty
+//	`rencode:",float"`         encode a time.Time field as float seconds
+//
+// Fields of anonymous embedded structs are promoted into the parent dict,
+// following the same rules as encoding/json. time.Time values are encoded as
+// integer epoch seconds, and decoded from both integer and float epochs.
+// Types implementing sql.Scanner and driver.Valuer, such as sql.NullString,
+// are decoded through Scan, which is passed nil for None, and encoded as the
+// result of Value.
 package rencode
 
 import (
@@ -32,12 +49,25 @@ const (
 	listFixedCount   byte = 64
 )
 
-// NewDecoder returns a new rencode decoder
+// byteScanner is the reader the decoder works on
+type byteScanner interface {
+	io.Reader
+	io.ByteScanner
+}
+
+// NewDecoder returns a new rencode decoder. Readers implementing
+// io.ByteScanner, such as *bufio.Reader or *bytes.Reader, are used directly
+// and are never read past the end of the decoded values. Other readers are
+// wrapped in a bufio.Reader, which may read ahead.
 func NewDecoder(r io.Reader) *Decoder {
+	if bs, ok := r.(byteScanner); ok {
+		return &Decoder{r: bs}
+	}
 	return &Decoder{r: bufio.NewReader(r)}
 }
 
-// NewEncoder returns a new rencode encoder
+// NewEncoder returns a new rencode encoder writing to w. Values written with
+// the streaming primitives are buffered until Flush is called.
 func NewEncoder(w io.Writer) *Encoder {
-	return &Encoder{w}
+	return &Encoder{w: w}
 }
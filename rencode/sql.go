@@ -0,0 +1,50 @@
+package rencode
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"math/big"
+	"reflect"
+)
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// scanner returns v as an sql.Scanner, such as sql.NullString, which is
+// passed None as nil
+func scanner(v reflect.Value) (sql.Scanner, bool) {
+	if v.Kind() != reflect.Ptr && v.CanAddr() &&
+		reflect.PtrTo(v.Type()).Implements(scannerType) {
+		return v.Addr().Interface().(sql.Scanner), true
+	}
+	return nil, false
+}
+
+// decodeScan decodes the next value into an interface{} and passes it to s,
+// converted to the types database drivers produce
+func (d *Decoder) decodeScan(s sql.Scanner) error {
+	d.only = nil
+	var x interface{}
+	if err := d.Decode(&x); err != nil {
+		return err
+	}
+	switch v := x.(type) {
+	case float32:
+		x = float64(v)
+	case Number:
+		x = string(v)
+	case big.Int:
+		x = v.String()
+	}
+	return s.Scan(x)
+}
+
+// valuer returns v as a driver.Valuer, whose value is encoded in its place
+func valuer(v reflect.Value) (driver.Valuer, bool) {
+	if i, ok := implementer(v, valuerType); ok {
+		return i.(driver.Valuer), true
+	}
+	return nil, false
+}
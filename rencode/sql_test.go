@@ -0,0 +1,69 @@
+package rencode
+
+import (
+	"bytes"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+type nullableStatus struct {
+	Name     sql.NullString  `rencode:"name"`
+	Eta      sql.NullInt64   `rencode:"eta"`
+	Progress sql.NullFloat64 `rencode:"progress"`
+	Paused   sql.NullBool    `rencode:"paused"`
+}
+
+func TestDecodeScanner(t *testing.T) {
+	var status nullableStatus
+	data := "j\x83eta\x05\x84nameE\x86paused\x43\x88progressB?\xc0\x00\x00"
+	if err := NewDecoder(bytes.NewBufferString(data)).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	expected := nullableStatus{
+		Eta:      sql.NullInt64{Int64: 5, Valid: true},
+		Progress: sql.NullFloat64{Float64: 1.5, Valid: true},
+		Paused:   sql.NullBool{Bool: true, Valid: true},
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Fatalf("\nexpected: %+v\nactual  : %+v", expected, status)
+	}
+
+	// None resets a valid value
+	status.Eta = sql.NullInt64{Int64: 1, Valid: true}
+	if err := NewDecoder(bytes.NewBufferString("g\x83etaE")).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Eta.Valid {
+		t.Fatalf("unexpected value %+v", status.Eta)
+	}
+
+	var s sql.NullString
+	if err := NewDecoder(bytes.NewBufferString("\xc0")).Decode(&s); err == nil {
+		t.Fatal("expected an error for a list")
+	}
+}
+
+func TestEncodeValuer(t *testing.T) {
+	status := nullableStatus{
+		Name: sql.NullString{String: "foo", Valid: true},
+		Eta:  sql.NullInt64{},
+	}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	if err := e.Encode(status); err != nil {
+		t.Fatal(err)
+	}
+	expected := "j\x83etaE\x84name\x83foo\x86pausedE\x88progressE"
+	if actual := buf.String(); actual != expected {
+		t.Fatalf("\nexpected: %+q\nactual  : %+q", expected, actual)
+	}
+
+	var decoded nullableStatus
+	if err := NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, status) {
+		t.Fatalf("\nexpected: %+v\nactual  : %+v", status, decoded)
+	}
+}
@@ -0,0 +1,273 @@
+package rencode
+
+// DecodeStats describes the value read by a Decode call
+type DecodeStats struct {
+	// Counts holds the number of values of each kind, indexed by Kind,
+	// dict keys included
+	Counts [Dict + 1]int64
+	// MaxDepth is the deepest nesting of lists and dicts, 0 for a scalar
+	MaxDepth int
+	// StringBytes is the total length of the strings, dict keys included
+	StringBytes int64
+	// Bytes is the length of the encoded value
+	Bytes int64
+}
+
+// StatsCollector receives the statistics of the values decoded by a Decoder
+type StatsCollector interface {
+	CollectDecodeStats(stats DecodeStats)
+}
+
+// StatsCollectorFunc is a function used as a StatsCollector
+type StatsCollectorFunc func(stats DecodeStats)
+
+// CollectDecodeStats calls f(stats)
+func (f StatsCollectorFunc) CollectDecodeStats(stats DecodeStats) {
+	f(stats)
+}
+
+// CollectStats sets the collector receiving the statistics of every value
+// successfully decoded by Decode, nil to stop collecting them. They help
+// understand the shape of payloads, for instance to set limits. Collecting
+// them counts the values as their bytes are read, without buffering them.
+func (d *Decoder) CollectStats(c StatsCollector) {
+	d.stats = c
+}
+
+// recordingReader records the bytes read from r
+type recordingReader struct {
+	r   byteScanner
+	buf []byte
+}
+
+func (rr *recordingReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	rr.buf = append(rr.buf, p[:n]...)
+	return n, err
+}
+
+func (rr *recordingReader) ReadByte() (byte, error) {
+	c, err := rr.r.ReadByte()
+	if err == nil {
+		rr.buf = append(rr.buf, c)
+	}
+	return c, err
+}
+
+func (rr *recordingReader) UnreadByte() error {
+	if err := rr.r.UnreadByte(); err != nil {
+		return err
+	}
+	rr.buf = rr.buf[:len(rr.buf)-1]
+	return nil
+}
+
+// startRecording makes the decoder record the bytes it reads
+func (d *Decoder) startRecording() *recordingReader {
+	rr := &recordingReader{r: d.r}
+	d.r = rr
+	return rr
+}
+
+// stopRecording removes rr from the readers of the decoder
+func (d *Decoder) stopRecording(rr *recordingReader) {
+	d.unwrap(rr, rr.r)
+}
+
+// unwrap replaces the reader r, wrapping inner, by inner, wherever PeekKind
+// put r
+func (d *Decoder) unwrap(r, inner byteScanner) {
+	if u, ok := d.r.(*unreader); ok && u.r == r {
+		u.r = inner
+	} else if d.r == r {
+		d.r = inner
+	}
+}
+
+// statsReader computes the statistics of the value read from r as its bytes
+// go by, following the structure of the value with a small state machine
+type statsReader struct {
+	r byteScanner
+	statsState
+	// last is the state before the last byte, restored by UnreadByte
+	last statsState
+}
+
+// statsState holds the statistics of the bytes read so far, and where a
+// statsReader is in the value
+type statsState struct {
+	stats DecodeStats
+	// step tells how the next byte is read
+	step statsStep
+	// n is the number of bytes left to skip, or the length being parsed
+	n int64
+	// open holds the number of values left in each open container, -1 for
+	// those ended by chrTerm. Popped entries stay in the backing array, so
+	// that restoring an older slice header undoes a pop.
+	open []int
+}
+
+type statsStep int
+
+const (
+	// stepCode reads the type code of a value
+	stepCode statsStep = iota
+	// stepSkip skips n bytes of a value
+	stepSkip
+	// stepLength parses the length prefix of a string, before ':'
+	stepLength
+	// stepBigInt skips the digits of an integer, until chrTerm
+	stepBigInt
+)
+
+func (sr *statsReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	if n > 0 {
+		sr.feed(p[:n-1])
+		sr.last = sr.statsState
+		sr.feed(p[n-1 : n])
+	}
+	return n, err
+}
+
+func (sr *statsReader) ReadByte() (byte, error) {
+	c, err := sr.r.ReadByte()
+	if err == nil {
+		sr.last = sr.statsState
+		sr.feed([]byte{c})
+	}
+	return c, err
+}
+
+func (sr *statsReader) UnreadByte() error {
+	if err := sr.r.UnreadByte(); err != nil {
+		return err
+	}
+	sr.statsState = sr.last
+	return nil
+}
+
+// feed advances the state over the bytes of b
+func (sr *statsReader) feed(b []byte) {
+	sr.stats.Bytes += int64(len(b))
+	for len(b) > 0 {
+		switch sr.step {
+		case stepSkip:
+			k := sr.n
+			if k > int64(len(b)) {
+				k = int64(len(b))
+			}
+			b = b[k:]
+			if sr.n -= k; sr.n == 0 {
+				sr.step = stepCode
+				sr.done()
+			}
+			continue
+		case stepLength:
+			if b[0] == ':' {
+				sr.stats.StringBytes += sr.n
+				sr.skip(sr.n)
+			} else {
+				sr.n = 10*sr.n + int64(b[0]-'0')
+			}
+		case stepBigInt:
+			if b[0] == chrTerm {
+				sr.step = stepCode
+				sr.done()
+			}
+		default:
+			sr.code(b[0])
+		}
+		b = b[1:]
+	}
+}
+
+// code accounts for the value introduced by c
+func (sr *statsReader) code(c byte) {
+	if c == chrTerm && len(sr.open) > 0 && sr.open[len(sr.open)-1] < 0 {
+		sr.open = sr.open[:len(sr.open)-1]
+		sr.done()
+		return
+	}
+	kind := kindOf(c)
+	sr.stats.Counts[kind]++
+	switch {
+	case isFixedString(c):
+		sr.stats.StringBytes += int64(c - strFixedStart)
+		sr.skip(int64(c - strFixedStart))
+	case isString(c):
+		sr.step, sr.n = stepLength, int64(c-'0')
+	case c == chrInt:
+		sr.step = stepBigInt
+	case c == chrInt1:
+		sr.skip(1)
+	case c == chrInt2:
+		sr.skip(2)
+	case c == chrInt4, c == chrFloat32:
+		sr.skip(4)
+	case c == chrInt8, c == chrFloat64:
+		sr.skip(8)
+	case c == chrList, c == chrDict:
+		sr.push(-1)
+	case isFixedSlice(c):
+		sr.push(int(c - listFixedStart))
+	case isFixedMap(c):
+		sr.push(2 * int(c-dictFixedStart))
+	case kind != Invalid:
+		sr.done()
+	}
+}
+
+// skip skips the n bytes left of a value
+func (sr *statsReader) skip(n int64) {
+	if n == 0 {
+		sr.step = stepCode
+		sr.done()
+		return
+	}
+	sr.step, sr.n = stepSkip, n
+}
+
+// push opens a container of n values
+func (sr *statsReader) push(n int) {
+	sr.step = stepCode
+	sr.open = append(sr.open, n)
+	if len(sr.open) > sr.stats.MaxDepth {
+		sr.stats.MaxDepth = len(sr.open)
+	}
+	if n == 0 {
+		sr.open = sr.open[:len(sr.open)-1]
+		sr.done()
+	}
+}
+
+// done accounts for the end of a value in its container, closing the
+// containers it completes
+func (sr *statsReader) done() {
+	for len(sr.open) > 0 {
+		top := len(sr.open) - 1
+		if sr.open[top] < 0 {
+			return
+		}
+		if sr.open[top]--; sr.open[top] > 0 {
+			return
+		}
+		sr.open = sr.open[:top]
+	}
+}
+
+// startStats makes the decoder compute the statistics of the value it reads
+func (d *Decoder) startStats() *statsReader {
+	sr := &statsReader{r: d.r}
+	d.r = sr
+	return sr
+}
+
+// reportStats removes sr from the readers of the decoder, passing the
+// statistics of the value it read to the collector unless err is set
+func (d *Decoder) reportStats(sr *statsReader, err error) {
+	d.unwrap(sr, sr.r)
+	if err == nil {
+		d.stats.CollectDecodeStats(sr.stats)
+	}
+}
@@ -0,0 +1,90 @@
+package rencode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCollectStats(t *testing.T) {
+	var stats []DecodeStats
+	d := NewDecoder(bytes.NewBufferString("h\x84name\x83foo\x85files;\xc1g\x84path\x81aC\x7f\x05"))
+	d.CollectStats(StatsCollectorFunc(func(s DecodeStats) {
+		stats = append(stats, s)
+	}))
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := d.Decode(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stats) != 2 {
+		t.Fatalf("expected stats for 2 values, got %d", len(stats))
+	}
+	expected := DecodeStats{MaxDepth: 4, StringBytes: 17, Bytes: 28}
+	expected.Counts[String] = 5
+	expected.Counts[List] = 2
+	expected.Counts[Dict] = 2
+	expected.Counts[Bool] = 1
+	if stats[0] != expected {
+		t.Fatalf("\nexpected: %+v\nactual  : %+v", expected, stats[0])
+	}
+	expected = DecodeStats{Bytes: 1}
+	expected.Counts[Int] = 1
+	if stats[1] != expected {
+		t.Fatalf("\nexpected: %+v\nactual  : %+v", expected, stats[1])
+	}
+
+	// values skipped or peeked at are counted as well
+	stats = nil
+	d = NewDecoder(bytes.NewBufferString("h\x84name\x83foo\x84size\x05"))
+	d.CollectStats(StatsCollectorFunc(func(s DecodeStats) {
+		stats = append(stats, s)
+	}))
+	var status struct {
+		Size int `rencode:"size"`
+	}
+	if err := d.Decode(&status); err != nil || status.Size != 5 {
+		t.Fatalf("unexpected result %+v, %v", status, err)
+	}
+	if len(stats) != 1 || stats[0].Counts[String] != 3 || stats[0].Bytes != 16 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDecodeCollectStatsCodes(t *testing.T) {
+	data, err := Append(nil, []interface{}{
+		int64(-100), int64(1000), int64(100000), int64(1 << 40),
+		bigIntFromString("123456789012345678901234567890"),
+		1.1, float32(2.5),
+		strings.Repeat("x", 100),
+		[]interface{}{},
+		sliceWithLength(70),
+		mapWithLength(30),
+		nil, true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats DecodeStats
+	d := NewDecoder(bytes.NewReader(data))
+	d.CollectStats(StatsCollectorFunc(func(s DecodeStats) { stats = s }))
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	expected := DecodeStats{MaxDepth: 2, StringBytes: 480, Bytes: int64(len(data))}
+	expected.Counts[None] = 1
+	expected.Counts[Bool] = 1
+	expected.Counts[Int] = 35
+	expected.Counts[Float] = 2
+	expected.Counts[String] = 101
+	expected.Counts[List] = 3
+	expected.Counts[Dict] = 1
+	if stats != expected {
+		t.Fatalf("\nexpected: %+v\nactual  : %+v", expected, stats)
+	}
+}
@@ -0,0 +1,45 @@
+package rencode
+
+import (
+	"math"
+	"reflect"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// encodeTime writes t as an epoch timestamp, in whole seconds or, when
+// float is true, in fractional seconds. The zero time is written as 0, the
+// timestamp Deluge gives events that did not happen.
+func (e *Encoder) encodeTime(t time.Time, float bool) error {
+	if t.IsZero() {
+		if float {
+			return e.encodeFloat64(0)
+		}
+		return e.encodeInt(0)
+	}
+	if float {
+		// UnixNano overflows outside of the years 1678 to 2262
+		return e.encodeFloat64(float64(t.Unix()) + float64(t.Nanosecond())/1e9)
+	}
+	return e.encodeInt(t.Unix())
+}
+
+// timeFromInt converts an epoch timestamp in whole seconds to a time, 0
+// being the zero time
+func timeFromInt(i int64) time.Time {
+	if i == 0 {
+		return time.Time{}
+	}
+	return time.Unix(i, 0)
+}
+
+// timeFromFloat converts an epoch timestamp in fractional seconds to a time,
+// 0 being the zero time
+func timeFromFloat(f float64) time.Time {
+	if f == 0 {
+		return time.Time{}
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e9)))
+}
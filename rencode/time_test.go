@@ -0,0 +1,51 @@
+package rencode
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestTimeEdgeCases(t *testing.T) {
+	type times struct {
+		Int   time.Time `rencode:"int"`
+		Float time.Time `rencode:"float,float"`
+	}
+	// the zero time is written as 0 and read back
+	data, err := Append(nil, times{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "h\x85float,\x00\x00\x00\x00\x00\x00\x00\x00\x83int\x00"; string(data) != expected {
+		t.Fatalf("\nexpected: %+q\nactual  : %+q", expected, data)
+	}
+	v := times{Int: time.Now(), Float: time.Now()}
+	if err := NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if !v.Int.IsZero() || !v.Float.IsZero() {
+		t.Fatalf("expected zero times, got %+v", v)
+	}
+
+	// times out of the range of UnixNano
+	for _, tm := range []time.Time{
+		time.Date(1600, 1, 2, 3, 4, 5, 500000000, time.UTC),
+		time.Date(2300, 1, 2, 3, 4, 5, 250000000, time.UTC),
+		time.Unix(-1, 500000000),
+	} {
+		data, err := Append(nil, times{Int: tm, Float: tm})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v times
+		if err := NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		if !v.Int.Equal(time.Unix(tm.Unix(), 0)) {
+			t.Errorf("%v: read back %v in seconds", tm, v.Int)
+		}
+		if d := v.Float.Sub(tm); d < -time.Microsecond || d > time.Microsecond {
+			t.Errorf("%v: read back %v in fractional seconds", tm, v.Float)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package rencode
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrCorrupted is the error wrapped by the errors returned for malformed
+// data, such as unknown type codes or invalid integers. Data ending in the
+// middle of a value is reported as io.ErrUnexpectedEOF instead.
+var ErrCorrupted = errors.New("rencode: corrupted data")
+
+// corruptf returns an error wrapping ErrCorrupted
+func corruptf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: "+format, append([]interface{}{ErrCorrupted}, args...)...)
+}
+
+// Valid reports whether data holds exactly one well-formed rencode value
+func Valid(data []byte) bool {
+	d := NewDecoder(bytes.NewReader(data))
+	if err := d.skipValue(); err != nil {
+		return false
+	}
+	_, err := d.peekByte()
+	return err == io.EOF
+}
+
+// Validate reads one value from r and checks that it is well-formed,
+// without allocating the decoded value
+func Validate(r io.Reader) error {
+	return NewDecoder(r).skipValue()
+}
+
+// skipValue consumes the next value, checking its structure but without
+// decoding it
+func (d *Decoder) skipValue() error {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if err := d.skipCode(c); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
+
+func (d *Decoder) skipCode(c byte) error {
+	if c == chrList || c == chrDict || isFixedSlice(c) || isFixedMap(c) {
+		if err := d.enter(); err != nil {
+			return err
+		}
+		defer d.leave()
+	}
+	switch c {
+	case chrNone, chrTrue, chrFalse:
+		return nil
+	case chrInt1:
+		return d.discard(1)
+	case chrInt2:
+		return d.discard(2)
+	case chrInt4, chrFloat32:
+		return d.discard(4)
+	case chrInt8, chrFloat64:
+		return d.discard(8)
+	case chrInt:
+		return d.skipBigInt()
+	case chrList:
+		return d.skipUntilTerm(1)
+	case chrDict:
+		return d.skipUntilTerm(2)
+	}
+	switch {
+	case isFixedPosInt(c), isFixedNegInt(c):
+		return nil
+	case isFixedString(c):
+		return d.discard(int64(c - strFixedStart))
+	case isString(c):
+		size, err := d.decodeStringSize(c)
+		if err != nil {
+			return err
+		}
+		return d.discard(size)
+	case isFixedSlice(c):
+		return d.skipN(int(c - listFixedStart))
+	case isFixedMap(c):
+		return d.skipN(2 * int(c-dictFixedStart))
+	}
+	return corruptf("unsupported code %v", c)
+}
+
+func (d *Decoder) discard(n int64) error {
+	if n < 0 {
+		return corruptf("invalid length %d", n)
+	}
+	if br, ok := d.r.(*bufio.Reader); ok {
+		_, err := br.Discard(int(n))
+		return err
+	}
+	if n > 256 {
+		_, err := io.CopyN(io.Discard, d.r, n)
+		return err
+	}
+	// short strings are skipped without the allocations of io.CopyN
+	for ; n > 0; n-- {
+		if _, err := d.r.ReadByte(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) skipN(n int) error {
+	for i := 0; i < n; i++ {
+		if err := d.skipValue(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipUntilTerm skips groups of n values until the terminator is reached
+func (d *Decoder) skipUntilTerm(n int) error {
+	for {
+		c, err := d.peekByte()
+		if err != nil {
+			return err
+		}
+		if c == chrTerm {
+			_, err := d.r.ReadByte()
+			return err
+		}
+		if err := d.skipN(n); err != nil {
+			return err
+		}
+	}
+}
+
+// skipBigInt skips the digits of a chrInt payload, checking their syntax
+func (d *Decoder) skipBigInt() error {
+	for n, digits := 0, 0; ; n++ {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case c == chrTerm && digits > 0:
+			return nil
+		case n >= d.maxIntChars():
+			return corruptf("value longer than %d characters", d.maxIntChars())
+		case c == '-' && n == 0:
+		case '0' <= c && c <= '9':
+			digits++
+		default:
+			return corruptf("invalid integer character %q", c)
+		}
+	}
+}
+
+// more reports whether the container of the given size, -1 when terminated,
+// has more values after the i first ones, consuming the terminator
+func (d *Decoder) more(i, size int) (bool, error) {
+	if size >= 0 {
+		return i < size, nil
+	}
+	code, err := d.peekByte()
+	if err != nil {
+		return false, err
+	}
+	if code == chrTerm {
+		_, err := d.r.ReadByte()
+		return false, err
+	}
+	return true, nil
+}
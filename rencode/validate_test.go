@@ -0,0 +1,86 @@
+package rencode
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	for _, test := range decodeTestCases {
+		if !Valid([]byte(test.value)) {
+			t.Fatalf("expected %q to be valid", test.value)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"\x83fo",
+		"?\x01",
+		"=12a\x7f",
+		"=-\x7f",
+		"3:ab",
+		"\xc2\x01",
+		";\x01\x02",
+		"h\x83foo\x01",
+		"<\x83foo\x01\x83bar",
+		"\x7f",
+		"\x01\x02",
+	}
+	for _, value := range invalid {
+		if Valid([]byte(value)) {
+			t.Fatalf("expected %q to be invalid", value)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	r := bytes.NewBufferString("\xc2\x01\x83foo\x01")
+	if err := Validate(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(bytes.NewBufferString("")); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if err := Validate(bytes.NewBufferString("\xc2\x01")); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestDecodeCorrupted(t *testing.T) {
+	corrupted := []string{
+		".",        // unknown code
+		"=12a\x7f", // invalid integer
+		"=" + strings.Repeat("1", 65) + "\x7f",
+		"x\x7f",                 // terminator in a fixed size dict
+		"99999999999999999999:", // string length overflowing int64
+		strings.Repeat(";", maxNesting+1),
+	}
+	for _, data := range corrupted {
+		var v interface{}
+		err := NewDecoder(bytes.NewBufferString(data)).Decode(&v)
+		if !errors.Is(err, ErrCorrupted) {
+			t.Errorf("%.20q: expected ErrCorrupted, got %v", data, err)
+		}
+		if err := Validate(bytes.NewBufferString(data)); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("%.20q: expected Validate to return ErrCorrupted, got %v", data, err)
+		}
+	}
+
+	truncated := []string{
+		">",                  // int1 without its byte
+		"A\x00\x00",          // truncated int8
+		"=12",                // unterminated integer
+		"999999999999999:ab", // string shorter than announced
+		";\x01\x02",          // unterminated list
+	}
+	for _, data := range truncated {
+		var v interface{}
+		err := NewDecoder(bytes.NewBufferString(data)).Decode(&v)
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("%q: expected io.ErrUnexpectedEOF, got %v", data, err)
+		}
+	}
+}
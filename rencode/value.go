@@ -0,0 +1,342 @@
+package rencode
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// Value is a decoded rencode value of any kind, with accessors converting it
+// to the Go type needed. It avoids chains of type assertions when navigating
+// nested responses:
+//
+//	name := v.Get("torrents", id, "name").String()
+//
+// The accessors return the zero value of their type when the value does not
+// exist or cannot be converted. Value can be used as a decoding destination,
+// and encodes as the value it holds.
+type Value struct {
+	v  interface{}
+	ok bool
+}
+
+// ValueOf returns the Value holding x, typically a value decoded into an
+// interface{}
+func ValueOf(x interface{}) Value {
+	return Value{v: x, ok: true}
+}
+
+// ParseValue decodes the value held by data
+func ParseValue(data []byte) (Value, error) {
+	var v Value
+	err := NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// UnmarshalRencode implements Unmarshaler
+func (v *Value) UnmarshalRencode(d *Decoder) error {
+	var x interface{}
+	if err := d.Decode(&x); err != nil {
+		return err
+	}
+	*v = ValueOf(x)
+	return nil
+}
+
+// MarshalRencode implements Marshaler
+func (v Value) MarshalRencode(e *Encoder) error {
+	return e.Encode(v.v)
+}
+
+// Exists reports whether the value exists, that is whether it is not the
+// result of Get with a path missing from the value
+func (v Value) Exists() bool {
+	return v.ok
+}
+
+// Kind returns the kind of the value, Invalid if it does not exist
+func (v Value) Kind() Kind {
+	if !v.ok {
+		return Invalid
+	}
+	switch v.v.(type) {
+	case nil:
+		return None
+	case bool:
+		return Bool
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, big.Int, *big.Int, Number:
+		return Int
+	case float32, float64:
+		return Float
+	case string, []byte:
+		return String
+	case []interface{}:
+		return List
+	case map[string]interface{}, map[interface{}]interface{}:
+		return Dict
+	}
+	return Invalid
+}
+
+// Get returns the value at the given path, made of string or int keys for
+// dicts and int indexes for lists. The returned value does not exist if the
+// path does not match the value.
+func (v Value) Get(path ...interface{}) Value {
+	for _, p := range path {
+		if !v.ok {
+			break
+		}
+		switch x := v.v.(type) {
+		case map[string]interface{}:
+			key, ok := p.(string)
+			if !ok {
+				return Value{}
+			}
+			v.v, v.ok = x[key]
+		case map[interface{}]interface{}:
+			switch key := p.(type) {
+			case string:
+				v.v, v.ok = x[key]
+			case int:
+				// integers are decoded as int64
+				v.v, v.ok = x[int64(key)]
+			default:
+				return Value{}
+			}
+		case []interface{}:
+			i, ok := p.(int)
+			if !ok || i < 0 || i >= len(x) {
+				return Value{}
+			}
+			v.v = x[i]
+		default:
+			return Value{}
+		}
+	}
+	return v
+}
+
+// Interface returns the value as decoded into an interface{}
+func (v Value) Interface() interface{} {
+	return v.v
+}
+
+// String returns strings as is, and the other scalars formatted as text.
+// None and missing values are returned as the empty string.
+func (v Value) String() string {
+	switch x := v.v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case big.Int:
+		return x.String()
+	case float32:
+		return strconv.FormatFloat(float64(x), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	}
+	return fmt.Sprint(v.v)
+}
+
+// Bytes returns strings as raw bytes
+func (v Value) Bytes() []byte {
+	switch x := v.v.(type) {
+	case []byte:
+		return x
+	case string:
+		return []byte(x)
+	}
+	return nil
+}
+
+// Int returns numbers, numeric strings and booleans as an int64
+func (v Value) Int() int64 {
+	switch x := v.v.(type) {
+	case bool:
+		if x {
+			return 1
+		}
+	case int64:
+		return x
+	case uint64:
+		return int64(x)
+	case float32:
+		return int64(x)
+	case float64:
+		return int64(x)
+	case big.Int:
+		return x.Int64()
+	case Number:
+		i, _ := x.Int64()
+		return i
+	case string, []byte:
+		i, _ := strconv.ParseInt(v.String(), 10, 64)
+		return i
+	default:
+		if i, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			return i
+		}
+	}
+	return 0
+}
+
+// Uint returns non-negative numbers, numeric strings and booleans as an
+// uint64
+func (v Value) Uint() uint64 {
+	switch x := v.v.(type) {
+	case uint64:
+		return x
+	case big.Int:
+		return x.Uint64()
+	case Number:
+		u, _ := x.Uint64()
+		return u
+	}
+	if i := v.Int(); i > 0 {
+		return uint64(i)
+	}
+	return 0
+}
+
+// Float returns numbers, numeric strings and booleans as a float64
+func (v Value) Float() float64 {
+	switch x := v.v.(type) {
+	case float32:
+		return float64(x)
+	case float64:
+		return x
+	case big.Int:
+		f, _ := new(big.Float).SetInt(&x).Float64()
+		return f
+	case string, []byte, Number:
+		f, _ := strconv.ParseFloat(v.String(), 64)
+		return f
+	}
+	return float64(v.Int())
+}
+
+// Bool returns booleans, true for non-zero numbers and for strings parsed
+// as true by strconv.ParseBool
+func (v Value) Bool() bool {
+	switch x := v.v.(type) {
+	case bool:
+		return x
+	case string, []byte:
+		b, _ := strconv.ParseBool(v.String())
+		return b
+	}
+	return v.Float() != 0
+}
+
+// List returns the elements of a list, nil for other values
+func (v Value) List() []Value {
+	x, ok := v.v.([]interface{})
+	if !ok {
+		return nil
+	}
+	l := make([]Value, len(x))
+	for i := range x {
+		l[i] = ValueOf(x[i])
+	}
+	return l
+}
+
+// Map returns the entries of a dict, nil for other values. Keys that are not
+// strings are formatted as text.
+func (v Value) Map() map[string]Value {
+	switch x := v.v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]Value, len(x))
+		for k := range x {
+			m[k] = ValueOf(x[k])
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[string]Value, len(x))
+		for k := range x {
+			m[ValueOf(k).String()] = ValueOf(x[k])
+		}
+		return m
+	}
+	return nil
+}
+
+// GetPath decodes the value at the given path in data, made of string keys
+// for dicts and int indexes for lists, skipping the values around it without
+// decoding them. The returned value does not exist if the path does not match
+// the value.
+func GetPath(data []byte, path ...interface{}) (Value, error) {
+	d := NewDecoder(bytes.NewReader(data))
+	for _, p := range path {
+		found, err := d.seek(p)
+		if err != nil || !found {
+			return Value{}, eofUnexpected(err)
+		}
+	}
+	var v Value
+	err := d.Decode(&v)
+	return v, eofUnexpected(err)
+}
+
+// seek consumes the next value up to its element at p, a dict key or a list
+// index, and reports whether it was found
+func (d *Decoder) seek(p interface{}) (bool, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return false, err
+	}
+	size := -1
+	switch {
+	case c == chrDict, c == chrList:
+	case isFixedMap(c):
+		size = int(c - dictFixedStart)
+	case isFixedSlice(c):
+		size = int(c - listFixedStart)
+	default:
+		return false, d.skipCode(c)
+	}
+	dict := c == chrDict || isFixedMap(c)
+	key, isKey := p.(string)
+	index, isIndex := p.(int)
+	if (dict && !isKey) || (!dict && !isIndex) {
+		return false, nil
+	}
+
+	for i := 0; size < 0 || i < size; i++ {
+		c, err := d.peekByte()
+		if err != nil {
+			return false, err
+		}
+		if size < 0 && c == chrTerm {
+			return false, nil
+		}
+		if !dict {
+			if i == index {
+				return true, nil
+			}
+			if err := d.skipValue(); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if isFixedString(c) || isString(c) {
+			k, err := d.decodeKey()
+			if err != nil {
+				return false, err
+			}
+			if k == key {
+				return true, nil
+			}
+		} else if err := d.skipValue(); err != nil {
+			return false, err
+		}
+		if err := d.skipValue(); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
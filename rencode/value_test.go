@@ -0,0 +1,126 @@
+package rencode
+
+import (
+	"testing"
+)
+
+func TestValue(t *testing.T) {
+	data, err := Append(nil, map[string]interface{}{
+		"torrents": map[string]interface{}{
+			"abc": map[string]interface{}{
+				"name":     "ubuntu.iso",
+				"progress": 50.5,
+				"size":     bigIntFromString("123456789012345678901"),
+				"paused":   false,
+				"peers":    []interface{}{"10.0.0.1", "10.0.0.2"},
+				"label":    nil,
+				"seeds":    "12",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := ParseValue(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	torrent := v.Get("torrents", "abc")
+	if torrent.Kind() != Dict || len(torrent.Map()) != 7 {
+		t.Fatalf("unexpected torrent %v", torrent.Interface())
+	}
+	if s := torrent.Get("name").String(); s != "ubuntu.iso" {
+		t.Errorf("unexpected name %q", s)
+	}
+	if f := torrent.Get("progress").Float(); f != 50.5 {
+		t.Errorf("unexpected progress %v", f)
+	}
+	if i := torrent.Get("progress").Int(); i != 50 {
+		t.Errorf("unexpected progress %v", i)
+	}
+	if s := torrent.Get("size").String(); s != "123456789012345678901" {
+		t.Errorf("unexpected size %q", s)
+	}
+	if torrent.Get("paused").Bool() {
+		t.Error("expected paused to be false")
+	}
+	if s := torrent.Get("peers", 1).String(); s != "10.0.0.2" {
+		t.Errorf("unexpected peer %q", s)
+	}
+	if l := torrent.Get("peers").List(); len(l) != 2 || l[0].String() != "10.0.0.1" {
+		t.Errorf("unexpected peers %v", l)
+	}
+	if i := torrent.Get("seeds").Int(); i != 12 {
+		t.Errorf("unexpected seeds %v", i)
+	}
+
+	label := torrent.Get("label")
+	if !label.Exists() || label.Kind() != None || label.String() != "" {
+		t.Errorf("unexpected label %v", label)
+	}
+	for _, path := range [][]interface{}{
+		{"torrents", "def"},
+		{"torrents", "abc", "peers", 2},
+		{"torrents", "abc", "peers", "a"},
+		{"torrents", "abc", "name", "x"},
+	} {
+		if missing := v.Get(path...); missing.Exists() || missing.Kind() != Invalid || missing.Int() != 0 {
+			t.Errorf("%v: expected a missing value, got %v", path, missing.Interface())
+		}
+	}
+
+	// values encode as the value they hold
+	encoded, err := Append(nil, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != string(data) {
+		t.Fatalf("expected %q, got %q", data, encoded)
+	}
+}
+
+func TestGetPath(t *testing.T) {
+	torrents := make(map[string]interface{})
+	for _, id := range []string{"a", "b", "c"} {
+		torrents[id] = map[string]interface{}{
+			"name":  "torrent " + id,
+			"files": []interface{}{"f1", "f2", "f3"},
+		}
+	}
+	data, err := Append(nil, map[string]interface{}{"stats": 1, "torrents": torrents})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := GetPath(data, "torrents", "b", "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "torrent b" {
+		t.Fatalf("unexpected value %v", v.Interface())
+	}
+	v, err = GetPath(data, "torrents", "c", "files", 2)
+	if err != nil || v.String() != "f3" {
+		t.Fatalf("unexpected value %v, %v", v.Interface(), err)
+	}
+	v, err = GetPath(data, "torrents", "c")
+	if err != nil || v.Get("files", 0).String() != "f1" {
+		t.Fatalf("unexpected value %v, %v", v.Interface(), err)
+	}
+
+	for _, path := range [][]interface{}{
+		{"torrents", "d"},
+		{"torrents", "a", "files", 3},
+		{"torrents", 0},
+		{"stats", "x"},
+	} {
+		if v, err := GetPath(data, path...); err != nil || v.Exists() {
+			t.Errorf("%v: expected a missing value, got %v, %v", path, v.Interface(), err)
+		}
+	}
+
+	if _, err := GetPath(data[:len(data)/2], "torrents", "c", "name"); err == nil {
+		t.Fatal("expected an error on truncated data")
+	}
+}
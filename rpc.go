@@ -0,0 +1,199 @@
+package delugerpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/rpc"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// clientCodec lets net/rpc clients talk to the daemon through a Client,
+// which matches the responses to the requests by id. Client is the preferred
+// way to make calls.
+type clientCodec struct {
+	client *Client
+
+	mu sync.Mutex
+	// responses holds the responses not read yet, in their order of arrival
+	responses []rpcResult
+	// ready is signaled when a response is added
+	ready chan struct{}
+
+	// payload is the return value of the response read last
+	payload []byte
+}
+
+// rpcResult is the response to the net/rpc request numbered seq
+type rpcResult struct {
+	seq uint64
+	msg *message
+}
+
+func (c *clientCodec) WriteRequest(r *rpc.Request, body interface{}) error {
+	args, kwargs := getArgs(body)
+	seq := r.Seq
+	_, err := c.client.start(context.Background(), r.ServiceMethod, args, kwargs, func(msg *message) {
+		// the shutdown of the client is reported by ReadResponseHeader
+		if msg == nil {
+			return
+		}
+		c.mu.Lock()
+		c.responses = append(c.responses, rpcResult{seq: seq, msg: msg})
+		c.mu.Unlock()
+		select {
+		case c.ready <- struct{}{}:
+		default:
+		}
+	})
+	return err
+}
+
+func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
+	for {
+		c.mu.Lock()
+		if len(c.responses) > 0 {
+			res := c.responses[0]
+			c.responses = c.responses[1:]
+			c.mu.Unlock()
+			r.Seq = res.seq
+			if res.msg.err != nil {
+				r.Error = res.msg.err.Error()
+			}
+			c.payload = res.msg.payload
+			return nil
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-c.ready:
+		case <-c.client.shut:
+			// the responses arriving before the shutdown are read first
+			c.mu.Lock()
+			pending := len(c.responses)
+			c.mu.Unlock()
+			if pending == 0 {
+				return c.client.shutdownErr()
+			}
+		}
+	}
+}
+
+func (c *clientCodec) ReadResponseBody(body interface{}) error {
+	payload := c.payload
+	c.payload = nil
+	if body == nil {
+		return nil
+	}
+	bv := reflect.ValueOf(body)
+	if bv.Kind() != reflect.Ptr || bv.IsNil() {
+		return errors.New("Unwritable type passed into decode")
+	}
+	return c.client.unmarshal(payload, body)
+}
+
+func (c *clientCodec) Close() error {
+	return c.client.Close()
+}
+
+func newDelugeCodec(conn net.Conn, o options, r *redialer) *clientCodec {
+	return &clientCodec{
+		client: newClient(conn, o, r),
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+// Dial creates RPC client with rencode codec, connected to the daemon
+// listening on addr. An addr of the form "unix:path", or an absolute path, is
+// a unix socket. Any other addr is a TCP address, such as "host:port" or
+// "[::1]:58846", whose port defaults to DefaultPort. The arguments of the
+// calls are given as Args, KWArgs or CallArgs.
+func Dial(addr string, opts ...Option) (*rpc.Client, error) {
+	network, address := splitAddress(addr)
+	return DialContext(context.Background(), network, address, opts...)
+}
+
+// DialContext is like Dial, but gives up connecting and completing the TLS
+// handshake when ctx is done or the configured timeouts expire. Once the
+// client is returned, ctx no longer affects it.
+func DialContext(ctx context.Context, network, address string, opts ...Option) (*rpc.Client, error) {
+	o := newOptions(opts)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	conn, err := o.dial(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	codec := newDelugeCodec(conn, o, o.redialer(network, address))
+	if err := o.setup(ctx, codec.client); err != nil {
+		return nil, err
+	}
+	return rpc.NewClientWithCodec(codec), nil
+}
+
+// CallArgs holds both the positional and the keyword arguments of a call
+// made through net/rpc
+type CallArgs struct {
+	Args   Args
+	KWArgs KWArgs
+}
+
+// getArgs returns the arguments held by the body of a net/rpc call: Args,
+// KWArgs or CallArgs, any other slice or array as positional arguments, or,
+// for compatibility, a map with "args" and "kwargs" keys
+func getArgs(body interface{}) (args Args, kwargs KWArgs) {
+	switch body := body.(type) {
+	case Args:
+		return body, nil
+	case KWArgs:
+		return nil, body
+	case CallArgs:
+		return body.Args, body.KWArgs
+	case *CallArgs:
+		if body == nil {
+			return nil, nil
+		}
+		return body.Args, body.KWArgs
+	}
+
+	bodyValue := reflect.ValueOf(body)
+	switch bodyValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < bodyValue.Len(); i++ {
+			args = append(args, bodyValue.Index(i).Interface())
+		}
+		return
+	case reflect.Map:
+		for _, key := range bodyValue.MapKeys() {
+			if strings.EqualFold("args", key.String()) {
+				argsValue := bodyValue.MapIndex(key)
+				if argsValue.Kind() == reflect.Interface {
+					argsValue = argsValue.Elem()
+				}
+				if argsValue.Kind() == reflect.Slice ||
+					argsValue.Kind() == reflect.Array {
+					for i := 0; i < argsValue.Len(); i++ {
+						args = append(args, argsValue.Index(i).Interface())
+					}
+				}
+			} else if strings.EqualFold("kwargs", key.String()) {
+				kwargsValue := bodyValue.MapIndex(key)
+				if kwargsValue.Kind() == reflect.Interface {
+					kwargsValue = kwargsValue.Elem()
+				}
+				if kwargsValue.Kind() == reflect.Map {
+					kwargs = make(map[string]interface{})
+					for _, key := range kwargsValue.MapKeys() {
+						kwargs[key.String()] = kwargsValue.MapIndex(key).Interface()
+					}
+				}
+			}
+		}
+		return
+	default:
+		return
+	}
+}
@@ -0,0 +1,75 @@
+package delugerpc
+
+import (
+	"bytes"
+	"net"
+	"net/rpc"
+	"reflect"
+	"testing"
+
+	"github.com/rogaps/delugerpc/rencode"
+)
+
+func TestGetArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   interface{}
+		args   Args
+		kwargs KWArgs
+	}{
+		{"Args", Args{"abc", 1}, Args{"abc", 1}, nil},
+		{"KWArgs", KWArgs{"args": 1}, nil, KWArgs{"args": 1}},
+		{"CallArgs", CallArgs{Args: Args{"abc"}, KWArgs: KWArgs{"paused": true}}, Args{"abc"}, KWArgs{"paused": true}},
+		{"*CallArgs", &CallArgs{Args: Args{"abc"}}, Args{"abc"}, nil},
+		{"slice", []string{"a", "b"}, Args{"a", "b"}, nil},
+		{"magic map", map[string]interface{}{
+			"args":   []interface{}{"abc"},
+			"kwargs": map[string]interface{}{"paused": true},
+		}, Args{"abc"}, KWArgs{"paused": true}},
+		{"nil", nil, nil, nil},
+	}
+	for _, tt := range tests {
+		args, kwargs := getArgs(tt.body)
+		if !reflect.DeepEqual(args, tt.args) || !reflect.DeepEqual(kwargs, tt.kwargs) {
+			t.Errorf("%s: getArgs = %v, %v, want %v, %v", tt.name, args, kwargs, tt.args, tt.kwargs)
+		}
+	}
+}
+
+func TestRPCClientTypedResult(t *testing.T) {
+	client, server := net.Pipe()
+	c := rpc.NewClientWithCodec(newDelugeCodec(client, newOptions(nil), nil))
+	defer c.Close()
+	d := &testDaemon{t: t, conn: newMessageConn(server, newOptions(nil))}
+	defer server.Close()
+	status := map[string]interface{}{"name": "ubuntu.iso", "progress": 42.5, "files": []interface{}{"a", "b"}}
+	go func() {
+		for i := 0; i < 2; i++ {
+			req := d.read()
+			d.reply(req.id, status)
+		}
+	}()
+
+	var typed struct {
+		Name     string  `rencode:"name"`
+		Progress float64 `rencode:"progress"`
+	}
+	if err := c.Call("core.get_torrent_status", Args{"abc", []string{"name", "progress"}}, &typed); err != nil {
+		t.Fatal(err)
+	}
+	if typed.Name != "ubuntu.iso" || typed.Progress != 42.5 {
+		t.Errorf("result = %+v", typed)
+	}
+
+	var raw rencode.RawMessage
+	if err := c.Call("core.get_torrent_status", Args{"abc", []string{}}, &raw); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := rencode.NewDecoder(bytes.NewReader(raw)).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, status) {
+		t.Errorf("raw result = %v, want %v", decoded, status)
+	}
+}
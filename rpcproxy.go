@@ -0,0 +1,86 @@
+package delugerpc
+
+import (
+	"context"
+	"net"
+
+	"github.com/rogaps/delugerpc/rencode"
+)
+
+// Proxy sits between clients, such as the Deluge UIs, and the daemon: each
+// connection accepted is forwarded to a connection of its own to the
+// daemon, and the hooks see the calls and events going through, for
+// auditing or access control. The responses are forwarded as encoded by the
+// daemon, so both ends must use Rencode.
+type Proxy struct {
+	// Addr is the address of the daemon, in any of the forms accepted by
+	// DialClient
+	Addr string
+	// Options configure the connections to the daemon, and ServerOptions
+	// those of the clients, such as their protocol version
+	Options       []Option
+	ServerOptions []Option
+
+	// OnCall is called with each request before it is forwarded. An error
+	// is raised to the client instead, such as an *RPCError denying access.
+	OnCall func(req *Request) error
+	// OnResult is called with the outcome of each request forwarded
+	OnResult func(req *Request, result rencode.RawMessage, err error)
+	// OnEvent is called with each event before it is forwarded, which is
+	// dropped when OnEvent returns false
+	OnEvent func(e Event) bool
+}
+
+// Serve accepts connections on l, wrapped by tls.NewListener unless the
+// clients connect with WithoutTLS, and forwards each with ServeConn on its
+// own goroutine. It returns the error of Accept.
+func (p *Proxy) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go p.ServeConn(context.Background(), conn)
+	}
+}
+
+// ServeConn forwards the connection of a client to a new connection to the
+// daemon, dialed with ctx, until either is closed. It returns the error of
+// the dialing.
+func (p *Proxy) ServeConn(ctx context.Context, conn net.Conn) error {
+	c := NewServerCodec(conn, p.ServerOptions...)
+	upstream, err := DialClient(ctx, p.Addr, p.Options...)
+	if err != nil {
+		c.Close()
+		return err
+	}
+	defer upstream.Close()
+	upstream.OnEvent("", func(e Event) {
+		if p.OnEvent == nil || p.OnEvent(e) {
+			c.WriteEvent(e.Name, e.Args...)
+		}
+	})
+	go func() {
+		// the client is disconnected along with the daemon
+		for s := range upstream.StateChanges() {
+			if s == Disconnected {
+				c.Close()
+			}
+		}
+	}()
+
+	serveCodec(c, func(_ *ServerCodec, req *Request) (interface{}, error) {
+		if p.OnCall != nil {
+			if err := p.OnCall(req); err != nil {
+				return nil, err
+			}
+		}
+		var result rencode.RawMessage
+		err := upstream.Call(context.Background(), req.Method, req.Args, req.KWArgs, &result)
+		if p.OnResult != nil {
+			p.OnResult(req, result, err)
+		}
+		return result, err
+	})
+	return nil
+}
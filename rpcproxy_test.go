@@ -0,0 +1,129 @@
+package delugerpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rogaps/delugerpc/rencode"
+)
+
+// listen returns a listener on the loopback interface, closed by the end of
+// the test
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestProxy(t *testing.T) {
+	daemon := listen(t)
+	go Serve(daemon, func(c *ServerCodec, req *Request) (interface{}, error) {
+		switch req.Method {
+		case "daemon.info":
+			return "2.1.1", nil
+		case "daemon.set_event_interest":
+			return true, nil
+		case "core.resume_torrent":
+			c.WriteEvent("TorrentResumedEvent", req.Args[0])
+			c.WriteEvent("TorrentStateChangedEvent", req.Args[0], "Downloading")
+			return nil, nil
+		}
+		return nil, &RPCError{Type: "InvalidTorrentError", Args: []interface{}{"no such torrent"}}
+	}, WithProtocolVersion(ProtocolV2))
+
+	var mu sync.Mutex
+	var audit []string
+	p := &Proxy{
+		Addr:          daemon.Addr().String(),
+		Options:       []Option{WithProtocolVersion(ProtocolV2), WithoutTLS()},
+		ServerOptions: []Option{WithProtocolVersion(ProtocolV1)},
+		OnCall: func(req *Request) error {
+			if req.Method == "core.remove_torrent" {
+				return &RPCError{Type: "NotAuthorizedError", Args: []interface{}{int64(5), int64(10)}}
+			}
+			return nil
+		},
+		OnResult: func(req *Request, result rencode.RawMessage, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			audit = append(audit, req.Method)
+		},
+		OnEvent: func(e Event) bool {
+			return e.Name != "TorrentStateChangedEvent"
+		},
+	}
+	proxy := listen(t)
+	go p.Serve(proxy)
+
+	ctx := context.Background()
+	c, err := DialClient(ctx, proxy.Addr().String(), WithProtocolVersion(ProtocolV1), WithoutTLS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var version string
+	if err := c.Call(ctx, "daemon.info", nil, nil, &version); err != nil || version != "2.1.1" {
+		t.Errorf("daemon.info = %q, %v", version, err)
+	}
+	var invalid *RPCError
+	if err := c.Call(ctx, "core.get_torrent_status", Args{"abc", []string{}}, nil, nil); !errors.As(err, &invalid) || invalid.Type != "InvalidTorrentError" {
+		t.Errorf("got %v, want the InvalidTorrentError of the daemon", err)
+	}
+	var denied *NotAuthorizedError
+	if err := c.Call(ctx, "core.remove_torrent", Args{"abc", false}, nil, nil); !errors.As(err, &denied) {
+		t.Errorf("got %v, want a NotAuthorizedError", err)
+	}
+
+	events, err := c.SubscribeEvents(ctx, "TorrentResumedEvent", "TorrentStateChangedEvent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Call(ctx, "core.resume_torrent", Args{"abc"}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		if e.Name != "TorrentResumedEvent" {
+			t.Errorf("got %s, want the filtered events to be dropped", e.Name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event not forwarded")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"daemon.info", "core.get_torrent_status", "daemon.set_event_interest", "core.resume_torrent"}
+	if len(audit) != len(want) {
+		t.Fatalf("audited %v, want %v", audit, want)
+	}
+	for i := range want {
+		if audit[i] != want[i] {
+			t.Errorf("audited %v, want %v", audit, want)
+			break
+		}
+	}
+}
+
+func TestProxyDialError(t *testing.T) {
+	l := listen(t)
+	addr := l.Addr().String()
+	l.Close()
+	p := &Proxy{Addr: addr, Options: []Option{WithoutTLS()}}
+	client, server := net.Pipe()
+	defer client.Close()
+	if err := p.ServeConn(context.Background(), server); err == nil {
+		t.Error("connected to a closed listener")
+	}
+	if _, err := client.Read(make([]byte, 1)); err == nil {
+		t.Error("client connection left open")
+	}
+}
@@ -0,0 +1,54 @@
+package delugerpc
+
+import (
+	"bytes"
+
+	"github.com/rogaps/delugerpc/rencode"
+)
+
+// Serializer encodes the bodies of the messages exchanged with the daemon,
+// before their compression
+type Serializer interface {
+	// Marshal returns the encoding of v
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes data into the value v points to
+	Unmarshal(data []byte, v interface{}) error
+	// SplitList returns the encodings of the elements of the list encoded
+	// in data, which may share its memory
+	SplitList(data []byte) ([][]byte, error)
+}
+
+// Rencode is the Serializer of the Deluge protocol, and the default one
+var Rencode Serializer = rencodeSerializer{}
+
+// WithSerializer encodes the messages with s instead of Rencode, for tests
+// or for other versions of the protocol
+func WithSerializer(s Serializer) Option {
+	return func(o *options) {
+		o.serializer = s
+	}
+}
+
+type rencodeSerializer struct{}
+
+func (rencodeSerializer) Marshal(v interface{}) ([]byte, error) {
+	return rencode.Append(nil, v)
+}
+
+func (rencodeSerializer) Unmarshal(data []byte, v interface{}) error {
+	return rencode.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func (rencodeSerializer) SplitList(data []byte) ([][]byte, error) {
+	br := bytes.NewReader(data)
+	var elems [][]byte
+	err := rencode.NewDecoder(br).DecodeListFunc(func(d *rencode.Decoder) error {
+		start := len(data) - br.Len()
+		if err := d.Skip(); err != nil {
+			return err
+		}
+		elems = append(elems, data[start:len(data)-br.Len()])
+		return nil
+	})
+	return elems, err
+}
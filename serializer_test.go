@@ -0,0 +1,107 @@
+package delugerpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// jsonSerializer encodes the messages as JSON
+type jsonSerializer struct{}
+
+func (jsonSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonSerializer) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonSerializer) SplitList(data []byte) ([][]byte, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	elems := make([][]byte, len(raw))
+	for i, r := range raw {
+		elems[i] = r
+	}
+	return elems, nil
+}
+
+func TestClientSerializer(t *testing.T) {
+	c, d := newTestClient(t, WithSerializer(jsonSerializer{}))
+	events := make(chan Event, 1)
+	c.OnEvent("TorrentAddedEvent", func(e Event) { events <- e })
+	go func() {
+		for i := 0; i < 2; i++ {
+			body, err := d.conn.readMessage()
+			if err != nil {
+				t.Errorf("reading request: %v", err)
+				return
+			}
+			var reqs [][]interface{}
+			if err := json.Unmarshal(body, &reqs); err != nil {
+				t.Errorf("decoding request: %v", err)
+				return
+			}
+			req := reqs[0]
+			id := int64(req[0].(float64))
+			if req[1] == "core.get_torrent_status" {
+				d.send(int(rpcError), id, "InvalidTorrentError", []interface{}{"no such torrent"}, map[string]interface{}{}, "")
+				continue
+			}
+			d.send(int(rpcEvent), "TorrentAddedEvent", []interface{}{"abc", false})
+			d.reply(id, map[string]interface{}{"method": req[1], "args": req[2]})
+		}
+	}()
+
+	var result struct {
+		Method string
+		Args   []string
+	}
+	if err := c.Call(context.Background(), "core.get_torrents_status", Args{"a", "b"}, nil, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Method != "core.get_torrents_status" || !reflect.DeepEqual(result.Args, []string{"a", "b"}) {
+		t.Errorf("got result %+v", result)
+	}
+	select {
+	case e := <-events:
+		if want := []interface{}{"abc", false}; !reflect.DeepEqual(e.Args, want) {
+			t.Errorf("got event args %v, want %v", e.Args, want)
+		}
+	case <-time.After(time.Second):
+		t.Error("event not dispatched")
+	}
+
+	err := c.Call(context.Background(), "core.get_torrent_status", Args{"abc"}, nil, nil)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Type != "InvalidTorrentError" {
+		t.Errorf("got error %v, want an InvalidTorrentError", err)
+	}
+}
+
+func TestRencodeSplitList(t *testing.T) {
+	data, err := Rencode.Marshal([]interface{}{1, "two", []interface{}{3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	elems, err := Rencode.SplitList(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(elems) != 3 {
+		t.Fatalf("got %d elements, want 3", len(elems))
+	}
+	var s string
+	if err := Rencode.Unmarshal(elems[1], &s); err != nil || s != "two" {
+		t.Errorf("got second element %q, %v", s, err)
+	}
+	if _, err := Rencode.SplitList(data[:len(data)-1]); err == nil {
+		t.Error("truncated list split")
+	}
+}
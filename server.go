@@ -0,0 +1,148 @@
+package delugerpc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Request is a call received from a client
+type Request struct {
+	ID     int64
+	Method string
+	Args   Args
+	KWArgs KWArgs
+}
+
+// ServerCodec is the daemon end of a connection: it reads the requests of
+// the client and writes the responses and events. Writes may be concurrent,
+// reads must not be.
+type ServerCodec struct {
+	conn *messageConn
+}
+
+// NewServerCodec returns the codec of conn, a connection accepted from a
+// client, already past the TLS handshake. The options of the framing and of
+// the encoding apply.
+func NewServerCodec(conn net.Conn, opts ...Option) *ServerCodec {
+	return &ServerCodec{conn: newMessageConn(conn, newOptions(opts))}
+}
+
+// ReadRequests returns the requests of the next message, which may hold
+// several
+func (c *ServerCodec) ReadRequests() ([]Request, error) {
+	body, err := c.conn.readMessage()
+	if err != nil {
+		return nil, err
+	}
+	s := c.conn.serializer
+	elems, err := s.SplitList(body)
+	if err != nil {
+		return nil, fmt.Errorf("delugerpc: malformed request: %w", err)
+	}
+	reqs := make([]Request, len(elems))
+	for i, elem := range elems {
+		fields, err := s.SplitList(elem)
+		if err == nil && len(fields) != 4 {
+			err = errors.New("wrong number of fields")
+		}
+		for j, v := range []interface{}{&reqs[i].ID, &reqs[i].Method, &reqs[i].Args, &reqs[i].KWArgs} {
+			if err != nil {
+				break
+			}
+			err = s.Unmarshal(fields[j], v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("delugerpc: malformed request: %w", err)
+		}
+	}
+	return reqs, nil
+}
+
+// WriteResponse writes the return value of the request id
+func (c *ServerCodec) WriteResponse(id int64, result interface{}) error {
+	return c.conn.writeMessage([]interface{}{int(rpcResponse), id, result})
+}
+
+// WriteError writes the exception raised by the request id. An error other
+// than an *RPCError is raised as a WrappedException of an Exception holding
+// its message, as the daemon does for the exceptions of the Python runtime.
+func (c *ServerCodec) WriteError(id int64, err error) error {
+	var e *RPCError
+	if !errors.As(err, &e) {
+		e = &RPCError{Type: "WrappedException", Args: []interface{}{err.Error(), "Exception", ""}}
+	}
+	args, kwargs := e.Args, e.KWArgs
+	if args == nil {
+		args = []interface{}{}
+	}
+	if kwargs == nil {
+		kwargs = map[string]interface{}{}
+	}
+	return c.conn.writeMessage([]interface{}{int(rpcError), id, e.Type, args, kwargs, e.Traceback})
+}
+
+// WriteEvent pushes the event name with args to the client
+func (c *ServerCodec) WriteEvent(name string, args ...interface{}) error {
+	if args == nil {
+		args = []interface{}{}
+	}
+	return c.conn.writeMessage([]interface{}{int(rpcEvent), name, args})
+}
+
+// Close closes the connection
+func (c *ServerCodec) Close() error {
+	return c.conn.Close()
+}
+
+// Handler handles the requests of the clients, returning the return value of
+// req or the exception it raises, as written by ServerCodec.WriteError. c is
+// the codec of the connection of the client, to push events.
+type Handler func(c *ServerCodec, req *Request) (interface{}, error)
+
+// Serve accepts connections on l, wrapped by tls.NewListener unless the
+// clients connect with WithoutTLS, and serves each with ServeConn on its own
+// goroutine. It returns the error of Accept.
+func Serve(l net.Listener, h Handler, opts ...Option) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go ServeConn(conn, h, opts...)
+	}
+}
+
+// ServeConn serves the requests read from conn with h until the connection
+// fails, then closes it. The requests are handled concurrently, each on its
+// own goroutine.
+func ServeConn(conn net.Conn, h Handler, opts ...Option) {
+	serveCodec(NewServerCodec(conn, opts...), h)
+}
+
+// serveCodec serves the requests read from c with h, as ServeConn does
+func serveCodec(c *ServerCodec, h Handler) {
+	defer c.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		reqs, err := c.ReadRequests()
+		if err != nil {
+			return
+		}
+		for i := range reqs {
+			req := &reqs[i]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result, err := h(c, req)
+				if err != nil {
+					c.WriteError(req.ID, err)
+				} else {
+					c.WriteResponse(req.ID, result)
+				}
+			}()
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package delugerpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go Serve(l, func(c *ServerCodec, req *Request) (interface{}, error) {
+		switch req.Method {
+		case "daemon.info":
+			return "2.1.1", nil
+		case "core.get_torrent_status":
+			if req.Args[0] != "abc" || req.KWArgs["diff"] != true {
+				return nil, errors.New("unexpected arguments")
+			}
+			if err := c.WriteEvent("TorrentStateChangedEvent", "abc", "Seeding"); err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"state": "Seeding"}, nil
+		}
+		return nil, &RPCError{Type: "WrappedException", Args: []interface{}{unknownMethodPrefix + req.Method, "AttributeError", ""}}
+	}, WithProtocolVersion(ProtocolV2))
+
+	ctx := context.Background()
+	c, err := DialClient(ctx, l.Addr().String(), WithProtocolVersion(ProtocolV2), WithoutTLS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	events := make(chan Event, 1)
+	c.OnEvent("TorrentStateChangedEvent", func(e Event) { events <- e })
+
+	b := c.Batch()
+	info := b.Add("daemon.info", nil, nil, new(string))
+	var status map[string]string
+	b.Add("core.get_torrent_status", Args{"abc", []string{"state"}}, KWArgs{"diff": true}, &status)
+	unknown := b.Add("core.no_such_method", nil, nil, nil)
+	if err := b.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v := *info.Result.(*string); v != "2.1.1" || info.Error != nil {
+		t.Errorf("daemon.info = %q, %v", v, info.Error)
+	}
+	if status["state"] != "Seeding" {
+		t.Errorf("got status %+v", status)
+	}
+	var unknownErr *UnknownMethodError
+	if !errors.As(unknown.Error, &unknownErr) || unknownErr.Method != "core.no_such_method" {
+		t.Errorf("got %v, want an UnknownMethodError", unknown.Error)
+	}
+	select {
+	case e := <-events:
+		if e.Args[1] != "Seeding" {
+			t.Errorf("got event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Error("event not received")
+	}
+}
+
+func TestServerCodecWriteError(t *testing.T) {
+	c, d := newTestClient(t)
+	s := &ServerCodec{conn: d.conn}
+	go func() {
+		reqs, err := s.ReadRequests()
+		if err != nil || len(reqs) != 1 {
+			t.Errorf("got requests %v, %v", reqs, err)
+			return
+		}
+		s.WriteError(reqs[0].ID, errors.New("disk full"))
+	}()
+	err := c.Call(context.Background(), "core.pause_torrent", Args{"abc"}, nil, nil)
+	var wrapped *WrappedException
+	if !errors.As(err, &wrapped) || wrapped.ExceptionType != "Exception" || wrapped.Message != "disk full" {
+		t.Errorf("got %v, want a wrapped Exception", err)
+	}
+}
@@ -0,0 +1,91 @@
+package delugerpc
+
+// ConnState is the state of the connection of a client to the daemon
+type ConnState int
+
+// The states of a connection, in the order they are reached
+const (
+	// Connecting is the state of a connection being dialed, or dialed
+	// again after being lost. See WithReconnect.
+	Connecting ConnState = iota
+	// Connected is the state of an established connection
+	Connected
+	// Authenticated is the state of a connection after a successful
+	// daemon.login
+	Authenticated
+	// Disconnected is the final state of a connection
+	Disconnected
+)
+
+var connStateNames = [...]string{
+	Connecting:    "connecting",
+	Connected:     "connected",
+	Authenticated: "authenticated",
+	Disconnected:  "disconnected",
+}
+
+func (s ConnState) String() string {
+	if s < 0 || int(s) >= len(connStateNames) {
+		return "invalid"
+	}
+	return connStateNames[s]
+}
+
+// stateChangesSize is the number of state changes a receiver of
+// StateChanges may fall behind by before the oldest are dropped
+const stateChangesSize = 4
+
+// State returns the current state of the connection
+func (c *Client) State() ConnState {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.state
+}
+
+// StateChanges returns a channel receiving the current state of the
+// connection, then each of its changes. The channel is closed after
+// Disconnected. A receiver falling behind misses the oldest changes, never
+// the latest state.
+func (c *Client) StateChanges() <-chan ConnState {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	ch := make(chan ConnState, stateChangesSize)
+	ch <- c.state
+	if c.state == Disconnected {
+		close(ch)
+	} else {
+		c.stateChs = append(c.stateChs, ch)
+	}
+	return ch
+}
+
+// setState moves the connection to state s, unless it is already
+// disconnected
+func (c *Client) setState(s ConnState) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if c.state == s || c.state == Disconnected {
+		return
+	}
+	c.state = s
+	for _, ch := range c.stateChs {
+		for sent := false; !sent; {
+			select {
+			case ch <- s:
+				sent = true
+			default:
+				// drops the oldest change
+				select {
+				case <-ch:
+				default:
+				}
+			}
+		}
+		if s == Disconnected {
+			close(ch)
+		}
+	}
+	if s == Disconnected {
+		c.stateChs = nil
+	}
+}
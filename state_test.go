@@ -0,0 +1,45 @@
+package delugerpc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestClientState(t *testing.T) {
+	c, d := newTestClient(t)
+	changes := c.StateChanges()
+	if s := <-changes; s != Connected {
+		t.Errorf("initial state = %v, want %v", s, Connected)
+	}
+
+	go func() {
+		req := d.read()
+		d.send(int(rpcError), req.id, "BadLoginError", []interface{}{"Password does not match"}, map[string]interface{}{}, "")
+		req = d.read()
+		d.reply(req.id, 10)
+	}()
+	if err := c.Call(context.Background(), "daemon.login", Args{"user", "wrong"}, nil, nil); err == nil {
+		t.Fatal("expected a login error")
+	}
+	if s := c.State(); s != Connected {
+		t.Errorf("state after a failed login = %v, want %v", s, Connected)
+	}
+	var level int
+	if err := c.Call(context.Background(), "daemon.login", Args{"user", "secret"}, nil, &level); err != nil {
+		t.Fatal(err)
+	}
+	if s := <-changes; s != Authenticated {
+		t.Errorf("state = %v, want %v", s, Authenticated)
+	}
+
+	c.Close()
+	if s := <-changes; s != Disconnected {
+		t.Errorf("state = %v, want %v", s, Disconnected)
+	}
+	if _, ok := <-changes; ok {
+		t.Error("channel not closed after Disconnected")
+	}
+	if s := <-c.StateChanges(); s != Disconnected || c.State() != Disconnected {
+		t.Errorf("state after close = %v", s)
+	}
+}
@@ -0,0 +1,158 @@
+package delugerpc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a version of Deluge, such as 2.1.1, 1.3.15 or 2.0.0b2
+type Version struct {
+	Major, Minor, Patch int
+	// Pre is the suffix of the pre-releases and development builds, such as
+	// "b2" or "dev23"
+	Pre string
+}
+
+// ParseVersion parses a version as returned by daemon.info
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	rest := s
+	for i, n := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		end := 0
+		for end < len(rest) && rest[end] >= '0' && rest[end] <= '9' {
+			end++
+		}
+		if end == 0 {
+			if i == 0 {
+				return Version{}, fmt.Errorf("delugerpc: invalid version %q", s)
+			}
+			break
+		}
+		*n, _ = strconv.Atoi(rest[:end])
+		rest = rest[end:]
+		if i == 2 || !strings.HasPrefix(rest, ".") || len(rest) < 2 || rest[1] < '0' || rest[1] > '9' {
+			break
+		}
+		rest = rest[1:]
+	}
+	v.Pre = strings.TrimPrefix(rest, ".")
+	return v, nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		if strings.HasPrefix(v.Pre, "dev") {
+			s += "."
+		}
+		s += v.Pre
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 as v is older than, the same as or newer than
+// w. Pre-releases are older than their release, and ordered as in PEP 440:
+// development builds, then alphas, betas and release candidates, each by
+// number.
+func (v Version) Compare(w Version) int {
+	for _, d := range []int{v.Major - w.Major, v.Minor - w.Minor, v.Patch - w.Patch} {
+		if d < 0 {
+			return -1
+		} else if d > 0 {
+			return 1
+		}
+	}
+	switch {
+	case v.Pre == w.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case w.Pre == "":
+		return -1
+	}
+	vk, vn, vr := splitPre(v.Pre)
+	wk, wn, wr := splitPre(w.Pre)
+	switch {
+	case preRanks[vk] != preRanks[wk]:
+		return compareInts(preRanks[vk], preRanks[wk])
+	case vk != wk:
+		return strings.Compare(vk, wk)
+	case vn != wn:
+		return compareInts(vn, wn)
+	}
+	return strings.Compare(vr, wr)
+}
+
+// preRanks orders the kinds of pre-releases, the unknown ones first
+var preRanks = map[string]int{
+	"dev":   1,
+	"a":     2,
+	"alpha": 2,
+	"b":     3,
+	"beta":  3,
+	"c":     4,
+	"rc":    4,
+}
+
+// splitPre splits the suffix of a pre-release into its kind, its number and
+// what follows, such as "b", 10 and "" for "b10"
+func splitPre(pre string) (kind string, n int, rest string) {
+	i := 0
+	for i < len(pre) && (pre[i] < '0' || pre[i] > '9') {
+		i++
+	}
+	j := i
+	for j < len(pre) && pre[j] >= '0' && pre[j] <= '9' {
+		j++
+	}
+	n, _ = strconv.Atoi(pre[i:j])
+	return pre[:i], n, pre[j:]
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Protocol returns the framing spoken by the daemons of version v
+func (v Version) Protocol() ProtocolVersion {
+	if v.Major >= 2 {
+		return ProtocolV2
+	}
+	return ProtocolV1
+}
+
+// WithDaemonVersion fetches the version of the daemon once connected by
+// DialClient, Dial or DialContext, so that DaemonVersion does not have to
+func WithDaemonVersion() Option {
+	return func(o *options) {
+		o.daemonVersion = true
+	}
+}
+
+// DaemonVersion returns the version of the daemon, calling daemon.info on
+// the first call only
+func (c *Client) DaemonVersion(ctx context.Context) (Version, error) {
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+	if c.version != nil {
+		return *c.version, nil
+	}
+	var s string
+	if err := c.Call(ctx, "daemon.info", nil, nil, &s); err != nil {
+		return Version{}, err
+	}
+	v, err := ParseVersion(s)
+	if err != nil {
+		return Version{}, err
+	}
+	c.version = &v
+	return v, nil
+}
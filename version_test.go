@@ -0,0 +1,90 @@
+package delugerpc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want Version
+	}{
+		{"2.1.1", Version{2, 1, 1, ""}},
+		{"1.3.15", Version{1, 3, 15, ""}},
+		{"2.0.0b2", Version{2, 0, 0, "b2"}},
+		{"2.0.4.dev23", Version{2, 0, 4, "dev23"}},
+		{"1.3", Version{1, 3, 0, ""}},
+	} {
+		v, err := ParseVersion(tt.s)
+		if err != nil || v != tt.want {
+			t.Errorf("ParseVersion(%q) = %+v, %v, want %+v", tt.s, v, err, tt.want)
+		}
+		if tt.s != "1.3" && v.String() != tt.s {
+			t.Errorf("%+v.String() = %q, want %q", v, v.String(), tt.s)
+		}
+	}
+	if _, err := ParseVersion("unknown"); err == nil {
+		t.Error("parsed an invalid version")
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	versions := []string{
+		"1.3.15",
+		"2.0.0.dev3", "2.0.0.dev23",
+		"2.0.0a1",
+		"2.0.0b1", "2.0.0b2", "2.0.0b10",
+		"2.0.0rc1",
+		"2.0.0",
+		"2.0.4.dev23",
+		"2.1.1",
+	}
+	for i, a := range versions {
+		for j, b := range versions {
+			va, _ := ParseVersion(a)
+			vb, _ := ParseVersion(b)
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := va.Compare(vb); got != want {
+				t.Errorf("%s.Compare(%s) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+	if v, _ := ParseVersion("1.3.15"); v.Protocol() != ProtocolV1 {
+		t.Errorf("1.3.15 speaks protocol %d", v.Protocol())
+	}
+	if v, _ := ParseVersion("2.0.0"); v.Protocol() != ProtocolV2 {
+		t.Errorf("2.0.0 speaks protocol %d", v.Protocol())
+	}
+}
+
+func TestClientDaemonVersion(t *testing.T) {
+	l := listen(t)
+	calls := make(chan string, 10)
+	go Serve(l, func(c *ServerCodec, req *Request) (interface{}, error) {
+		calls <- req.Method
+		return "2.1.1", nil
+	})
+	c, err := DialClient(context.Background(), l.Addr().String(), WithoutTLS(), WithDaemonVersion())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if m := <-calls; m != "daemon.info" {
+		t.Errorf("called %s on connect", m)
+	}
+	for i := 0; i < 2; i++ {
+		v, err := c.DaemonVersion(context.Background())
+		if err != nil || v != (Version{2, 1, 1, ""}) {
+			t.Errorf("DaemonVersion = %+v, %v", v, err)
+		}
+	}
+	if len(calls) != 0 {
+		t.Errorf("daemon.info called again")
+	}
+}
@@ -0,0 +1,86 @@
+package delugerpc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rogaps/delugerpc/rencode"
+)
+
+// WithWireDump writes every message exchanged with the daemon to w, as
+// written to or read from the connection: a timestamped hex dump of its
+// frame, followed by the rendering of its body by rencode.Dump. The dumps
+// hold the passwords given to daemon.login.
+func WithWireDump(w io.Writer) Option {
+	return func(o *options) {
+		o.wireDump = w
+	}
+}
+
+// dumpWire writes the dump of a message to the wire dump, with dir being
+// ">" for messages sent and "<" for messages received. body is the
+// decompressed body of frame, nil to decompress it.
+func (c *messageConn) dumpWire(dir string, frame, body []byte) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s %d bytes\n", time.Now().UTC().Format(time.RFC3339Nano), dir, len(frame))
+	b.WriteString(hex.Dump(frame))
+	if body == nil {
+		compressed := frame
+		if c.version == ProtocolV2 {
+			compressed = frame[protocolV2Header:]
+		}
+		var err error
+		if body, err = decompress(compressed); err != nil {
+			fmt.Fprintf(&b, "undecodable body: %v\n", err)
+		}
+	}
+	if body != nil {
+		var dump bytes.Buffer
+		if err := rencode.Dump(&dump, body); err != nil {
+			fmt.Fprintf(&b, "undecodable body: %v\n", err)
+		} else {
+			b.Write(dump.Bytes())
+		}
+	}
+	b.WriteByte('\n')
+
+	c.wireMu.Lock()
+	defer c.wireMu.Unlock()
+	c.wireDump.Write(b.Bytes())
+}
+
+func decompress(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// teeReader records the bytes of a Deluge 1.x message read by the zlib
+// reader, keeping the io.ByteReader of r so that it never reads past the
+// message
+type teeReader struct {
+	r   *bufio.Reader
+	buf *bytes.Buffer
+}
+
+func (t *teeReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.buf.Write(p[:n])
+	return n, err
+}
+
+func (t *teeReader) ReadByte() (byte, error) {
+	b, err := t.r.ReadByte()
+	if err == nil {
+		t.buf.WriteByte(b)
+	}
+	return b, err
+}
@@ -0,0 +1,54 @@
+package delugerpc
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWireDump(t *testing.T) {
+	for _, version := range []ProtocolVersion{ProtocolV1, ProtocolV2} {
+		var dump bytes.Buffer
+		client, server := net.Pipe()
+		c, err := NewClient(client, WithProtocolVersion(version), WithWireDump(&dump))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := &testDaemon{t: t, conn: newMessageConn(server, newOptions([]Option{WithProtocolVersion(version)}))}
+		go func() {
+			req := d.read()
+			d.reply(req.id, "2.1.1")
+		}()
+		if err := c.Call(context.Background(), "daemon.info", nil, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+		server.Close()
+
+		records := strings.Split(strings.TrimSuffix(dump.String(), "\n\n"), "\n\n")
+		if len(records) != 2 {
+			t.Fatalf("protocol %d: got %d records:\n%s", version, len(records), dump.String())
+		}
+		header := regexp.MustCompile(`^\d{4}-\d\d-\d\dT[\d:.]+Z ([<>]) \d+ bytes\n`)
+		for i, want := range []struct {
+			dir, body string
+		}{
+			{">", "'daemon.info'"},
+			{"<", "'2.1.1'"},
+		} {
+			m := header.FindStringSubmatch(records[i])
+			if m == nil || m[1] != want.dir {
+				t.Errorf("protocol %d: record %d has header %q, want direction %s", version, i, m, want.dir)
+			}
+			if !strings.Contains(records[i], "00000000  ") || !strings.Contains(records[i], want.body) {
+				t.Errorf("protocol %d: record %d lacks the hex dump or %s:\n%s", version, i, want.body, records[i])
+			}
+		}
+		if version == ProtocolV2 && !strings.Contains(records[1], "00000000  44 ") {
+			t.Errorf("received frame dumped without its header:\n%s", records[1])
+		}
+	}
+}
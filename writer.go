@@ -0,0 +1,74 @@
+package delugerpc
+
+import "context"
+
+// DefaultWriteQueueSize is the default number of messages waiting to be
+// written
+const DefaultWriteQueueSize = 64
+
+// WithWriteQueue sets the number of messages waiting to be written to the
+// daemon. Messages are encoded by the callers and written one at a time by a
+// writer goroutine; once the queue is full, calls wait for room until their
+// context is done. Defaults to DefaultWriteQueueSize.
+func WithWriteQueue(size int) Option {
+	return func(o *options) {
+		o.writeQueueSize = size
+	}
+}
+
+// outgoing is a message queued for the write loop
+type outgoing struct {
+	ctx  context.Context
+	conn *messageConn
+	msg  []byte
+	done chan writeResult
+}
+
+type writeResult struct {
+	n   int
+	err error
+}
+
+// write queues msg, a framed message, and waits for it to be written to mc.
+// It returns the number of bytes written, as writeMessageContext does.
+func (c *Client) write(ctx context.Context, mc *messageConn, msg []byte) (int, error) {
+	w := &outgoing{ctx: ctx, conn: mc, msg: msg, done: make(chan writeResult, 1)}
+	select {
+	case c.writes <- w:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-c.shut:
+		return 0, c.shutdownErr()
+	}
+	select {
+	case r := <-w.done:
+		return r.n, r.err
+	case <-c.writerDone:
+		// the write loop answered, or left the message queued
+		select {
+		case r := <-w.done:
+			return r.n, r.err
+		default:
+			return 0, c.shutdownErr()
+		}
+	}
+}
+
+// writeLoop writes the queued messages until the client shuts down. The
+// messages whose context is done while queued are skipped.
+func (c *Client) writeLoop() {
+	defer close(c.writerDone)
+	for {
+		select {
+		case w := <-c.writes:
+			if err := w.ctx.Err(); err != nil {
+				w.done <- writeResult{err: err}
+				continue
+			}
+			n, err := w.conn.writeContext(w.ctx, w.msg)
+			w.done <- writeResult{n, err}
+		case <-c.shut:
+			return
+		}
+	}
+}
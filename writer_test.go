@@ -0,0 +1,72 @@
+package delugerpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitQueued waits for n messages to be waiting for the write loop
+func waitQueued(t *testing.T, c *Client, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for len(c.writes) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d messages queued, want %d", len(c.writes), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestClientWriteQueueFull(t *testing.T) {
+	c, d := newTestClient(t, WithWriteQueue(1))
+	var wg sync.WaitGroup
+	call := func(method string) {
+		defer wg.Done()
+		var got string
+		if err := c.Call(context.Background(), method, nil, nil, &got); err != nil || got != method {
+			t.Errorf("got %q, %v, want %q", got, err, method)
+		}
+	}
+	wg.Add(2)
+	go call("daemon.info")
+	go call("core.get_free_space")
+
+	// the daemon reads one request, the write loop blocks writing the
+	// other, and the next one fills the queue
+	reqs := []testRequest{d.read()}
+	waitQueued(t, c, 0)
+	wg.Add(1)
+	go call("core.get_session_state")
+	waitQueued(t, c, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Call(ctx, "core.get_torrents_status", nil, nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v with the queue full, want context.DeadlineExceeded", err)
+	}
+
+	reqs = append(reqs, d.read(), d.read())
+	for _, req := range reqs {
+		d.reply(req.id, req.method)
+	}
+	wg.Wait()
+}
+
+func TestClientEncodeError(t *testing.T) {
+	c, d := newTestClient(t)
+	if err := c.Call(context.Background(), "daemon.info", Args{make(chan int)}, nil, nil); err == nil {
+		t.Fatal("unencodable argument sent")
+	}
+	// the connection is still usable
+	go func() {
+		req := d.read()
+		d.reply(req.id, "2.1.1")
+	}()
+	var version string
+	if err := c.Call(context.Background(), "daemon.info", nil, nil, &version); err != nil || version != "2.1.1" {
+		t.Errorf("got %q, %v", version, err)
+	}
+}